@@ -0,0 +1,34 @@
+// Package shapertest provides shapers for the tests of packages built on
+// ot. It is separate from testutil, which ot's own tests import.
+package shapertest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/boxesandglue/textshape/internal/testutil"
+	"github.com/boxesandglue/textshape/ot"
+)
+
+// Load returns a shaper for the test font name and skips the test if the
+// font is not found.
+func Load(t testing.TB, name string) *ot.Shaper {
+	t.Helper()
+	fontPath := testutil.FindTestFont(name)
+	if fontPath == "" {
+		t.Skipf("%s not found", name)
+	}
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	font, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("ParseFont: %v", err)
+	}
+	shaper, err := ot.NewShaper(font)
+	if err != nil {
+		t.Fatalf("NewShaper: %v", err)
+	}
+	return shaper
+}
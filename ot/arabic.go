@@ -269,6 +269,17 @@ func (s *Shaper) arabicJoining(buf *Buffer) []ArabicAction {
 	state := uint8(0)
 	prevI := -1 // Index of previous non-transparent character
 
+	// The pre-context sets the initial state
+	// HarfBuzz: "Check pre-context" in arabic_joining()
+	for _, cp := range buf.preContext {
+		jt := getJoiningType(cp, getGeneralCategory(cp))
+		if jt == joiningTypeT {
+			continue
+		}
+		state = arabicStateTable[state][joiningTypeColumn(jt)].nextState
+		break
+	}
+
 	for i := 0; i < len(buf.Info); i++ {
 		cp := buf.Info[i].Codepoint
 		jt := getJoiningType(cp, getGeneralCategory(cp))
@@ -282,9 +293,17 @@ func (s *Shaper) arabicJoining(buf *Buffer) []ArabicAction {
 		col := joiningTypeColumn(jt)
 		entry := arabicStateTable[state][col]
 
-		// Apply previous action
+		// Apply previous action. Otherwise the forms depend on whether the
+		// text before joins, so the range is unsafe to concat.
 		if prevI >= 0 && entry.prevAction != arabicActionNone {
 			actions[prevI] = entry.prevAction
+		} else if prevI < 0 {
+			if col >= joiningTypeColumn(joiningTypeR) {
+				buf.unsafeToConcatFromOutbuffer(0, i+1)
+			}
+		} else if col >= joiningTypeColumn(joiningTypeR) || (2 <= state && state <= 5) {
+			// States 2 to 5 have a possible previous action
+			buf.unsafeToConcat(prevI, i+1)
 		}
 
 		// Set current action
@@ -295,6 +314,22 @@ func (s *Shaper) arabicJoining(buf *Buffer) []ArabicAction {
 		prevI = i
 	}
 
+	// The post-context decides the action of the last character
+	// HarfBuzz: "Check post-context" in arabic_joining()
+	for _, cp := range buf.postContext {
+		jt := getJoiningType(cp, getGeneralCategory(cp))
+		if jt == joiningTypeT {
+			continue
+		}
+		entry := arabicStateTable[state][joiningTypeColumn(jt)]
+		if prevI >= 0 && entry.prevAction != arabicActionNone {
+			actions[prevI] = entry.prevAction
+		} else if prevI >= 0 && 2 <= state && state <= 5 {
+			buf.unsafeToConcat(prevI, len(buf.Info))
+		}
+		break
+	}
+
 	return actions
 }
 
@@ -308,14 +343,11 @@ func (s *Shaper) arabicJoining(buf *Buffer) []ArabicAction {
 //
 // After this, lookups can check (glyph.mask & lookup.mask) to determine if they apply.
 func (s *Shaper) setupMasksArabic(buf *Buffer) []ArabicAction {
-	debugPrintf("setupMasksArabic: called with %d glyphs\n", len(buf.Info))
-
 	// Step 1: Set global mask on all glyphs
 	buf.ResetMasks(MaskGlobal)
 
 	// Step 2: Run Arabic joining analysis
 	actions := s.arabicJoining(buf)
-	debugPrintf("setupMasksArabic: actions len=%d\n", len(actions))
 
 	// Step 2.5: For Mongolian script, copy action from base to variation selectors
 	// HarfBuzz equivalent: mongolian_variation_selectors() in hb-ot-shaper-arabic.cc:377-385
@@ -329,10 +361,7 @@ func (s *Shaper) setupMasksArabic(buf *Buffer) []ArabicAction {
 	// HarfBuzz equivalent: info[i].mask |= arabic_plan->mask_array[action]
 	for i, action := range actions {
 		if i < len(buf.Info) {
-			mask := arabicActionToMask(action)
-			buf.Info[i].Mask |= mask
-			debugPrintf("setupMasksArabic: [%d] U+%04X action=%d mask=0x%X -> total=0x%X\n",
-				i, buf.Info[i].Codepoint, action, mask, buf.Info[i].Mask)
+			buf.Info[i].Mask |= arabicActionToMask(action)
 		}
 	}
 
@@ -481,20 +510,23 @@ func (s *Shaper) applyArabicFeatures(buf *Buffer, userFeatures []Feature) {
 		}
 
 		// Build OT Map with all positional features
-		otMap := NewOTMap()
-		featureList, err := s.gsub.ParseFeatureList()
-		if err == nil {
-			for _, pf := range positionalFeatures {
-				lookups := featureList.FindFeature(pf.tag)
-				for _, lookupIdx := range lookups {
-					otMap.AddGSUBLookup(lookupIdx, pf.mask, pf.tag)
+		otMap := s.planMap(buf, "arabic positional", func() *OTMap {
+			otMap := NewOTMap()
+			featureList, err := s.gsub.ParseFeatureList()
+			if err == nil {
+				for _, pf := range positionalFeatures {
+					lookups := featureList.FindFeature(pf.tag)
+					for _, lookupIdx := range lookups {
+						otMap.AddGSUBLookup(lookupIdx, pf.mask, pf.tag)
+					}
 				}
 			}
-		}
 
-		// Sort lookups by index and deduplicate
-		// HarfBuzz: hb-ot-map.cc:362-377
-		otMap.GSUBLookups = deduplicateLookups(otMap.GSUBLookups)
+			// Sort lookups by index and deduplicate
+			// HarfBuzz: hb-ot-map.cc:362-377
+			otMap.GSUBLookups = deduplicateLookups(otMap.GSUBLookups)
+			return otMap
+		})
 
 		// Apply all lookups in sorted order
 		otMap.ApplyGSUB(s.gsub, buf, s.font, s.gdef)
@@ -648,20 +680,23 @@ func (s *Shaper) applyRligCaltLigaTogether(buf *Buffer) {
 	}
 
 	// Build OT Map with rlig, calt, liga features
-	otMap := NewOTMap()
+	otMap := s.planMap(buf, "rlig calt liga", func() *OTMap {
+		otMap := NewOTMap()
 
-	ligatureFeatures := []Tag{tagRlig, tagCalt, tagLiga}
-	for _, tag := range ligatureFeatures {
-		lookups := featureList.FindFeature(tag)
-		for _, lookupIdx := range lookups {
-			otMap.AddGSUBLookup(lookupIdx, MaskGlobal, tag)
+		ligatureFeatures := []Tag{tagRlig, tagCalt, tagLiga}
+		for _, tag := range ligatureFeatures {
+			lookups := featureList.FindFeature(tag)
+			for _, lookupIdx := range lookups {
+				otMap.AddGSUBLookup(lookupIdx, MaskGlobal, tag)
+			}
 		}
-	}
 
-	// Sort lookups by index and deduplicate
-	// This ensures lookup 9 is applied before lookup 10, regardless of which
-	// feature (rlig or calt) references them.
-	otMap.GSUBLookups = deduplicateLookups(otMap.GSUBLookups)
+		// Sort lookups by index and deduplicate
+		// This ensures lookup 9 is applied before lookup 10, regardless of which
+		// feature (rlig or calt) references them.
+		otMap.GSUBLookups = deduplicateLookups(otMap.GSUBLookups)
+		return otMap
+	})
 
 	// Apply all lookups in sorted order
 	otMap.ApplyGSUB(s.gsub, buf, s.font, s.gdef)
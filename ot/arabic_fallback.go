@@ -440,8 +440,10 @@ func (lookup *fallbackLookup) applyLigatureSubst(buf *Buffer, mask uint32, gdef
 				}
 
 				// Find minimum cluster (for RTL text, this is the ligature's cluster)
+				// At ClusterLevelCharacters every glyph keeps its own cluster.
+				mergeClusters := buf.ClusterLevel != ClusterLevelCharacters
 				ligCluster := buf.Info[i].Cluster
-				for j := i + 1; j < matchIdx; j++ {
+				for j := i + 1; j < matchIdx && mergeClusters; j++ {
 					if buf.Info[j].Cluster < ligCluster {
 						ligCluster = buf.Info[j].Cluster
 					}
@@ -456,7 +458,9 @@ func (lookup *fallbackLookup) applyLigatureSubst(buf *Buffer, mask uint32, gdef
 				for _, markIdx := range skippedMarks {
 					if markIdx < matchIdx {
 						mark := buf.Info[markIdx]
-						mark.Cluster = ligCluster // Update mark's cluster to match ligature
+						if mergeClusters {
+							mark.Cluster = ligCluster // Update mark's cluster to match ligature
+						}
 						newInfo = append(newInfo, mark)
 					}
 				}
@@ -466,7 +470,9 @@ func (lookup *fallbackLookup) applyLigatureSubst(buf *Buffer, mask uint32, gdef
 				for j := matchIdx; j < len(buf.Info); j++ {
 					glyph := buf.Info[j]
 					if mergedClusters[glyph.Cluster] && isMarkGlyph(glyph, gdef) {
-						glyph.Cluster = ligCluster
+						if mergeClusters {
+							glyph.Cluster = ligCluster
+						}
 						glyph.SetLigPropsForMark(ligID, lastComponent)
 					}
 					newInfo = append(newInfo, glyph)
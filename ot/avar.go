@@ -145,3 +145,26 @@ func (a *Avar) MapCoords(coords []int) []int {
 	}
 	return result
 }
+
+// AxisValueMapping is one fromCoord -> toCoord pair of an avar segment map.
+// Both values are in F2DOT14 format.
+type AxisValueMapping struct {
+	From int16
+	To   int16
+}
+
+// SegmentMap returns the segment map of an axis, or nil if the axis has none.
+func (a *Avar) SegmentMap(axisIndex int) []AxisValueMapping {
+	if a == nil || axisIndex < 0 || axisIndex >= a.axisCount {
+		return nil
+	}
+	segments := a.axisMaps[axisIndex].segments
+	if len(segments) == 0 {
+		return nil
+	}
+	mapping := make([]AxisValueMapping, len(segments))
+	for i, s := range segments {
+		mapping[i] = AxisValueMapping{From: s.fromCoord, To: s.toCoord}
+	}
+	return mapping
+}
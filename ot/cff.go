@@ -11,8 +11,9 @@ var TagCFF = MakeTag('C', 'F', 'F', ' ')
 
 // CFF represents a parsed CFF (Compact Font Format) table.
 type CFF struct {
-	data   []byte
-	header cffHeader
+	data        []byte
+	header      cffHeader
+	topDictData []byte
 
 	Name        string
 	TopDict     TopDict
@@ -26,7 +27,7 @@ type CFF struct {
 	// CID fonts
 	IsCID    bool
 	FDArray  []FontDict
-	FDSelect []byte
+	FDSelect []byte // Font DICT index for each glyph
 }
 
 type cffHeader struct {
@@ -50,9 +51,10 @@ type TopDict struct {
 	Encoding    int    // Offset to Encoding
 
 	// CID fonts
-	ROS      [3]int // Registry, Ordering, Supplement (SIDs)
-	FDArray  int
-	FDSelect int
+	ROS      [3]int // Registry, Ordering (SIDs), Supplement
+	CIDCount int
+	FDArray  int // Offset to FDArray INDEX
+	FDSelect int // Offset to FDSelect
 	IsCID    bool
 }
 
@@ -76,7 +78,12 @@ type PrivateDict struct {
 
 // FontDict contains per-font dictionary data (for CID fonts).
 type FontDict struct {
-	Private [2]int // [size, offset]
+	FontName    int    // SID
+	Private     [2]int // [size, offset]
+	PrivateDict PrivateDict
+	LocalSubrs  [][]byte // Local subroutines of this Font DICT
+
+	data []byte
 }
 
 // ParseCFF parses a CFF table from raw data.
@@ -117,6 +124,7 @@ func ParseCFF(data []byte) (*CFF, error) {
 	if len(topDicts) == 0 {
 		return nil, errors.New("CFF: no Top DICT found")
 	}
+	cff.topDictData = topDicts[0]
 	cff.TopDict, err = parseTopDict(topDicts[0])
 	if err != nil {
 		return nil, fmt.Errorf("CFF: parsing Top DICT: %w", err)
@@ -154,25 +162,16 @@ func ParseCFF(data []byte) (*CFF, error) {
 
 	// Parse Private DICT
 	if cff.TopDict.Private[0] > 0 && cff.TopDict.Private[1] > 0 {
-		privOffset := cff.TopDict.Private[1]
-		privSize := cff.TopDict.Private[0]
-		if privOffset+privSize <= len(data) {
-			cff.PrivateDict, err = parsePrivateDict(data[privOffset : privOffset+privSize])
-			if err != nil {
-				return nil, fmt.Errorf("CFF: parsing Private DICT: %w", err)
-			}
+		cff.PrivateDict, cff.LocalSubrs, err = parsePrivateDictAndSubrs(data, cff.TopDict.Private)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-			// Parse Local Subrs (offset relative to Private DICT)
-			if cff.PrivateDict.Subrs > 0 {
-				localSubrsOffset := privOffset + cff.PrivateDict.Subrs
-				if localSubrsOffset < len(data) {
-					cff.LocalSubrs, _, err = parseINDEX(data[localSubrsOffset:])
-					if err != nil {
-						// Not fatal - some fonts don't have local subrs
-						cff.LocalSubrs = nil
-					}
-				}
-			}
+	// Parse FDArray and FDSelect (CID fonts)
+	if cff.IsCID {
+		if err := cff.parseCIDDicts(); err != nil {
+			return nil, err
 		}
 	}
 
@@ -191,6 +190,242 @@ func ParseCFF(data []byte) (*CFF, error) {
 	return cff, nil
 }
 
+// parsePrivateDictAndSubrs parses the Private DICT at private ([size, offset])
+// together with the Local Subrs INDEX it points to.
+func parsePrivateDictAndSubrs(data []byte, private [2]int) (PrivateDict, [][]byte, error) {
+	privSize, privOffset := private[0], private[1]
+	if privOffset < 0 || privSize < 0 || privOffset+privSize > len(data) {
+		return PrivateDict{}, nil, nil
+	}
+	dict, err := parsePrivateDict(data[privOffset : privOffset+privSize])
+	if err != nil {
+		return dict, nil, fmt.Errorf("CFF: parsing Private DICT: %w", err)
+	}
+
+	// Parse Local Subrs (offset relative to Private DICT)
+	var subrs [][]byte
+	if dict.Subrs > 0 {
+		localSubrsOffset := privOffset + dict.Subrs
+		if localSubrsOffset < len(data) {
+			subrs, _, err = parseINDEX(data[localSubrsOffset:])
+			if err != nil {
+				// Not fatal - some fonts don't have local subrs
+				subrs = nil
+			}
+		}
+	}
+	return dict, subrs, nil
+}
+
+// parseCIDDicts parses the FDArray with each Font DICT's Private DICT and
+// Local Subrs, and the FDSelect of a CID-keyed font.
+func (c *CFF) parseCIDDicts() error {
+	data := c.data
+	if c.TopDict.FDArray <= 0 || c.TopDict.FDArray >= len(data) {
+		return errors.New("CFF: CID font without FDArray")
+	}
+	fontDicts, _, err := parseINDEX(data[c.TopDict.FDArray:])
+	if err != nil {
+		return fmt.Errorf("CFF: parsing FDArray INDEX: %w", err)
+	}
+	c.FDArray = make([]FontDict, len(fontDicts))
+	for i, fd := range fontDicts {
+		c.FDArray[i] = parseFontDict(fd)
+		c.FDArray[i].PrivateDict, c.FDArray[i].LocalSubrs, err = parsePrivateDictAndSubrs(data, c.FDArray[i].Private)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.FDSelect = make([]byte, len(c.CharStrings))
+	if c.TopDict.FDSelect > 0 && c.TopDict.FDSelect < len(data) {
+		if err := parseFDSelect(data[c.TopDict.FDSelect:], c.FDSelect); err != nil {
+			return fmt.Errorf("CFF: parsing FDSelect: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseFontDict parses a Font DICT from the FDArray.
+func parseFontDict(data []byte) FontDict {
+	dict := FontDict{data: data}
+	operands := make([]int, 0, 4)
+	pos := 0
+
+	for pos < len(data) {
+		b := data[pos]
+
+		// Operand
+		if b >= 32 && b <= 254 || b == 28 || b == 29 || b == 30 {
+			val, consumed := decodeDictOperand(data[pos:])
+			operands = append(operands, val)
+			pos += consumed
+			continue
+		}
+
+		// Operator
+		op := int(b)
+		pos++
+		if b == 12 && pos < len(data) {
+			op = 12<<8 | int(data[pos])
+			pos++
+		}
+
+		switch op {
+		case dictFontName:
+			if len(operands) > 0 {
+				dict.FontName = operands[len(operands)-1]
+			}
+		case dictPrivate:
+			if len(operands) >= 2 {
+				dict.Private[0] = operands[len(operands)-2] // size
+				dict.Private[1] = operands[len(operands)-1] // offset
+			}
+		}
+
+		operands = operands[:0]
+	}
+
+	return dict
+}
+
+// parseFDSelect fills fds with the Font DICT index of each glyph.
+// Formats 0 and 3 are supported.
+func parseFDSelect(data []byte, fds []byte) error {
+	if len(data) < 1 {
+		return errors.New("data too short")
+	}
+	switch data[0] {
+	case 0:
+		if len(data) < 1+len(fds) {
+			return errors.New("data too short")
+		}
+		copy(fds, data[1:])
+	case 3:
+		if len(data) < 3 {
+			return errors.New("data too short")
+		}
+		nRanges := int(binary.BigEndian.Uint16(data[1:]))
+		if len(data) < 3+nRanges*3+2 {
+			return errors.New("data too short")
+		}
+		for i := 0; i < nRanges; i++ {
+			rec := data[3+i*3:]
+			first := int(binary.BigEndian.Uint16(rec))
+			fd := rec[2]
+			// The range ends where the next one (or the sentinel) starts.
+			next := int(binary.BigEndian.Uint16(data[3+(i+1)*3:]))
+			for gid := first; gid < next && gid < len(fds); gid++ {
+				fds[gid] = fd
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported format %d", data[0])
+	}
+	return nil
+}
+
+// TopDictData returns the raw Top DICT of the table.
+func (c *CFF) TopDictData() []byte {
+	return c.topDictData
+}
+
+// FontDictData returns the raw Font DICT fd of a CID-keyed font, or nil.
+func (c *CFF) FontDictData(fd int) []byte {
+	if fd < 0 || fd >= len(c.FDArray) {
+		return nil
+	}
+	return c.FDArray[fd].data
+}
+
+// FDIndex returns the index into FDArray of the Font DICT used by glyph.
+// It returns 0 for non-CID fonts.
+func (c *CFF) FDIndex(glyph GlyphID) int {
+	if int(glyph) < len(c.FDSelect) {
+		return int(c.FDSelect[glyph])
+	}
+	return 0
+}
+
+// GlyphLocalSubrs returns the local subroutines that apply to glyph: those of
+// its Font DICT in a CID-keyed font, otherwise the font's Local Subrs.
+func (c *CFF) GlyphLocalSubrs(glyph GlyphID) [][]byte {
+	if c.IsCID {
+		if fd := c.FDIndex(glyph); fd < len(c.FDArray) {
+			return c.FDArray[fd].LocalSubrs
+		}
+		return nil
+	}
+	return c.LocalSubrs
+}
+
+// GlyphOutline draws the outline of glyph. Glyphs built with seac draw
+// their base and accent glyphs.
+// HarfBuzz equivalent: OT::cff1::accelerator_t::get_path() in hb-ot-cff1-table.cc
+func (c *CFF) GlyphOutline(glyph GlyphID, pen Pen) error {
+	return c.glyphOutline(glyph, pen, 0, 0, true)
+}
+
+// glyphOutline draws glyph moved by (dx, dy). The components of a seac
+// may not use seac themselves.
+func (c *CFF) glyphOutline(glyph GlyphID, pen Pen, dx, dy float64, seac bool) error {
+	if int(glyph) >= len(c.CharStrings) {
+		return ErrInvalidOffset
+	}
+	b := &csPathBuilder{pen: pen, x: dx, y: dy}
+	m := newCSMachine(c.GlobalSubrs, c.GlyphLocalSubrs(glyph), b.op)
+	if err := m.run(c.CharStrings[glyph]); err != nil {
+		return err
+	}
+	b.closePath()
+	if !b.hasSeac {
+		return nil
+	}
+
+	// HarfBuzz: _get_seac_param() in hb-ot-cff1-table.cc
+	base, ok := c.stdCodeToGlyph(b.seac[2])
+	accent, ok2 := c.stdCodeToGlyph(b.seac[3])
+	if !seac || !ok || !ok2 {
+		return errCSInvalidSeac
+	}
+	if err := c.glyphOutline(base, pen, dx, dy, false); err != nil {
+		return err
+	}
+	return c.glyphOutline(accent, pen, dx+b.seac[0], dy+b.seac[1], false)
+}
+
+// stdCodeToGlyph returns the glyph of a Standard Encoding code, as used by
+// seac. CID-keyed fonts have no such glyphs.
+// HarfBuzz equivalent: OT::cff1::accelerator_t::std_code_to_glyph()
+func (c *CFF) stdCodeToGlyph(code float64) (GlyphID, bool) {
+	if c.IsCID || code < 0 || code >= float64(len(cffStdEncoding)) {
+		return 0, false
+	}
+	sid := GlyphID(cffStdEncoding[int(code)])
+	if sid == 0 {
+		return 0, false
+	}
+	if c.Charset == nil {
+		// ISOAdobe charset: glyph IDs are SIDs
+		return sid, int(sid) < len(c.CharStrings)
+	}
+	for gid, s := range c.Charset {
+		if s == sid {
+			return GlyphID(gid), true
+		}
+	}
+	return 0, false
+}
+
+// GlyphExtents returns the extents of glyph. Returns false for empty glyphs.
+func (c *CFF) GlyphExtents(glyph GlyphID) (GlyphExtents, bool) {
+	var path Path
+	if err := c.GlyphOutline(glyph, &path); err != nil {
+		return GlyphExtents{}, false
+	}
+	return path.Extents()
+}
+
 // parseINDEX parses a CFF INDEX structure.
 // Returns the data items and bytes consumed.
 func parseINDEX(data []byte) ([][]byte, int, error) {
@@ -262,8 +497,9 @@ func readOffset(data []byte, size int) int {
 // parseTopDict parses a Top DICT.
 func parseTopDict(data []byte) (TopDict, error) {
 	dict := TopDict{
-		Charset:  0, // Default charset
-		Encoding: 0, // Default encoding
+		Charset:  0,    // Default charset
+		Encoding: 0,    // Default encoding
+		CIDCount: 8720, // Default CID count
 	}
 
 	operands := make([]int, 0, 16)
@@ -337,6 +573,10 @@ func parseTopDict(data []byte) (TopDict, error) {
 				dict.ROS[2] = operands[len(operands)-1]
 				dict.IsCID = true
 			}
+		case dictCIDCount:
+			if len(operands) > 0 {
+				dict.CIDCount = operands[len(operands)-1]
+			}
 		case dictFDArray:
 			if len(operands) > 0 {
 				dict.FDArray = operands[len(operands)-1]
@@ -0,0 +1,491 @@
+package ot
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// TagCFF2 is the table tag for CFF2 data.
+var TagCFF2 = MakeTag('C', 'F', 'F', '2')
+
+// CFF2 represents a parsed CFF2 table, the variable successor of CFF.
+// CFF2 has no Name, String or charset data; every font is organized like
+// a CID-keyed CFF font with an FDArray.
+type CFF2 struct {
+	data []byte
+
+	TopDict     CFF2TopDict
+	GlobalSubrs [][]byte // Global subroutines
+	CharStrings [][]byte // Per-glyph CharStrings
+	FDArray     []CFF2FontDict
+	FDSelect    []uint16 // Font DICT index for each glyph (nil with a single Font DICT)
+	VarStore    *ItemVariationStore
+
+	// varStoreData holds the raw VariationStore, without its length prefix.
+	varStoreData []byte
+}
+
+// CFF2TopDict contains the Top DICT data of a CFF2 table.
+type CFF2TopDict struct {
+	FontMatrix  []float64 // nil for the default [0.001 0 0 0.001 0 0]
+	CharStrings int       // Offset to CharStrings INDEX
+	FDArray     int       // Offset to FDArray INDEX
+	FDSelect    int       // Offset to FDSelect (0 if absent)
+	VarStore    int       // Offset to VariationStore (0 if absent)
+}
+
+// CFF2FontDict contains a Font DICT of the FDArray together with its
+// Private DICT data.
+type CFF2FontDict struct {
+	Private    [2]int   // [size, offset]
+	LocalSubrs [][]byte // Local subroutines
+	VSIndex    int      // Default ItemVariationData index for blends
+
+	// privateData holds the raw Private DICT; its values may be blended.
+	privateData []byte
+}
+
+// ParseCFF2 parses a CFF2 table from raw data.
+func ParseCFF2(data []byte) (*CFF2, error) {
+	if len(data) < 5 {
+		return nil, errors.New("CFF2: data too short")
+	}
+	if data[0] != 2 {
+		return nil, fmt.Errorf("CFF2: unsupported version %d.%d", data[0], data[1])
+	}
+	headerSize := int(data[2])
+	topDictLength := int(binary.BigEndian.Uint16(data[3:]))
+	if headerSize+topDictLength > len(data) {
+		return nil, errors.New("CFF2: Top DICT extends beyond table")
+	}
+
+	c := &CFF2{data: data}
+	c.TopDict = parseCFF2TopDict(data[headerSize : headerSize+topDictLength])
+
+	var err error
+	c.GlobalSubrs, _, err = parseINDEX2(data[headerSize+topDictLength:])
+	if err != nil {
+		return nil, fmt.Errorf("CFF2: parsing Global Subrs INDEX: %w", err)
+	}
+
+	if c.TopDict.CharStrings <= 0 || c.TopDict.CharStrings >= len(data) {
+		return nil, errors.New("CFF2: missing CharStrings INDEX")
+	}
+	c.CharStrings, _, err = parseINDEX2(data[c.TopDict.CharStrings:])
+	if err != nil {
+		return nil, fmt.Errorf("CFF2: parsing CharStrings INDEX: %w", err)
+	}
+
+	if c.TopDict.VarStore > 0 && c.TopDict.VarStore+2 <= len(data) {
+		length := int(binary.BigEndian.Uint16(data[c.TopDict.VarStore:]))
+		start := c.TopDict.VarStore + 2
+		if start+length > len(data) {
+			return nil, errors.New("CFF2: VariationStore extends beyond table")
+		}
+		c.varStoreData = data[start : start+length]
+		c.VarStore, err = parseItemVariationStore(c.varStoreData)
+		if err != nil {
+			return nil, fmt.Errorf("CFF2: parsing VariationStore: %w", err)
+		}
+	}
+
+	if c.TopDict.FDArray <= 0 || c.TopDict.FDArray >= len(data) {
+		return nil, errors.New("CFF2: missing FDArray")
+	}
+	fontDicts, _, err := parseINDEX2(data[c.TopDict.FDArray:])
+	if err != nil {
+		return nil, fmt.Errorf("CFF2: parsing FDArray INDEX: %w", err)
+	}
+	c.FDArray = make([]CFF2FontDict, len(fontDicts))
+	for i, fdData := range fontDicts {
+		fd := &c.FDArray[i]
+		fd.Private = parseFontDict(fdData).Private
+		size, offset := fd.Private[0], fd.Private[1]
+		if size <= 0 || offset < 0 || offset+size > len(data) {
+			continue
+		}
+		fd.privateData = data[offset : offset+size]
+		subrs := 0
+		parseCFF2Dict(fd.privateData, nil, func(op int, operands []float64) {
+			switch op {
+			case dictSubrs:
+				if len(operands) > 0 {
+					subrs = int(operands[len(operands)-1])
+				}
+			case dictVsindex:
+				if len(operands) > 0 {
+					fd.VSIndex = int(operands[len(operands)-1])
+				}
+			}
+		})
+		if subrs > 0 && offset+subrs < len(data) {
+			fd.LocalSubrs, _, err = parseINDEX2(data[offset+subrs:])
+			if err != nil {
+				return nil, fmt.Errorf("CFF2: parsing Local Subrs INDEX: %w", err)
+			}
+		}
+	}
+
+	if c.TopDict.FDSelect > 0 && c.TopDict.FDSelect < len(data) {
+		c.FDSelect = make([]uint16, len(c.CharStrings))
+		if err := parseFDSelect2(data[c.TopDict.FDSelect:], c.FDSelect); err != nil {
+			return nil, fmt.Errorf("CFF2: parsing FDSelect: %w", err)
+		}
+		for gid, fd := range c.FDSelect {
+			if int(fd) >= len(c.FDArray) {
+				return nil, fmt.Errorf("CFF2: glyph %d uses Font DICT %d of %d", gid, fd, len(c.FDArray))
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// parseINDEX2 parses a CFF2 INDEX, which has a 32-bit count.
+// Returns the data items and bytes consumed.
+func parseINDEX2(data []byte) ([][]byte, int, error) {
+	if len(data) < 4 {
+		return nil, 0, errors.New("INDEX: data too short")
+	}
+	count := int(binary.BigEndian.Uint32(data))
+	if count == 0 {
+		return nil, 4, nil
+	}
+	if len(data) < 5 {
+		return nil, 0, errors.New("INDEX: data too short for offSize")
+	}
+	offSize := int(data[4])
+	if offSize < 1 || offSize > 4 {
+		return nil, 0, fmt.Errorf("INDEX: invalid offSize %d", offSize)
+	}
+	headerSize := 5 + (count+1)*offSize
+	if count > len(data) || len(data) < headerSize {
+		return nil, 0, errors.New("INDEX: data too short for offsets")
+	}
+
+	items := make([][]byte, count)
+	start := readOffset(data[5:], offSize)
+	for i := 0; i < count; i++ {
+		end := readOffset(data[5+(i+1)*offSize:], offSize)
+		if start < 1 || end < start || headerSize+end-1 > len(data) {
+			return nil, 0, fmt.Errorf("INDEX: invalid item bounds [%d:%d]", start, end)
+		}
+		items[i] = data[headerSize+start-1 : headerSize+end-1]
+		start = end
+	}
+	return items, headerSize + start - 1, nil
+}
+
+// parseFDSelect2 fills fds with the Font DICT index of each glyph.
+// CFF2 adds Format 4 with 32-bit glyph IDs and 16-bit Font DICT indices to
+// Formats 0 and 3.
+func parseFDSelect2(data []byte, fds []uint16) error {
+	if len(data) > 0 && data[0] == 4 {
+		if len(data) < 5 {
+			return errors.New("data too short")
+		}
+		nRanges := int(binary.BigEndian.Uint32(data[1:]))
+		if nRanges > len(data) || len(data) < 5+nRanges*6+4 {
+			return errors.New("data too short")
+		}
+		for i := 0; i < nRanges; i++ {
+			rec := data[5+i*6:]
+			first := int(binary.BigEndian.Uint32(rec))
+			fd := binary.BigEndian.Uint16(rec[4:])
+			next := int(binary.BigEndian.Uint32(data[5+(i+1)*6:]))
+			for gid := first; gid < next && gid < len(fds); gid++ {
+				fds[gid] = fd
+			}
+		}
+		return nil
+	}
+	fds8 := make([]byte, len(fds))
+	if err := parseFDSelect(data, fds8); err != nil {
+		return err
+	}
+	for gid, fd := range fds8 {
+		fds[gid] = uint16(fd)
+	}
+	return nil
+}
+
+// parseCFF2TopDict parses a CFF2 Top DICT.
+func parseCFF2TopDict(data []byte) CFF2TopDict {
+	var dict CFF2TopDict
+	parseCFF2Dict(data, nil, func(op int, operands []float64) {
+		last := 0
+		if len(operands) > 0 {
+			last = int(operands[len(operands)-1])
+		}
+		switch op {
+		case dictFontMatrix:
+			if len(operands) == 6 {
+				dict.FontMatrix = append([]float64{}, operands...)
+			}
+		case dictCharStrings:
+			dict.CharStrings = last
+		case dictFDArray:
+			dict.FDArray = last
+		case dictFDSelect:
+			dict.FDSelect = last
+		case dictVstore:
+			dict.VarStore = last
+		}
+	})
+	return dict
+}
+
+// parseCFF2Dict walks a CFF2 DICT and calls fn for each operator. blend
+// resolves blend operators; if it is nil, blended operands are left
+// unresolved, which is fine for callers that only read non-blendable
+// operators.
+func parseCFF2Dict(data []byte, blend func(operands []float64) []float64, fn func(op int, operands []float64)) {
+	operands := make([]float64, 0, 16)
+	pos := 0
+	for pos < len(data) {
+		b := data[pos]
+
+		// Operand
+		if b >= 32 && b <= 254 || b == 28 || b == 29 || b == 30 {
+			val, consumed := decodeDictNumber(data[pos:])
+			operands = append(operands, val)
+			pos += consumed
+			continue
+		}
+
+		// Operator
+		op := int(b)
+		pos++
+		if b == 12 && pos < len(data) {
+			op = 12<<8 | int(data[pos])
+			pos++
+		}
+
+		if op == dictBlend {
+			if blend != nil {
+				operands = blend(operands)
+			}
+			continue
+		}
+		fn(op, operands)
+		operands = operands[:0]
+	}
+}
+
+// decodeDictNumber decodes a DICT operand, including real numbers.
+// Returns the value and bytes consumed.
+func decodeDictNumber(data []byte) (float64, int) {
+	if len(data) == 0 || data[0] != 30 {
+		v, n := decodeDictOperand(data)
+		return float64(v), n
+	}
+
+	// Real number: BCD nibbles terminated by 0xf
+	var s []byte
+	pos := 1
+	for pos < len(data) {
+		b := data[pos]
+		pos++
+		for _, nib := range [2]byte{b >> 4, b & 0x0f} {
+			switch {
+			case nib <= 9:
+				s = append(s, '0'+nib)
+			case nib == 0xa:
+				s = append(s, '.')
+			case nib == 0xb:
+				s = append(s, 'E')
+			case nib == 0xc:
+				s = append(s, 'E', '-')
+			case nib == 0xe:
+				s = append(s, '-')
+			case nib == 0xf:
+				v, _ := strconv.ParseFloat(string(s), 64)
+				return v, pos
+			}
+		}
+	}
+	return 0, pos
+}
+
+// NumGlyphs returns the number of glyphs in the CFF2 font.
+func (c *CFF2) NumGlyphs() int {
+	return len(c.CharStrings)
+}
+
+// FDIndex returns the index into FDArray of the Font DICT used by glyph.
+func (c *CFF2) FDIndex(glyph GlyphID) int {
+	if int(glyph) < len(c.FDSelect) {
+		return int(c.FDSelect[glyph])
+	}
+	return 0
+}
+
+// TopDictData returns the raw Top DICT of the table.
+func (c *CFF2) TopDictData() []byte {
+	headerSize := int(c.data[2])
+	return c.data[headerSize : headerSize+int(binary.BigEndian.Uint16(c.data[3:]))]
+}
+
+// PrivateDictData returns the raw Private DICT of Font DICT fd, or nil.
+// Its values may contain blends.
+func (c *CFF2) PrivateDictData(fd int) []byte {
+	if fd < 0 || fd >= len(c.FDArray) {
+		return nil
+	}
+	return c.FDArray[fd].privateData
+}
+
+// VarStoreData returns the raw ItemVariationStore of the table, or nil.
+func (c *CFF2) VarStoreData() []byte {
+	return c.varStoreData
+}
+
+// newMachine returns a csMachine for glyph at the normalized coordinates
+// coords (F2DOT14, after avar mapping).
+func (c *CFF2) newMachine(glyph GlyphID, coords []int, op func(int, []float64, []byte)) (*csMachine, error) {
+	if int(glyph) >= len(c.CharStrings) {
+		return nil, ErrInvalidOffset
+	}
+	fd := c.FDIndex(glyph)
+	if fd >= len(c.FDArray) {
+		return nil, ErrInvalidTable
+	}
+	m := newCSMachine(c.GlobalSubrs, c.FDArray[fd].LocalSubrs, op)
+	m.cff2 = true
+	m.vstore = c.VarStore
+	m.coords = coords
+	m.vsindex = c.FDArray[fd].VSIndex
+	return m, nil
+}
+
+// GlyphOutline draws the outline of glyph at the normalized coordinates
+// coords (F2DOT14, after avar mapping; nil for the default instance).
+func (c *CFF2) GlyphOutline(glyph GlyphID, coords []int, pen Pen) error {
+	b := &csPathBuilder{pen: pen}
+	m, err := c.newMachine(glyph, coords, b.op)
+	if err != nil {
+		return err
+	}
+	if err := m.run(c.CharStrings[glyph]); err != nil {
+		return err
+	}
+	b.closePath()
+	return nil
+}
+
+// GlyphExtents returns the extents of glyph at the normalized coordinates
+// coords. Returns false for empty glyphs.
+func (c *CFF2) GlyphExtents(glyph GlyphID, coords []int) (GlyphExtents, bool) {
+	var path Path
+	if err := c.GlyphOutline(glyph, coords, &path); err != nil {
+		return GlyphExtents{}, false
+	}
+	return path.Extents()
+}
+
+// InstanceCharString returns the CharString of glyph at coords as a Type 2
+// CharString for a CFF (version 1) table: subroutines are inlined, blends
+// resolved, coordinates rounded to integers and hints kept. The result
+// ends with endchar and has no width operand.
+func (c *CFF2) InstanceCharString(glyph GlyphID, coords []int) ([]byte, error) {
+	enc := &csEncoder{}
+	b := &csPathBuilder{pen: enc, hint: enc.hint}
+	m, err := c.newMachine(glyph, coords, b.op)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.run(c.CharStrings[glyph]); err != nil {
+		return nil, err
+	}
+	enc.operator(csEndchar)
+	return enc.buf, nil
+}
+
+// PrivateDict returns the Private DICT of Font DICT fd with blended values
+// resolved at coords.
+func (c *CFF2) PrivateDict(fd int, coords []int) PrivateDict {
+	dict := PrivateDict{
+		BlueScale: 0.039625, // Default
+		BlueShift: 7,        // Default
+		BlueFuzz:  1,        // Default
+	}
+	if fd < 0 || fd >= len(c.FDArray) {
+		return dict
+	}
+	fontDict := &c.FDArray[fd]
+
+	var scalars []float64
+	blend := func(operands []float64) []float64 {
+		if scalars == nil {
+			scalars = c.VarStore.regionScalars(fontDict.VSIndex, coords)
+		}
+		if len(operands) == 0 {
+			return operands
+		}
+		n := int(operands[len(operands)-1])
+		operands = operands[:len(operands)-1]
+		k := len(scalars)
+		base := len(operands) - n*(k+1)
+		if n < 0 || base < 0 {
+			return operands[:0]
+		}
+		for i := 0; i < n; i++ {
+			for j, scalar := range scalars {
+				operands[base+i] += operands[base+n+i*k+j] * scalar
+			}
+		}
+		return operands[:base+n]
+	}
+
+	ints := func(operands []float64) []int {
+		r := make([]int, len(operands))
+		// Delta-encoded arrays are summed before rounding so that
+		// rounding errors do not accumulate.
+		var sum float64
+		prev := 0
+		for i, v := range operands {
+			sum += v
+			abs := int(math.Round(sum))
+			r[i] = abs - prev
+			prev = abs
+		}
+		return r
+	}
+	last := func(operands []float64) float64 {
+		if len(operands) == 0 {
+			return 0
+		}
+		return operands[len(operands)-1]
+	}
+
+	parseCFF2Dict(fontDict.privateData, blend, func(op int, operands []float64) {
+		switch op {
+		case dictBlueValues:
+			dict.BlueValues = ints(operands)
+		case dictOtherBlues:
+			dict.OtherBlues = ints(operands)
+		case dictFamilyBlues:
+			dict.FamilyBlues = ints(operands)
+		case dictFamilyOtherBlues:
+			dict.FamilyOtherBlues = ints(operands)
+		case dictStdHW:
+			dict.StdHW = int(math.Round(last(operands)))
+		case dictStdVW:
+			dict.StdVW = int(math.Round(last(operands)))
+		case dictStemSnapH:
+			dict.StemSnapH = ints(operands)
+		case dictStemSnapV:
+			dict.StemSnapV = ints(operands)
+		case dictBlueScale:
+			dict.BlueScale = last(operands)
+		case dictBlueShift:
+			dict.BlueShift = int(math.Round(last(operands)))
+		case dictBlueFuzz:
+			dict.BlueFuzz = int(math.Round(last(operands)))
+		}
+	})
+	return dict
+}
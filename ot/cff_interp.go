@@ -0,0 +1,525 @@
+package ot
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Limits from the Type 2 CharString and CFF2 specifications.
+const (
+	csMaxCallDepth = 10
+	csMaxStack     = 513 // CFF2 maxstack default; CFF limits to 48
+)
+
+var (
+	errCSStackOverflow  = errors.New("charstring: stack overflow")
+	errCSStackUnderflow = errors.New("charstring: stack underflow")
+	errCSCallDepth      = errors.New("charstring: subroutine nesting too deep")
+	errCSInvalidSubr    = errors.New("charstring: invalid subroutine")
+	errCSInvalidSeac    = errors.New("charstring: invalid seac")
+)
+
+// csMachine executes Type 2 (CFF) and CFF2 CharStrings. Subroutine calls,
+// blends and the width operand are resolved by the machine; every other
+// operator is passed to op together with its operands.
+type csMachine struct {
+	globalSubrs [][]byte
+	localSubrs  [][]byte
+	globalBias  int
+	localBias   int
+
+	// CFF2: no width, no endchar, blend and vsindex operators
+	cff2    bool
+	vstore  *ItemVariationStore
+	coords  []int
+	vsindex int
+	scalars []float64 // region scalars for vsindex, computed on first blend
+
+	stack     []float64
+	nStems    int
+	depth     int
+	seenWidth bool
+	width     float64
+	hasWidth  bool
+	done      bool
+
+	op func(op int, args []float64, mask []byte)
+}
+
+func newCSMachine(globalSubrs, localSubrs [][]byte, op func(op int, args []float64, mask []byte)) *csMachine {
+	return &csMachine{
+		globalSubrs: globalSubrs,
+		localSubrs:  localSubrs,
+		globalBias:  calcSubrBias(len(globalSubrs)),
+		localBias:   calcSubrBias(len(localSubrs)),
+		stack:       make([]float64, 0, 48),
+		op:          op,
+	}
+}
+
+// run executes a CharString or subroutine.
+func (m *csMachine) run(data []byte) error {
+	pos := 0
+	for pos < len(data) && !m.done {
+		b := data[pos]
+
+		// Operands
+		if b >= 32 || b == csShortint {
+			var v float64
+			switch {
+			case b <= 246:
+				if b == csShortint {
+					if pos+3 > len(data) {
+						return ErrInvalidTable
+					}
+					v = float64(int16(binary.BigEndian.Uint16(data[pos+1:])))
+					pos += 3
+				} else {
+					v = float64(int(b) - 139)
+					pos++
+				}
+			case b <= 250:
+				if pos+2 > len(data) {
+					return ErrInvalidTable
+				}
+				v = float64((int(b)-247)*256 + int(data[pos+1]) + 108)
+				pos += 2
+			case b <= 254:
+				if pos+2 > len(data) {
+					return ErrInvalidTable
+				}
+				v = float64(-(int(b)-251)*256 - int(data[pos+1]) - 108)
+				pos += 2
+			default: // 255: 16.16 fixed
+				if pos+5 > len(data) {
+					return ErrInvalidTable
+				}
+				v = float64(int32(binary.BigEndian.Uint32(data[pos+1:]))) / 65536
+				pos += 5
+			}
+			if len(m.stack) >= csMaxStack {
+				return errCSStackOverflow
+			}
+			m.stack = append(m.stack, v)
+			continue
+		}
+
+		// Operators
+		op := int(b)
+		pos++
+		if b == csEscape {
+			if pos >= len(data) {
+				return ErrInvalidTable
+			}
+			op = 12<<8 | int(data[pos])
+			pos++
+		}
+
+		switch op {
+		case csCallsubr, csCallgsubr:
+			if len(m.stack) == 0 {
+				return errCSStackUnderflow
+			}
+			n := int(m.stack[len(m.stack)-1])
+			m.stack = m.stack[:len(m.stack)-1]
+			subrs, bias := m.localSubrs, m.localBias
+			if op == csCallgsubr {
+				subrs, bias = m.globalSubrs, m.globalBias
+			}
+			n += bias
+			if n < 0 || n >= len(subrs) {
+				return errCSInvalidSubr
+			}
+			if m.depth >= csMaxCallDepth {
+				return errCSCallDepth
+			}
+			m.depth++
+			err := m.run(subrs[n])
+			m.depth--
+			if err != nil {
+				return err
+			}
+
+		case csReturn:
+			return nil
+
+		case csVsindex:
+			if !m.cff2 || len(m.stack) == 0 {
+				return errCSStackUnderflow
+			}
+			m.vsindex = int(m.stack[len(m.stack)-1])
+			m.stack = m.stack[:0]
+			m.scalars = nil
+
+		case csBlend:
+			if !m.cff2 {
+				m.stack = m.stack[:0]
+				continue
+			}
+			if err := m.blend(); err != nil {
+				return err
+			}
+
+		case csHstem, csVstem, csHstemhm, csVstemhm:
+			m.readWidth(len(m.stack)%2 == 1)
+			m.nStems += len(m.stack) / 2
+			m.emit(op, nil)
+
+		case csHintmask, csCntrmask:
+			m.readWidth(len(m.stack)%2 == 1)
+			m.nStems += len(m.stack) / 2
+			n := (m.nStems + 7) / 8
+			if pos+n > len(data) {
+				return ErrInvalidTable
+			}
+			m.emit(op, data[pos:pos+n])
+			pos += n
+
+		case csRmoveto:
+			m.readWidth(len(m.stack) > 2)
+			m.emit(op, nil)
+
+		case csHmoveto, csVmoveto:
+			m.readWidth(len(m.stack) > 1)
+			m.emit(op, nil)
+
+		case csEndchar:
+			m.readWidth(len(m.stack) == 1 || len(m.stack) == 5)
+			m.emit(op, nil)
+			m.done = true
+
+		default:
+			m.emit(op, nil)
+		}
+	}
+	return nil
+}
+
+// readWidth takes the optional width operand of a CFF CharString, which
+// precedes the operands of the first stack-clearing operator.
+func (m *csMachine) readWidth(present bool) {
+	if m.cff2 || m.seenWidth {
+		return
+	}
+	m.seenWidth = true
+	if present && len(m.stack) > 0 {
+		m.width = m.stack[0]
+		m.hasWidth = true
+		m.stack = m.stack[1:]
+	}
+}
+
+// emit passes an operator to the consumer and clears the stack.
+func (m *csMachine) emit(op int, mask []byte) {
+	if m.op != nil {
+		m.op(op, m.stack, mask)
+	}
+	m.stack = m.stack[:0]
+}
+
+// blend implements the CFF2 blend operator: it replaces n default values
+// followed by n*k deltas with the n interpolated values.
+func (m *csMachine) blend() error {
+	if len(m.stack) == 0 {
+		return errCSStackUnderflow
+	}
+	n := int(m.stack[len(m.stack)-1])
+	m.stack = m.stack[:len(m.stack)-1]
+	if m.scalars == nil {
+		m.scalars = m.vstore.regionScalars(m.vsindex, m.coords)
+	}
+	k := len(m.scalars)
+	base := len(m.stack) - n*(k+1)
+	if n < 0 || base < 0 {
+		return errCSStackUnderflow
+	}
+	for i := 0; i < n; i++ {
+		v := m.stack[base+i]
+		deltas := m.stack[base+n+i*k:]
+		for j, scalar := range m.scalars {
+			v += deltas[j] * scalar
+		}
+		m.stack[base+i] = v
+	}
+	m.stack = m.stack[:base+n]
+	return nil
+}
+
+// csPathBuilder turns the operators of a csMachine into Pen calls.
+// Hint operators are passed to hint if it is set.
+type csPathBuilder struct {
+	pen    Pen
+	hint   func(op int, args []float64, mask []byte)
+	x, y   float64
+	inPath bool
+
+	// seac holds adx, ady, bchar and achar of an endchar that builds the
+	// glyph from a base and an accent (the Type 1 seac).
+	seac    [4]float64
+	hasSeac bool
+}
+
+func (b *csPathBuilder) moveTo(dx, dy float64) {
+	b.closePath()
+	b.x += dx
+	b.y += dy
+	b.pen.MoveTo(float32(b.x), float32(b.y))
+	b.inPath = true
+}
+
+func (b *csPathBuilder) lineTo(dx, dy float64) {
+	b.x += dx
+	b.y += dy
+	b.pen.LineTo(float32(b.x), float32(b.y))
+}
+
+func (b *csPathBuilder) curveTo(dx1, dy1, dx2, dy2, dx3, dy3 float64) {
+	x1, y1 := b.x+dx1, b.y+dy1
+	x2, y2 := x1+dx2, y1+dy2
+	b.x, b.y = x2+dx3, y2+dy3
+	b.pen.CubeTo(float32(x1), float32(y1), float32(x2), float32(y2), float32(b.x), float32(b.y))
+}
+
+func (b *csPathBuilder) closePath() {
+	if b.inPath {
+		b.pen.Close()
+		b.inPath = false
+	}
+}
+
+// op handles one operator. Operands that do not fit the operator are
+// ignored, as in FreeType.
+func (b *csPathBuilder) op(op int, a []float64, mask []byte) {
+	switch op {
+	case csHstem, csVstem, csHstemhm, csVstemhm, csHintmask, csCntrmask:
+		if b.hint != nil {
+			b.hint(op, a, mask)
+		}
+
+	case csRmoveto:
+		if len(a) >= 2 {
+			b.moveTo(a[0], a[1])
+		}
+	case csHmoveto:
+		if len(a) >= 1 {
+			b.moveTo(a[0], 0)
+		}
+	case csVmoveto:
+		if len(a) >= 1 {
+			b.moveTo(0, a[0])
+		}
+
+	case csRlineto:
+		for ; len(a) >= 2; a = a[2:] {
+			b.lineTo(a[0], a[1])
+		}
+	case csHlineto, csVlineto:
+		horizontal := op == csHlineto
+		for _, d := range a {
+			if horizontal {
+				b.lineTo(d, 0)
+			} else {
+				b.lineTo(0, d)
+			}
+			horizontal = !horizontal
+		}
+
+	case csRrcurveto:
+		for ; len(a) >= 6; a = a[6:] {
+			b.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+		}
+	case csRcurveline:
+		for ; len(a) >= 8; a = a[6:] {
+			b.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+		}
+		if len(a) >= 2 {
+			b.lineTo(a[0], a[1])
+		}
+	case csRlinecurve:
+		for ; len(a) >= 8; a = a[2:] {
+			b.lineTo(a[0], a[1])
+		}
+		if len(a) >= 6 {
+			b.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+		}
+	case csVvcurveto:
+		var dx1 float64
+		if len(a)%2 == 1 {
+			dx1, a = a[0], a[1:]
+		}
+		for ; len(a) >= 4; a = a[4:] {
+			b.curveTo(dx1, a[0], a[1], a[2], 0, a[3])
+			dx1 = 0
+		}
+	case csHhcurveto:
+		var dy1 float64
+		if len(a)%2 == 1 {
+			dy1, a = a[0], a[1:]
+		}
+		for ; len(a) >= 4; a = a[4:] {
+			b.curveTo(a[0], dy1, a[1], a[2], a[3], 0)
+			dy1 = 0
+		}
+	case csHvcurveto, csVhcurveto:
+		horizontal := op == csHvcurveto
+		for len(a) >= 4 {
+			var last float64
+			if len(a) == 5 {
+				last = a[4]
+			}
+			if horizontal {
+				b.curveTo(a[0], 0, a[1], a[2], last, a[3])
+			} else {
+				b.curveTo(0, a[0], a[1], a[2], a[3], last)
+			}
+			a = a[4:]
+			if len(a) == 1 {
+				a = a[1:]
+			}
+			horizontal = !horizontal
+		}
+
+	case csFlex:
+		if len(a) >= 12 {
+			b.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+			b.curveTo(a[6], a[7], a[8], a[9], a[10], a[11])
+		}
+	case csHflex:
+		if len(a) >= 7 {
+			y := b.y
+			b.curveTo(a[0], 0, a[1], a[2], a[3], 0)
+			b.curveTo(a[4], 0, a[5], y-b.y, a[6], 0)
+		}
+	case csHflex1:
+		if len(a) >= 9 {
+			y := b.y
+			b.curveTo(a[0], a[1], a[2], a[3], a[4], 0)
+			b.curveTo(a[5], 0, a[6], a[7], a[8], y-(b.y+a[7]))
+		}
+	case csFlex1:
+		if len(a) >= 11 {
+			x, y := b.x, b.y
+			dx := a[0] + a[2] + a[4] + a[6] + a[8]
+			dy := a[1] + a[3] + a[5] + a[7] + a[9]
+			b.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+			if math.Abs(dx) > math.Abs(dy) {
+				b.curveTo(a[6], a[7], a[8], a[9], a[10], y-(b.y+a[7]+a[9]))
+			} else {
+				b.curveTo(a[6], a[7], a[8], a[9], x-(b.x+a[6]+a[8]), a[10])
+			}
+		}
+
+	case csEndchar:
+		b.closePath()
+		if len(a) == 4 {
+			copy(b.seac[:], a)
+			b.hasSeac = true
+		}
+	}
+}
+
+// csEncoder is a Pen that writes a Type 2 CharString with integer
+// coordinates. Points are rounded in absolute coordinates, so rounding
+// errors do not accumulate along a contour.
+type csEncoder struct {
+	buf    []byte
+	x, y   int
+	hasOps bool
+}
+
+func (e *csEncoder) num(v int) {
+	switch {
+	case v >= -107 && v <= 107:
+		e.buf = append(e.buf, byte(v+139))
+	case v >= 108 && v <= 1131:
+		v -= 108
+		e.buf = append(e.buf, byte(v/256+247), byte(v%256))
+	case v >= -1131 && v <= -108:
+		v = -v - 108
+		e.buf = append(e.buf, byte(v/256+251), byte(v%256))
+	default:
+		e.buf = append(e.buf, csShortint, byte(v>>8), byte(v))
+	}
+}
+
+func (e *csEncoder) operator(op int) {
+	if op >= 12<<8 {
+		e.buf = append(e.buf, csEscape, byte(op))
+	} else {
+		e.buf = append(e.buf, byte(op))
+	}
+	e.hasOps = true
+}
+
+func (e *csEncoder) point(x, y float32) {
+	rx, ry := int(math.Round(float64(x))), int(math.Round(float64(y)))
+	e.num(rx - e.x)
+	e.num(ry - e.y)
+	e.x, e.y = rx, ry
+}
+
+// MoveTo implements Pen.
+func (e *csEncoder) MoveTo(x, y float32) {
+	e.point(x, y)
+	e.operator(csRmoveto)
+}
+
+// LineTo implements Pen.
+func (e *csEncoder) LineTo(x, y float32) {
+	e.point(x, y)
+	e.operator(csRlineto)
+}
+
+// QuadTo implements Pen by raising the curve to a cubic.
+func (e *csEncoder) QuadTo(cx, cy, x, y float32) {
+	x0, y0 := float32(e.x), float32(e.y)
+	e.CubeTo(x0+2*(cx-x0)/3, y0+2*(cy-y0)/3, x+2*(cx-x)/3, y+2*(cy-y)/3, x, y)
+}
+
+// CubeTo implements Pen.
+func (e *csEncoder) CubeTo(c1x, c1y, c2x, c2y, x, y float32) {
+	e.point(c1x, c1y)
+	e.point(c2x, c2y)
+	e.point(x, y)
+	e.operator(csRrcurveto)
+}
+
+// Close implements Pen. Contours are closed implicitly in CharStrings.
+func (e *csEncoder) Close() {}
+
+// csMaxStemArgs limits the operands of a written stem operator so that a
+// width operand still fits the 48-entry CFF stack.
+const csMaxStemArgs = 46
+
+// hint writes a hint operator. Stem edges are rounded in absolute
+// coordinates like points. An implicit vstem before hintmask is written
+// as an explicit vstemhm.
+func (e *csEncoder) hint(op int, args []float64, mask []byte) {
+	stemOp := op
+	if op == csHintmask || op == csCntrmask {
+		stemOp = csVstemhm
+	}
+	// Each stem operator starts at 0, so a split continues with the
+	// absolute position of the next edge.
+	var edge float64
+	for len(args) >= 2 {
+		n := len(args) &^ 1
+		if n > csMaxStemArgs {
+			n = csMaxStemArgs
+		}
+		prev := 0
+		for _, d := range args[:n] {
+			edge += d
+			r := int(math.Round(edge))
+			e.num(r - prev)
+			prev = r
+		}
+		e.operator(stemOp)
+		args = args[n:]
+	}
+	if op == csHintmask || op == csCntrmask {
+		e.operator(op)
+		e.buf = append(e.buf, mask...)
+	}
+}
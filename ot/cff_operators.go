@@ -16,6 +16,7 @@ const (
 	dictEncoding    = 16
 	dictCharStrings = 17
 	dictPrivate     = 18
+	dictVstore      = 24 // CFF2 VariationStore offset
 
 	// Top DICT operators (two byte, prefix 12)
 	dictCopyright      = 12<<8 | 0
@@ -51,6 +52,8 @@ const (
 	dictStdHW            = 10
 	dictStdVW            = 11
 	dictSubrs            = 19 // Local Subrs offset
+	dictVsindex          = 22 // CFF2
+	dictBlend            = 23 // CFF2
 
 	// Private DICT operators (two byte, prefix 12)
 	dictBlueScale         = 12<<8 | 9
@@ -80,6 +83,8 @@ const (
 	csReturn     = 11
 	csEscape     = 12 // Two-byte operator prefix
 	csEndchar    = 14
+	csVsindex    = 15 // CFF2: select ItemVariationData for blend
+	csBlend      = 16 // CFF2: blend operands with region deltas
 	csHstemhm    = 18
 	csHintmask   = 19
 	csCntrmask   = 20
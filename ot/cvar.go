@@ -0,0 +1,28 @@
+package ot
+
+import (
+	"encoding/binary"
+)
+
+// ParseCvar parses a cvar (CVT Variations) table and returns its tuple
+// variations. axisCount is the number of axes in fvar and cvtCount is the
+// number of values in the cvt table. The returned tuples have no YDeltas.
+func ParseCvar(data []byte, axisCount, cvtCount int) ([]TupleVariation, error) {
+	if len(data) < 8 {
+		return nil, ErrInvalidTable
+	}
+
+	major := binary.BigEndian.Uint16(data[0:])
+	if major != 1 {
+		return nil, ErrInvalidFormat
+	}
+
+	// cvar has the same layout as a glyph's variation data, except that it
+	// starts with a version and never refers to shared tuples.
+	g := &Gvar{axisCount: axisCount}
+	tuples := g.parseTupleVariations(data, 4, cvtCount)
+	for i := range tuples {
+		tuples[i].YDeltas = nil
+	}
+	return tuples, nil
+}
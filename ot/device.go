@@ -0,0 +1,214 @@
+package ot
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Device and VariationIndex tables
+//
+// HarfBuzz equivalent: Device, HintingDevice and VariationDevice in
+// hb-ot-layout-common.hh
+//
+// Device tables adjust GPOS values and anchors. Hinting Device tables
+// (formats 1-3) hold per-ppem pixel deltas, VariationIndex tables (format
+// 0x8000) reference a delta set in the ItemVariationStore of GDEF.
+
+// Device table formats.
+const (
+	DeviceFormatLocal2BitDeltas = 1      // Signed 2-bit deltas
+	DeviceFormatLocal4BitDeltas = 2      // Signed 4-bit deltas
+	DeviceFormatLocal8BitDeltas = 3      // Signed 8-bit deltas
+	DeviceFormatVariationIndex  = 0x8000 // Index into the ItemVariationStore
+)
+
+// Device is a parsed Device or VariationIndex table.
+type Device struct {
+	format uint16
+
+	// Formats 1-3
+	startSize   uint16
+	endSize     uint16
+	deltaValues []uint16
+
+	// Format 0x8000: outer index in the high and inner index in the low 16 bits
+	varIdx uint32
+}
+
+// parseDevice parses a Device or VariationIndex table at the given offset.
+// It returns nil for a zero offset, unknown formats and truncated tables.
+func parseDevice(data []byte, offset int) *Device {
+	if offset <= 0 || offset+6 > len(data) {
+		return nil
+	}
+
+	first := binary.BigEndian.Uint16(data[offset:])
+	second := binary.BigEndian.Uint16(data[offset+2:])
+	format := binary.BigEndian.Uint16(data[offset+4:])
+
+	switch format {
+	case DeviceFormatLocal2BitDeltas, DeviceFormatLocal4BitDeltas, DeviceFormatLocal8BitDeltas:
+		if second < first {
+			return nil
+		}
+		// Each uint16 packs 8, 4 or 2 deltas
+		count := (int(second-first) >> (4 - format)) + 1
+		if offset+6+count*2 > len(data) {
+			return nil
+		}
+		d := &Device{
+			format:      format,
+			startSize:   first,
+			endSize:     second,
+			deltaValues: make([]uint16, count),
+		}
+		for i := range d.deltaValues {
+			d.deltaValues[i] = binary.BigEndian.Uint16(data[offset+6+i*2:])
+		}
+		return d
+
+	case DeviceFormatVariationIndex:
+		return &Device{format: format, varIdx: uint32(first)<<16 | uint32(second)}
+	}
+	return nil
+}
+
+// Format returns the format of the Device table.
+func (d *Device) Format() uint16 {
+	return d.format
+}
+
+// VariationIndex returns the delta set index of a VariationIndex table.
+func (d *Device) VariationIndex() uint32 {
+	return d.varIdx
+}
+
+// deltaPixels returns the pixel delta of a hinting Device table at a ppem size.
+// HarfBuzz equivalent: HintingDevice::get_delta_pixels() in hb-ot-layout-common.hh
+func (d *Device) deltaPixels(ppem uint16) int {
+	f := d.format
+	if f < DeviceFormatLocal2BitDeltas || f > DeviceFormatLocal8BitDeltas {
+		return 0
+	}
+	if ppem < d.startSize || ppem > d.endSize {
+		return 0
+	}
+
+	s := uint(ppem - d.startSize)
+	word := uint(d.deltaValues[s>>(4-f)])
+	bits := word >> (16 - (((s & ((1 << (4 - f)) - 1)) + 1) << f))
+	mask := uint(0xFFFF) >> (16 - (1 << f))
+
+	delta := int(bits & mask)
+	if delta >= int((mask+1)>>1) {
+		delta -= int(mask + 1)
+	}
+	return delta
+}
+
+// DeviceContext is the font instance state Device and VariationIndex tables
+// are resolved against.
+// HarfBuzz equivalent: coords, x_ppem/y_ppem and x_scale/y_scale of hb_font_t
+// together with hb_ot_apply_context_t::var_store
+type DeviceContext struct {
+	// Coords are the normalized variation coordinates in F2DOT14 format.
+	Coords []int
+	// VarStore is the ItemVariationStore of GDEF.
+	VarStore *ItemVariationStore
+	// XPpem and YPpem select the deltas of hinting Device tables. Zero
+	// disables hinting deltas.
+	XPpem, YPpem uint16
+	// XScale and YScale are the font scale: positions are in units of
+	// 1/XScale (1/YScale) em. They convert pixel deltas into positions.
+	XScale, YScale int32
+	// Upem is the font's units per em. Values in font units are scaled by
+	// XScale/Upem and YScale/Upem; zero leaves them unscaled.
+	Upem int32
+	// ContourPoint returns a point of a glyph outline at the current
+	// variation location, for format 2 anchors. It may be nil.
+	// HarfBuzz equivalent: hb_font_get_glyph_contour_point_for_origin()
+	ContourPoint func(gid GlyphID, index uint16) (x, y float64, ok bool)
+}
+
+// XDelta returns the horizontal adjustment of a Device table in scaled units.
+// HarfBuzz equivalent: Device::get_x_delta() in hb-ot-layout-common.hh
+func (dc *DeviceContext) XDelta(d *Device) int32 {
+	return dc.delta(d, dc.XPpem, dc.XScale)
+}
+
+// YDelta returns the vertical adjustment of a Device table in scaled units.
+// HarfBuzz equivalent: Device::get_y_delta() in hb-ot-layout-common.hh
+func (dc *DeviceContext) YDelta(d *Device) int32 {
+	return dc.delta(d, dc.YPpem, dc.YScale)
+}
+
+func (dc *DeviceContext) delta(d *Device, ppem uint16, scale int32) int32 {
+	if dc == nil || d == nil {
+		return 0
+	}
+	switch d.format {
+	case DeviceFormatLocal2BitDeltas, DeviceFormatLocal4BitDeltas, DeviceFormatLocal8BitDeltas:
+		// HarfBuzz: HintingDevice::get_delta()
+		if ppem == 0 {
+			return 0
+		}
+		pixels := d.deltaPixels(ppem)
+		if pixels == 0 {
+			return 0
+		}
+		return int32(int64(pixels) * int64(scale) / int64(ppem))
+	case DeviceFormatVariationIndex:
+		// HarfBuzz: VariationDevice::get_delta()
+		if dc.VarStore == nil || len(dc.Coords) == 0 {
+			return 0
+		}
+		return dc.emScalef(dc.VarStore.GetDelta(d.varIdx, dc.Coords), scale)
+	}
+	return 0
+}
+
+// emScaleX scales a horizontal value in font units, rounded like HarfBuzz.
+// A nil context leaves the value unscaled.
+// HarfBuzz equivalent: hb_font_t::em_scale_x()
+func (dc *DeviceContext) emScaleX(v int16) int32 {
+	if dc == nil {
+		return int32(v)
+	}
+	return emScale(int32(v), dc.XScale, dc.Upem)
+}
+
+// emScaleY scales a vertical value in font units, see emScaleX.
+// HarfBuzz equivalent: hb_font_t::em_scale_y()
+func (dc *DeviceContext) emScaleY(v int16) int32 {
+	if dc == nil {
+		return int32(v)
+	}
+	return emScale(int32(v), dc.YScale, dc.Upem)
+}
+
+// emFscale scales a coordinate in font units without rounding.
+// HarfBuzz equivalent: hb_font_t::em_fscale_x() and em_fscale_y()
+func (dc *DeviceContext) emFscale(v float64, scale int32) float64 {
+	if dc == nil || dc.Upem == 0 || scale == dc.Upem {
+		return v
+	}
+	return v * float64(scale) / float64(dc.Upem)
+}
+
+// emScalef scales a fractional value in font units, such as a variation
+// delta, and rounds the result.
+// HarfBuzz equivalent: hb_font_t::em_scalef_x() and em_scalef_y()
+func (dc *DeviceContext) emScalef(v float32, scale int32) int32 {
+	return int32(math.Round(dc.emFscale(float64(v), scale)))
+}
+
+// emScale scales v from upem to scale units, rounding like HarfBuzz's
+// 16.16 fixed-point multiplication. A zero upem leaves v unscaled.
+// HarfBuzz equivalent: hb_font_t::em_mult()
+func emScale(v, scale, upem int32) int32 {
+	if upem == 0 || scale == upem {
+		return v
+	}
+	mult := (int64(scale) << 16) / int64(upem)
+	return int32((int64(v)*mult + 0x8000) >> 16)
+}
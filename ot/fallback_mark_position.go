@@ -36,7 +36,7 @@ const (
 // This is called when GPOS mark positioning is not available.
 // Source: HarfBuzz _hb_ot_shape_fallback_mark_position() in hb-ot-shape-fallback.cc:456-483
 func (s *Shaper) fallbackMarkPosition(buf *Buffer) {
-	if s.glyf == nil || s.hmtx == nil {
+	if (s.glyf == nil && s.cff == nil && s.cff2 == nil) || s.hmtx == nil {
 		return
 	}
 
@@ -53,6 +53,22 @@ func (s *Shaper) fallbackMarkPosition(buf *Buffer) {
 	s.positionCluster(buf, start, len(buf.Info))
 }
 
+// glyphExtents returns the extents of a glyph from glyf or, for CFF fonts,
+// from the outline, at the current variation coordinates.
+func (s *Shaper) glyphExtents(glyph GlyphID) (GlyphExtents, bool) {
+	switch {
+	case s.glyf != nil && s.gvar != nil && s.gvar.HasData() && s.hasNonZeroCoords():
+		return s.glyf.GlyphExtentsAt(glyph, s.gvar, s.normalizedCoordsI)
+	case s.glyf != nil:
+		return s.glyf.GetGlyphExtents(glyph)
+	case s.cff != nil:
+		return s.cff.GlyphExtents(glyph)
+	case s.cff2 != nil:
+		return s.cff2.GlyphExtents(glyph, s.normalizedCoordsI)
+	}
+	return GlyphExtents{}, false
+}
+
 // positionCluster positions marks within a single cluster.
 // Source: HarfBuzz position_cluster() in hb-ot-shape-fallback.cc:441-453
 func (s *Shaper) positionCluster(buf *Buffer, start, end int) {
@@ -92,7 +108,7 @@ func (s *Shaper) positionClusterImpl(buf *Buffer, start, end int) {
 // Source: HarfBuzz position_around_base() in hb-ot-shape-fallback.cc:315-409
 func (s *Shaper) positionAroundBaseImpl(buf *Buffer, base, end int) {
 	// Get base extents
-	baseExtents, ok := s.glyf.GetGlyphExtents(buf.Info[base].GlyphID)
+	baseExtents, ok := s.scaledGlyphExtents(buf.Info[base].GlyphID)
 	if !ok {
 		// If no extents, zero mark advances and return
 		s.zeroMarkAdvances(buf, base+1, end)
@@ -105,7 +121,7 @@ func (s *Shaper) positionAroundBaseImpl(buf *Buffer, base, end int) {
 	// Use horizontal advance for width (generally better, works for zero-ink glyphs)
 	// HarfBuzz lines 339-340
 	baseExtents.XBearing = 0
-	baseExtents.Width = int16(s.hmtx.GetAdvanceWidth(buf.Info[base].GlyphID))
+	baseExtents.Width = s.glyphHAdvance(buf.Info[base].GlyphID)
 
 	// Position marks around the base
 	s.positionAroundBase(buf, base, end, baseExtents)
@@ -121,8 +137,8 @@ func (s *Shaper) positionAroundBase(buf *Buffer, base, end int, baseExtents Glyp
 
 	// Calculate x_offset and y_offset based on direction
 	// HarfBuzz lines 347-351
-	xOffset := int16(0)
-	yOffset := int16(0)
+	xOffset := int32(0)
+	yOffset := int32(0)
 	if buf.Direction == DirectionLTR || buf.Direction == DirectionTTB {
 		xOffset = -buf.Pos[base].XAdvance
 		yOffset = -buf.Pos[base].YAdvance
@@ -167,11 +183,11 @@ func (s *Shaper) positionAroundBase(buf *Buffer, base, end int, baseExtents Glyp
 
 					// Adjust extents for this component
 					if horizDir == DirectionLTR {
-						componentExtents.XBearing += int16(thisLigComponent * int(componentExtents.Width) / numLigComponents)
+						componentExtents.XBearing += int32(thisLigComponent * int(componentExtents.Width) / numLigComponents)
 					} else {
-						componentExtents.XBearing += int16((numLigComponents - 1 - thisLigComponent) * int(componentExtents.Width) / numLigComponents)
+						componentExtents.XBearing += int32((numLigComponents - 1 - thisLigComponent) * int(componentExtents.Width) / numLigComponents)
 					}
-					componentExtents.Width /= int16(numLigComponents)
+					componentExtents.Width /= int32(numLigComponents)
 				}
 			}
 
@@ -322,7 +338,7 @@ func recategorizeCCC(modCCC uint8) uint8 {
 // positionMark positions a single mark relative to its base.
 // Source: HarfBuzz position_mark() in hb-ot-shape-fallback.cc:208-313
 func (s *Shaper) positionMark(buf *Buffer, baseExtents *GlyphExtents, i int, ccc uint8) {
-	markExtents, ok := s.glyf.GetGlyphExtents(buf.Info[i].GlyphID)
+	markExtents, ok := s.scaledGlyphExtents(buf.Info[i].GlyphID)
 	if !ok {
 		return
 	}
@@ -331,8 +347,10 @@ func (s *Shaper) positionMark(buf *Buffer, baseExtents *GlyphExtents, i int, ccc
 	// HarfBuzz: _hb_ot_shape_fallback_mark_position_recategorize_marks()
 	posCCC := recategorizeCCC(ccc)
 
-	// Y gap (typically 1/16 of upem)
-	yGap := int16(s.face.Upem() / 16)
+	// Y gap (1/16 em)
+	// HarfBuzz: font->y_scale / 16
+	_, yScale := s.Scale()
+	yGap := yScale / 16
 
 	pos := &buf.Pos[i]
 	pos.XOffset = 0
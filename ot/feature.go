@@ -73,6 +73,9 @@ func (f Feature) IsGlobal() bool {
 //   - "kern[3:]"       -> kern=1 from cluster 3 to end
 //   - "kern[:5]"       -> kern=1 from start to cluster 5
 //
+// Ranges are cluster values, so they count in the units the text was added
+// in: runes for AddString, bytes for AddUTF8 and code units for AddUTF16.
+//
 // Returns false if the string cannot be parsed.
 func FeatureFromString(s string) (Feature, bool) {
 	s = strings.TrimSpace(s)
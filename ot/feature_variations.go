@@ -340,3 +340,43 @@ func (fv *FeatureVariations) RecordCount() int {
 	}
 	return len(fv.records)
 }
+
+// Conditions returns the conditions of the FeatureVariationRecord at index,
+// all of which must hold for the record to match. ok is false if the record
+// has no valid ConditionSet and never matches.
+func (fv *FeatureVariations) Conditions(index int) (conditions []*Condition, ok bool) {
+	if fv == nil || index < 0 || index >= len(fv.records) || fv.records[index].conditionSet == nil {
+		return nil, false
+	}
+	return fv.records[index].conditionSet.conditions, true
+}
+
+// FeatureSubstitution replaces the lookups of a feature while the conditions
+// of its FeatureVariationRecord hold.
+type FeatureSubstitution struct {
+	FeatureIndex uint16
+	Lookups      []uint16
+}
+
+// Substitutions returns the feature substitutions of the
+// FeatureVariationRecord at index.
+func (fv *FeatureVariations) Substitutions(index int) []FeatureSubstitution {
+	if fv == nil || index < 0 || index >= len(fv.records) || fv.records[index].featureTableSubst == nil {
+		return nil
+	}
+	records := fv.records[index].featureTableSubst.records
+	subst := make([]FeatureSubstitution, len(records))
+	for i, rec := range records {
+		subst[i] = FeatureSubstitution{FeatureIndex: rec.featureIndex, Lookups: rec.lookupIndices}
+	}
+	return subst
+}
+
+// AxisRange returns the axis index and the range (F2DOT14, normalized after
+// avar) of a Format 1 condition. ok is false for other formats.
+func (c *Condition) AxisRange() (axisIndex int, min, max int16, ok bool) {
+	if c == nil || c.format != 1 {
+		return 0, 0, 0, false
+	}
+	return int(c.axisIndex), c.filterRangeMin, c.filterRangeMax, true
+}
@@ -36,6 +36,9 @@ type GDEF struct {
 
 	// Mark glyph sets (version >= 1.2, optional)
 	markGlyphSetsDef *MarkGlyphSetsDef
+
+	// Item variation store for VariationIndex tables (version >= 1.3, optional)
+	varStore *ItemVariationStore
 }
 
 // AttachList contains attachment points for glyphs.
@@ -99,6 +102,11 @@ func ParseGDEF(data []byte) (*GDEF, error) {
 		markGlyphSetsDefOffset = int(binary.BigEndian.Uint16(data[12:]))
 	}
 
+	var varStoreOffset int
+	if versionMinor >= 3 && len(data) >= 18 {
+		varStoreOffset = int(binary.BigEndian.Uint32(data[14:]))
+	}
+
 	// Parse GlyphClassDef
 	if glyphClassDefOffset != 0 {
 		cd, err := ParseClassDef(data, glyphClassDefOffset)
@@ -144,6 +152,14 @@ func ParseGDEF(data []byte) (*GDEF, error) {
 		gdef.markGlyphSetsDef = mgsd
 	}
 
+	// Parse ItemVariationStore (version >= 1.3)
+	// A broken store only disables variation deltas.
+	if varStoreOffset != 0 && varStoreOffset < len(data) {
+		if vs, err := parseItemVariationStore(data[varStoreOffset:]); err == nil {
+			gdef.varStore = vs
+		}
+	}
+
 	return gdef, nil
 }
 
@@ -310,6 +326,12 @@ func (g *GDEF) Version() (uint16, uint16) {
 	return g.versionMajor, g.versionMinor
 }
 
+// VarStore returns the item variation store of the GDEF table, or nil if
+// the table has none.
+func (g *GDEF) VarStore() *ItemVariationStore {
+	return g.varStore
+}
+
 // HasGlyphClasses returns true if the GDEF table has glyph class definitions.
 func (g *GDEF) HasGlyphClasses() bool {
 	return g.glyphClassDef != nil
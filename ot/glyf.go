@@ -151,10 +151,10 @@ func (g *Glyf) GetGlyphExtents(gid GlyphID) (GlyphExtents, bool) {
 
 	data := g.data[offset:]
 	// Skip numberOfContours (bytes 0-1)
-	xMin := int16(binary.BigEndian.Uint16(data[2:]))
-	yMin := int16(binary.BigEndian.Uint16(data[4:]))
-	xMax := int16(binary.BigEndian.Uint16(data[6:]))
-	yMax := int16(binary.BigEndian.Uint16(data[8:]))
+	xMin := int32(int16(binary.BigEndian.Uint16(data[2:])))
+	yMin := int32(int16(binary.BigEndian.Uint16(data[4:])))
+	xMax := int32(int16(binary.BigEndian.Uint16(data[6:])))
+	yMax := int32(int16(binary.BigEndian.Uint16(data[8:])))
 
 	return GlyphExtents{
 		XBearing: xMin,
@@ -205,7 +205,7 @@ func (g *Glyf) GetComponents(gid GlyphID) []GlyphID {
 		return nil
 	}
 
-	components := g.parseComposite(glyph.Data)
+	components := parseComposite(glyph.Data)
 	result := make([]GlyphID, len(components))
 	for i, comp := range components {
 		result[i] = comp.GlyphID
@@ -213,8 +213,17 @@ func (g *Glyf) GetComponents(gid GlyphID) []GlyphID {
 	return result
 }
 
+// ParseCompositeGlyph parses the components of composite glyph data.
+// Returns nil for simple glyphs.
+func ParseCompositeGlyph(data []byte) []CompositeComponent {
+	if len(data) < 10 || int16(binary.BigEndian.Uint16(data)) >= 0 {
+		return nil
+	}
+	return parseComposite(data)
+}
+
 // parseComposite parses composite glyph components.
-func (g *Glyf) parseComposite(data []byte) []CompositeComponent {
+func parseComposite(data []byte) []CompositeComponent {
 	if len(data) < 10 {
 		return nil
 	}
@@ -223,6 +232,10 @@ func (g *Glyf) parseComposite(data []byte) []CompositeComponent {
 	offset := 10
 	var components []CompositeComponent
 
+	f2dot14 := func(off int) float32 {
+		return float32(int16(binary.BigEndian.Uint16(data[off:]))) / 16384
+	}
+
 	for {
 		if offset+4 > len(data) {
 			break
@@ -235,6 +248,9 @@ func (g *Glyf) parseComposite(data []byte) []CompositeComponent {
 		comp := CompositeComponent{
 			GlyphID: glyphIndex,
 			Flags:   flags,
+			Scale:   1,
+			ScaleX:  1,
+			ScaleY:  1,
 		}
 
 		// Parse arguments
@@ -249,17 +265,40 @@ func (g *Glyf) parseComposite(data []byte) []CompositeComponent {
 			if offset+2 > len(data) {
 				break
 			}
-			comp.Arg1 = int16(int8(data[offset]))
-			comp.Arg2 = int16(int8(data[offset+1]))
+			if flags&argsAreXYValues != 0 {
+				comp.Arg1 = int16(int8(data[offset]))
+				comp.Arg2 = int16(int8(data[offset+1]))
+			} else {
+				// Point numbers are unsigned
+				comp.Arg1 = int16(data[offset])
+				comp.Arg2 = int16(data[offset+1])
+			}
 			offset += 2
 		}
 
-		// Skip transform components (we just need glyph IDs for closure)
+		// Parse transform components
 		if flags&weHaveAScale != 0 {
+			if offset+2 > len(data) {
+				break
+			}
+			comp.Scale = f2dot14(offset)
+			comp.ScaleX, comp.ScaleY = comp.Scale, comp.Scale
 			offset += 2 // F2Dot14
 		} else if flags&weHaveXYScale != 0 {
+			if offset+4 > len(data) {
+				break
+			}
+			comp.ScaleX = f2dot14(offset)
+			comp.ScaleY = f2dot14(offset + 2)
 			offset += 4 // 2 x F2Dot14
 		} else if flags&weHave2x2 != 0 {
+			if offset+8 > len(data) {
+				break
+			}
+			comp.ScaleX = f2dot14(offset)
+			comp.Scale01 = f2dot14(offset + 2)
+			comp.Scale10 = f2dot14(offset + 4)
+			comp.ScaleY = f2dot14(offset + 6)
 			offset += 8 // 4 x F2Dot14
 		}
 
@@ -273,6 +312,98 @@ func (g *Glyf) parseComposite(data []byte) []CompositeComponent {
 	return components
 }
 
+// HasXYOffset returns true if Arg1 and Arg2 are an x/y offset.
+// Otherwise they are point numbers to align (parent point, component point).
+func (c CompositeComponent) HasXYOffset() bool {
+	return c.Flags&argsAreXYValues != 0
+}
+
+// InstanceCompositeGlyph creates a new composite glyph with deltas applied
+// to the component offsets, one delta per component. Components aligned by
+// point numbers are left unchanged. The bounding box is not updated.
+func InstanceCompositeGlyph(data []byte, xDeltas, yDeltas []int16) []byte {
+	if len(data) < 10 || int16(binary.BigEndian.Uint16(data)) >= 0 {
+		return data
+	}
+
+	result := make([]byte, 10, len(data)+len(xDeltas)*2)
+	copy(result, data[:10])
+
+	offset := 10
+	for i := 0; ; i++ {
+		if offset+4 > len(data) {
+			return data
+		}
+		flags := binary.BigEndian.Uint16(data[offset:])
+		glyphIndex := binary.BigEndian.Uint16(data[offset+2:])
+		offset += 4
+
+		var arg1, arg2 int
+		argSize := 2
+		if flags&argAreWords != 0 {
+			argSize = 4
+		}
+		if offset+argSize > len(data) {
+			return data
+		}
+		if flags&argsAreXYValues == 0 {
+			// Point numbers: copy unchanged
+			result = binary.BigEndian.AppendUint16(result, flags)
+			result = binary.BigEndian.AppendUint16(result, glyphIndex)
+			result = append(result, data[offset:offset+argSize]...)
+		} else {
+			if argSize == 4 {
+				arg1 = int(int16(binary.BigEndian.Uint16(data[offset:])))
+				arg2 = int(int16(binary.BigEndian.Uint16(data[offset+2:])))
+			} else {
+				arg1 = int(int8(data[offset]))
+				arg2 = int(int8(data[offset+1]))
+			}
+			if i < len(xDeltas) && i < len(yDeltas) {
+				arg1 += int(xDeltas[i])
+				arg2 += int(yDeltas[i])
+			}
+
+			// Use byte arguments only if both offsets fit
+			if arg1 >= -128 && arg1 <= 127 && arg2 >= -128 && arg2 <= 127 {
+				flags &^= argAreWords
+				result = binary.BigEndian.AppendUint16(result, flags)
+				result = binary.BigEndian.AppendUint16(result, glyphIndex)
+				result = append(result, byte(int8(arg1)), byte(int8(arg2)))
+			} else {
+				flags |= argAreWords
+				result = binary.BigEndian.AppendUint16(result, flags)
+				result = binary.BigEndian.AppendUint16(result, glyphIndex)
+				result = binary.BigEndian.AppendUint16(result, uint16(int16(arg1)))
+				result = binary.BigEndian.AppendUint16(result, uint16(int16(arg2)))
+			}
+		}
+		offset += argSize
+
+		// Copy transform components
+		transformSize := 0
+		if flags&weHaveAScale != 0 {
+			transformSize = 2
+		} else if flags&weHaveXYScale != 0 {
+			transformSize = 4
+		} else if flags&weHave2x2 != 0 {
+			transformSize = 8
+		}
+		if offset+transformSize > len(data) {
+			return data
+		}
+		result = append(result, data[offset:offset+transformSize]...)
+		offset += transformSize
+
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+
+	// Instructions (if any) follow the last component unchanged
+	return append(result, data[offset:]...)
+}
+
 // RemapComposite creates a new composite glyph with remapped component IDs.
 func RemapComposite(data []byte, glyphMap map[GlyphID]GlyphID) []byte {
 	if len(data) < 10 {
@@ -0,0 +1,274 @@
+package ot
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Glyph outline points at a variation location
+//
+// HarfBuzz equivalent: glyf::Glyph::get_points() in OT/glyf/Glyph.hh
+//
+// The points of composite glyphs are flattened in component order, so a
+// point index addresses the same point as in TrueType instructions and in
+// format 2 anchors. gvar deltas are applied per tuple, with untouched
+// points of simple glyphs inferred per contour (IUP).
+
+// maxGlyfCompositeDepth limits the nesting of composite glyphs.
+const maxGlyfCompositeDepth = 8
+
+// scaledComponentOffset makes the component offset subject to the
+// component transform.
+const scaledComponentOffset uint16 = 0x0800
+
+// GlyphOutlinePoint is a point of a glyph outline in font units.
+type GlyphOutlinePoint struct {
+	X, Y    float64
+	OnCurve bool
+}
+
+// GlyphPoints returns the outline points of a glyph with composite
+// components resolved, together with the index of the last point of each
+// contour. If gvar is non-nil and coords (normalized F2DOT14 coordinates)
+// are not all zero, the glyph variations at that location are applied.
+// Phantom points are not included.
+func (g *Glyf) GlyphPoints(gid GlyphID, gvar *Gvar, coords []int) ([]GlyphOutlinePoint, []int) {
+	if g == nil {
+		return nil, nil
+	}
+	if gvar != nil && !gvar.HasData() {
+		gvar = nil
+	}
+	if gvar != nil {
+		varied := false
+		for _, c := range coords {
+			if c != 0 {
+				varied = true
+				break
+			}
+		}
+		if !varied {
+			gvar = nil
+		}
+	}
+	return g.glyphPoints(gid, gvar, coords, 0)
+}
+
+// GlyphExtentsAt returns the extents of a glyph at the normalized
+// coordinates coords: the bounds of all its points with the glyph
+// variations applied, rounded. Returns false for empty glyphs.
+// HarfBuzz equivalent: glyf_accelerator_t::get_extents_at() in OT/glyf/glyf.hh
+func (g *Glyf) GlyphExtentsAt(gid GlyphID, gvar *Gvar, coords []int) (GlyphExtents, bool) {
+	points, _ := g.GlyphPoints(gid, gvar, coords)
+	if len(points) == 0 {
+		return GlyphExtents{}, false
+	}
+	xMin, yMin := points[0].X, points[0].Y
+	xMax, yMax := xMin, yMin
+	for _, pt := range points[1:] {
+		xMin, xMax = math.Min(xMin, pt.X), math.Max(xMax, pt.X)
+		yMin, yMax = math.Min(yMin, pt.Y), math.Max(yMax, pt.Y)
+	}
+	xBearing := math.Round(xMin)
+	yBearing := math.Round(yMax)
+	return GlyphExtents{
+		XBearing: int32(xBearing),
+		YBearing: int32(yBearing),
+		Width:    int32(math.Round(xMax - xBearing)),
+		Height:   int32(math.Round(yMin - yBearing)),
+	}, true
+}
+
+func (g *Glyf) glyphPoints(gid GlyphID, gvar *Gvar, coords []int, depth int) ([]GlyphOutlinePoint, []int) {
+	if depth > maxGlyfCompositeDepth {
+		return nil, nil
+	}
+	data := g.GetGlyphBytes(gid)
+	if len(data) < 10 {
+		return nil, nil
+	}
+
+	numberOfContours := int(int16(binary.BigEndian.Uint16(data)))
+	if numberOfContours >= 0 {
+		return simpleGlyphPoints(gid, data, numberOfContours, gvar, coords)
+	}
+
+	components := ParseCompositeGlyph(data)
+	var dx, dy []float64
+	if gvar != nil {
+		// One delta per component offset, plus 4 phantom points
+		numPoints := len(components) + 4
+		dx, dy = glyphVariationDeltas(gvar, gid, coords, numPoints, nil, nil)
+	}
+
+	var out []GlyphOutlinePoint
+	var endPts []int
+	for i, c := range components {
+		child, childEnds := g.glyphPoints(c.GlyphID, gvar, coords, depth+1)
+		for j, pt := range child {
+			child[j].X = pt.X*float64(c.ScaleX) + pt.Y*float64(c.Scale10)
+			child[j].Y = pt.X*float64(c.Scale01) + pt.Y*float64(c.ScaleY)
+		}
+
+		var ox, oy float64
+		if c.HasXYOffset() {
+			ox, oy = float64(c.Arg1), float64(c.Arg2)
+			if dx != nil {
+				ox += dx[i]
+				oy += dy[i]
+			}
+			if c.Flags&scaledComponentOffset != 0 {
+				ox, oy = ox*float64(c.ScaleX)+oy*float64(c.Scale10), ox*float64(c.Scale01)+oy*float64(c.ScaleY)
+			}
+			if c.Flags&roundXYToGrid != 0 {
+				ox, oy = float64(roundToInt(float32(ox))), float64(roundToInt(float32(oy)))
+			}
+		} else if p1, p2 := int(uint16(c.Arg1)), int(uint16(c.Arg2)); p1 < len(out) && p2 < len(child) {
+			// Align a point of the component with a point of the glyph so far
+			ox = out[p1].X - child[p2].X
+			oy = out[p1].Y - child[p2].Y
+		}
+
+		base := len(out)
+		for _, pt := range child {
+			out = append(out, GlyphOutlinePoint{X: pt.X + ox, Y: pt.Y + oy, OnCurve: pt.OnCurve})
+		}
+		for _, e := range childEnds {
+			endPts = append(endPts, base+e)
+		}
+	}
+	return out, endPts
+}
+
+// simpleGlyphPoints returns the points of a simple glyph.
+func simpleGlyphPoints(gid GlyphID, data []byte, numberOfContours int, gvar *Gvar, coords []int) ([]GlyphOutlinePoint, []int) {
+	if numberOfContours == 0 {
+		return nil, nil
+	}
+	points, _, err := ParseSimpleGlyph(data)
+	if err != nil || 10+numberOfContours*2 > len(data) {
+		return nil, nil
+	}
+	endPts := make([]int, numberOfContours)
+	for i := range endPts {
+		endPts[i] = int(binary.BigEndian.Uint16(data[10+i*2:]))
+	}
+
+	out := make([]GlyphOutlinePoint, len(points))
+	for i, pt := range points {
+		out[i] = GlyphOutlinePoint{X: float64(pt.X), Y: float64(pt.Y), OnCurve: pt.OnCurve}
+	}
+	if gvar != nil {
+		dx, dy := glyphVariationDeltas(gvar, gid, coords, len(points)+4, points, endPts)
+		for i := range out {
+			out[i].X += dx[i]
+			out[i].Y += dy[i]
+		}
+	}
+	return out, endPts
+}
+
+// glyphVariationDeltas sums the gvar deltas of a glyph at a location.
+// numPoints includes the 4 phantom points. If points is non-nil, deltas
+// of sparse tuples are interpolated per contour, otherwise untouched
+// points keep a zero delta.
+// HarfBuzz equivalent: gvar::accelerator_t::apply_deltas_to_points() in hb-ot-var-gvar-table.hh
+func glyphVariationDeltas(gvar *Gvar, gid GlyphID, coords []int, numPoints int, points []SimpleGlyphPoint, endPts []int) (dx, dy []float64) {
+	dx = make([]float64, numPoints)
+	dy = make([]float64, numPoints)
+	for _, tv := range gvar.GetGlyphTupleVariations(gid, numPoints) {
+		scalar := float64(gvar.calculateScalar(tv.Peak, tv.Start, tv.End, coords))
+		if scalar == 0 || tv.YDeltas == nil {
+			continue
+		}
+
+		if tv.Points == nil {
+			for i := 0; i < numPoints && i < len(tv.XDeltas) && i < len(tv.YDeltas); i++ {
+				dx[i] += float64(tv.XDeltas[i]) * scalar
+				dy[i] += float64(tv.YDeltas[i]) * scalar
+			}
+			continue
+		}
+
+		tx := make([]float64, numPoints)
+		ty := make([]float64, numPoints)
+		touched := make([]bool, numPoints)
+		for i, pt := range tv.Points {
+			if pt >= numPoints || i >= len(tv.XDeltas) || i >= len(tv.YDeltas) {
+				continue
+			}
+			tx[pt] = float64(tv.XDeltas[i])
+			ty[pt] = float64(tv.YDeltas[i])
+			touched[pt] = true
+		}
+		if points != nil {
+			InferDeltas(tx, ty, touched, points, endPts)
+		}
+		for i := range tx {
+			dx[i] += tx[i] * scalar
+			dy[i] += ty[i] * scalar
+		}
+	}
+	return dx, dy
+}
+
+// InferDeltas infers the deltas of the points a sparse tuple variation does
+// not touch from the touched points of the same contour (Interpolate
+// Untouched Points). points are the original outline points and endPts the
+// last point of each contour; points outside of all contours, such as
+// phantom points, keep their delta.
+// HarfBuzz equivalent: gvar::accelerator_t::infer_deltas() in hb-ot-var-gvar-table.hh
+func InferDeltas(dx, dy []float64, touched []bool, points []SimpleGlyphPoint, endPts []int) {
+	start := 0
+	for _, end := range endPts {
+		if end >= len(points) || end < start {
+			break
+		}
+		var refs []int
+		for i := start; i <= end; i++ {
+			if touched[i] {
+				refs = append(refs, i)
+			}
+		}
+
+		switch {
+		case len(refs) == 0 || len(refs) == end-start+1:
+		case len(refs) == 1:
+			for i := start; i <= end; i++ {
+				dx[i], dy[i] = dx[refs[0]], dy[refs[0]]
+			}
+		default:
+			n := end - start + 1
+			for k, i1 := range refs {
+				i2 := refs[(k+1)%len(refs)]
+				for i := start + (i1-start+1)%n; i != i2; i = start + (i-start+1)%n {
+					dx[i] = interpolateDelta(float64(points[i].X), float64(points[i1].X), float64(points[i2].X), dx[i1], dx[i2])
+					dy[i] = interpolateDelta(float64(points[i].Y), float64(points[i1].Y), float64(points[i2].Y), dy[i1], dy[i2])
+				}
+			}
+		}
+		start = end + 1
+	}
+}
+
+// interpolateDelta interpolates the delta of coordinate c between two
+// reference coordinates c1 and c2 with deltas d1 and d2.
+func interpolateDelta(c, c1, c2, d1, d2 float64) float64 {
+	if c1 == c2 {
+		if d1 == d2 {
+			return d1
+		}
+		return 0
+	}
+	if c1 > c2 {
+		c1, c2 = c2, c1
+		d1, d2 = d2, d1
+	}
+	if c <= c1 {
+		return d1
+	}
+	if c >= c2 {
+		return d2
+	}
+	return d1 + (c-c1)*(d2-d1)/(c2-c1)
+}
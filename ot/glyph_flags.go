@@ -0,0 +1,241 @@
+package ot
+
+// Glyph flags
+//
+// HarfBuzz equivalent: hb_glyph_flags_t in hb-buffer.h and the
+// unsafe_to_break()/unsafe_to_concat() family in hb-buffer.hh
+//
+// Glyph flags tell callers where a shaped run can be reused. Lookups mark
+// the glyphs they looked at while matching: a glyph flagged unsafe to break
+// depends on glyphs of an earlier cluster, so breaking the text before it
+// and shaping both sides separately can give a different result. Unsafe to
+// concat is the weaker property for the other direction: shaping the text
+// on both sides of the glyph separately and joining the results can differ
+// from shaping the whole text.
+
+// GlyphFlags are output flags of a shaped glyph.
+// HarfBuzz equivalent: hb_glyph_flags_t in hb-buffer.h
+type GlyphFlags uint32
+
+const (
+	// GlyphFlagUnsafeToBreak means that breaking the text before this
+	// glyph and shaping the parts separately may change the result, so the
+	// text has to be reshaped on both sides of the break.
+	// HarfBuzz: HB_GLYPH_FLAG_UNSAFE_TO_BREAK
+	GlyphFlagUnsafeToBreak GlyphFlags = 1 << 0
+	// GlyphFlagUnsafeToConcat means that shaping the text before and after
+	// this glyph separately and concatenating the results may differ from
+	// shaping the whole text. It is only computed when the buffer has
+	// BufferFlagProduceUnsafeToConcat set. Unsafe to break implies unsafe
+	// to concat.
+	// HarfBuzz: HB_GLYPH_FLAG_UNSAFE_TO_CONCAT
+	GlyphFlagUnsafeToConcat GlyphFlags = 1 << 1
+
+	// GlyphFlagDefined are all defined glyph flags.
+	// HarfBuzz: HB_GLYPH_FLAG_DEFINED
+	GlyphFlagDefined = GlyphFlagUnsafeToBreak | GlyphFlagUnsafeToConcat
+)
+
+// UnsafeToBreak reports whether the glyph has GlyphFlagUnsafeToBreak set.
+func (g *GlyphInfo) UnsafeToBreak() bool {
+	return g.Flags&GlyphFlagUnsafeToBreak != 0
+}
+
+// UnsafeToConcat reports whether the glyph has GlyphFlagUnsafeToConcat set.
+func (g *GlyphInfo) UnsafeToConcat() bool {
+	return g.Flags&GlyphFlagUnsafeToConcat != 0
+}
+
+// setCluster assigns a cluster to a glyph. A glyph that changes cluster
+// takes over the given flags, since its old flags described a boundary that
+// no longer exists.
+// HarfBuzz equivalent: hb_buffer_t::set_cluster() in hb-buffer.hh
+func setCluster(info *GlyphInfo, cluster int, flags GlyphFlags) {
+	if info.Cluster != cluster {
+		info.Flags = flags & GlyphFlagDefined
+	}
+	info.Cluster = cluster
+}
+
+// unsafeToBreak marks the glyphs in [start, end) that do not belong to the
+// first or last cluster of the range as unsafe to break.
+// At ClusterLevelCharacters all glyphs not in the minimum cluster are marked.
+// HarfBuzz equivalent: hb_buffer_t::unsafe_to_break() in hb-buffer.hh
+func (b *Buffer) unsafeToBreak(start, end int) {
+	b.setGlyphFlags(GlyphFlagUnsafeToBreak|GlyphFlagUnsafeToConcat, start, end, true, false)
+}
+
+// unsafeToConcat marks all glyphs in [start, end) as unsafe to concat.
+// HarfBuzz equivalent: hb_buffer_t::unsafe_to_concat() in hb-buffer.hh
+func (b *Buffer) unsafeToConcat(start, end int) {
+	if b.Flags&BufferFlagProduceUnsafeToConcat == 0 {
+		return
+	}
+	b.setGlyphFlags(GlyphFlagUnsafeToConcat, start, end, false, false)
+}
+
+// unsafeToBreakFromOutbuffer is unsafeToBreak for a range that starts in
+// the output buffer: start is an output position, end an input position.
+// Without an output buffer both are input positions.
+// HarfBuzz equivalent: hb_buffer_t::unsafe_to_break_from_outbuffer() in hb-buffer.hh
+func (b *Buffer) unsafeToBreakFromOutbuffer(start, end int) {
+	b.setGlyphFlags(GlyphFlagUnsafeToBreak|GlyphFlagUnsafeToConcat, start, end, true, true)
+}
+
+// unsafeToConcatFromOutbuffer is unsafeToConcat for a range that starts in
+// the output buffer.
+// HarfBuzz equivalent: hb_buffer_t::unsafe_to_concat_from_outbuffer() in hb-buffer.hh
+func (b *Buffer) unsafeToConcatFromOutbuffer(start, end int) {
+	if b.Flags&BufferFlagProduceUnsafeToConcat == 0 {
+		return
+	}
+	b.setGlyphFlags(GlyphFlagUnsafeToConcat, start, end, false, true)
+}
+
+// setGlyphFlags sets flags on a glyph range. With interior set, the glyphs
+// of the cluster at either end of the range are left alone.
+// HarfBuzz equivalent: hb_buffer_t::_set_glyph_flags() in hb-buffer.hh
+func (b *Buffer) setGlyphFlags(flags GlyphFlags, start, end int, interior, fromOutBuffer bool) {
+	if end > len(b.Info) {
+		end = len(b.Info)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if interior && !fromOutBuffer && end-start < 2 {
+		return
+	}
+
+	b.ScratchFlags |= ScratchFlagHasGlyphFlags
+
+	if !fromOutBuffer || !b.haveOutput {
+		if !interior {
+			for i := start; i < end; i++ {
+				b.Info[i].Flags |= flags
+			}
+			return
+		}
+		cluster := b.findMinCluster(b.Info, start, end, -1)
+		b.setInfosGlyphFlags(b.Info, start, end, cluster, flags)
+		return
+	}
+
+	if start > b.outLen {
+		start = b.outLen
+	}
+	if end < b.Idx {
+		end = b.Idx
+	}
+	if !interior {
+		for i := start; i < b.outLen; i++ {
+			b.outInfo[i].Flags |= flags
+		}
+		for i := b.Idx; i < end; i++ {
+			b.Info[i].Flags |= flags
+		}
+		return
+	}
+	cluster := b.findMinCluster(b.Info, b.Idx, end, -1)
+	cluster = b.findMinCluster(b.outInfo, start, b.outLen, cluster)
+	b.setInfosGlyphFlags(b.outInfo, start, b.outLen, cluster, flags)
+	b.setInfosGlyphFlags(b.Info, b.Idx, end, cluster, flags)
+}
+
+// findMinCluster returns the smallest cluster of infos[start:end] and
+// cluster, where a negative cluster stands for none. Monotone cluster
+// levels only need to look at both ends.
+// HarfBuzz equivalent: hb_buffer_t::_infos_find_min_cluster() in hb-buffer.hh
+func (b *Buffer) findMinCluster(infos []GlyphInfo, start, end, cluster int) int {
+	if start >= end {
+		return cluster
+	}
+	if b.ClusterLevel == ClusterLevelCharacters {
+		for i := start; i < end; i++ {
+			if cluster < 0 || infos[i].Cluster < cluster {
+				cluster = infos[i].Cluster
+			}
+		}
+		return cluster
+	}
+	for _, c := range [2]int{infos[start].Cluster, infos[end-1].Cluster} {
+		if cluster < 0 || c < cluster {
+			cluster = c
+		}
+	}
+	return cluster
+}
+
+// setInfosGlyphFlags sets flags on the glyphs of infos[start:end] that are
+// not in the given cluster. With monotone clusters the glyphs of the
+// cluster at the other end of the range are skipped as well.
+// HarfBuzz equivalent: hb_buffer_t::_infos_set_glyph_flags() in hb-buffer.hh
+func (b *Buffer) setInfosGlyphFlags(infos []GlyphInfo, start, end, cluster int, flags GlyphFlags) {
+	if start >= end {
+		return
+	}
+	first := infos[start].Cluster
+	last := infos[end-1].Cluster
+
+	if b.ClusterLevel == ClusterLevelCharacters || (cluster != first && cluster != last) {
+		for i := start; i < end; i++ {
+			if infos[i].Cluster != cluster {
+				b.ScratchFlags |= ScratchFlagHasGlyphFlags
+				infos[i].Flags |= flags
+			}
+		}
+		return
+	}
+
+	if cluster == first {
+		for i := end; start < i && infos[i-1].Cluster != first; i-- {
+			b.ScratchFlags |= ScratchFlagHasGlyphFlags
+			infos[i-1].Flags |= flags
+		}
+	} else {
+		for i := start; i < end && infos[i].Cluster != last; i++ {
+			b.ScratchFlags |= ScratchFlagHasGlyphFlags
+			infos[i].Flags |= flags
+		}
+	}
+}
+
+// propagateFlags gives all glyphs of a cluster the union of their flags,
+// so a cluster is either safe to break before or not.
+// HarfBuzz equivalent: hb_ot_shape_propagate_flags() in hb-ot-shape.cc
+func propagateFlags(buf *Buffer) {
+	if buf.ScratchFlags&ScratchFlagHasGlyphFlags == 0 {
+		return
+	}
+	for start := 0; start < len(buf.Info); {
+		end := start + 1
+		for end < len(buf.Info) && buf.Info[end].Cluster == buf.Info[start].Cluster {
+			end++
+		}
+		var flags GlyphFlags
+		for i := start; i < end; i++ {
+			flags |= buf.Info[i].Flags & GlyphFlagDefined
+		}
+		if flags != 0 {
+			for i := start; i < end; i++ {
+				buf.Info[i].Flags |= flags
+			}
+		}
+		start = end
+	}
+}
+
+// unsafeToBreakSyllables marks every syllable unsafe to break, as the
+// syllabic shapers reorder and substitute within syllables. syllable
+// returns the syllable value of the glyph at i.
+// HarfBuzz equivalent: foreach_syllable() with unsafe_to_break() in the
+// setup_syllables() functions of the syllabic shapers
+func unsafeToBreakSyllables(buf *Buffer, syllable func(i int) uint32) {
+	for start := 0; start < len(buf.Info); {
+		end := start + 1
+		for end < len(buf.Info) && syllable(end) == syllable(start) {
+			end++
+		}
+		buf.unsafeToBreak(start, end)
+		start = end
+	}
+}
@@ -0,0 +1,208 @@
+package ot
+
+// Glyph outlines
+//
+// HarfBuzz equivalent: hb_font_draw_glyph() in hb-font.cc with the glyf,
+// CFF and CFF2 draw functions of hb-ot-font.cc
+//
+// Face.GlyphOutline draws a glyph in font units at normalized variation
+// coordinates: glyf outlines with composites resolved and gvar deltas
+// applied, CFF outlines with seac accents, CFF2 outlines with blends.
+// Shaper.GlyphOutline draws at the shaper's variation coordinates and
+// font scale, with synthetic bold and slant.
+
+// outlineTables holds the tables a glyph outline can come from.
+type outlineTables struct {
+	glyf *Glyf
+	gvar *Gvar
+	cff  *CFF
+	cff2 *CFF2
+}
+
+// draw draws a glyph from the outline table of the font. coords are
+// normalized F2DOT14 coordinates.
+func (t outlineTables) draw(glyph GlyphID, coords []int, pen Pen) error {
+	switch {
+	case t.glyf != nil:
+		return t.glyf.GlyphOutline(glyph, t.gvar, coords, pen)
+	case t.cff != nil:
+		return t.cff.GlyphOutline(glyph, pen)
+	case t.cff2 != nil:
+		return t.cff2.GlyphOutline(glyph, coords, pen)
+	}
+	return ErrTableNotFound
+}
+
+// GlyphOutline draws the outline of a glyph. Quadratic curves are drawn
+// with QuadTo; an on-curve point is implied between two off-curve points.
+// If gvar is non-nil, the glyph variations at coords (normalized F2DOT14
+// coordinates) are applied, see GlyphPoints.
+// HarfBuzz equivalent: glyf::Glyph::draw() in OT/glyf/Glyph.hh with
+// glyf_impl::path_builder_t in OT/glyf/path-builder.hh
+func (g *Glyf) GlyphOutline(gid GlyphID, gvar *Gvar, coords []int, pen Pen) error {
+	if g == nil || int(gid) >= g.loca.NumGlyphs() {
+		return ErrInvalidOffset
+	}
+	points, endPts := g.GlyphPoints(gid, gvar, coords)
+	start := 0
+	for _, end := range endPts {
+		if end >= len(points) || end < start {
+			break
+		}
+		drawQuadContour(points[start:end+1], pen)
+		start = end + 1
+	}
+	return nil
+}
+
+// drawQuadContour draws a closed TrueType contour.
+func drawQuadContour(contour []GlyphOutlinePoint, pen Pen) {
+	n := len(contour)
+	if n < 2 {
+		return
+	}
+	mid := func(a, b GlyphOutlinePoint) GlyphOutlinePoint {
+		return GlyphOutlinePoint{X: (a.X + b.X) / 2, Y: (a.Y + b.Y) / 2, OnCurve: true}
+	}
+
+	// Start at the first on-curve point, or between the last and the
+	// first point if all points are off-curve.
+	first := -1
+	for i, p := range contour {
+		if p.OnCurve {
+			first = i
+			break
+		}
+	}
+	var start GlyphOutlinePoint
+	var rest []GlyphOutlinePoint
+	if first < 0 {
+		start = mid(contour[n-1], contour[0])
+		rest = contour
+	} else {
+		start = contour[first]
+		rest = append(append(rest, contour[first+1:]...), contour[:first]...)
+	}
+	pen.MoveTo(float32(start.X), float32(start.Y))
+
+	var ctrl GlyphOutlinePoint
+	hasCtrl := false
+	for _, p := range rest {
+		switch {
+		case p.OnCurve && hasCtrl:
+			pen.QuadTo(float32(ctrl.X), float32(ctrl.Y), float32(p.X), float32(p.Y))
+			hasCtrl = false
+		case p.OnCurve:
+			pen.LineTo(float32(p.X), float32(p.Y))
+		case hasCtrl:
+			m := mid(ctrl, p)
+			pen.QuadTo(float32(ctrl.X), float32(ctrl.Y), float32(m.X), float32(m.Y))
+			ctrl = p
+		default:
+			ctrl, hasCtrl = p, true
+		}
+	}
+	if hasCtrl {
+		pen.QuadTo(float32(ctrl.X), float32(ctrl.Y), float32(start.X), float32(start.Y))
+	}
+	pen.Close()
+}
+
+// Draw replays the path into pen.
+// HarfBuzz equivalent: hb_outline_t::replay() in hb-outline.cc
+func (p Path) Draw(pen Pen) {
+	for _, seg := range p {
+		a := seg.Args
+		switch seg.Op {
+		case PathMoveTo:
+			pen.MoveTo(a[0], a[1])
+		case PathLineTo:
+			pen.LineTo(a[0], a[1])
+		case PathQuadTo:
+			pen.QuadTo(a[0], a[1], a[2], a[3])
+		case PathCubeTo:
+			pen.CubeTo(a[0], a[1], a[2], a[3], a[4], a[5])
+		case PathClose:
+			pen.Close()
+		}
+	}
+}
+
+// outlineTables returns the outline tables of the face, parsing them on
+// first use.
+func (f *Face) outlineTables() outlineTables {
+	f.outlineOnce.Do(func() {
+		font := f.Font
+		if font.HasTable(TagGlyf) && font.HasTable(TagLoca) {
+			f.outlines.glyf, _ = ParseGlyfFromFont(font)
+			if data, err := font.TableData(TagGvar); err == nil && f.outlines.glyf != nil {
+				f.outlines.gvar, _ = ParseGvar(data)
+			}
+		}
+		if data, err := font.TableData(TagCFF); err == nil {
+			f.outlines.cff, _ = ParseCFF(data)
+		}
+		if data, err := font.TableData(TagCFF2); err == nil {
+			f.outlines.cff2, _ = ParseCFF2(data)
+		}
+	})
+	return f.outlines
+}
+
+// GlyphOutline returns the outline of a glyph in font units. coords are
+// normalized F2DOT14 variation coordinates, one per fvar axis; nil selects
+// the default instance.
+// HarfBuzz equivalent: hb_font_draw_glyph() on a font without synthetic
+// bold or slant
+func (f *Face) GlyphOutline(gid GlyphID, coords []int) (Path, error) {
+	var path Path
+	err := f.DrawGlyph(gid, coords, &path)
+	return path, err
+}
+
+// DrawGlyph draws the outline of a glyph in font units into pen, see
+// GlyphOutline.
+// HarfBuzz equivalent: hb_font_draw_glyph()
+func (f *Face) DrawGlyph(gid GlyphID, coords []int, pen Pen) error {
+	return f.outlineTables().draw(gid, coords, pen)
+}
+
+// GlyphOutline returns the outline of a glyph at the current variation
+// coordinates in scaled units, with synthetic bold and slant applied.
+// HarfBuzz equivalent: hb_font_draw_glyph() in hb-font.cc
+func (s *Shaper) GlyphOutline(glyph GlyphID) (Path, error) {
+	var path Path
+	tables := outlineTables{glyf: s.glyf, gvar: s.gvar, cff: s.cff, cff2: s.cff2}
+	if err := tables.draw(glyph, s.normalizedCoordsI, &path); err != nil {
+		return nil, err
+	}
+
+	xScale, yScale := s.Scale()
+	upem := float32(s.face.Upem())
+	if fx, fy := float32(xScale)/upem, float32(yScale)/upem; fx != 1 || fy != 1 {
+		for i := range path {
+			seg := &path[i]
+			for j := 0; j < seg.numPoints(); j++ {
+				seg.Args[2*j] *= fx
+				seg.Args[2*j+1] *= fy
+			}
+		}
+	}
+
+	// HarfBuzz: synthetic branch of hb_font_t::draw_glyph() in hb-font.hh
+	xStrength, yStrength := s.emboldenStrength()
+	path.Embolden(float32(xStrength), float32(yStrength), s.emboldenInPlace)
+	path.Slant(float32(s.slantXY()))
+	return path, nil
+}
+
+// DrawGlyph draws the outline of a glyph into pen, see GlyphOutline.
+// HarfBuzz equivalent: hb_font_draw_glyph()
+func (s *Shaper) DrawGlyph(glyph GlyphID, pen Pen) error {
+	path, err := s.GlyphOutline(glyph)
+	if err != nil {
+		return err
+	}
+	path.Draw(pen)
+	return nil
+}
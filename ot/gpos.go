@@ -65,6 +65,12 @@ type ValueRecord struct {
 	YPlacement int16 // Vertical adjustment for placement
 	XAdvance   int16 // Horizontal adjustment for advance
 	YAdvance   int16 // Vertical adjustment for advance
+
+	// Device or VariationIndex tables adjusting the values (nil if absent)
+	XPlaDevice *Device
+	YPlaDevice *Device
+	XAdvDevice *Device
+	YAdvDevice *Device
 }
 
 // valueFormatLen returns the number of int16 values in a ValueRecord with the given format.
@@ -83,8 +89,9 @@ func valueFormatSize(format uint16) int {
 	return valueFormatLen(format) * 2
 }
 
-// parseValueRecord parses a ValueRecord from data.
-func parseValueRecord(data []byte, offset int, format uint16) (ValueRecord, int) {
+// parseValueRecord parses a ValueRecord from data. Device table offsets are
+// relative to base.
+func parseValueRecord(data []byte, base, offset int, format uint16) (ValueRecord, int) {
 	var vr ValueRecord
 	off := offset
 
@@ -104,27 +111,46 @@ func parseValueRecord(data []byte, offset int, format uint16) (ValueRecord, int)
 		vr.YAdvance = int16(binary.BigEndian.Uint16(data[off:]))
 		off += 2
 	}
-	// Skip device tables (we don't support variable fonts yet)
 	if format&ValueFormatXPlaDevice != 0 {
+		vr.XPlaDevice = parseValueDevice(data, base, off)
 		off += 2
 	}
 	if format&ValueFormatYPlaDevice != 0 {
+		vr.YPlaDevice = parseValueDevice(data, base, off)
 		off += 2
 	}
 	if format&ValueFormatXAdvDevice != 0 {
+		vr.XAdvDevice = parseValueDevice(data, base, off)
 		off += 2
 	}
 	if format&ValueFormatYAdvDevice != 0 {
+		vr.YAdvDevice = parseValueDevice(data, base, off)
 		off += 2
 	}
 
 	return vr, off - offset
 }
 
-// IsZero returns true if all values are zero.
+// parseValueDevice parses the Device table referenced by the offset at off.
+func parseValueDevice(data []byte, base, off int) *Device {
+	devOff := int(binary.BigEndian.Uint16(data[off:]))
+	if devOff == 0 {
+		return nil
+	}
+	return parseDevice(data, base+devOff)
+}
+
+// IsZero returns true if all values are zero and there are no Device tables.
 func (vr *ValueRecord) IsZero() bool {
 	return vr.XPlacement == 0 && vr.YPlacement == 0 &&
-		vr.XAdvance == 0 && vr.YAdvance == 0
+		vr.XAdvance == 0 && vr.YAdvance == 0 &&
+		!vr.HasDevice()
+}
+
+// HasDevice returns true if any value has a Device or VariationIndex table.
+func (vr *ValueRecord) HasDevice() bool {
+	return vr.XPlaDevice != nil || vr.YPlaDevice != nil ||
+		vr.XAdvDevice != nil || vr.YAdvDevice != nil
 }
 
 // GPOS represents the Glyph Positioning table.
@@ -380,7 +406,7 @@ func parseSinglePos(data []byte, offset int) (*SinglePos, error) {
 	switch format {
 	case 1:
 		// Single ValueRecord for all glyphs
-		vr, _ := parseValueRecord(data, offset+6, valueFormat)
+		vr, _ := parseValueRecord(data, offset, offset+6, valueFormat)
 		sp.valueRecord = vr
 		return sp, nil
 
@@ -395,7 +421,7 @@ func parseSinglePos(data []byte, offset int) (*SinglePos, error) {
 		sp.valueRecords = make([]ValueRecord, valueCount)
 		off := offset + 8
 		for i := 0; i < valueCount; i++ {
-			vr, size := parseValueRecord(data, off, valueFormat)
+			vr, size := parseValueRecord(data, offset, off, valueFormat)
 			sp.valueRecords[i] = vr
 			off += size
 		}
@@ -552,9 +578,9 @@ func parsePairPosFormat1(data []byte, offset int, pp *PairPos) (*PairPos, error)
 		for j := 0; j < pairCount; j++ {
 			records[j].SecondGlyph = GlyphID(binary.BigEndian.Uint16(data[off:]))
 			off += 2
-			records[j].Value1, _ = parseValueRecord(data, off, pp.valueFormat1)
+			records[j].Value1, _ = parseValueRecord(data, absOff, off, pp.valueFormat1)
 			off += valueFormatSize(pp.valueFormat1)
-			records[j].Value2, _ = parseValueRecord(data, off, pp.valueFormat2)
+			records[j].Value2, _ = parseValueRecord(data, absOff, off, pp.valueFormat2)
 			off += valueFormatSize(pp.valueFormat2)
 		}
 		pp.pairSets[i] = records
@@ -600,9 +626,9 @@ func parsePairPosFormat2(data []byte, offset int, pp *PairPos) (*PairPos, error)
 	for c1 := 0; c1 < int(class1Count); c1++ {
 		pp.classMatrix[c1] = make([]PairClassRecord, class2Count)
 		for c2 := 0; c2 < int(class2Count); c2++ {
-			pp.classMatrix[c1][c2].Value1, _ = parseValueRecord(data, off, pp.valueFormat1)
+			pp.classMatrix[c1][c2].Value1, _ = parseValueRecord(data, offset, off, pp.valueFormat1)
 			off += valueFormatSize(pp.valueFormat1)
-			pp.classMatrix[c1][c2].Value2, _ = parseValueRecord(data, off, pp.valueFormat2)
+			pp.classMatrix[c1][c2].Value2, _ = parseValueRecord(data, offset, off, pp.valueFormat2)
 			off += valueFormatSize(pp.valueFormat2)
 		}
 	}
@@ -647,19 +673,12 @@ func (pp *PairPos) applyFormat1(ctx *OTApplyContext, coverageIndex uint32, nextG
 	})
 
 	if idx >= len(pairSet) || pairSet[idx].SecondGlyph != nextGlyph {
+		ctx.Buffer.unsafeToConcat(ctx.Buffer.Idx, ctx.Buffer.Idx+2)
 		return false
 	}
 
 	record := &pairSet[idx]
-	ctx.AdjustPosition(ctx.Buffer.Idx, &record.Value1)
-	ctx.AdjustPosition(ctx.Buffer.Idx+1, &record.Value2)
-
-	// Advance based on valueFormat2
-	if pp.valueFormat2 != 0 {
-		ctx.Buffer.Idx += 2
-	} else {
-		ctx.Buffer.Idx++
-	}
+	pp.applyPair(ctx, &record.Value1, &record.Value2)
 	return true
 }
 
@@ -668,20 +687,36 @@ func (pp *PairPos) applyFormat2(ctx *OTApplyContext, glyph, nextGlyph GlyphID) b
 	class2 := pp.classDef2.GetClass(nextGlyph)
 
 	if class1 >= int(pp.class1Count) || class2 >= int(pp.class2Count) {
+		ctx.Buffer.unsafeToConcat(ctx.Buffer.Idx, ctx.Buffer.Idx+2)
 		return false
 	}
 
 	record := &pp.classMatrix[class1][class2]
-	ctx.AdjustPosition(ctx.Buffer.Idx, &record.Value1)
-	ctx.AdjustPosition(ctx.Buffer.Idx+1, &record.Value2)
+	pp.applyPair(ctx, &record.Value1, &record.Value2)
+	return true
+}
+
+// applyPair applies the values of a matched pair and advances past it.
+// A pair that moves a glyph is unsafe to break; so is the glyph after a
+// pair with a second value format, as the second glyph can't start a pair.
+// HarfBuzz equivalent: PairValueRecord::apply() in OT/Layout/GPOS/PairValueRecord.hh
+func (pp *PairPos) applyPair(ctx *OTApplyContext, v1, v2 *ValueRecord) {
+	idx := ctx.Buffer.Idx
+	ctx.AdjustPosition(idx, v1)
+	ctx.AdjustPosition(idx+1, v2)
+	if !v1.IsZero() || !v2.IsZero() {
+		ctx.Buffer.unsafeToBreak(idx, idx+2)
+	} else {
+		ctx.Buffer.unsafeToConcat(idx, idx+2)
+	}
 
 	// Advance based on valueFormat2
 	if pp.valueFormat2 != 0 {
+		ctx.Buffer.unsafeToBreak(idx, idx+3)
 		ctx.Buffer.Idx += 2
 	} else {
 		ctx.Buffer.Idx++
 	}
-	return true
 }
 
 // Coverage returns the coverage table for this subtable.
@@ -882,6 +917,7 @@ func (cp *CursivePos) Apply(ctx *OTApplyContext) bool {
 	// CursivePosFormat1.hh:134-141
 	prevIdx := ctx.PrevGlyph(ctx.Buffer.Idx)
 	if prevIdx < 0 {
+		ctx.Buffer.unsafeToConcat(0, ctx.Buffer.Idx+1)
 		return false
 	}
 
@@ -889,59 +925,62 @@ func (cp *CursivePos) Apply(ctx *OTApplyContext) bool {
 	// HarfBuzz: CursivePosFormat1.hh:143-149
 	prevCovIndex := cp.coverage.GetCoverage(ctx.Buffer.Info[prevIdx].GlyphID)
 	if prevCovIndex == NotCovered || int(prevCovIndex) >= len(cp.entryExitRecords) {
+		ctx.Buffer.unsafeToConcat(prevIdx, ctx.Buffer.Idx+1)
 		return false
 	}
 	if cp.entryExitRecords[prevCovIndex].ExitAnchor == nil {
+		ctx.Buffer.unsafeToConcat(prevIdx, ctx.Buffer.Idx+1)
 		return false
 	}
 	prevRecord := &cp.entryExitRecords[prevCovIndex]
 
 	i := prevIdx
 	j := ctx.Buffer.Idx
+	ctx.Buffer.unsafeToBreak(i, j+1)
 
 	// Get anchor coordinates
-	entryX := int32(thisRecord.EntryAnchor.X)
-	entryY := int32(thisRecord.EntryAnchor.Y)
-	exitX := int32(prevRecord.ExitAnchor.X)
-	exitY := int32(prevRecord.ExitAnchor.Y)
+	entryXf, entryYf := thisRecord.EntryAnchor.resolve(ctx.Device, ctx.Buffer.Info[j].GlyphID)
+	exitXf, exitYf := prevRecord.ExitAnchor.resolve(ctx.Device, ctx.Buffer.Info[i].GlyphID)
+	entryX, entryY := int32(roundAnchor(entryXf)), int32(roundAnchor(entryYf))
+	exitX, exitY := int32(roundAnchor(exitXf)), int32(roundAnchor(exitYf))
 
 	// Main-direction adjustment (affects advance widths)
 	switch ctx.Buffer.Direction {
 	case DirectionLTR:
 		// In LTR, previous glyph's advance is set to exit anchor X
-		ctx.Buffer.Pos[i].XAdvance = int16(exitX) + ctx.Buffer.Pos[i].XOffset
+		ctx.Buffer.Pos[i].XAdvance = exitX + ctx.Buffer.Pos[i].XOffset
 
 		// Current glyph's advance and offset are adjusted by entry anchor X
-		d := int16(entryX) + ctx.Buffer.Pos[j].XOffset
+		d := entryX + ctx.Buffer.Pos[j].XOffset
 		ctx.Buffer.Pos[j].XAdvance -= d
 		ctx.Buffer.Pos[j].XOffset -= d
 
 	case DirectionRTL:
 		// In RTL, previous glyph's advance and offset are adjusted by exit anchor X
-		d := int16(exitX) + ctx.Buffer.Pos[i].XOffset
+		d := exitX + ctx.Buffer.Pos[i].XOffset
 		ctx.Buffer.Pos[i].XAdvance -= d
 		ctx.Buffer.Pos[i].XOffset -= d
 
 		// Current glyph's advance is set to entry anchor X
-		ctx.Buffer.Pos[j].XAdvance = int16(entryX) + ctx.Buffer.Pos[j].XOffset
+		ctx.Buffer.Pos[j].XAdvance = entryX + ctx.Buffer.Pos[j].XOffset
 
 	case DirectionTTB:
 		// In TTB, previous glyph's advance is set to exit anchor Y
-		ctx.Buffer.Pos[i].YAdvance = int16(exitY) + ctx.Buffer.Pos[i].YOffset
+		ctx.Buffer.Pos[i].YAdvance = exitY + ctx.Buffer.Pos[i].YOffset
 
 		// Current glyph's advance and offset are adjusted by entry anchor Y
-		d := int16(entryY) + ctx.Buffer.Pos[j].YOffset
+		d := entryY + ctx.Buffer.Pos[j].YOffset
 		ctx.Buffer.Pos[j].YAdvance -= d
 		ctx.Buffer.Pos[j].YOffset -= d
 
 	case DirectionBTT:
 		// In BTT, previous glyph's advance and offset are adjusted by exit anchor Y
-		d := int16(exitY) + ctx.Buffer.Pos[i].YOffset
+		d := exitY + ctx.Buffer.Pos[i].YOffset
 		ctx.Buffer.Pos[i].YAdvance -= d
 		ctx.Buffer.Pos[i].YOffset -= d
 
 		// Current glyph's advance is set to entry anchor Y
-		ctx.Buffer.Pos[j].YAdvance = int16(entryY)
+		ctx.Buffer.Pos[j].YAdvance = entryY
 	}
 
 	// Cross-direction adjustment
@@ -949,8 +988,8 @@ func (cp *CursivePos) Apply(ctx *OTApplyContext) bool {
 	// RightToLeft flag determines which glyph is the child
 	child := i
 	parent := j
-	xOffset := int16(entryX - exitX)
-	yOffset := int16(entryY - exitY)
+	xOffset := entryX - exitX
+	yOffset := entryY - exitY
 
 	if ctx.LookupFlag&LookupFlagRightToLeft == 0 {
 		// Not RTL: swap child and parent
@@ -1388,6 +1427,7 @@ var (
 	TagAbvm = MakeTag('a', 'b', 'v', 'm') // Above-base Mark Positioning
 	TagBlwm = MakeTag('b', 'l', 'w', 'm') // Below-base Mark Positioning
 	TagDist = MakeTag('d', 'i', 's', 't') // Distances
+	TagVkrn = MakeTag('v', 'k', 'r', 'n') // Vertical Kerning
 )
 
 // --- Anchor ---
@@ -1400,7 +1440,9 @@ type Anchor struct {
 	Y      int16 // Y coordinate in design units
 	// Format 2 adds: anchorPoint (contour point index)
 	AnchorPoint uint16
-	// Format 3 adds: device table offsets (not yet implemented)
+	// Format 3 adds: Device or VariationIndex tables for X and Y (may be nil)
+	XDevice *Device
+	YDevice *Device
 }
 
 // parseAnchor parses an Anchor table from data at the given offset.
@@ -1419,17 +1461,54 @@ func parseAnchor(data []byte, offset int) (*Anchor, error) {
 		Y:      y,
 	}
 
-	if format == 2 {
+	switch format {
+	case 2:
 		if offset+8 > len(data) {
 			return nil, ErrInvalidOffset
 		}
 		anchor.AnchorPoint = binary.BigEndian.Uint16(data[offset+6:])
+	case 3:
+		if offset+10 > len(data) {
+			return nil, ErrInvalidOffset
+		}
+		// Device offsets are relative to the start of the Anchor table
+		anchor.XDevice = parseValueDevice(data, offset, offset+6)
+		anchor.YDevice = parseValueDevice(data, offset, offset+8)
 	}
-	// Format 3 with device tables could be added here
 
 	return anchor, nil
 }
 
+// resolve returns the anchor position in scaled units for a glyph.
+// Format 2 anchors use the glyph's contour point when the font is scaled to
+// a ppem size or varied, format 3 anchors add their Device deltas.
+// HarfBuzz equivalent: Anchor::get_anchor() in OT/Layout/GPOS/Anchor*.hh
+func (a *Anchor) resolve(dc *DeviceContext, gid GlyphID) (x, y float64) {
+	x, y = float64(a.X), float64(a.Y)
+	if dc == nil {
+		return x, y
+	}
+	x, y = dc.emFscale(x, dc.XScale), dc.emFscale(y, dc.YScale)
+	switch a.Format {
+	case 2:
+		if dc.ContourPoint == nil {
+			return x, y
+		}
+		if cx, cy, ok := dc.ContourPoint(gid, a.AnchorPoint); ok {
+			if dc.XPpem != 0 || len(dc.Coords) > 0 {
+				x = dc.emFscale(cx, dc.XScale)
+			}
+			if dc.YPpem != 0 || len(dc.Coords) > 0 {
+				y = dc.emFscale(cy, dc.YScale)
+			}
+		}
+	case 3:
+		x += float64(dc.XDelta(a.XDevice))
+		y += float64(dc.YDelta(a.YDevice))
+	}
+	return x, y
+}
+
 // --- MarkRecord ---
 
 // MarkRecord associates a mark glyph with a class and anchor.
@@ -1738,6 +1817,7 @@ func (m *MarkBasePos) Apply(ctx *OTApplyContext) bool {
 	// Check if we found a base
 	// HarfBuzz: lines 148-152
 	if ctx.LastBase == -1 {
+		ctx.Buffer.unsafeToConcat(0, ctx.Buffer.Idx+1)
 		return false
 	}
 
@@ -1749,6 +1829,7 @@ func (m *MarkBasePos) Apply(ctx *OTApplyContext) bool {
 	baseGlyph := ctx.Buffer.Info[baseIdx].GlyphID
 	baseIndex := m.baseCoverage.GetCoverage(baseGlyph)
 	if baseIndex == NotCovered {
+		ctx.Buffer.unsafeToConcat(baseIdx, ctx.Buffer.Idx+1)
 		return false
 	}
 
@@ -1765,11 +1846,11 @@ func (m *MarkBasePos) Apply(ctx *OTApplyContext) bool {
 
 	// Calculate position offset: mark should be placed at baseAnchor - markAnchor
 	// HarfBuzz: Scales anchor coordinates with em_fscale_x/y then rounds
-	// For now, we assume scale = upem (1:1) and just round the coordinates
-	// TODO: Implement proper scaling when Font has scale information
+	markX, markY := markAnchor.resolve(ctx.Device, ctx.Buffer.Info[ctx.Buffer.Idx].GlyphID)
+	baseX, baseY := baseAnchor.resolve(ctx.Device, ctx.Buffer.Info[baseIdx].GlyphID)
 
-	xOffset := int16(roundAnchor(float64(baseAnchor.X) - float64(markAnchor.X)))
-	yOffset := int16(roundAnchor(float64(baseAnchor.Y) - float64(markAnchor.Y)))
+	xOffset := int32(roundAnchor(baseX - markX))
+	yOffset := int32(roundAnchor(baseY - markY))
 
 	// Apply the positioning - use = not += to match HarfBuzz behavior
 	// When multiple lookups position the same mark, later lookups override earlier ones
@@ -1780,6 +1861,9 @@ func (m *MarkBasePos) Apply(ctx *OTApplyContext) bool {
 	ctx.Buffer.Pos[ctx.Buffer.Idx].AttachType = AttachTypeMark
 	ctx.Buffer.Pos[ctx.Buffer.Idx].AttachChain = int16(baseIdx - ctx.Buffer.Idx)
 
+	// HarfBuzz: MarkArray::apply()
+	ctx.Buffer.unsafeToBreak(baseIdx, ctx.Buffer.Idx+1)
+
 	ctx.Buffer.Idx++
 	return true
 }
@@ -2137,8 +2221,10 @@ func (m *MarkLigPos) ApplyWithComponent(ctx *OTApplyContext, componentIndex int)
 
 	// Calculate position offset
 	// HarfBuzz: Scales anchor coordinates with em_fscale_x/y then rounds
-	xOffset := int16(roundAnchor(float64(ligAnchor.X) - float64(markAnchor.X)))
-	yOffset := int16(roundAnchor(float64(ligAnchor.Y) - float64(markAnchor.Y)))
+	markX, markY := markAnchor.resolve(ctx.Device, ctx.Buffer.Info[ctx.Buffer.Idx].GlyphID)
+	ligX, ligY := ligAnchor.resolve(ctx.Device, ctx.Buffer.Info[ligIdx].GlyphID)
+	xOffset := int32(roundAnchor(ligX - markX))
+	yOffset := int32(roundAnchor(ligY - markY))
 
 	// Apply the positioning - use = not += to match HarfBuzz behavior
 	// When multiple lookups position the same mark, later lookups override earlier ones
@@ -2149,6 +2235,9 @@ func (m *MarkLigPos) ApplyWithComponent(ctx *OTApplyContext, componentIndex int)
 	ctx.Buffer.Pos[ctx.Buffer.Idx].AttachType = AttachTypeMark
 	ctx.Buffer.Pos[ctx.Buffer.Idx].AttachChain = int16(ligIdx - ctx.Buffer.Idx)
 
+	// HarfBuzz: MarkArray::apply()
+	ctx.Buffer.unsafeToBreak(ligIdx, ctx.Buffer.Idx+1)
+
 	ctx.Buffer.Idx++
 	return true
 }
@@ -2310,8 +2399,10 @@ func (m *MarkMarkPos) Apply(ctx *OTApplyContext) bool {
 
 	// Calculate position offset: mark1 should be placed at mark2Anchor - mark1Anchor
 	// HarfBuzz: Scales anchor coordinates with em_fscale_x/y then rounds
-	xOffset := int16(roundAnchor(float64(mark2Anchor.X) - float64(mark1Anchor.X)))
-	yOffset := int16(roundAnchor(float64(mark2Anchor.Y) - float64(mark1Anchor.Y)))
+	mark1X, mark1Y := mark1Anchor.resolve(ctx.Device, ctx.Buffer.Info[ctx.Buffer.Idx].GlyphID)
+	mark2X, mark2Y := mark2Anchor.resolve(ctx.Device, ctx.Buffer.Info[mark2Idx].GlyphID)
+	xOffset := int32(roundAnchor(mark2X - mark1X))
+	yOffset := int32(roundAnchor(mark2Y - mark1Y))
 
 	// Apply the positioning - use = not += to match HarfBuzz behavior
 	// When multiple lookups position the same mark, later lookups override earlier ones
@@ -2322,6 +2413,9 @@ func (m *MarkMarkPos) Apply(ctx *OTApplyContext) bool {
 	ctx.Buffer.Pos[ctx.Buffer.Idx].AttachType = AttachTypeMark
 	ctx.Buffer.Pos[ctx.Buffer.Idx].AttachChain = int16(mark2Idx - ctx.Buffer.Idx)
 
+	// HarfBuzz: MarkArray::apply()
+	ctx.Buffer.unsafeToBreak(mark2Idx, ctx.Buffer.Idx+1)
+
 	ctx.Buffer.Idx++
 	return true
 }
@@ -2623,6 +2717,37 @@ func parseContextPosFormat3(data []byte, offset int) (*ContextPos, error) {
 	}, nil
 }
 
+// Format returns the subtable format (1, 2 or 3).
+func (cp *ContextPos) Format() uint16 {
+	return cp.format
+}
+
+// Coverage returns the coverage table (formats 1 and 2).
+func (cp *ContextPos) Coverage() *Coverage {
+	return cp.coverage
+}
+
+// RuleSets returns the rule sets, indexed by coverage index (format 1)
+// or by input class (format 2).
+func (cp *ContextPos) RuleSets() [][]GPOSContextRule {
+	return cp.ruleSets
+}
+
+// ClassDef returns the input class definition (format 2).
+func (cp *ContextPos) ClassDef() *ClassDef {
+	return cp.classDef
+}
+
+// InputCoverages returns the input coverage tables (format 3).
+func (cp *ContextPos) InputCoverages() []*Coverage {
+	return cp.inputCoverages
+}
+
+// LookupRecords returns the lookup records (format 3).
+func (cp *ContextPos) LookupRecords() []GPOSLookupRecord {
+	return cp.lookupRecords
+}
+
 // Apply applies context positioning.
 func (cp *ContextPos) Apply(ctx *OTApplyContext) bool {
 	switch cp.format {
@@ -2651,7 +2776,10 @@ func (cp *ContextPos) applyFormat1(ctx *OTApplyContext) bool {
 
 	ruleSet := cp.ruleSets[coverageIndex]
 	for _, rule := range ruleSet {
-		if cp.matchRuleFormat1(ctx, &rule) {
+		ctx.beginMatch()
+		matched := cp.matchRuleFormat1(ctx, &rule)
+		ctx.endMatch(matched)
+		if matched {
 			inputLen := len(rule.Input) + 1
 			cp.applyLookups(ctx, rule.LookupRecords, inputLen)
 			ctx.Buffer.Idx += inputLen
@@ -2665,10 +2793,12 @@ func (cp *ContextPos) applyFormat1(ctx *OTApplyContext) bool {
 func (cp *ContextPos) matchRuleFormat1(ctx *OTApplyContext, rule *GPOSContextRule) bool {
 	inputLen := len(rule.Input) + 1
 	if ctx.Buffer.Idx+inputLen > len(ctx.Buffer.Info) {
+		ctx.matchedAt(len(ctx.Buffer.Info) - 1)
 		return false
 	}
 
 	for i, glyph := range rule.Input {
+		ctx.matchedAt(ctx.Buffer.Idx + 1 + i)
 		if ctx.Buffer.Info[ctx.Buffer.Idx+1+i].GlyphID != glyph {
 			return false
 		}
@@ -2691,7 +2821,10 @@ func (cp *ContextPos) applyFormat2(ctx *OTApplyContext) bool {
 
 	ruleSet := cp.ruleSets[classIndex]
 	for _, rule := range ruleSet {
-		if cp.matchRuleFormat2(ctx, &rule) {
+		ctx.beginMatch()
+		matched := cp.matchRuleFormat2(ctx, &rule)
+		ctx.endMatch(matched)
+		if matched {
 			inputLen := len(rule.Input) + 1
 			cp.applyLookups(ctx, rule.LookupRecords, inputLen)
 			ctx.Buffer.Idx += inputLen
@@ -2705,10 +2838,12 @@ func (cp *ContextPos) applyFormat2(ctx *OTApplyContext) bool {
 func (cp *ContextPos) matchRuleFormat2(ctx *OTApplyContext, rule *GPOSContextRule) bool {
 	inputLen := len(rule.Input) + 1
 	if ctx.Buffer.Idx+inputLen > len(ctx.Buffer.Info) {
+		ctx.matchedAt(len(ctx.Buffer.Info) - 1)
 		return false
 	}
 
 	for i, classValue := range rule.Input {
+		ctx.matchedAt(ctx.Buffer.Idx + 1 + i)
 		glyphClass := cp.classDef.GetClass(ctx.Buffer.Info[ctx.Buffer.Idx+1+i].GlyphID)
 		if glyphClass != int(classValue) {
 			return false
@@ -2725,16 +2860,22 @@ func (cp *ContextPos) applyFormat3(ctx *OTApplyContext) bool {
 		return false
 	}
 
+	ctx.beginMatch()
 	if ctx.Buffer.Idx+inputLen > len(ctx.Buffer.Info) {
+		ctx.matchedAt(len(ctx.Buffer.Info) - 1)
+		ctx.endMatch(false)
 		return false
 	}
 
 	// Check all input coverages
 	for i, cov := range cp.inputCoverages {
+		ctx.matchedAt(ctx.Buffer.Idx + i)
 		if cov.GetCoverage(ctx.Buffer.Info[ctx.Buffer.Idx+i].GlyphID) == NotCovered {
+			ctx.endMatch(false)
 			return false
 		}
 	}
+	ctx.endMatch(true)
 
 	cp.applyLookups(ctx, cp.lookupRecords, inputLen)
 	ctx.Buffer.Idx += inputLen
@@ -3136,6 +3277,57 @@ func parseChainContextPosFormat3(data []byte, offset int) (*ChainContextPos, err
 	}, nil
 }
 
+// Format returns the subtable format (1, 2 or 3).
+func (ccp *ChainContextPos) Format() uint16 {
+	return ccp.format
+}
+
+// Coverage returns the coverage table (formats 1 and 2).
+func (ccp *ChainContextPos) Coverage() *Coverage {
+	return ccp.coverage
+}
+
+// ChainRuleSets returns the rule sets, indexed by coverage index (format 1)
+// or by input class (format 2).
+func (ccp *ChainContextPos) ChainRuleSets() [][]GPOSChainRule {
+	return ccp.chainRuleSets
+}
+
+// BacktrackClassDef returns the backtrack class definition (format 2).
+func (ccp *ChainContextPos) BacktrackClassDef() *ClassDef {
+	return ccp.backtrackClassDef
+}
+
+// InputClassDef returns the input class definition (format 2).
+func (ccp *ChainContextPos) InputClassDef() *ClassDef {
+	return ccp.inputClassDef
+}
+
+// LookaheadClassDef returns the lookahead class definition (format 2).
+func (ccp *ChainContextPos) LookaheadClassDef() *ClassDef {
+	return ccp.lookaheadClassDef
+}
+
+// BacktrackCoverages returns the backtrack coverage tables (format 3).
+func (ccp *ChainContextPos) BacktrackCoverages() []*Coverage {
+	return ccp.backtrackCoverages
+}
+
+// InputCoverages returns the input coverage tables (format 3).
+func (ccp *ChainContextPos) InputCoverages() []*Coverage {
+	return ccp.inputCoverages
+}
+
+// LookaheadCoverages returns the lookahead coverage tables (format 3).
+func (ccp *ChainContextPos) LookaheadCoverages() []*Coverage {
+	return ccp.lookaheadCoverages
+}
+
+// LookupRecords returns the lookup records (format 3).
+func (ccp *ChainContextPos) LookupRecords() []GPOSLookupRecord {
+	return ccp.lookupRecords
+}
+
 // Apply applies chaining context positioning.
 func (ccp *ChainContextPos) Apply(ctx *OTApplyContext) bool {
 	switch ccp.format {
@@ -3164,7 +3356,10 @@ func (ccp *ChainContextPos) applyFormat1(ctx *OTApplyContext) bool {
 
 	ruleSet := ccp.chainRuleSets[coverageIndex]
 	for _, rule := range ruleSet {
-		if ccp.matchRuleFormat1(ctx, &rule) {
+		ctx.beginMatch()
+		matched := ccp.matchRuleFormat1(ctx, &rule)
+		ctx.endMatch(matched)
+		if matched {
 			inputLen := len(rule.Input) + 1
 			ccp.applyLookups(ctx, rule.LookupRecords, inputLen)
 			ctx.Buffer.Idx += inputLen
@@ -3180,6 +3375,7 @@ func (ccp *ChainContextPos) matchRuleFormat1(ctx *OTApplyContext, rule *GPOSChai
 
 	// Check if enough glyphs for input sequence
 	if ctx.Buffer.Idx+inputLen > len(ctx.Buffer.Info) {
+		ctx.matchedAt(len(ctx.Buffer.Info) - 1)
 		return false
 	}
 
@@ -3189,6 +3385,7 @@ func (ccp *ChainContextPos) matchRuleFormat1(ctx *OTApplyContext, rule *GPOSChai
 		if backIdx < 0 {
 			return false
 		}
+		ctx.matchedAt(backIdx)
 		if ctx.Buffer.Info[backIdx].GlyphID != glyph {
 			return false
 		}
@@ -3196,6 +3393,7 @@ func (ccp *ChainContextPos) matchRuleFormat1(ctx *OTApplyContext, rule *GPOSChai
 
 	// Check input sequence (starting from second glyph)
 	for i, glyph := range rule.Input {
+		ctx.matchedAt(ctx.Buffer.Idx + 1 + i)
 		if ctx.Buffer.Info[ctx.Buffer.Idx+1+i].GlyphID != glyph {
 			return false
 		}
@@ -3206,8 +3404,10 @@ func (ccp *ChainContextPos) matchRuleFormat1(ctx *OTApplyContext, rule *GPOSChai
 	for i, glyph := range rule.Lookahead {
 		lookaheadIdx := lookaheadStart + i
 		if lookaheadIdx >= len(ctx.Buffer.Info) {
+			ctx.matchedAt(len(ctx.Buffer.Info) - 1)
 			return false
 		}
+		ctx.matchedAt(lookaheadIdx)
 		if ctx.Buffer.Info[lookaheadIdx].GlyphID != glyph {
 			return false
 		}
@@ -3230,7 +3430,10 @@ func (ccp *ChainContextPos) applyFormat2(ctx *OTApplyContext) bool {
 
 	ruleSet := ccp.chainRuleSets[classIndex]
 	for _, rule := range ruleSet {
-		if ccp.matchRuleFormat2(ctx, &rule) {
+		ctx.beginMatch()
+		matched := ccp.matchRuleFormat2(ctx, &rule)
+		ctx.endMatch(matched)
+		if matched {
 			inputLen := len(rule.Input) + 1
 			ccp.applyLookups(ctx, rule.LookupRecords, inputLen)
 			ctx.Buffer.Idx += inputLen
@@ -3246,6 +3449,7 @@ func (ccp *ChainContextPos) matchRuleFormat2(ctx *OTApplyContext, rule *GPOSChai
 
 	// Check if enough glyphs for input sequence
 	if ctx.Buffer.Idx+inputLen > len(ctx.Buffer.Info) {
+		ctx.matchedAt(len(ctx.Buffer.Info) - 1)
 		return false
 	}
 
@@ -3255,6 +3459,7 @@ func (ccp *ChainContextPos) matchRuleFormat2(ctx *OTApplyContext, rule *GPOSChai
 		if backIdx < 0 {
 			return false
 		}
+		ctx.matchedAt(backIdx)
 		glyphClass := ccp.backtrackClassDef.GetClass(ctx.Buffer.Info[backIdx].GlyphID)
 		if glyphClass != int(classValue) {
 			return false
@@ -3263,6 +3468,7 @@ func (ccp *ChainContextPos) matchRuleFormat2(ctx *OTApplyContext, rule *GPOSChai
 
 	// Check input classes (starting from second glyph)
 	for i, classValue := range rule.Input {
+		ctx.matchedAt(ctx.Buffer.Idx + 1 + i)
 		glyphClass := ccp.inputClassDef.GetClass(ctx.Buffer.Info[ctx.Buffer.Idx+1+i].GlyphID)
 		if glyphClass != int(classValue) {
 			return false
@@ -3274,8 +3480,10 @@ func (ccp *ChainContextPos) matchRuleFormat2(ctx *OTApplyContext, rule *GPOSChai
 	for i, classValue := range rule.Lookahead {
 		lookaheadIdx := lookaheadStart + i
 		if lookaheadIdx >= len(ctx.Buffer.Info) {
+			ctx.matchedAt(len(ctx.Buffer.Info) - 1)
 			return false
 		}
+		ctx.matchedAt(lookaheadIdx)
 		glyphClass := ccp.lookaheadClassDef.GetClass(ctx.Buffer.Info[lookaheadIdx].GlyphID)
 		if glyphClass != int(classValue) {
 			return false
@@ -3315,6 +3523,7 @@ func (ccp *ChainContextPos) applyFormat3(ctx *OTApplyContext) bool {
 
 	// Match remaining input sequence by coverage using skippy-iteration
 	// HarfBuzz: uses iter_input (context_match=false) with coverage matching
+	ctx.beginMatch()
 	bufLen := len(ctx.Buffer.Info)
 	pos := ctx.Buffer.Idx
 	for i := 1; i < inputLen; i++ {
@@ -3322,6 +3531,7 @@ func (ccp *ChainContextPos) applyFormat3(ctx *OTApplyContext) bool {
 		found := false
 		for pos < bufLen-1 {
 			pos++
+			ctx.matchedAt(pos)
 			skip := ctx.MaySkip(pos, false) // context_match=false for input matching
 			if skip == SkipYes {
 				continue // Definitely skip (e.g., ignored by LookupFlag)
@@ -3337,9 +3547,11 @@ func (ccp *ChainContextPos) applyFormat3(ctx *OTApplyContext) bool {
 				continue // Skip default ignorables if not in coverage
 			}
 			// Not in coverage and can't skip -> fail
+			ctx.endMatch(false)
 			return false
 		}
 		if !found {
+			ctx.endMatch(false)
 			return false
 		}
 		matchPositions[i] = pos
@@ -3357,6 +3569,7 @@ func (ccp *ChainContextPos) applyFormat3(ctx *OTApplyContext) bool {
 		found := false
 		for lookaheadPos < bufLen-1 {
 			lookaheadPos++
+			ctx.matchedAt(lookaheadPos)
 			skip := ctx.MaySkip(lookaheadPos, true) // context_match=true
 			if skip == SkipYes {
 				continue // Definitely skip (e.g., ignored by LookupFlag)
@@ -3372,9 +3585,11 @@ func (ccp *ChainContextPos) applyFormat3(ctx *OTApplyContext) bool {
 				continue // Skip default ignorables (like CGJ) if not in coverage
 			}
 			// Not in coverage and can't skip -> fail
+			ctx.endMatch(false)
 			return false
 		}
 		if !found {
+			ctx.endMatch(false)
 			return false
 		}
 	}
@@ -3390,6 +3605,7 @@ func (ccp *ChainContextPos) applyFormat3(ctx *OTApplyContext) bool {
 		found := false
 		for backtrackPos > 0 {
 			backtrackPos--
+			ctx.matchedAt(backtrackPos)
 			info := &ctx.Buffer.Info[backtrackPos]
 			skip := ctx.MaySkipInfo(info, true) // context_match=true
 			if skip == SkipYes {
@@ -3405,13 +3621,17 @@ func (ccp *ChainContextPos) applyFormat3(ctx *OTApplyContext) bool {
 				continue // Skip default ignorables (like CGJ) if not in coverage
 			}
 			// Not in coverage and can't skip -> fail
+			ctx.endMatch(false)
 			return false
 		}
 		if !found {
+			ctx.endMatch(false)
 			return false
 		}
 	}
 
+	ctx.endMatch(true)
+
 	// Store match positions for use in applyLookups
 	ctx.MatchPositions = matchPositions
 
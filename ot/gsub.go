@@ -962,6 +962,37 @@ func (cs *ContextSubst) Apply(ctx *OTApplyContext) int {
 	}
 }
 
+// Format returns the subtable format (1, 2 or 3).
+func (cs *ContextSubst) Format() uint16 {
+	return cs.format
+}
+
+// Coverage returns the coverage table (formats 1 and 2).
+func (cs *ContextSubst) Coverage() *Coverage {
+	return cs.coverage
+}
+
+// RuleSets returns the rule sets, indexed by coverage index (format 1)
+// or by input class (format 2).
+func (cs *ContextSubst) RuleSets() [][]ContextRule {
+	return cs.ruleSets
+}
+
+// ClassDef returns the input class definition (format 2).
+func (cs *ContextSubst) ClassDef() *ClassDef {
+	return cs.classDef
+}
+
+// InputCoverages returns the input coverage tables (format 3).
+func (cs *ContextSubst) InputCoverages() []*Coverage {
+	return cs.inputCoverages
+}
+
+// LookupRecords returns the lookup records (format 3).
+func (cs *ContextSubst) LookupRecords() []LookupRecord {
+	return cs.lookupRecords
+}
+
 // applyFormat1 applies ContextSubstFormat1 (simple glyph context).
 func (cs *ContextSubst) applyFormat1(ctx *OTApplyContext) int {
 	glyph := ctx.Buffer.Info[ctx.Buffer.Idx].GlyphID
@@ -976,7 +1007,10 @@ func (cs *ContextSubst) applyFormat1(ctx *OTApplyContext) int {
 
 	rules := cs.ruleSets[coverageIndex]
 	for _, rule := range rules {
-		if cs.matchRuleFormat1(ctx, &rule) {
+		ctx.beginMatch()
+		matched := cs.matchRuleFormat1(ctx, &rule)
+		ctx.endMatch(matched)
+		if matched {
 			cs.applyLookups(ctx, rule.LookupRecords, len(rule.Input)+1)
 			return 1
 		}
@@ -998,8 +1032,10 @@ func (cs *ContextSubst) matchRuleFormat1(ctx *OTApplyContext, rule *ContextRule)
 		// NextGlyph(pos) searches from pos+1, so we pass the current position
 		pos = ctx.NextGlyph(pos)
 		if pos == -1 {
+			ctx.matchedAt(len(ctx.Buffer.Info) - 1)
 			return false
 		}
+		ctx.matchedAt(pos)
 		if ctx.Buffer.Info[pos].GlyphID != g {
 			return false
 		}
@@ -1025,7 +1061,10 @@ func (cs *ContextSubst) applyFormat2(ctx *OTApplyContext) int {
 
 	rules := cs.ruleSets[inputClass]
 	for _, rule := range rules {
-		if cs.matchRuleFormat2(ctx, &rule) {
+		ctx.beginMatch()
+		matched := cs.matchRuleFormat2(ctx, &rule)
+		ctx.endMatch(matched)
+		if matched {
 			cs.applyLookups(ctx, rule.LookupRecords, len(rule.Input)+1)
 			return 1
 		}
@@ -1047,8 +1086,10 @@ func (cs *ContextSubst) matchRuleFormat2(ctx *OTApplyContext, rule *ContextRule)
 		// NextGlyph(pos) searches from pos+1, so we pass the current position
 		pos = ctx.NextGlyph(pos)
 		if pos == -1 {
+			ctx.matchedAt(len(ctx.Buffer.Info) - 1)
 			return false
 		}
+		ctx.matchedAt(pos)
 		glyphClass := cs.classDef.GetClass(ctx.Buffer.Info[pos].GlyphID)
 		if glyphClass != int(classID) {
 			return false
@@ -1079,17 +1120,23 @@ func (cs *ContextSubst) applyFormat3(ctx *OTApplyContext) int {
 	matchPositions[0] = ctx.Buffer.Idx
 
 	// Match remaining input sequence by coverage using skippy-iteration
+	ctx.beginMatch()
 	pos := ctx.Buffer.Idx
 	for i := 1; i < inputLen; i++ {
 		pos = ctx.NextGlyph(pos)
 		if pos < 0 {
+			ctx.matchedAt(len(ctx.Buffer.Info) - 1)
+			ctx.endMatch(false)
 			return 0
 		}
+		ctx.matchedAt(pos)
 		if cs.inputCoverages[i].GetCoverage(ctx.Buffer.Info[pos].GlyphID) == NotCovered {
+			ctx.endMatch(false)
 			return 0
 		}
 		matchPositions[i] = pos
 	}
+	ctx.endMatch(true)
 
 	// Store match positions for use in applyLookups
 	ctx.MatchPositions = matchPositions
@@ -1391,8 +1438,12 @@ func (l *LigatureSubst) Apply(ctx *OTApplyContext) int {
 
 	// Try each ligature in order of preference
 	for _, lig := range ligSet {
+		ctx.beginMatch()
 		matchedPositions := l.matchLigature(ctx, &lig)
-		if matchedPositions != nil {
+		if matchedPositions == nil {
+			// HarfBuzz: Ligature::apply() marks the examined glyphs unsafe to concat
+			ctx.endMatch(false)
+		} else {
 			// Apply ligature - replace all matched positions with the ligature glyph
 			// The matchedPositions includes all positions that should be consumed
 			// (including default ignorables that were skipped during matching)
@@ -1429,8 +1480,10 @@ func (l *LigatureSubst) matchLigature(ctx *OTApplyContext, lig *Ligature) []int
 		}
 
 		if pos >= len(ctx.Buffer.Info) {
+			ctx.matchedAt(pos - 1)
 			return nil // Not enough glyphs
 		}
+		ctx.matchedAt(pos)
 
 		// Per-syllable check: all matched glyphs must be in the same syllable
 		// HarfBuzz equivalent: per_syllable && syllable != info.syllable() in may_match()
@@ -1610,6 +1663,53 @@ func (f *FeatureList) GetFeature(index int) (*FeatureRecord, error) {
 	return feat, nil
 }
 
+// FeatureParams returns the FeatureParams table of the feature at the given
+// index, or nil if it has none or its format is unknown. The formats of
+// 'size', 'ss01'-'ss20' and 'cv01'-'cv99' are known.
+func (f *FeatureList) FeatureParams(index int) []byte {
+	if index < 0 || index >= f.count {
+		return nil
+	}
+
+	recordOff := f.offset + 2 + index*6
+	tag := Tag(binary.BigEndian.Uint32(f.data[recordOff:]))
+	absOff := f.offset + int(binary.BigEndian.Uint16(f.data[recordOff+4:]))
+	if absOff+2 > len(f.data) {
+		return nil
+	}
+	paramsOff := int(binary.BigEndian.Uint16(f.data[absOff:]))
+	if paramsOff == 0 {
+		return nil
+	}
+	if absOff+paramsOff > len(f.data) {
+		return nil
+	}
+	params := f.data[absOff+paramsOff:]
+
+	var size int
+	switch t := tag.String(); {
+	case t == "size":
+		// designSize, subfamilyIdentifier, subfamilyNameID, rangeStart, rangeEnd
+		size = 10
+	case t >= "ss01" && t <= "ss20":
+		// version, uiNameID
+		size = 4
+	case t >= "cv01" && t <= "cv99":
+		// format, 4 name IDs, numNamedParameters, firstParamUILabelNameID,
+		// charCount, character[charCount] (uint24)
+		if len(params) < 14 {
+			return nil
+		}
+		size = 14 + 3*int(binary.BigEndian.Uint16(params[12:]))
+	default:
+		return nil
+	}
+	if len(params) < size {
+		return nil
+	}
+	return params[:size]
+}
+
 // FindFeature finds a feature by tag and returns its lookup indices.
 func (f *FeatureList) FindFeature(tag Tag) []uint16 {
 	// Collect unique lookup indices from all features with matching tag
@@ -2009,6 +2109,65 @@ func (sl *ScriptList) GetDefaultScript() *LangSys {
 	return nil
 }
 
+// ScriptRecord holds a script tag together with all of its language systems.
+type ScriptRecord struct {
+	Tag            Tag
+	DefaultLangSys *LangSys // nil if the script has no default LangSys
+	LangSys        []LangSysRecord
+}
+
+// LangSysRecord holds a language tag and its LangSys table.
+type LangSysRecord struct {
+	Tag     Tag
+	LangSys *LangSys
+}
+
+// Count returns the number of scripts in the ScriptList.
+func (sl *ScriptList) Count() int {
+	return sl.count
+}
+
+// Scripts returns all script records in font order, including every
+// language-specific LangSys. This is mainly used by the subsetter, which
+// has to rebuild the complete ScriptList.
+func (sl *ScriptList) Scripts() []ScriptRecord {
+	scripts := make([]ScriptRecord, 0, sl.count)
+	for i := 0; i < sl.count; i++ {
+		recOff := sl.offset + 2 + i*6
+		rec := ScriptRecord{Tag: Tag(binary.BigEndian.Uint32(sl.data[recOff:]))}
+
+		scriptOff := sl.offset + int(binary.BigEndian.Uint16(sl.data[recOff+4:]))
+		if scriptOff+4 > len(sl.data) {
+			continue
+		}
+
+		defaultLangSysOff := int(binary.BigEndian.Uint16(sl.data[scriptOff:]))
+		if defaultLangSysOff != 0 {
+			rec.DefaultLangSys = sl.parseLangSys(scriptOff + defaultLangSysOff)
+		}
+
+		langSysCount := int(binary.BigEndian.Uint16(sl.data[scriptOff+2:]))
+		for j := 0; j < langSysCount; j++ {
+			langRecOff := scriptOff + 4 + j*6
+			if langRecOff+6 > len(sl.data) {
+				break
+			}
+			langSysOff := int(binary.BigEndian.Uint16(sl.data[langRecOff+4:]))
+			ls := sl.parseLangSys(scriptOff + langSysOff)
+			if ls == nil {
+				continue
+			}
+			rec.LangSys = append(rec.LangSys, LangSysRecord{
+				Tag:     Tag(binary.BigEndian.Uint32(sl.data[langRecOff:])),
+				LangSys: ls,
+			})
+		}
+
+		scripts = append(scripts, rec)
+	}
+	return scripts
+}
+
 // parseScript parses a Script table and returns its default LangSys.
 func (sl *ScriptList) parseScript(off int) *LangSys {
 	if off+4 > len(sl.data) {
@@ -2516,7 +2675,11 @@ func (g *GSUB) ApplyFeatureToBufferWithMaskAndVariations(tag Tag, buf *Buffer, g
 	sort.Ints(sorted)
 
 	for _, lookupIdx := range sorted {
+		if !buf.message(font, "start GSUB lookup %d feature '%s'", lookupIdx, tag) {
+			continue
+		}
 		g.ApplyLookupToBufferWithMask(lookupIdx, buf, gdef, featureMask, font)
+		buf.message(font, "end GSUB lookup %d feature '%s'", lookupIdx, tag)
 	}
 }
 
@@ -2565,7 +2728,11 @@ func (g *GSUB) ApplyFeatureToBufferRangeWithMask(tag Tag, buf *Buffer, gdef *GDE
 	sort.Ints(sorted)
 
 	for _, lookupIdx := range sorted {
+		if !buf.message(font, "start GSUB lookup %d feature '%s'", lookupIdx, tag) {
+			continue
+		}
 		g.ApplyLookupToBufferRangeWithMask(lookupIdx, buf, gdef, featureMask, font, start, end)
+		buf.message(font, "end GSUB lookup %d feature '%s'", lookupIdx, tag)
 		// Update end if buffer length changed (e.g., ligature or multiple substitution)
 		// We need to find where this syllable ends now
 		if start < len(buf.Info) {
@@ -2743,6 +2910,9 @@ var (
 	TagRlig = MakeTag('r', 'l', 'i', 'g') // Required Ligatures
 	TagSmcp = MakeTag('s', 'm', 'c', 'p') // Small Capitals
 	TagCalt = MakeTag('c', 'a', 'l', 't') // Contextual Alternates
+	TagVert = MakeTag('v', 'e', 'r', 't') // Vertical Alternates
+	TagVrt2 = MakeTag('v', 'r', 't', '2') // Vertical Alternates and Rotation
+	TagVkna = MakeTag('v', 'k', 'n', 'a') // Vertical Kana Alternates
 )
 
 // --- LookupRecord ---
@@ -3112,6 +3282,57 @@ func (ccs *ChainContextSubst) Apply(ctx *OTApplyContext) int {
 	}
 }
 
+// Format returns the subtable format (1, 2 or 3).
+func (ccs *ChainContextSubst) Format() uint16 {
+	return ccs.format
+}
+
+// Coverage returns the coverage table (formats 1 and 2).
+func (ccs *ChainContextSubst) Coverage() *Coverage {
+	return ccs.coverage
+}
+
+// ChainRuleSets returns the rule sets, indexed by coverage index (format 1)
+// or by input class (format 2).
+func (ccs *ChainContextSubst) ChainRuleSets() [][]ChainRule {
+	return ccs.chainRuleSets
+}
+
+// BacktrackClassDef returns the backtrack class definition (format 2).
+func (ccs *ChainContextSubst) BacktrackClassDef() *ClassDef {
+	return ccs.backtrackClassDef
+}
+
+// InputClassDef returns the input class definition (format 2).
+func (ccs *ChainContextSubst) InputClassDef() *ClassDef {
+	return ccs.inputClassDef
+}
+
+// LookaheadClassDef returns the lookahead class definition (format 2).
+func (ccs *ChainContextSubst) LookaheadClassDef() *ClassDef {
+	return ccs.lookaheadClassDef
+}
+
+// BacktrackCoverages returns the backtrack coverage tables (format 3).
+func (ccs *ChainContextSubst) BacktrackCoverages() []*Coverage {
+	return ccs.backtrackCoverages
+}
+
+// InputCoverages returns the input coverage tables (format 3).
+func (ccs *ChainContextSubst) InputCoverages() []*Coverage {
+	return ccs.inputCoverages
+}
+
+// LookaheadCoverages returns the lookahead coverage tables (format 3).
+func (ccs *ChainContextSubst) LookaheadCoverages() []*Coverage {
+	return ccs.lookaheadCoverages
+}
+
+// LookupRecords returns the lookup records (format 3).
+func (ccs *ChainContextSubst) LookupRecords() []LookupRecord {
+	return ccs.lookupRecords
+}
+
 // wouldApply checks if this ChainContextSubst would apply to the given glyph sequence.
 // HarfBuzz equivalent: chain_context_would_apply_lookup() in hb-ot-layout-gsubgpos.hh:3126-3141
 //
@@ -3251,7 +3472,10 @@ func (ccs *ChainContextSubst) applyFormat1(ctx *OTApplyContext) int {
 
 	rules := ccs.chainRuleSets[coverageIndex]
 	for _, rule := range rules {
-		if ccs.matchRuleFormat1(ctx, &rule) {
+		ctx.beginMatch()
+		matched := ccs.matchRuleFormat1(ctx, &rule)
+		ctx.endMatch(matched)
+		if matched {
 			ccs.applyLookups(ctx, rule.LookupRecords, len(rule.Input)+1)
 			return 1
 		}
@@ -3265,33 +3489,45 @@ func (ccs *ChainContextSubst) matchRuleFormat1(ctx *OTApplyContext, rule *ChainR
 	// Check if enough glyphs for input sequence
 	inputLen := len(rule.Input) + 1 // +1 for first glyph (covered by coverage)
 	if ctx.Buffer.Idx+inputLen > len(ctx.Buffer.Info) {
+		ctx.matchedAt(len(ctx.Buffer.Info) - 1)
 		return false
 	}
 
 	// Match input sequence (starting from second glyph)
 	for i, g := range rule.Input {
+		ctx.matchedAt(ctx.Buffer.Idx + 1 + i)
 		if ctx.Buffer.Info[ctx.Buffer.Idx+1+i].GlyphID != g {
 			return false
 		}
 	}
 
-	// Check lookahead
+	// Check lookahead, continuing in the post-context at the end of the buffer
 	lookaheadStart := ctx.Buffer.Idx + inputLen
-	if lookaheadStart+len(rule.Lookahead) > len(ctx.Buffer.Info) {
-		return false
-	}
 	for i, g := range rule.Lookahead {
+		if lookaheadStart+i >= len(ctx.Buffer.Info) {
+			ctx.matchedAt(len(ctx.Buffer.Info) - 1)
+			if !ctx.matchPostContext(i, len(rule.Lookahead), func(j int, gid GlyphID) bool { return gid == rule.Lookahead[j] }) {
+				return false
+			}
+			break
+		}
+		ctx.matchedAt(lookaheadStart + i)
 		if ctx.Buffer.Info[lookaheadStart+i].GlyphID != g {
 			return false
 		}
 	}
 
-	// Check backtrack (in reverse order)
-	if ctx.Buffer.Idx < len(rule.Backtrack) {
-		return false
-	}
+	// Check backtrack (in reverse order), continuing in the pre-context
 	for i, g := range rule.Backtrack {
+		if ctx.Buffer.Idx-1-i < 0 {
+			ctx.matchedAt(0)
+			if !ctx.matchPreContext(i, len(rule.Backtrack), func(j int, gid GlyphID) bool { return gid == rule.Backtrack[j] }) {
+				return false
+			}
+			break
+		}
 		// Backtrack[0] is immediately before current position
+		ctx.matchedAt(ctx.Buffer.Idx - 1 - i)
 		if ctx.Buffer.Info[ctx.Buffer.Idx-1-i].GlyphID != g {
 			return false
 		}
@@ -3322,7 +3558,10 @@ func (ccs *ChainContextSubst) applyFormat2(ctx *OTApplyContext) int {
 
 	rules := ccs.chainRuleSets[inputClass]
 	for _, rule := range rules {
-		if ccs.matchRuleFormat2(ctx, &rule) {
+		ctx.beginMatch()
+		matched := ccs.matchRuleFormat2(ctx, &rule)
+		ctx.endMatch(matched)
+		if matched {
 			ccs.applyLookups(ctx, rule.LookupRecords, len(rule.Input)+1)
 			return 1
 		}
@@ -3349,8 +3588,10 @@ func (ccs *ChainContextSubst) matchRuleFormat2(ctx *OTApplyContext, rule *ChainR
 	for i, classID := range rule.Input {
 		pos = ctx.NextGlyph(pos)
 		if pos < 0 {
+			ctx.matchedAt(len(ctx.Buffer.Info) - 1)
 			return false
 		}
+		ctx.matchedAt(pos)
 		glyphClass := ccs.inputClassDef.GetClass(ctx.Buffer.Info[pos].GlyphID)
 		if glyphClass != int(classID) {
 			return false
@@ -3361,11 +3602,19 @@ func (ccs *ChainContextSubst) matchRuleFormat2(ctx *OTApplyContext, rule *ChainR
 	// Check lookahead by class (continue from last input position)
 	// HarfBuzz: uses iter_context (context_match=true) - mask is NOT checked!
 	lookaheadPos := pos
-	for _, classID := range rule.Lookahead {
+	for i, classID := range rule.Lookahead {
 		lookaheadPos = ctx.NextContextGlyph(lookaheadPos) // context_match=true
 		if lookaheadPos < 0 {
-			return false
+			// Continue in the post-context
+			ctx.matchedAt(len(ctx.Buffer.Info) - 1)
+			if !ctx.matchPostContext(i, len(rule.Lookahead), func(j int, gid GlyphID) bool {
+				return ccs.lookaheadClassDef.GetClass(gid) == int(rule.Lookahead[j])
+			}) {
+				return false
+			}
+			break
 		}
+		ctx.matchedAt(lookaheadPos)
 		glyphClass := ccs.lookaheadClassDef.GetClass(ctx.Buffer.Info[lookaheadPos].GlyphID)
 		if glyphClass != int(classID) {
 			return false
@@ -3375,11 +3624,19 @@ func (ccs *ChainContextSubst) matchRuleFormat2(ctx *OTApplyContext, rule *ChainR
 	// Check backtrack by class (in reverse order, starting before current position)
 	// HarfBuzz: uses iter_context (context_match=true) - mask is NOT checked!
 	backtrackPos := ctx.Buffer.Idx
-	for _, classID := range rule.Backtrack {
+	for i, classID := range rule.Backtrack {
 		backtrackPos = ctx.PrevContextGlyph(backtrackPos) // context_match=true
 		if backtrackPos < 0 {
-			return false
+			// Continue in the pre-context
+			ctx.matchedAt(0)
+			if !ctx.matchPreContext(i, len(rule.Backtrack), func(j int, gid GlyphID) bool {
+				return ccs.backtrackClassDef.GetClass(gid) == int(rule.Backtrack[j])
+			}) {
+				return false
+			}
+			break
 		}
+		ctx.matchedAt(backtrackPos)
 		glyphClass := ccs.backtrackClassDef.GetClass(ctx.Buffer.Info[backtrackPos].GlyphID)
 		if glyphClass != int(classID) {
 			return false
@@ -3412,13 +3669,18 @@ func (ccs *ChainContextSubst) applyFormat3(ctx *OTApplyContext) int {
 	matchPositions[0] = ctx.Buffer.Idx
 
 	// Match remaining input sequence by coverage using skippy-iteration
+	ctx.beginMatch()
 	pos := ctx.Buffer.Idx
 	for i := 1; i < inputLen; i++ {
 		pos = ctx.NextGlyph(pos)
 		if pos < 0 {
+			ctx.matchedAt(len(ctx.Buffer.Info) - 1)
+			ctx.endMatch(false)
 			return 0
 		}
+		ctx.matchedAt(pos)
 		if ccs.inputCoverages[i].GetCoverage(ctx.Buffer.Info[pos].GlyphID) == NotCovered {
+			ctx.endMatch(false)
 			return 0
 		}
 		matchPositions[i] = pos
@@ -3443,10 +3705,11 @@ func (ccs *ChainContextSubst) applyFormat3(ctx *OTApplyContext) int {
 	// before checking may_match.
 	bufLen := len(ctx.Buffer.Info)
 	lookaheadPos := pos
-	for _, cov := range ccs.lookaheadCoverages {
+	for k, cov := range ccs.lookaheadCoverages {
 		found := false
 		for lookaheadPos < bufLen-1 {
 			lookaheadPos++
+			ctx.matchedAt(lookaheadPos)
 			skip := ctx.MaySkip(lookaheadPos, true) // context_match=true
 			if skip == SkipYes {
 				continue // Definitely skip
@@ -3462,10 +3725,18 @@ func (ccs *ChainContextSubst) applyFormat3(ctx *OTApplyContext) int {
 				continue // Skip default ignorables (like CGJ) if not in coverage
 			}
 			// Not in coverage and can't skip -> fail
+			ctx.endMatch(false)
 			return 0
 		}
 		if !found {
-			return 0
+			// Continue in the post-context
+			if !ctx.matchPostContext(k, len(ccs.lookaheadCoverages), func(j int, gid GlyphID) bool {
+				return ccs.lookaheadCoverages[j].GetCoverage(gid) != NotCovered
+			}) {
+				ctx.endMatch(false)
+				return 0
+			}
+			break
 		}
 	}
 
@@ -3482,13 +3753,15 @@ func (ccs *ChainContextSubst) applyFormat3(ctx *OTApplyContext) int {
 	// - info[idx:] contains not-yet-processed glyphs
 	// Backtrack matching should use out_info, not info!
 	backtrackPos := ctx.Buffer.BacktrackLen()
-	for _, cov := range ccs.backtrackCoverages {
+	for k, cov := range ccs.backtrackCoverages {
 		found := false
 		for backtrackPos > 0 {
 			backtrackPos--
+			ctx.matchedBacktrackAt(backtrackPos)
 			// Get glyph info from the correct buffer (output for backtrack)
 			info := ctx.Buffer.BacktrackInfo(backtrackPos)
 			if info == nil {
+				ctx.endMatch(false)
 				return 0
 			}
 			skip := ctx.MaySkipInfo(info, true) // context_match=true
@@ -3505,13 +3778,23 @@ func (ccs *ChainContextSubst) applyFormat3(ctx *OTApplyContext) int {
 				continue // Skip default ignorables (like CGJ) if not in coverage
 			}
 			// Not in coverage and can't skip -> fail
+			ctx.endMatch(false)
 			return 0
 		}
 		if !found {
-			return 0
+			// Continue in the pre-context
+			if !ctx.matchPreContext(k, len(ccs.backtrackCoverages), func(j int, gid GlyphID) bool {
+				return ccs.backtrackCoverages[j].GetCoverage(gid) != NotCovered
+			}) {
+				ctx.endMatch(false)
+				return 0
+			}
+			break
 		}
 	}
 
+	ctx.endMatch(true)
+
 	// Store match positions for use in applyLookups
 	ctx.MatchPositions = matchPositions
 
@@ -3793,30 +4076,69 @@ func (r *ReverseChainSingleSubst) Apply(ctx *OTApplyContext) int {
 		return 0
 	}
 
-	// Match backtrack (in reverse order, looking backwards from current position)
-	if ctx.Buffer.Idx < len(r.backtrackCoverages) {
+	// Reverse lookups work in place, so the context is in Info
+	start, end, matched := r.matchContext(ctx)
+	if !matched {
+		ctx.Buffer.unsafeToConcat(start, end)
 		return 0
 	}
+	ctx.Buffer.unsafeToBreak(start, end)
+
+	// Replace glyph in place (don't advance index - reverse lookup handles this)
+	ctx.Buffer.Info[ctx.Buffer.Idx].GlyphID = r.substitutes[coverageIndex]
+	return 1
+}
+
+// matchContext matches the backtrack and lookahead of a reverse chaining
+// substitution at the current position. It returns the range of glyphs
+// it examined.
+func (r *ReverseChainSingleSubst) matchContext(ctx *OTApplyContext) (start, end int, matched bool) {
+	idx := ctx.Buffer.Idx
+	start, end = idx, idx+1
+
+	// Match backtrack (in reverse order, looking backwards from current position)
+	if idx < len(r.backtrackCoverages) {
+		return 0, end, false
+	}
 	for i, cov := range r.backtrackCoverages {
-		if cov.GetCoverage(ctx.Buffer.Info[ctx.Buffer.Idx-1-i].GlyphID) == NotCovered {
-			return 0
+		start = idx - 1 - i
+		if cov.GetCoverage(ctx.Buffer.Info[start].GlyphID) == NotCovered {
+			return start, end, false
 		}
 	}
 
 	// Match lookahead (looking forward from current position)
-	lookaheadStart := ctx.Buffer.Idx + 1
+	lookaheadStart := idx + 1
 	if lookaheadStart+len(r.lookaheadCoverages) > len(ctx.Buffer.Info) {
-		return 0
+		return start, len(ctx.Buffer.Info), false
 	}
 	for i, cov := range r.lookaheadCoverages {
+		end = lookaheadStart + i + 1
 		if cov.GetCoverage(ctx.Buffer.Info[lookaheadStart+i].GlyphID) == NotCovered {
-			return 0
+			return start, end, false
 		}
 	}
+	return start, end, true
+}
 
-	// Replace glyph in place (don't advance index - reverse lookup handles this)
-	ctx.Buffer.Info[ctx.Buffer.Idx].GlyphID = r.substitutes[coverageIndex]
-	return 1
+// Coverage returns the coverage table of the substituted glyph.
+func (r *ReverseChainSingleSubst) Coverage() *Coverage {
+	return r.coverage
+}
+
+// BacktrackCoverages returns the backtrack coverage tables.
+func (r *ReverseChainSingleSubst) BacktrackCoverages() []*Coverage {
+	return r.backtrackCoverages
+}
+
+// LookaheadCoverages returns the lookahead coverage tables.
+func (r *ReverseChainSingleSubst) LookaheadCoverages() []*Coverage {
+	return r.lookaheadCoverages
+}
+
+// Substitutes returns the substitute glyphs, indexed by coverage index.
+func (r *ReverseChainSingleSubst) Substitutes() []GlyphID {
+	return r.substitutes
 }
 
 // ApplyLookupReverseWithGDEF applies this lookup in reverse order with GDEF-based glyph filtering.
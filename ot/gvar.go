@@ -2,6 +2,7 @@ package ot
 
 import (
 	"encoding/binary"
+	"math"
 )
 
 // Gvar represents a parsed gvar (Glyph Variations) table.
@@ -80,6 +81,148 @@ func (g *Gvar) GlyphCount() int {
 	return g.glyphCount
 }
 
+// SharedTuplesData returns the raw shared tuple records.
+func (g *Gvar) SharedTuplesData() []byte {
+	size := g.sharedTupleCount * g.axisCount * 2
+	start := int(g.sharedTuplesOffset)
+	if size == 0 || start+size > len(g.data) {
+		return nil
+	}
+	return g.data[start : start+size]
+}
+
+// GetGlyphVariationData returns the raw GlyphVariationData for a glyph,
+// or nil if the glyph has no variations.
+func (g *Gvar) GetGlyphVariationData(glyphID GlyphID) []byte {
+	if int(glyphID) >= g.glyphCount {
+		return nil
+	}
+	start := int(g.glyphVarDataOffset) + int(g.glyphVarDataOffsets[glyphID])
+	end := int(g.glyphVarDataOffset) + int(g.glyphVarDataOffsets[glyphID+1])
+	if start >= end || end > len(g.data) {
+		return nil
+	}
+	return g.data[start:end]
+}
+
+// TupleVariation is a single tuple of a tuple variation store (the variation
+// data of one glyph in gvar, or of the CVT in cvar), decoded but not evaluated.
+type TupleVariation struct {
+	// Peak holds the peak coordinate per axis in F2DOT14 format.
+	Peak []int16
+
+	// Start and End hold the intermediate region per axis. They are nil if
+	// the tuple uses the implicit region between 0 and Peak.
+	Start []int16
+	End   []int16
+
+	// Points lists the point numbers the deltas apply to.
+	// nil means the deltas apply to all points.
+	Points []int
+
+	// XDeltas and YDeltas contain one delta per entry in Points (or per
+	// point if Points is nil). YDeltas is nil for cvar.
+	XDeltas []int16
+	YDeltas []int16
+}
+
+// GetGlyphTupleVariations returns the tuple variations of a glyph without
+// evaluating them. numPoints is the number of points in the glyph
+// (including 4 phantom points). Returns nil if the glyph has no variations.
+func (g *Gvar) GetGlyphTupleVariations(glyphID GlyphID, numPoints int) []TupleVariation {
+	if g == nil {
+		return nil
+	}
+	return g.parseTupleVariations(g.GetGlyphVariationData(glyphID), 0, numPoints)
+}
+
+// parseTupleVariations decodes a tuple variation store. countOffset is the
+// position of the tupleVariationCount field; the offset to the serialized
+// data follows it and is relative to the start of data.
+func (g *Gvar) parseTupleVariations(data []byte, countOffset, numPoints int) []TupleVariation {
+	if len(data) < countOffset+4 {
+		return nil
+	}
+
+	tupleVarCount := binary.BigEndian.Uint16(data[countOffset:])
+	tupleCount := int(tupleVarCount & 0x0FFF)
+	dataOffset := int(binary.BigEndian.Uint16(data[countOffset+2:]))
+	if tupleCount == 0 || dataOffset > len(data) {
+		return nil
+	}
+
+	var sharedPoints []int
+	serializedOffset := dataOffset
+	if tupleVarCount&0x8000 != 0 {
+		var consumed int
+		sharedPoints, consumed = g.parsePointNumbers(data[serializedOffset:])
+		serializedOffset += consumed
+	}
+
+	readTuple := func(offset int) []int16 {
+		coords := make([]int16, g.axisCount)
+		for i := range coords {
+			coords[i] = int16(binary.BigEndian.Uint16(data[offset+i*2:]))
+		}
+		return coords
+	}
+
+	tuples := make([]TupleVariation, 0, tupleCount)
+	headerOffset := countOffset + 4
+	tupleSize := g.axisCount * 2
+	for t := 0; t < tupleCount; t++ {
+		if headerOffset+4 > len(data) {
+			break
+		}
+		variationDataSize := int(binary.BigEndian.Uint16(data[headerOffset:]))
+		tupleIndex := binary.BigEndian.Uint16(data[headerOffset+2:])
+		headerOffset += 4
+
+		var tv TupleVariation
+		if tupleIndex&0x8000 != 0 {
+			if headerOffset+tupleSize > len(data) {
+				break
+			}
+			tv.Peak = readTuple(headerOffset)
+			headerOffset += tupleSize
+		} else {
+			tv.Peak = g.getSharedTuple(int(tupleIndex & 0x0FFF))
+		}
+		if tupleIndex&0x4000 != 0 {
+			if headerOffset+2*tupleSize > len(data) {
+				break
+			}
+			tv.Start = readTuple(headerOffset)
+			tv.End = readTuple(headerOffset + tupleSize)
+			headerOffset += 2 * tupleSize
+		}
+
+		end := serializedOffset + variationDataSize
+		if end > len(data) {
+			break
+		}
+		serialized := data[serializedOffset:end]
+		serializedOffset = end
+
+		tv.Points = sharedPoints
+		if tupleIndex&0x2000 != 0 {
+			var consumed int
+			tv.Points, consumed = g.parsePointNumbers(serialized)
+			serialized = serialized[consumed:]
+		}
+		if len(tv.Points) == 0 {
+			tv.Points = nil
+		}
+		tv.XDeltas, tv.YDeltas, _ = g.parseDeltas(serialized, len(tv.Points), numPoints)
+
+		if tv.Peak != nil {
+			tuples = append(tuples, tv)
+		}
+	}
+
+	return tuples
+}
+
 // getSharedTuple returns the coordinates for a shared tuple.
 // Coordinates are in F2DOT14 format.
 func (g *Gvar) getSharedTuple(index int) []int16 {
@@ -117,155 +260,46 @@ type GlyphPoint struct {
 // GetGlyphDeltas computes the delta values for a glyph at the given
 // normalized coordinates. The coordinates should be in F2DOT14 format.
 // numPoints is the number of points in the glyph (including 4 phantom points).
-// Note: This version doesn't perform proper IUP interpolation for sparse deltas.
-// Use GetGlyphDeltasWithCoords for proper IUP support.
+// Note: Points a sparse tuple variation does not touch keep a zero delta.
+// Use GetGlyphDeltasWithCoords for IUP interpolation.
 func (g *Gvar) GetGlyphDeltas(glyphID GlyphID, normalizedCoords []int, numPoints int) *GlyphDeltas {
 	return g.GetGlyphDeltasWithCoords(glyphID, normalizedCoords, numPoints, nil)
 }
 
 // GetGlyphDeltasWithCoords computes the delta values for a glyph at the given
-// normalized coordinates with proper IUP interpolation.
-// origCoords contains the original point coordinates for IUP interpolation.
-// If nil, a simplified interpolation is used.
+// normalized coordinates with IUP interpolation.
+// origCoords contains the original coordinates of the outline points, which
+// are interpolated as a single contour. If nil, untouched points keep a zero
+// delta.
 func (g *Gvar) GetGlyphDeltasWithCoords(glyphID GlyphID, normalizedCoords []int, numPoints int, origCoords []GlyphPoint) *GlyphDeltas {
 	if g == nil || int(glyphID) >= g.glyphCount {
 		return nil
 	}
-
-	// Get the glyph's variation data
-	startOffset := g.glyphVarDataOffset + g.glyphVarDataOffsets[glyphID]
-	endOffset := g.glyphVarDataOffset + g.glyphVarDataOffsets[glyphID+1]
-
-	if startOffset == endOffset {
+	if g.glyphVarDataOffsets[glyphID] == g.glyphVarDataOffsets[glyphID+1] {
 		// No variation data for this glyph
 		return nil
 	}
 
-	if int(endOffset) > len(g.data) {
-		return nil
-	}
-
-	glyphData := g.data[startOffset:endOffset]
-	if len(glyphData) < 4 {
-		return nil
-	}
-
-	// Parse TupleVariationCount
-	tupleVarCount := binary.BigEndian.Uint16(glyphData[0:])
-	tupleCount := int(tupleVarCount & 0x0FFF)
-	sharedPointNumbers := (tupleVarCount & 0x8000) != 0
-	dataOffset := binary.BigEndian.Uint16(glyphData[2:])
-
-	if tupleCount == 0 {
-		return nil
+	// Phantom points are not part of the outline
+	var points []SimpleGlyphPoint
+	var endPts []int
+	if n := min(len(origCoords), numPoints-4); n > 0 {
+		points = make([]SimpleGlyphPoint, n)
+		for i := range points {
+			points[i] = SimpleGlyphPoint{X: origCoords[i].X, Y: origCoords[i].Y}
+		}
+		endPts = []int{n - 1}
 	}
+	dx, dy := glyphVariationDeltas(g, glyphID, normalizedCoords, numPoints, points, endPts)
 
-	// Initialize result
 	deltas := &GlyphDeltas{
 		XDeltas: make([]int16, numPoints),
 		YDeltas: make([]int16, numPoints),
 	}
-
-	// Parse shared point numbers if present
-	var sharedPoints []int
-	serializedDataStart := int(dataOffset)
-	if sharedPointNumbers {
-		var consumed int
-		sharedPoints, consumed = g.parsePointNumbers(glyphData[serializedDataStart:])
-		serializedDataStart += consumed
-	}
-
-	// Parse each tuple variation header and accumulate deltas
-	headerOffset := 4
-	serializedOffset := serializedDataStart
-
-	for t := 0; t < tupleCount; t++ {
-		if headerOffset+4 > len(glyphData) {
-			break
-		}
-
-		variationDataSize := int(binary.BigEndian.Uint16(glyphData[headerOffset:]))
-		tupleIndex := binary.BigEndian.Uint16(glyphData[headerOffset+2:])
-		headerOffset += 4
-
-		// Flags from tupleIndex
-		embeddedPeakTuple := (tupleIndex & 0x8000) != 0
-		intermediateRegion := (tupleIndex & 0x4000) != 0
-		privatePointNumbers := (tupleIndex & 0x2000) != 0
-		tupleIdx := int(tupleIndex & 0x0FFF)
-
-		// Get peak tuple coordinates
-		var peakCoords []int16
-		if embeddedPeakTuple {
-			peakCoords = make([]int16, g.axisCount)
-			for i := 0; i < g.axisCount; i++ {
-				if headerOffset+2 > len(glyphData) {
-					break
-				}
-				peakCoords[i] = int16(binary.BigEndian.Uint16(glyphData[headerOffset:]))
-				headerOffset += 2
-			}
-		} else {
-			peakCoords = g.getSharedTuple(tupleIdx)
-		}
-
-		// Get intermediate region if present
-		var startCoords, endCoords []int16
-		if intermediateRegion {
-			startCoords = make([]int16, g.axisCount)
-			endCoords = make([]int16, g.axisCount)
-			for i := 0; i < g.axisCount; i++ {
-				if headerOffset+2 > len(glyphData) {
-					break
-				}
-				startCoords[i] = int16(binary.BigEndian.Uint16(glyphData[headerOffset:]))
-				headerOffset += 2
-			}
-			for i := 0; i < g.axisCount; i++ {
-				if headerOffset+2 > len(glyphData) {
-					break
-				}
-				endCoords[i] = int16(binary.BigEndian.Uint16(glyphData[headerOffset:]))
-				headerOffset += 2
-			}
-		}
-
-		// Calculate scalar for this tuple
-		scalar := g.calculateScalar(peakCoords, startCoords, endCoords, normalizedCoords)
-		if scalar == 0 {
-			serializedOffset += variationDataSize
-			continue
-		}
-
-		// Parse point numbers for this tuple
-		var pointIndices []int
-		deltaDataStart := serializedOffset
-		if privatePointNumbers {
-			var consumed int
-			pointIndices, consumed = g.parsePointNumbers(glyphData[serializedOffset:])
-			deltaDataStart += consumed
-		} else {
-			pointIndices = sharedPoints
-		}
-
-		// Parse deltas
-		xDeltas, yDeltas, _ := g.parseDeltas(glyphData[deltaDataStart:], len(pointIndices), numPoints)
-
-		// Apply deltas with scalar
-		if len(pointIndices) == 0 {
-			// All points
-			for i := 0; i < numPoints && i < len(xDeltas); i++ {
-				deltas.XDeltas[i] += int16(float32(xDeltas[i]) * scalar)
-				deltas.YDeltas[i] += int16(float32(yDeltas[i]) * scalar)
-			}
-		} else {
-			// Specific points - need interpolation for missing points
-			g.applyDeltasWithInterpolation(deltas, pointIndices, xDeltas, yDeltas, scalar, numPoints, origCoords)
-		}
-
-		serializedOffset += variationDataSize
+	for i := range dx {
+		deltas.XDeltas[i] = int16(math.Round(dx[i]))
+		deltas.YDeltas[i] = int16(math.Round(dy[i]))
 	}
-
 	return deltas
 }
 
@@ -468,114 +502,3 @@ func (g *Gvar) parseDeltas(data []byte, numDeltas, numPoints int) (xDeltas, yDel
 
 	return xDeltas, yDeltas, offset
 }
-
-// applyDeltasWithInterpolation applies deltas to specific points and interpolates others.
-// This implements the IUP (Interpolate Untouched Points) algorithm.
-func (g *Gvar) applyDeltasWithInterpolation(deltas *GlyphDeltas, pointIndices []int, xDelta, yDelta []int16, scalar float32, numPoints int, origCoords []GlyphPoint) {
-	// Create a set of touched points
-	touched := make(map[int]bool)
-	for _, idx := range pointIndices {
-		touched[idx] = true
-	}
-
-	// Apply deltas to specified points
-	for i, ptIdx := range pointIndices {
-		if ptIdx >= numPoints || i >= len(xDelta) {
-			continue
-		}
-		deltas.XDeltas[ptIdx] += int16(float32(xDelta[i]) * scalar)
-		deltas.YDeltas[ptIdx] += int16(float32(yDelta[i]) * scalar)
-	}
-
-	// IUP: For untouched points, interpolate from neighboring touched points
-	// Since we don't have contour information here, we treat all points as one contour
-	// This is a simplification - proper IUP would need contour boundaries
-
-	// Find all untouched points and interpolate
-	for i := 0; i < numPoints; i++ {
-		if touched[i] {
-			continue
-		}
-
-		// Find previous touched point
-		prevTouched := -1
-		for j := 1; j <= numPoints; j++ {
-			idx := (i - j + numPoints) % numPoints
-			if touched[idx] {
-				prevTouched = idx
-				break
-			}
-		}
-
-		// Find next touched point
-		nextTouched := -1
-		for j := 1; j <= numPoints; j++ {
-			idx := (i + j) % numPoints
-			if touched[idx] {
-				nextTouched = idx
-				break
-			}
-		}
-
-		if prevTouched == -1 || nextTouched == -1 {
-			// No touched points found, delta stays 0
-			continue
-		}
-
-		if prevTouched == nextTouched {
-			// Only one touched point, use its delta
-			deltas.XDeltas[i] = deltas.XDeltas[prevTouched]
-			deltas.YDeltas[i] = deltas.YDeltas[prevTouched]
-			continue
-		}
-
-		// IUP interpolation using original coordinates
-		if origCoords != nil && i < len(origCoords) && prevTouched < len(origCoords) && nextTouched < len(origCoords) {
-			deltas.XDeltas[i] += iupInterpolate(
-				origCoords[i].X,
-				origCoords[prevTouched].X, origCoords[nextTouched].X,
-				deltas.XDeltas[prevTouched], deltas.XDeltas[nextTouched],
-			)
-			deltas.YDeltas[i] += iupInterpolate(
-				origCoords[i].Y,
-				origCoords[prevTouched].Y, origCoords[nextTouched].Y,
-				deltas.YDeltas[prevTouched], deltas.YDeltas[nextTouched],
-			)
-		} else {
-			// Fallback: simple average
-			deltas.XDeltas[i] = (deltas.XDeltas[prevTouched] + deltas.XDeltas[nextTouched]) / 2
-			deltas.YDeltas[i] = (deltas.YDeltas[prevTouched] + deltas.YDeltas[nextTouched]) / 2
-		}
-	}
-}
-
-// iupInterpolate performs IUP interpolation for a single coordinate.
-// coord is the coordinate of the untouched point.
-// coord1, coord2 are the coordinates of the two surrounding touched points.
-// delta1, delta2 are the deltas of the two surrounding touched points.
-func iupInterpolate(coord, coord1, coord2 int16, delta1, delta2 int16) int16 {
-	// Ensure coord1 <= coord2 for the algorithm
-	if coord1 > coord2 {
-		coord1, coord2 = coord2, coord1
-		delta1, delta2 = delta2, delta1
-	}
-
-	if coord <= coord1 {
-		// coord is at or before coord1 - use delta1
-		return delta1
-	}
-	if coord >= coord2 {
-		// coord is at or after coord2 - use delta2
-		return delta2
-	}
-
-	// coord is strictly between coord1 and coord2 - interpolate
-	if coord1 == coord2 {
-		// Same position, use average
-		return (delta1 + delta2) / 2
-	}
-
-	// Linear interpolation: delta = delta1 + (delta2 - delta1) * (coord - coord1) / (coord2 - coord1)
-	t := float32(coord-coord1) / float32(coord2-coord1)
-	return int16(float32(delta1) + t*float32(delta2-delta1))
-}
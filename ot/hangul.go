@@ -0,0 +1,385 @@
+package ot
+
+// Hangul Shaper
+//
+// HarfBuzz equivalent: hb-ot-shaper-hangul.cc
+//
+// This implements Hangul text shaping:
+// - Composition of <L,V> and <L,V,T> jamo sequences into precomposed syllables
+// - Decomposition of precomposed syllables the font cannot display as a whole
+// - ljmo/vjmo/tjmo features for jamo that could not be composed (Old Hangul)
+// - Reordering of the Hangul tone marks U+302E and U+302F
+
+// Hangul syllable composition constants.
+// HarfBuzz equivalent: L_BASE, V_BASE, ... in hb-ot-shaper-hangul.cc:101-108
+const (
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11A7
+	hangulSBase  = 0xAC00
+	hangulLCount = 19
+	hangulVCount = 21
+	hangulTCount = 28
+	hangulNCount = hangulVCount * hangulTCount
+	hangulSCount = hangulLCount * hangulNCount
+)
+
+// Hangul jamo features stored in GlyphInfo.HangulFeature.
+// HarfBuzz equivalent: hangul_feature_t in hb-ot-shaper-hangul.cc:36-43
+const (
+	hangulFeatureNone uint8 = iota
+	hangulFeatureLJMO
+	hangulFeatureVJMO
+	hangulFeatureTJMO
+)
+
+// Hangul jamo feature masks.
+// HarfBuzz: allocated by the map for the non-global ljmo/vjmo/tjmo features
+const (
+	MaskLjmo uint32 = 1 << 8  // Leading jamo forms
+	MaskVjmo uint32 = 1 << 9  // Vowel jamo forms
+	MaskTjmo uint32 = 1 << 10 // Trailing jamo forms
+)
+
+var (
+	tagLjmo = MakeTag('l', 'j', 'm', 'o')
+	tagVjmo = MakeTag('v', 'j', 'm', 'o')
+	tagTjmo = MakeTag('t', 'j', 'm', 'o')
+)
+
+// hangulFeatureMasks maps the jamo features to their masks.
+// HarfBuzz equivalent: hangul_shape_plan_t::mask_array
+var hangulFeatureMasks = [...]uint32{
+	hangulFeatureNone: 0,
+	hangulFeatureLJMO: MaskLjmo,
+	hangulFeatureVJMO: MaskVjmo,
+	hangulFeatureTJMO: MaskTjmo,
+}
+
+// isHangulL returns true for leading consonant jamo, including Old Hangul.
+// HarfBuzz equivalent: isL() in hb-ot-shaper-hangul.cc:110
+func isHangulL(u Codepoint) bool {
+	return (u >= 0x1100 && u <= 0x115F) || (u >= 0xA960 && u <= 0xA97C)
+}
+
+// isHangulV returns true for vowel jamo, including Old Hangul.
+// HarfBuzz equivalent: isV() in hb-ot-shaper-hangul.cc:111
+func isHangulV(u Codepoint) bool {
+	return (u >= 0x1160 && u <= 0x11A7) || (u >= 0xD7B0 && u <= 0xD7C6)
+}
+
+// isHangulT returns true for trailing consonant jamo, including Old Hangul.
+// HarfBuzz equivalent: isT() in hb-ot-shaper-hangul.cc:112
+func isHangulT(u Codepoint) bool {
+	return (u >= 0x11A8 && u <= 0x11FF) || (u >= 0xD7CB && u <= 0xD7FB)
+}
+
+// isHangulTone returns true for the Hangul tone marks U+302E and U+302F.
+// HarfBuzz equivalent: isHangulTone() in hb-ot-shaper-hangul.cc:113
+func isHangulTone(u Codepoint) bool {
+	return u == 0x302E || u == 0x302F
+}
+
+// isCombiningL returns true for leading jamo that take part in syllable composition.
+// HarfBuzz equivalent: isCombiningL() in hb-ot-shaper-hangul.cc:116
+func isCombiningL(u Codepoint) bool {
+	return u >= hangulLBase && u < hangulLBase+hangulLCount
+}
+
+// isCombiningV returns true for vowel jamo that take part in syllable composition.
+// HarfBuzz equivalent: isCombiningV() in hb-ot-shaper-hangul.cc:117
+func isCombiningV(u Codepoint) bool {
+	return u >= hangulVBase && u < hangulVBase+hangulVCount
+}
+
+// isCombiningT returns true for trailing jamo that take part in syllable composition.
+// HarfBuzz equivalent: isCombiningT() in hb-ot-shaper-hangul.cc:118
+func isCombiningT(u Codepoint) bool {
+	return u > hangulTBase && u < hangulTBase+hangulTCount
+}
+
+// isCombinedS returns true for precomposed Hangul syllables.
+// HarfBuzz equivalent: isCombinedS() in hb-ot-shaper-hangul.cc:119
+func isCombinedS(u Codepoint) bool {
+	return u >= hangulSBase && u < hangulSBase+hangulSCount
+}
+
+// hasGlyph returns true if the font maps the codepoint to a glyph.
+func (s *Shaper) hasGlyph(cp Codepoint) bool {
+	if s.cmap == nil {
+		return false
+	}
+	gid, ok := s.cmap.Lookup(cp)
+	return ok && gid != 0
+}
+
+// isZeroWidthChar returns true if the font has a glyph for the codepoint
+// and that glyph has no advance.
+// HarfBuzz equivalent: is_zero_width_char() in hb-ot-shaper-hangul.cc:124-129
+func (s *Shaper) isZeroWidthChar(cp Codepoint) bool {
+	if s.cmap == nil {
+		return false
+	}
+	gid, ok := s.cmap.Lookup(cp)
+	return ok && gid != 0 && s.glyphHAdvance(gid) == 0
+}
+
+// preprocessTextHangul composes and decomposes Hangul syllables depending on
+// the glyphs the font supports, records the jamo feature of every glyph and
+// moves tone marks in front of their syllable.
+// HarfBuzz equivalent: preprocess_text_hangul() in hb-ot-shaper-hangul.cc:131-384
+//
+// Hangul syllables come in two shapes: LV, and LVT. Of those, the LV and LVT
+// forms of modern Hangul have precomposed characters. If the font has the
+// precomposed glyph, the jamo sequence is composed; otherwise a precomposed
+// syllable is decomposed and the jamo get the ljmo/vjmo/tjmo features.
+//
+// The tone marks are combining marks that render to the left of the
+// syllable, so unless they are zero width they are moved in front of it.
+func (s *Shaper) preprocessTextHangul(buf *Buffer) {
+	buf.clearOutput()
+
+	// Extent of the most recently seen syllable; valid only if start < end
+	start, end := 0, 0
+	count := buf.Len()
+
+	for buf.Idx = 0; buf.Idx < count; {
+		u := buf.Info[buf.Idx].Codepoint
+
+		if isHangulTone(u) {
+			if start < end && end == buf.outLen {
+				// Tone mark follows a valid syllable; move it in front, unless it's zero width.
+				buf.nextGlyph()
+				if !s.isZeroWidthChar(u) {
+					mergeOutClusters(buf, start, end+1)
+					tone := buf.outInfo[end]
+					copy(buf.outInfo[start+1:end+1], buf.outInfo[start:end])
+					buf.outInfo[start] = tone
+				}
+			} else {
+				// No valid syllable as base for tone mark; try to insert dotted circle.
+				if buf.Flags&BufferFlagDoNotInsertDottedCircle == 0 && s.hasGlyph(0x25CC) {
+					chars := []Codepoint{u, 0x25CC}
+					if s.isZeroWidthChar(u) {
+						chars = []Codepoint{0x25CC, u}
+					}
+					buf.replaceGlyphs(1, chars)
+				} else {
+					// No dotted circle available in the font; just leave tone mark untouched.
+					buf.nextGlyph()
+				}
+			}
+			start = buf.outLen
+			end = buf.outLen
+			continue
+		}
+
+		// Remember current position as a potential syllable start;
+		// will only be used if we set end to a later position.
+		start = buf.outLen
+
+		if isHangulL(u) && buf.Idx+1 < count {
+			l := u
+			v := buf.Info[buf.Idx+1].Codepoint
+			if isHangulV(v) {
+				// Have <L,V> or <L,V,T>.
+				var t Codepoint
+				tindex := Codepoint(0)
+				if buf.Idx+2 < count {
+					t = buf.Info[buf.Idx+2].Codepoint
+					if isHangulT(t) {
+						tindex = t - hangulTBase // Only used if isCombiningT(t); otherwise invalid.
+					} else {
+						t = 0 // The next character was not a trailing jamo.
+					}
+				}
+
+				// We've got a syllable <L,V,T?>; see if it can potentially be composed.
+				if isCombiningL(l) && isCombiningV(v) && (t == 0 || isCombiningT(t)) {
+					composed := hangulSBase + (l-hangulLBase)*hangulNCount + (v-hangulVBase)*hangulTCount + tindex
+					if s.hasGlyph(composed) {
+						numIn := 2
+						if t != 0 {
+							numIn = 3
+						}
+						buf.replaceGlyphs(numIn, []Codepoint{composed})
+						end = start + 1
+						continue
+					}
+				}
+
+				// We didn't compose, either because it's an Old Hangul syllable without a
+				// precomposed character in Unicode, or because the font didn't support the
+				// necessary precomposed glyph.
+				// Set jamo features on the individual glyphs, and advance past them.
+				buf.Info[buf.Idx].HangulFeature = hangulFeatureLJMO
+				buf.nextGlyph()
+				buf.Info[buf.Idx].HangulFeature = hangulFeatureVJMO
+				buf.nextGlyph()
+				if t != 0 {
+					buf.Info[buf.Idx].HangulFeature = hangulFeatureTJMO
+					buf.nextGlyph()
+					end = start + 3
+				} else {
+					end = start + 2
+				}
+				mergeOutClusters(buf, start, end)
+				continue
+			}
+		} else if isCombinedS(u) {
+			// Have <LV>, <LVT>, or <LV,T>
+			syllable := u
+			hasGlyph := s.hasGlyph(syllable)
+			lindex := (syllable - hangulSBase) / hangulNCount
+			nindex := (syllable - hangulSBase) % hangulNCount
+			vindex := nindex / hangulTCount
+			tindex := nindex % hangulTCount
+
+			if tindex == 0 && buf.Idx+1 < count && isCombiningT(buf.Info[buf.Idx+1].Codepoint) {
+				// <LV,T>, try to combine.
+				composed := syllable + buf.Info[buf.Idx+1].Codepoint - hangulTBase
+				if s.hasGlyph(composed) {
+					buf.replaceGlyphs(2, []Codepoint{composed})
+					end = start + 1
+					continue
+				}
+			}
+
+			// Otherwise, decompose if font doesn't support <LV> or <LVT>,
+			// or if having non-combining <LV,T>. Note that we already handled
+			// combining <LV,T> above.
+			if !hasGlyph || (tindex == 0 && buf.Idx+1 < count && isHangulT(buf.Info[buf.Idx+1].Codepoint)) {
+				decomposed := []Codepoint{hangulLBase + lindex, hangulVBase + vindex, hangulTBase + tindex}
+				if s.hasGlyph(decomposed[0]) && s.hasGlyph(decomposed[1]) &&
+					(tindex == 0 || s.hasGlyph(decomposed[2])) {
+					sLen := 2
+					if tindex != 0 {
+						sLen = 3
+					}
+					buf.replaceGlyphs(1, decomposed[:sLen])
+
+					// If we decomposed an LV because of a non-combining T following,
+					// we want to include this T in the syllable.
+					if hasGlyph && tindex == 0 {
+						buf.nextGlyph()
+						sLen++
+					}
+
+					// We decomposed S: apply jamo features to the individual glyphs
+					// that are now in the output buffer.
+					end = start + sLen
+					i := start
+					buf.outInfo[i].HangulFeature = hangulFeatureLJMO
+					i++
+					buf.outInfo[i].HangulFeature = hangulFeatureVJMO
+					i++
+					if i < end {
+						buf.outInfo[i].HangulFeature = hangulFeatureTJMO
+					}
+					mergeOutClusters(buf, start, end)
+					continue
+				}
+			}
+
+			if hasGlyph {
+				// We didn't decompose the S, so just advance past it and fall through.
+				end = start + 1
+			}
+		}
+
+		// Didn't find a recognizable syllable, so we leave end <= start;
+		// this will prevent tone-mark reordering happening.
+		buf.nextGlyph()
+	}
+
+	buf.sync()
+}
+
+// setupMasksHangul adds the jamo feature masks recorded during preprocessing.
+// HarfBuzz equivalent: setup_masks_hangul() in hb-ot-shaper-hangul.cc:386-401
+func setupMasksHangul(buf *Buffer) {
+	for i := range buf.Info {
+		buf.Info[i].Mask |= hangulFeatureMasks[buf.Info[i].HangulFeature]
+	}
+}
+
+// shapeHangul applies Hangul shaping.
+// HarfBuzz equivalent: _hb_ot_shaper_hangul in hb-ot-shaper-hangul.cc:404-420
+//
+// Hangul uses no normalization (the shaper composes and decomposes itself),
+// does not zero mark advances and has no fallback positioning.
+// Uniscribe does not apply 'calt' for Hangul, and certain fonts (Noto Sans CJK,
+// Source Sans Han, etc) apply all of jamo lookups in calt, which is not
+// desirable, so it is disabled unless requested explicitly.
+func (s *Shaper) shapeHangul(buf *Buffer, features []Feature, defaultFeatures bool) {
+	// Step 0: Preprocess text (syllable composition and tone marks)
+	s.preprocessTextHangul(buf)
+
+	// Step 1: NO normalization
+	// HarfBuzz: HB_OT_SHAPE_NORMALIZATION_MODE_NONE
+
+	// Step 2: Initialize masks and add the jamo feature masks
+	buf.ResetMasks(MaskGlobal)
+	setupMasksHangul(buf)
+
+	// Step 3: Map codepoints to glyphs
+	s.mapCodepointsToGlyphs(buf)
+
+	// Step 4: Set glyph classes from GDEF
+	s.setGlyphClasses(buf)
+
+	// Step 5: Categorize and apply features
+	// HarfBuzz: override_features_hangul() disables calt
+	if defaultFeatures {
+		filtered := make([]Feature, 0, len(features))
+		for _, f := range features {
+			if f.Tag != tagCalt {
+				filtered = append(filtered, f)
+			}
+		}
+		features = filtered
+	}
+	gsubFeatures, gposFeatures := s.planFeatures(buf, features)
+
+	// Direction features come first, then the jamo features
+	// HarfBuzz: collect_features_hangul() adds ljmo, vjmo, tjmo after a GSUB pause
+	var jamoFeatures []Feature
+	switch buf.Direction {
+	case DirectionRTL:
+		jamoFeatures = append(jamoFeatures, Feature{Tag: MakeTag('r', 't', 'l', 'a'), Value: 1})
+		jamoFeatures = append(jamoFeatures, Feature{Tag: MakeTag('r', 't', 'l', 'm'), Value: 1})
+	case DirectionLTR:
+		jamoFeatures = append(jamoFeatures, Feature{Tag: MakeTag('l', 't', 'r', 'a'), Value: 1})
+		jamoFeatures = append(jamoFeatures, Feature{Tag: MakeTag('l', 't', 'r', 'm'), Value: 1})
+	}
+	jamoFeatures = append(jamoFeatures,
+		Feature{Tag: tagLjmo, Value: 1},
+		Feature{Tag: tagVjmo, Value: 1},
+		Feature{Tag: tagTjmo, Value: 1},
+	)
+	gsubFeatures = append(jamoFeatures, gsubFeatures...)
+
+	s.applyGSUBWithMasks(buf, gsubFeatures, map[Tag]uint32{
+		tagLjmo: MaskLjmo,
+		tagVjmo: MaskVjmo,
+		tagTjmo: MaskTjmo,
+	})
+	s.setBaseAdvances(buf)
+
+	// Add default GPOS features if none provided
+	if len(gposFeatures) == 0 {
+		gposFeatures = s.getDefaultGPOSFeatures(buf.Direction)
+	}
+
+	// Hangul uses ZeroWidthMarksNone - don't zero mark advances
+	// HarfBuzz: HB_OT_SHAPE_ZERO_WIDTH_MARKS_NONE
+	s.applyGPOSWithZeroWidthMarks(buf, gposFeatures, ZeroWidthMarksNone)
+
+	// NO fallback kern - Hangul has FallbackPosition = false
+	// HarfBuzz: fallback_position = false
+
+	// Reverse buffer for RTL display
+	if buf.Direction == DirectionRTL {
+		s.reverseClusters(buf)
+	}
+}
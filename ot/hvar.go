@@ -96,6 +96,52 @@ func (h *Hvar) GetAdvanceDelta(glyph GlyphID, normalizedCoords []int) float32 {
 	return h.varStore.GetDelta(varIdx, normalizedCoords)
 }
 
+// Vvar represents a parsed VVAR (Vertical Metrics Variations) table.
+// Its layout extends HVAR by a mapping for the vertical origins of VORG.
+type Vvar struct {
+	Hvar
+	vorgMap *DeltaSetIndexMap
+}
+
+// ParseVvar parses a VVAR table.
+func ParseVvar(data []byte) (*Vvar, error) {
+	if len(data) < 24 {
+		return nil, ErrInvalidTable
+	}
+	h, err := ParseHvar(data)
+	if err != nil {
+		return nil, err
+	}
+	v := &Vvar{Hvar: *h}
+
+	// Parse vertical origin DeltaSetIndexMap
+	vorgMapOffset := binary.BigEndian.Uint32(data[20:])
+	if vorgMapOffset != 0 && int(vorgMapOffset) < len(data) {
+		dm, err := parseDeltaSetIndexMap(data[vorgMapOffset:])
+		if err != nil {
+			return nil, err
+		}
+		v.vorgMap = dm
+	}
+
+	return v, nil
+}
+
+// HasData returns true if the VVAR table has valid data.
+func (v *Vvar) HasData() bool {
+	return v != nil && v.varStore != nil
+}
+
+// GetVertOriginDelta returns the delta of the VORG vertical origin for a
+// glyph at the given normalized coordinates (F2DOT14). Fonts without a
+// vertical origin mapping have no deltas.
+func (v *Vvar) GetVertOriginDelta(glyph GlyphID, normalizedCoords []int) float32 {
+	if v == nil || v.varStore == nil || v.vorgMap == nil {
+		return 0
+	}
+	return v.varStore.GetDelta(v.vorgMap.Map(uint32(glyph)), normalizedCoords)
+}
+
 // ItemVariationStore holds variation data for different regions.
 type ItemVariationStore struct {
 	data       []byte
@@ -254,6 +300,29 @@ func (vs *ItemVariationStore) getVarDataDelta(varData []byte, inner int, coords
 	return delta
 }
 
+// regionScalars returns the scalars at coords of the regions referenced by
+// the ItemVariationData subtable outer, in the order of its region indices.
+// This is what the CFF2 blend operator needs.
+func (vs *ItemVariationStore) regionScalars(outer int, coords []int) []float64 {
+	if vs == nil || outer < 0 || outer >= len(vs.dataSets) {
+		return nil
+	}
+	varData := vs.dataSets[outer].data
+	if len(varData) < 6 {
+		return nil
+	}
+	regionIndexCount := int(binary.BigEndian.Uint16(varData[4:]))
+	if len(varData) < 6+regionIndexCount*2 {
+		return nil
+	}
+	scalars := make([]float64, regionIndexCount)
+	for i := range scalars {
+		regionIdx := int(binary.BigEndian.Uint16(varData[6+i*2:]))
+		scalars[i] = float64(vs.regions.Evaluate(regionIdx, coords))
+	}
+	return scalars
+}
+
 // VarRegionList holds the list of variation regions.
 type VarRegionList struct {
 	data        []byte
@@ -178,23 +178,23 @@ func newIndicPlan(gsub *GSUB, script Tag, config *IndicConfig) *IndicPlan {
 	return plan
 }
 
-// getIndicPlan returns the IndicPlan for the given script, creating one if necessary.
+// getIndicPlan returns the IndicPlan for the given script from the shape
+// plan of the buffer, creating one if necessary.
 // HarfBuzz equivalent: accessing indic_plan via plan->data() in shaper functions
-func (s *Shaper) getIndicPlan(script Tag, config *IndicConfig) *IndicPlan {
-	if s.indicPlans == nil {
-		s.indicPlans = make(map[Tag]*IndicPlan)
-	}
-	plan, ok := s.indicPlans[script]
-	if !ok {
-		plan = newIndicPlan(s.gsub, script, config)
+func (s *Shaper) getIndicPlan(buf *Buffer, script Tag, config *IndicConfig) *IndicPlan {
+	build := func() *IndicPlan {
+		plan := newIndicPlan(s.gsub, script, config)
 		// Load virama glyph ID for halant recovery in final reordering
 		// HarfBuzz equivalent: load_virama_glyph() in hb-ot-shaper-indic.cc
 		if s.cmap != nil && config.Virama != 0 {
 			plan.viramaGID, _ = s.cmap.Lookup(config.Virama)
 		}
-		s.indicPlans[script] = plan
+		return plan
 	}
-	return plan
+	if buf.plan == nil {
+		return build()
+	}
+	return buf.plan.indicPlan(script, build)
 }
 
 // Indic shaper implementation based on HarfBuzz's hb-ot-shaper-indic.cc
@@ -1938,7 +1938,7 @@ func (s *Shaper) shapeIndic(buf *Buffer, features []Feature) {
 
 	// Get or create IndicPlan for this script
 	// HarfBuzz equivalent: data_create_indic() and accessing plan->data()
-	indicPlan := s.getIndicPlan(script, config)
+	indicPlan := s.getIndicPlan(buf, script, config)
 
 	// DEBUG
 	if debugIndic {
@@ -1985,6 +1985,8 @@ func (s *Shaper) shapeIndic(buf *Buffer, features []Feature) {
 	for i := range buf.Info {
 		buf.Info[i].Syllable = indicInfo[i].Syllable
 	}
+	// HarfBuzz: setup_syllables_indic() marks syllables unsafe to break
+	unsafeToBreakSyllables(buf, func(i int) uint32 { return uint32(buf.Info[i].Syllable) })
 
 	// Step 6: Set up base masks BEFORE initial reordering
 	// HarfBuzz: Masks are set in initial_reordering_consonant_syllable (hb-ot-shaper-indic.cc:843-848)
@@ -2021,7 +2023,7 @@ func (s *Shaper) shapeIndic(buf *Buffer, features []Feature) {
 	// Step 9: Apply user-requested GSUB features (e.g., ss03, salt) BEFORE other features
 	// HarfBuzz: Lookups are sorted by index. User features like ss03 often have lower
 	// lookup indices than standard features like psts, so they need to be applied first.
-	userGSUB, _ := s.categorizeFeatures(features)
+	userGSUB, _ := s.planFeatures(buf, features)
 	s.applyUserIndicGSUBFeatures(buf, userGSUB)
 
 	// Step 9.5: Apply other GSUB features
@@ -2038,7 +2040,7 @@ func (s *Shaper) shapeIndic(buf *Buffer, features []Feature) {
 	// Step 12: Apply GPOS features
 	// For Indic, we need to apply standard GPOS features even if none were explicitly requested
 	// HarfBuzz: These are applied as part of the Indic shaper's positioning phase
-	gposFeatures := s.getIndicGPOSFeatures(features)
+	gposFeatures := s.getIndicGPOSFeatures(buf, features)
 	s.applyGPOS(buf, gposFeatures)
 
 	// Note: Indic uses ZeroWidthMarksNone, so NO zeroMarkWidthsByGDEF call here
@@ -2049,7 +2051,7 @@ func (s *Shaper) shapeIndic(buf *Buffer, features []Feature) {
 // HarfBuzz equivalent: positioning features are always applied for Indic scripts.
 // The Indic-specific features (dist, abvm, blwm) are always required, plus
 // standard positioning features (kern, mark, mkmk).
-func (s *Shaper) getIndicGPOSFeatures(features []Feature) []Feature {
+func (s *Shaper) getIndicGPOSFeatures(buf *Buffer, features []Feature) []Feature {
 	// Indic-specific positioning features are ALWAYS applied
 	// These are not optional - they are required for correct Indic rendering
 	// HarfBuzz: hb-ot-shaper-indic.cc applies these unconditionally
@@ -2080,7 +2082,7 @@ func (s *Shaper) getIndicGPOSFeatures(features []Feature) []Feature {
 	}
 
 	// Add any explicit GPOS features from user (they may override defaults)
-	_, userGPOS := s.categorizeFeatures(features)
+	_, userGPOS := s.planFeatures(buf, features)
 	for _, f := range userGPOS {
 		// Only add if not already in result
 		found := false
@@ -2,6 +2,7 @@ package ot
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/boxesandglue/textshape/internal/testutil"
@@ -445,9 +446,13 @@ func TestHebrewDiacriticsDebug(t *testing.T) {
 	buf.Direction = DirectionRTL
 	buf.Script = MakeTag('H', 'e', 'b', 'r')
 
-	// Enable debug output
-	debugGPOS = true
-	defer func() { debugGPOS = false }()
+	// Trace the GPOS lookups
+	buf.SetMessageFunc(func(buf *Buffer, font *Font, message string) bool {
+		if strings.HasPrefix(message, "end GPOS") {
+			t.Logf("%s: %s", message, buf.Serialize(font, SerializeFormatText, SerializeFlagNoGlyphNames))
+		}
+		return true
+	})
 
 	// Print GPOS lookup info
 	if shaper.gpos != nil {
@@ -181,6 +181,8 @@ func (s *Shaper) shapeKhmer(buf *Buffer, features []Feature) {
 
 	// Step 5: Find syllables and merge clusters
 	hasBrokenSyllable := s.findKhmerSyllables(buf, categories)
+	// HarfBuzz: setup_syllables_khmer() marks syllables unsafe to break
+	unsafeToBreakSyllables(buf, func(i int) uint32 { return buf.Info[i].Mask & 0xFFFF })
 
 	// Step 6: Insert dotted circles for broken clusters
 	// HarfBuzz equivalent: hb_syllabic_insert_dotted_circles()
@@ -198,7 +200,7 @@ func (s *Shaper) shapeKhmer(buf *Buffer, features []Feature) {
 	s.setBaseAdvances(buf)
 
 	// Step 9: Apply GPOS features
-	_, gposFeatures := s.categorizeFeatures(features)
+	_, gposFeatures := s.planFeatures(buf, features)
 	gposFeatures = append(gposFeatures, s.getKhmerGPOSFeatures()...)
 	s.applyGPOS(buf, gposFeatures)
 
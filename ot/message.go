@@ -0,0 +1,45 @@
+package ot
+
+import "fmt"
+
+// Shaping messages
+//
+// HarfBuzz equivalent: hb_buffer_set_message_func() and
+// hb_buffer_t::message() in hb-buffer.cc
+//
+// A buffer can carry a callback that the shaper calls before and after
+// each stage of the pipeline. It receives the buffer in its current state,
+// so Serialize shows what a stage did. The messages are:
+//
+//	start normalize / end normalize
+//	start GSUB lookup <index> feature '<tag>' / end GSUB lookup ...
+//	start GPOS lookup <index> feature '<tag>' / end GPOS lookup ...
+//	start fallback mark / end fallback mark
+//	start fallback kern / end fallback kern
+//
+// Returning false from a start message skips that stage. Returning false
+// from all following start messages stops shaping after a stage.
+
+// MessageFunc receives the shaping messages of a buffer. font is the font
+// being shaped with and may be nil when a lookup is applied directly. The
+// callback must not modify the buffer. The return value of end messages
+// is ignored.
+// HarfBuzz equivalent: hb_buffer_message_func_t in hb-buffer.h
+type MessageFunc func(buf *Buffer, font *Font, message string) bool
+
+// SetMessageFunc sets the message callback of the buffer. A nil func
+// disables messages.
+// HarfBuzz equivalent: hb_buffer_set_message_func() in hb-buffer.cc
+func (b *Buffer) SetMessageFunc(f MessageFunc) {
+	b.messageFunc = f
+}
+
+// message sends a message to the callback and reports whether the stage
+// should run. The message is only formatted if a callback is set.
+// HarfBuzz equivalent: hb_buffer_t::message() in hb-buffer.hh
+func (b *Buffer) message(font *Font, format string, args ...interface{}) bool {
+	if b.messageFunc == nil {
+		return true
+	}
+	return b.messageFunc(b, font, fmt.Sprintf(format, args...))
+}
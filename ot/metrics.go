@@ -3,6 +3,7 @@ package ot
 import (
 	"encoding/binary"
 	"io"
+	"sync"
 )
 
 // FontExtents contains font-wide extent values.
@@ -15,10 +16,10 @@ type FontExtents struct {
 
 // GlyphExtents contains glyph extent values.
 type GlyphExtents struct {
-	XBearing int16 // Left side of glyph from origin
-	YBearing int16 // Top side of glyph from origin
-	Width    int16 // Width of glyph
-	Height   int16 // Height of glyph (usually negative)
+	XBearing int32 // Left side of glyph from origin
+	YBearing int32 // Top side of glyph from origin
+	Width    int32 // Width of glyph
+	Height   int32 // Height of glyph (usually negative)
 }
 
 // Head represents the font header table.
@@ -309,6 +310,10 @@ type Face struct {
 	fvar  *Fvar
 	upem  uint16
 	isCFF bool
+
+	// Outline tables, parsed on first use by DrawGlyph
+	outlineOnce sync.Once
+	outlines    outlineTables
 }
 
 // NewFace creates a new Face from a Font, parsing required tables.
@@ -362,8 +367,8 @@ func NewFace(font *Font) (*Face, error) {
 		}
 	}
 
-	// Check if CFF font
-	f.isCFF = font.HasTable(TagCFF)
+	// Check if CFF font (CFF or CFF2 outlines)
+	f.isCFF = font.HasTable(TagCFF) || font.HasTable(TagCFF2)
 
 	// Parse fvar (variable fonts)
 	if data, err := font.TableData(TagFvar); err == nil {
@@ -378,7 +383,7 @@ func (f *Face) Upem() uint16 {
 	return f.upem
 }
 
-// IsCFF returns true if the font uses CFF outlines.
+// IsCFF returns true if the font uses CFF or CFF2 outlines.
 func (f *Face) IsCFF() bool {
 	return f.isCFF
 }
@@ -626,7 +626,7 @@ func (s *Shaper) shapeMyanmar(buf *Buffer, features []Feature) {
 	s.setBaseAdvances(buf)
 
 	// Step 11: Apply GPOS features
-	_, gposFeatures := s.categorizeFeatures(features)
+	_, gposFeatures := s.planFeatures(buf, features)
 	gposFeatures = append(gposFeatures, s.getMyanmarGPOSFeatures()...)
 	s.applyGPOS(buf, gposFeatures)
 
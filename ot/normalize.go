@@ -10,10 +10,6 @@ package ot
 // 2. Reorder: Sort marks by canonical combining class
 // 3. Recompose: Combine base + mark sequences if font has precomposed glyph
 
-import (
-	"sort"
-)
-
 // NormalizationMode controls how normalization is performed.
 // HarfBuzz equivalent: hb_ot_shape_normalization_mode_t
 type NormalizationMode int
@@ -55,30 +51,33 @@ func (s *Shaper) normalizeBuffer(buf *Buffer, mode NormalizationMode) {
 		return
 	}
 
+	if !buf.message(s.font, "start normalize") {
+		return
+	}
+	defer buf.message(s.font, "end normalize")
+
 	// Phase 1: Decompose
 	// HarfBuzz equivalent: hb-ot-shape-normalize.cc:322-367
-	decomposed := s.decomposeBuffer(buf, mode != NormalizationModeDecomposed)
+	buf.Info = s.decomposeBuffer(buf, mode != NormalizationModeDecomposed)
 
 	// Phase 2: Reorder marks by combining class
 	// HarfBuzz equivalent: hb-ot-shape-normalize.cc:370-400
-	s.reorderMarks(decomposed)
+	s.reorderMarks(buf)
 
 	// Phase 2b: Unhide CGJ between marks with correct CCC order
 	// HarfBuzz equivalent: hb-ot-shape-normalize.cc:402-414
 	// CGJ (U+034F) should NOT be skipped during GSUB context matching if it's
 	// between two marks where the preceding mark has CCC <= following mark's CCC.
 	// This allows CGJ to be "transparent" in such cases.
-	unhideCGJ(decomposed)
+	unhideCGJ(buf.Info)
 
 	// Phase 3: Recompose if mode allows
 	// HarfBuzz equivalent: hb-ot-shape-normalize.cc:418-473
 	if mode == NormalizationModeComposedDiacritics {
-		decomposed = s.recomposeBuffer(decomposed)
+		buf.Info = s.recomposeBuffer(buf.Info, buf.ClusterLevel)
 	}
 
-	// Update buffer
-	buf.Info = decomposed
-	buf.Pos = make([]GlyphPos, len(decomposed))
+	buf.Pos = make([]GlyphPos, len(buf.Info))
 }
 
 // decomposeBuffer performs the decomposition phase.
@@ -153,6 +152,7 @@ func (s *Shaper) decomposeCurrentCharacter(result *[]GlyphInfo, info *GlyphInfo,
 				Cluster:    cluster,
 				Mask:       MaskGlobal,
 				GlyphProps: glyphProps,
+				Flags:      info.Flags,
 			})
 			return
 		}
@@ -162,6 +162,9 @@ func (s *Shaper) decomposeCurrentCharacter(result *[]GlyphInfo, info *GlyphInfo,
 	decomposed := s.decomposeCodepoint(cp, cluster)
 	if len(decomposed) > 0 {
 		decomposed[0].GlyphProps = glyphProps
+		for i := range decomposed {
+			decomposed[i].Flags = info.Flags
+		}
 		*result = append(*result, decomposed...)
 		return
 	}
@@ -173,6 +176,7 @@ func (s *Shaper) decomposeCurrentCharacter(result *[]GlyphInfo, info *GlyphInfo,
 			Cluster:    cluster,
 			Mask:       MaskGlobal,
 			GlyphProps: glyphProps,
+			Flags:      info.Flags,
 		})
 		return
 	}
@@ -183,6 +187,7 @@ func (s *Shaper) decomposeCurrentCharacter(result *[]GlyphInfo, info *GlyphInfo,
 		Cluster:    cluster,
 		Mask:       MaskGlobal,
 		GlyphProps: glyphProps,
+		Flags:      info.Flags,
 	})
 }
 
@@ -276,7 +281,8 @@ func unhideCGJ(info []GlyphInfo) {
 //
 // After sorting marks by combining class, this function optionally calls
 // a script-specific reorder callback (e.g., for Arabic mark reordering).
-func (s *Shaper) reorderMarks(info []GlyphInfo) {
+func (s *Shaper) reorderMarks(buf *Buffer) {
+	info := buf.Info
 	n := len(info)
 	if n < 2 {
 		return
@@ -307,28 +313,42 @@ func (s *Shaper) reorderMarks(info []GlyphInfo) {
 
 		// Stable sort by combining class
 		// HarfBuzz equivalent: buffer->sort() with compare_combining_class
-		sortMarksByCombiningClass(info[start:end])
+		sortMarksByCombiningClass(buf, start, end)
 
 		// Call script-specific mark reordering callback if set
 		// HarfBuzz equivalent: plan->shaper->reorder_marks() in hb-ot-shape-normalize.cc:394-395
-		if s.reorderMarksCallback != nil {
-			s.reorderMarksCallback(info, start, end)
+		if buf.reorderMarks != nil {
+			buf.reorderMarks(buf, start, end)
 		}
 	}
 }
 
-// sortMarksByCombiningClass performs a stable sort on marks by combining class.
-func sortMarksByCombiningClass(marks []GlyphInfo) {
-	sort.SliceStable(marks, func(i, j int) bool {
-		ccI := getModifiedCombiningClass(marks[i].Codepoint)
-		ccJ := getModifiedCombiningClass(marks[j].Codepoint)
-		return ccI < ccJ
-	})
+// sortMarksByCombiningClass performs a stable insertion sort on the marks in
+// [start, end) by combining class. The clusters of moved marks are merged
+// with the marks they move across.
+// HarfBuzz equivalent: hb_buffer_t::sort() in hb-buffer.cc
+func sortMarksByCombiningClass(buf *Buffer, start, end int) {
+	info := buf.Info
+	for i := start + 1; i < end; i++ {
+		cc := getModifiedCombiningClass(info[i].Codepoint)
+		j := i
+		for j > start && getModifiedCombiningClass(info[j-1].Codepoint) > cc {
+			j--
+		}
+		if i == j {
+			continue
+		}
+		// Move item i to occupy place for item j, shift what's in between
+		buf.MergeClusters(j, i+1)
+		t := info[i]
+		copy(info[j+1:i+1], info[j:i])
+		info[j] = t
+	}
 }
 
 // recomposeBuffer performs the recomposition phase.
 // HarfBuzz equivalent: hb-ot-shape-normalize.cc:418-473
-func (s *Shaper) recomposeBuffer(info []GlyphInfo) []GlyphInfo {
+func (s *Shaper) recomposeBuffer(info []GlyphInfo, level ClusterLevel) []GlyphInfo {
 	if len(info) < 2 {
 		return info
 	}
@@ -368,7 +388,8 @@ func (s *Shaper) recomposeBuffer(info []GlyphInfo) []GlyphInfo {
 					// Compose!
 					result[starterIdx].Codepoint = composed
 					// Merge clusters: use minimum cluster value
-					if info[i].Cluster < result[starterIdx].Cluster {
+					// HarfBuzz: buffer->merge_out_clusters(starter, buffer->out_len)
+					if level != ClusterLevelCharacters && info[i].Cluster < result[starterIdx].Cluster {
 						result[starterIdx].Cluster = info[i].Cluster
 					}
 					continue
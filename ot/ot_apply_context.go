@@ -87,6 +87,12 @@ type OTApplyContext struct {
 	// HarfBuzz: hb_vector_t<uint32_t> match_positions
 	MatchPositions []int
 
+	// Range of glyphs examined by the current contextual rule, for glyph
+	// flags. matchStart is a backtrack position (see BacktrackInfo),
+	// matchEnd an exclusive input position.
+	// HarfBuzz: start_index/end_index in chain_context_apply_lookup()
+	matchStart, matchEnd int
+
 	// GPOS-specific: last base glyph tracking
 	// HarfBuzz: signed last_base, unsigned last_base_until in hb_ot_apply_context_t:741-742
 	LastBase      int // Index of last base glyph (-1 if none)
@@ -95,6 +101,11 @@ type OTApplyContext struct {
 	// Has glyph classes from GDEF
 	// HarfBuzz: bool has_glyph_classes
 	HasGlyphClasses bool
+
+	// Device holds the variation coordinates and ppem that Device and
+	// VariationIndex tables are resolved against (nil: tables are ignored).
+	// HarfBuzz: font->coords, font->x_ppem/y_ppem and var_store
+	Device *DeviceContext
 }
 
 // NewOTApplyContext creates a new apply context.
@@ -618,7 +629,7 @@ func (ctx *OTApplyContext) ReplaceGlyphs(newGlyphs []GlyphID) {
 		// Deletion: consume input without output (HarfBuzz: buffer->delete_glyph())
 		// Spec disallows this, but Uniscribe allows it.
 		// https://github.com/harfbuzz/harfbuzz/issues/253
-		ctx.Buffer.Idx++
+		ctx.Buffer.deleteGlyph()
 		return
 	}
 
@@ -667,9 +678,9 @@ func (ctx *OTApplyContext) ReplaceGlyphs(newGlyphs []GlyphID) {
 // - Consume 1 input glyph (idx++)
 // - Produce 0 output glyphs (no outputGlyph call)
 func (ctx *OTApplyContext) DeleteGlyph() {
-	// Skip input glyph without outputting
-	// HarfBuzz: idx += 1, out_len += 0
-	ctx.Buffer.Idx++
+	// Skip input glyph without outputting, keeping its cluster alive
+	// HarfBuzz: buffer->delete_glyph()
+	ctx.Buffer.deleteGlyph()
 }
 
 // LigatePositions replaces glyphs at specific positions with a ligature.
@@ -776,6 +787,81 @@ func (ctx *OTApplyContext) LigatePositions(ligGlyph GlyphID, positions []int) {
 	_ = lastLigID // Avoid unused variable warning
 }
 
+// --- Glyph flags ---
+
+// beginMatch starts recording the glyphs a contextual rule examines.
+func (ctx *OTApplyContext) beginMatch() {
+	ctx.matchStart = ctx.Buffer.BacktrackLen()
+	ctx.matchEnd = ctx.Buffer.Idx + 1
+}
+
+// matchedAt records that the rule examined the input glyph at pos. A
+// position before Idx is taken as backtrack context.
+func (ctx *OTApplyContext) matchedAt(pos int) {
+	if pos < ctx.Buffer.Idx {
+		ctx.matchedBacktrackAt(ctx.Buffer.BacktrackLen() - (ctx.Buffer.Idx - pos))
+		return
+	}
+	if pos+1 > ctx.matchEnd {
+		ctx.matchEnd = min(pos+1, len(ctx.Buffer.Info))
+	}
+}
+
+// matchedBacktrackAt records that the rule examined the backtrack glyph
+// at pos.
+func (ctx *OTApplyContext) matchedBacktrackAt(pos int) {
+	if pos < ctx.matchStart {
+		ctx.matchStart = max(pos, 0)
+	}
+}
+
+// endMatch sets the glyph flags for the examined glyphs: a matched rule
+// makes them unsafe to break, a failed one unsafe to concat. It has to be
+// called before the nested lookups change the buffer.
+// HarfBuzz equivalent: unsafe_to_break_from_outbuffer() and
+// unsafe_to_concat_from_outbuffer() in context_apply_lookup() and
+// chain_context_apply_lookup()
+func (ctx *OTApplyContext) endMatch(matched bool) {
+	if matched {
+		ctx.Buffer.unsafeToBreakFromOutbuffer(ctx.matchStart, ctx.matchEnd)
+	} else {
+		ctx.Buffer.unsafeToConcatFromOutbuffer(ctx.matchStart, ctx.matchEnd)
+	}
+}
+
+// --- Text context ---
+
+// matchPreContext matches the backtrack items from index from on against
+// the buffer's pre-context, for when the backtrack runs past the start of
+// the buffer. match reports whether item i matches a glyph.
+func (ctx *OTApplyContext) matchPreContext(from, count int, match func(i int, gid GlyphID) bool) bool {
+	return ctx.matchTextContext(ctx.Buffer.contextGlyphs[0], from, count, match)
+}
+
+// matchPostContext matches the lookahead items from index from on against
+// the buffer's post-context, for when the lookahead runs past the end of
+// the buffer.
+func (ctx *OTApplyContext) matchPostContext(from, count int, match func(i int, gid GlyphID) bool) bool {
+	return ctx.matchTextContext(ctx.Buffer.contextGlyphs[1], from, count, match)
+}
+
+// matchTextContext matches items against context glyphs in order, skipping
+// glyphs the lookup ignores. The context is matched by nominal glyph; it
+// isn't substituted itself.
+func (ctx *OTApplyContext) matchTextContext(glyphs []GlyphID, from, count int, match func(i int, gid GlyphID) bool) bool {
+	j := 0
+	for i := from; i < count; i++ {
+		for j < len(glyphs) && !ctx.CheckGlyphProperty(&GlyphInfo{GlyphID: glyphs[j]}) {
+			j++
+		}
+		if j >= len(glyphs) || !match(i, glyphs[j]) {
+			return false
+		}
+		j++
+	}
+	return true
+}
+
 // --- Navigation ---
 
 // NextGlyph finds the next glyph that should not be skipped.
@@ -857,13 +943,31 @@ func (ctx *OTApplyContext) MergeClusters(start, end int) {
 // --- GPOS-specific ---
 
 // AdjustPosition adjusts the position at the given index with a ValueRecord.
-// HarfBuzz equivalent: applies ValueRecord values directly to position.
+// Advances only apply in the direction of the text. Y advances grow
+// downwards but font space grows upwards, hence the negation.
+// HarfBuzz equivalent: ValueFormat::apply_value() in OT/Layout/GPOS/ValueFormat.hh
 func (ctx *OTApplyContext) AdjustPosition(index int, vr *ValueRecord) {
 	if ctx.Buffer == nil || index < 0 || index >= len(ctx.Buffer.Pos) {
 		return
 	}
-	ctx.Buffer.Pos[index].XOffset += vr.XPlacement
-	ctx.Buffer.Pos[index].YOffset += vr.YPlacement
-	ctx.Buffer.Pos[index].XAdvance += vr.XAdvance
-	ctx.Buffer.Pos[index].YAdvance += vr.YAdvance
+	horizontal := ctx.Buffer.Direction.IsHorizontal()
+	pos := &ctx.Buffer.Pos[index]
+	pos.XOffset += ctx.Device.emScaleX(vr.XPlacement)
+	pos.YOffset += ctx.Device.emScaleY(vr.YPlacement)
+	if horizontal {
+		pos.XAdvance += ctx.Device.emScaleX(vr.XAdvance)
+	} else {
+		pos.YAdvance -= ctx.Device.emScaleY(vr.YAdvance)
+	}
+
+	if ctx.Device == nil || !vr.HasDevice() {
+		return
+	}
+	pos.XOffset += ctx.Device.XDelta(vr.XPlaDevice)
+	pos.YOffset += ctx.Device.YDelta(vr.YPlaDevice)
+	if horizontal {
+		pos.XAdvance += ctx.Device.XDelta(vr.XAdvDevice)
+	} else {
+		pos.YAdvance -= ctx.Device.YDelta(vr.YAdvDevice)
+	}
 }
@@ -91,19 +91,36 @@ func (m *OTMap) ApplyGSUB(gsub *GSUB, buf *Buffer, font *Font, gdef *GDEF) {
 	}
 
 	for _, lookup := range m.GSUBLookups {
+		// HarfBuzz: hb-ot-layout.cc:2036-2038
+		if !buf.message(font, "start GSUB lookup %d feature '%s'", lookup.Index, lookup.FeatureTag) {
+			continue
+		}
 		gsub.applyLookupWithMap(int(lookup.Index), buf, font, gdef, &lookup)
+		buf.message(font, "end GSUB lookup %d feature '%s'", lookup.Index, lookup.FeatureTag)
 	}
 }
 
 // ApplyGPOS applies all GPOS lookups in the map to the buffer.
 // HarfBuzz equivalent: hb_ot_map_t::apply() with GPOS proxy in hb-ot-layout.cc:2010-2060
 func (m *OTMap) ApplyGPOS(gpos *GPOS, buf *Buffer, font *Font, gdef *GDEF) {
+	m.ApplyGPOSWithDevice(gpos, buf, font, gdef, nil)
+}
+
+// ApplyGPOSWithDevice applies all GPOS lookups in the map to the buffer and
+// resolves Device and VariationIndex tables against dev. A nil dev ignores
+// these tables.
+// HarfBuzz equivalent: hb_ot_map_t::apply() with GPOS proxy in hb-ot-layout.cc:2010-2060
+func (m *OTMap) ApplyGPOSWithDevice(gpos *GPOS, buf *Buffer, font *Font, gdef *GDEF, dev *DeviceContext) {
 	if gpos == nil {
 		return
 	}
 
 	for _, lookup := range m.GPOSLookups {
-		gpos.applyLookupWithMap(int(lookup.Index), buf, font, gdef, &lookup)
+		if !buf.message(font, "start GPOS lookup %d feature '%s'", lookup.Index, lookup.FeatureTag) {
+			continue
+		}
+		gpos.applyLookupWithMap(int(lookup.Index), buf, font, gdef, &lookup, dev)
+		buf.message(font, "end GPOS lookup %d feature '%s'", lookup.Index, lookup.FeatureTag)
 	}
 }
 
@@ -200,7 +217,7 @@ func (g *GSUB) applyLookupWithMap(lookupIndex int, buf *Buffer, font *Font, gdef
 // The lookup properties (mask, auto_zwj, etc.) are set before application.
 //
 // HarfBuzz reference: hb-ot-layout.cc:2042-2052
-func (g *GPOS) applyLookupWithMap(lookupIndex int, buf *Buffer, font *Font, gdef *GDEF, lookupMap *LookupMap) {
+func (g *GPOS) applyLookupWithMap(lookupIndex int, buf *Buffer, font *Font, gdef *GDEF, lookupMap *LookupMap, dev *DeviceContext) {
 	lookup := g.GetLookup(lookupIndex)
 	if lookup == nil {
 		return
@@ -231,6 +248,7 @@ func (g *GPOS) applyLookupWithMap(lookupIndex int, buf *Buffer, font *Font, gdef
 		Random:           lookupMap.Random,      // From LookupMap (HarfBuzz: lookup.random)
 		PerSyllable:      lookupMap.PerSyllable, // From LookupMap (HarfBuzz: lookup.per_syllable)
 		NestingLevel:     HBMaxNestingLevel,     // Initialize nesting level
+		Device:           dev,
 	}
 
 	// Set RecurseFunc for nested lookup application
@@ -1,5 +1,7 @@
 package ot
 
+import "sync"
+
 // OT Shaper - HarfBuzz-style script-specific shaping
 //
 // HarfBuzz equivalent: hb_ot_shaper_t in hb-ot-shaper.hh:67-169
@@ -108,6 +110,7 @@ type NormalizeContext struct {
 //
 // The plan is compiled once and can be reused for multiple shaping calls.
 // This improves performance by avoiding repeated feature lookups.
+// Create plans with Shaper.NewShapePlan and use them with ShapeWithPlan.
 type ShapePlan struct {
 	// Shaper is the script-specific shaper for this plan
 	Shaper *OTShaper
@@ -137,6 +140,32 @@ type ShapePlan struct {
 	gsub *GSUB
 	gpos *GPOS
 	gdef *GDEF
+
+	// owner is the Shaper the plan was created by.
+	owner *Shaper
+
+	// userFeatures are the features the plan was created with, features
+	// the resolved features (defaults, vertical features) split into
+	// gsubFeatures and gposFeatures.
+	userFeatures    []Feature
+	features        []Feature
+	defaultFeatures bool
+	gsubFeatures    []Feature
+	gposFeatures    []Feature
+
+	// gsubVariationsIndex is the FeatureVariations record for the
+	// variation coordinates of the plan.
+	// HarfBuzz: hb_shape_plan_key_t::variations_index[]
+	gsubVariationsIndex uint32
+
+	// coords is the key of the variation coordinates the plan was created
+	// at, see coordsKey.
+	coords string
+
+	// Lookup maps and Indic plans compiled on first use, guarded by mu.
+	mu         sync.Mutex
+	maps       map[string]*OTMap
+	indicPlans map[Tag]*IndicPlan
 }
 
 // SegmentProperties holds text segment properties.
@@ -387,7 +416,7 @@ var HebrewShaper = &OTShaper{
 // HarfBuzz equivalent: _hb_ot_shaper_hangul
 var HangulShaper = &OTShaper{
 	Name:                    "hangul",
-	NormalizationPreference: NormalizationModeAuto,
+	NormalizationPreference: NormalizationModeNone,
 	ZeroWidthMarks:          ZeroWidthMarksNone,
-	FallbackPosition:        true,
+	FallbackPosition:        false,
 }
@@ -92,6 +92,16 @@ func arabicJoiningAnalysis(buf *Buffer) []ArabicAction {
 	state := uint8(0)
 	prevAction := arabicActionNone
 
+	// HarfBuzz: "Check pre-context"
+	for _, cp := range buf.preContext {
+		thisType := getJoiningType(cp, getGeneralCategory(cp))
+		if thisType == joiningTypeT {
+			continue
+		}
+		state = arabicStateTable[state][joiningTypeColumn(thisType)].nextState
+		break
+	}
+
 	// Process each character
 	for i := 0; i < len(buf.Info); i++ {
 		thisType := getJoiningType(buf.Info[i].Codepoint, getGeneralCategory(buf.Info[i].Codepoint))
@@ -120,6 +130,24 @@ func arabicJoiningAnalysis(buf *Buffer) []ArabicAction {
 		state = entry.nextState
 	}
 
+	// HarfBuzz: "Check post-context"
+	for _, cp := range buf.postContext {
+		thisType := getJoiningType(cp, getGeneralCategory(cp))
+		if thisType == joiningTypeT {
+			continue
+		}
+		entry := arabicStateTable[state][joiningTypeColumn(thisType)]
+		if prevAction != arabicActionNone && entry.prevAction != arabicActionNone {
+			for j := len(actions) - 1; j >= 0; j-- {
+				if actions[j] != arabicActionNone {
+					actions[j] = entry.prevAction
+					break
+				}
+			}
+		}
+		break
+	}
+
 	return actions
 }
 
@@ -167,13 +195,14 @@ func isArabicMCM(cp Codepoint) bool {
 //
 // Note: This version is kept for OTShaper interface compatibility.
 func reorderMarksArabic(plan *ShapePlan, buf *Buffer, start, end int) {
-	reorderMarksArabicSlice(buf.Info, start, end)
+	reorderArabicMarks(buf, start, end)
 }
 
-// reorderMarksArabicSlice is the slice-based version of reorderMarksArabic.
-// Used during normalization when working with temporary slices.
+// reorderArabicMarks is the plan-independent version of reorderMarksArabic,
+// used as the normalization callback.
 // HarfBuzz equivalent: reorder_marks_arabic() in hb-ot-shaper-arabic.cc:686-750
-func reorderMarksArabicSlice(info []GlyphInfo, start, end int) {
+func reorderArabicMarks(buf *Buffer, start, end int) {
+	info := buf.Info
 	// Note: We process even single-element sequences because we need to
 	// set ModifiedCCC for Arabic MCMs regardless of reordering.
 	// HarfBuzz does NOT have an early return here.
@@ -210,7 +239,7 @@ func reorderMarksArabicSlice(info []GlyphInfo, start, end int) {
 
 		// Shift the MCMs to the beginning of the mark sequence
 		// HarfBuzz: memmove pattern in reorder_marks_arabic lines 723-726
-		mergeClustersSlice(info, start, j)
+		buf.MergeClusters(start, j)
 
 		// Save MCMs
 		mcmCount := j - i
@@ -420,7 +449,7 @@ func applyStch(buf *Buffer, shaper *Shaper) {
 						j--
 						buf.Info[j] = buf.Info[k-1]
 						buf.Pos[j] = buf.Pos[k-1]
-						buf.Pos[j].XOffset = int16(xOffset)
+						buf.Pos[j].XOffset = int32(xOffset)
 						if !rtl {
 							xOffset += width
 							if n > 0 {
@@ -458,9 +487,9 @@ func applyStch(buf *Buffer, shaper *Shaper) {
 }
 
 // getGlyphHAdvance returns the horizontal advance for a glyph.
-func (s *Shaper) getGlyphHAdvance(glyph GlyphID) int16 {
+func (s *Shaper) getGlyphHAdvance(glyph GlyphID) int32 {
 	if s.hmtx != nil {
-		return int16(s.hmtx.GetAdvanceWidth(glyph))
+		return s.glyphHAdvance(glyph)
 	}
 	return 0
 }
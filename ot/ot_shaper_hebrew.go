@@ -30,7 +30,7 @@ const (
 	hebrewCCC26 = 26 // point varika
 )
 
-// reorderMarksHebrewSlice performs Hebrew-specific mark reordering.
+// reorderHebrewMarks performs Hebrew-specific mark reordering.
 // HarfBuzz equivalent: reorder_marks_hebrew() in hb-ot-shaper-hebrew.cc:165-190
 //
 // This function looks for a specific pattern and swaps marks:
@@ -39,7 +39,8 @@ const (
 //
 // This is needed because Hebrew vowels need to be positioned correctly
 // when multiple marks are stacked under a base character.
-func reorderMarksHebrewSlice(info []GlyphInfo, start, end int) {
+func reorderHebrewMarks(buf *Buffer, start, end int) {
+	info := buf.Info
 	// Need at least 3 marks for this pattern
 	// HarfBuzz: for (unsigned i = start + 2; i < end; i++)
 	for i := start + 2; i < end; i++ {
@@ -58,13 +59,7 @@ func reorderMarksHebrewSlice(info []GlyphInfo, start, end int) {
 
 			// Merge clusters before swapping
 			// HarfBuzz: buffer->merge_clusters(i - 1, i + 1)
-			// We merge clusters inline since we're working with a slice
-			minCluster := info[i-1].Cluster
-			if info[i].Cluster < minCluster {
-				minCluster = info[i].Cluster
-			}
-			info[i-1].Cluster = minCluster
-			info[i].Cluster = minCluster
+			buf.MergeClusters(i-1, i+1)
 
 			// Swap the last two marks
 			// HarfBuzz: hb_swap(info[i - 1], info[i])
@@ -80,7 +75,7 @@ func reorderMarksHebrewSlice(info []GlyphInfo, start, end int) {
 // reorderMarksHebrew is the OTShaper callback wrapper.
 // HarfBuzz equivalent: reorder_marks field in _hb_ot_shaper_hebrew
 func reorderMarksHebrew(plan *ShapePlan, buf *Buffer, start, end int) {
-	reorderMarksHebrewSlice(buf.Info, start, end)
+	reorderHebrewMarks(buf, start, end)
 }
 
 // Hebrew presentation form dagesh table
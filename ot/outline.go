@@ -0,0 +1,115 @@
+package ot
+
+import "math"
+
+// Pen receives the drawing commands of a glyph outline in font units.
+// Y grows upwards, as in the font.
+type Pen interface {
+	MoveTo(x, y float32)
+	LineTo(x, y float32)
+	QuadTo(cx, cy, x, y float32)
+	CubeTo(c1x, c1y, c2x, c2y, x, y float32)
+	Close()
+}
+
+// PathOp is the kind of a path segment.
+type PathOp uint8
+
+// Path segment kinds.
+const (
+	PathMoveTo PathOp = iota
+	PathLineTo
+	PathQuadTo
+	PathCubeTo
+	PathClose
+)
+
+// PathSegment is one drawing command of a Path. Args holds the control
+// points followed by the end point as x, y pairs; unused entries are zero.
+type PathSegment struct {
+	Op   PathOp
+	Args [6]float32
+}
+
+// Path is a glyph outline recorded as a list of segments.
+// A *Path can be used as a Pen.
+type Path []PathSegment
+
+// MoveTo starts a new contour at (x, y).
+func (p *Path) MoveTo(x, y float32) {
+	*p = append(*p, PathSegment{Op: PathMoveTo, Args: [6]float32{x, y}})
+}
+
+// LineTo adds a line to (x, y).
+func (p *Path) LineTo(x, y float32) {
+	*p = append(*p, PathSegment{Op: PathLineTo, Args: [6]float32{x, y}})
+}
+
+// QuadTo adds a quadratic Bézier curve to (x, y).
+func (p *Path) QuadTo(cx, cy, x, y float32) {
+	*p = append(*p, PathSegment{Op: PathQuadTo, Args: [6]float32{cx, cy, x, y}})
+}
+
+// CubeTo adds a cubic Bézier curve to (x, y).
+func (p *Path) CubeTo(c1x, c1y, c2x, c2y, x, y float32) {
+	*p = append(*p, PathSegment{Op: PathCubeTo, Args: [6]float32{c1x, c1y, c2x, c2y, x, y}})
+}
+
+// Close closes the current contour.
+func (p *Path) Close() {
+	*p = append(*p, PathSegment{Op: PathClose})
+}
+
+// numPoints returns the number of points in Args used by the segment.
+func (s PathSegment) numPoints() int {
+	switch s.Op {
+	case PathMoveTo, PathLineTo:
+		return 1
+	case PathQuadTo:
+		return 2
+	case PathCubeTo:
+		return 3
+	}
+	return 0
+}
+
+// Bounds returns the control box of the path: the bounding box of all
+// end and control points. ok is false for an empty path.
+// Like HarfBuzz, CFF glyph extents are based on this box.
+func (p Path) Bounds() (xMin, yMin, xMax, yMax float32, ok bool) {
+	xMin, yMin = float32(math.Inf(1)), float32(math.Inf(1))
+	xMax, yMax = float32(math.Inf(-1)), float32(math.Inf(-1))
+	for _, seg := range p {
+		for i := 0; i < seg.numPoints(); i++ {
+			x, y := seg.Args[2*i], seg.Args[2*i+1]
+			xMin = float32(math.Min(float64(xMin), float64(x)))
+			yMin = float32(math.Min(float64(yMin), float64(y)))
+			xMax = float32(math.Max(float64(xMax), float64(x)))
+			yMax = float32(math.Max(float64(yMax), float64(y)))
+			ok = true
+		}
+	}
+	if !ok {
+		return 0, 0, 0, 0, false
+	}
+	return xMin, yMin, xMax, yMax, true
+}
+
+// Extents returns the glyph extents of the path, rounded outwards to
+// integers. ok is false for an empty path.
+func (p Path) Extents() (GlyphExtents, bool) {
+	xMin, yMin, xMax, yMax, ok := p.Bounds()
+	if !ok {
+		return GlyphExtents{}, false
+	}
+	left := math.Floor(float64(xMin))
+	bottom := math.Floor(float64(yMin))
+	right := math.Ceil(float64(xMax))
+	top := math.Ceil(float64(yMax))
+	return GlyphExtents{
+		XBearing: int32(left),
+		YBearing: int32(top),
+		Width:    int32(right - left),
+		Height:   int32(bottom - top),
+	}, true
+}
@@ -40,6 +40,9 @@ var (
 	TagHead = MakeTag('h', 'e', 'a', 'd')
 	TagHhea = MakeTag('h', 'h', 'e', 'a')
 	TagHmtx = MakeTag('h', 'm', 't', 'x')
+	TagVhea = MakeTag('v', 'h', 'e', 'a')
+	TagVmtx = MakeTag('v', 'm', 't', 'x')
+	TagVORG = MakeTag('V', 'O', 'R', 'G')
 	TagMaxp = MakeTag('m', 'a', 'x', 'p')
 	TagName = MakeTag('n', 'a', 'm', 'e')
 	TagOS2  = MakeTag('O', 'S', '/', '2')
@@ -0,0 +1,131 @@
+package ot
+
+import "math"
+
+// Font scale and size
+//
+// HarfBuzz equivalent: hb_font_set_scale(), hb_font_set_ppem() and
+// hb_font_set_ptem() in hb-font.cc
+//
+// By default a Shaper returns positions in font units. With SetScale they
+// come back in caller units instead: a scale of 12*64 at 12 pixels per em
+// gives 26.6 fixed-point pixels, a scale of size*1000 gives 1/1000 points
+// for a font size in points. Values read from the font are scaled where
+// they are fetched and rounded to integers, as HarfBuzz does. Variation
+// deltas are scaled before they are rounded, so with a scale larger than
+// the upem the advances of variable fonts keep their fractional part.
+//
+// The size of the font selects the Device table deltas (SetPpem) and, for
+// fonts with an 'opsz' axis, the optical size (SetPtem, SetPpem).
+
+// SetScale sets the font scale: positions are returned in units of
+// 1/xScale em horizontally and 1/yScale em vertically. Zero selects the
+// font's upem, so positions are in font units.
+// HarfBuzz equivalent: hb_font_set_scale()
+func (s *Shaper) SetScale(xScale, yScale int32) {
+	s.xScale = xScale
+	s.yScale = yScale
+}
+
+// Scale returns the font scale, see SetScale.
+// HarfBuzz equivalent: hb_font_get_scale()
+func (s *Shaper) Scale() (xScale, yScale int32) {
+	upem := int32(s.face.Upem())
+	xScale, yScale = s.xScale, s.yScale
+	if xScale == 0 {
+		xScale = upem
+	}
+	if yScale == 0 {
+		yScale = upem
+	}
+	return xScale, yScale
+}
+
+// SetPtem sets the point size of the font. For fonts with an 'opsz' axis it
+// selects the optical size, unless the axis was set with SetVariations or
+// SetVariation. Zero unsets the point size.
+// HarfBuzz equivalent: hb_font_set_ptem()
+func (s *Shaper) SetPtem(ptem float32) {
+	s.ptem = ptem
+	s.applyOpticalSize()
+}
+
+// Ptem returns the point size set with SetPtem.
+// HarfBuzz equivalent: hb_font_get_ptem()
+func (s *Shaper) Ptem() float32 {
+	return s.ptem
+}
+
+// applyOpticalSize sets the 'opsz' axis to the point size or, without one,
+// to the vertical ppem, as browsers do for font-optical-sizing: auto. An
+// explicitly set axis is left alone, and without a size the axis returns
+// to its default.
+func (s *Shaper) applyOpticalSize() {
+	if s.opszSet || s.fvar == nil || len(s.normalizedCoords) == 0 {
+		return
+	}
+	size := s.ptem
+	if size == 0 {
+		size = float32(s.yPpem)
+	}
+	for i, axis := range s.fvar.AxisInfos() {
+		if axis.Tag != TagAxisOpticalSize {
+			continue
+		}
+		value := axis.DefaultValue
+		if size > 0 {
+			value = size
+		}
+		s.designCoords[i] = clampFloat32(value, axis.MinValue, axis.MaxValue)
+		s.normalizedCoords[i] = s.fvar.NormalizeAxisValue(i, value)
+		s.applyAvarMapping()
+		return
+	}
+}
+
+// emScaleX scales a horizontal value in font units.
+// HarfBuzz equivalent: hb_font_t::em_scale_x()
+func (s *Shaper) emScaleX(v int32) int32 {
+	xScale, _ := s.Scale()
+	return emScale(v, xScale, int32(s.face.Upem()))
+}
+
+// emScaleY scales a vertical value in font units.
+// HarfBuzz equivalent: hb_font_t::em_scale_y()
+func (s *Shaper) emScaleY(v int32) int32 {
+	_, yScale := s.Scale()
+	return emScale(v, yScale, int32(s.face.Upem()))
+}
+
+// emScaleVar scales a value in font units plus a variation delta. In font
+// units the delta is rounded on its own; otherwise the sum is scaled and
+// then rounded, which keeps the fractional part of the delta.
+func (s *Shaper) emScaleVar(v int32, delta float32, scale int32) int32 {
+	upem := int32(s.face.Upem())
+	if scale == upem {
+		return v + roundToInt(delta)
+	}
+	return int32(math.Round((float64(v) + float64(delta)) * float64(scale) / float64(upem)))
+}
+
+// scaledGlyphExtents returns the extents of a glyph scaled to the font
+// scale, rounded outwards, with synthetic bold and slant.
+// HarfBuzz equivalent: hb_font_t::get_glyph_extents() with scale_glyph_extents()
+func (s *Shaper) scaledGlyphExtents(glyph GlyphID) (GlyphExtents, bool) {
+	extents, ok := s.glyphExtents(glyph)
+	if !ok {
+		return extents, false
+	}
+	xScale, yScale := s.Scale()
+	upem := int32(s.face.Upem())
+	if xScale == upem && yScale == upem && s.slant == 0 && s.xEmbolden == 0 && s.yEmbolden == 0 {
+		return extents, true
+	}
+	fx := float64(xScale) / float64(upem)
+	fy := float64(yScale) / float64(upem)
+	x1 := float64(extents.XBearing) * fx
+	y1 := float64(extents.YBearing) * fy
+	x2 := float64(extents.XBearing+extents.Width) * fx
+	y2 := float64(extents.YBearing+extents.Height) * fy
+	return s.syntheticExtents(x1, y1, x2, y2), true
+}
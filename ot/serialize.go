@@ -0,0 +1,358 @@
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Buffer serialization
+//
+// HarfBuzz equivalent: hb-buffer-serialize.cc
+//
+// Shaped buffers are written in the formats of hb-shape, so output can be
+// diffed against HarfBuzz directly. The text format looks like
+//
+//	[T=0+1186|o=1@-42,0+1127]
+//
+// with the glyph name (or ID), "=" cluster, "@" offset, "+" advance, "#"
+// glyph flags and "<" extents ">" per glyph. The JSON format is an array
+// of objects with the keys g, cl, dx, dy, ax, ay, fl, xb, yb, w and h.
+
+// SerializeFormat selects the buffer serialization format.
+// HarfBuzz equivalent: hb_buffer_serialize_format_t in hb-buffer.h
+type SerializeFormat int
+
+const (
+	// SerializeFormatText is the bracketed text format of hb-shape.
+	// HarfBuzz: HB_BUFFER_SERIALIZE_FORMAT_TEXT
+	SerializeFormatText SerializeFormat = iota
+	// SerializeFormatJSON is the JSON format of hb-shape --output-format=json.
+	// HarfBuzz: HB_BUFFER_SERIALIZE_FORMAT_JSON
+	SerializeFormatJSON
+)
+
+// SerializeFlags control what Serialize writes.
+// HarfBuzz equivalent: hb_buffer_serialize_flags_t in hb-buffer.h
+type SerializeFlags uint32
+
+const (
+	// SerializeFlagDefault writes glyph names, clusters and positions.
+	SerializeFlagDefault SerializeFlags = 0
+	// SerializeFlagNoClusters omits cluster values.
+	SerializeFlagNoClusters SerializeFlags = 1 << 0
+	// SerializeFlagNoPositions omits offsets and advances.
+	SerializeFlagNoPositions SerializeFlags = 1 << 1
+	// SerializeFlagNoGlyphNames writes glyph IDs instead of names.
+	SerializeFlagNoGlyphNames SerializeFlags = 1 << 2
+	// SerializeFlagGlyphExtents writes the ink extents of each glyph.
+	SerializeFlagGlyphExtents SerializeFlags = 1 << 3
+	// SerializeFlagGlyphFlags writes the glyph flags of glyphs that have any.
+	SerializeFlagGlyphFlags SerializeFlags = 1 << 4
+	// SerializeFlagNoAdvances omits advances and writes absolute offsets
+	// instead, accumulated from the advances of the preceding glyphs.
+	SerializeFlagNoAdvances SerializeFlags = 1 << 5
+)
+
+// ErrInvalidSerialization is returned by ParseSerialized for malformed input.
+var ErrInvalidSerialization = errors.New("invalid serialized buffer")
+
+// Serialize writes the glyphs of a shaped buffer in the given format.
+// Glyph names are taken from font with Font.GetGlyphName; with a nil font
+// or SerializeFlagNoGlyphNames glyph IDs are written. Extents need a font
+// as well and are written as zero without one.
+// HarfBuzz equivalent: hb_buffer_serialize_glyphs() in hb-buffer-serialize.cc
+func (b *Buffer) Serialize(font *Font, format SerializeFormat, flags SerializeFlags) string {
+	if font == nil {
+		flags |= SerializeFlagNoGlyphNames
+	}
+	var extents func(GlyphID) (GlyphExtents, bool)
+	if flags&SerializeFlagGlyphExtents != 0 {
+		extents = fontGlyphExtents(font)
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('[')
+
+	var x, y int
+	for i, info := range b.Info {
+		var pos GlyphPos
+		if i < len(b.Pos) {
+			pos = b.Pos[i]
+		}
+		var ext GlyphExtents
+		if extents != nil {
+			ext, _ = extents(info.GlyphID)
+		}
+
+		if format == SerializeFormatJSON {
+			b.serializeGlyphJSON(&sb, i, info, pos, x, y, ext, font, flags)
+		} else {
+			b.serializeGlyphText(&sb, i, info, pos, x, y, ext, font, flags)
+		}
+
+		if flags&SerializeFlagNoAdvances != 0 {
+			x += int(pos.XAdvance)
+			y += int(pos.YAdvance)
+		}
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
+
+// serializeGlyphText writes one glyph in text format.
+// HarfBuzz equivalent: _hb_buffer_serialize_glyphs_text() in hb-buffer-serialize.cc
+func (b *Buffer) serializeGlyphText(sb *strings.Builder, i int, info GlyphInfo, pos GlyphPos, x, y int, ext GlyphExtents, font *Font, flags SerializeFlags) {
+	if i > 0 {
+		sb.WriteByte('|')
+	}
+	if flags&SerializeFlagNoGlyphNames == 0 {
+		sb.WriteString(font.GetGlyphName(info.GlyphID))
+	} else {
+		sb.WriteString(strconv.Itoa(int(info.GlyphID)))
+	}
+
+	if flags&SerializeFlagNoClusters == 0 {
+		fmt.Fprintf(sb, "=%d", info.Cluster)
+	}
+
+	if flags&SerializeFlagNoPositions == 0 {
+		dx, dy := x+int(pos.XOffset), y+int(pos.YOffset)
+		if dx != 0 || dy != 0 {
+			fmt.Fprintf(sb, "@%d,%d", dx, dy)
+		}
+		if flags&SerializeFlagNoAdvances == 0 {
+			fmt.Fprintf(sb, "+%d", pos.XAdvance)
+			if pos.YAdvance != 0 {
+				fmt.Fprintf(sb, ",%d", pos.YAdvance)
+			}
+		}
+	}
+
+	if flags&SerializeFlagGlyphFlags != 0 && info.Flags&GlyphFlagDefined != 0 {
+		fmt.Fprintf(sb, "#%X", uint32(info.Flags&GlyphFlagDefined))
+	}
+
+	if flags&SerializeFlagGlyphExtents != 0 {
+		fmt.Fprintf(sb, "<%d,%d,%d,%d>", ext.XBearing, ext.YBearing, ext.Width, ext.Height)
+	}
+}
+
+// serializeGlyphJSON writes one glyph in JSON format.
+// HarfBuzz equivalent: _hb_buffer_serialize_glyphs_json() in hb-buffer-serialize.cc
+func (b *Buffer) serializeGlyphJSON(sb *strings.Builder, i int, info GlyphInfo, pos GlyphPos, x, y int, ext GlyphExtents, font *Font, flags SerializeFlags) {
+	if i > 0 {
+		sb.WriteByte(',')
+	}
+	sb.WriteString(`{"g":`)
+	if flags&SerializeFlagNoGlyphNames == 0 {
+		sb.WriteByte('"')
+		for _, c := range font.GetGlyphName(info.GlyphID) {
+			if c == '"' || c == '\\' {
+				sb.WriteByte('\\')
+			}
+			sb.WriteRune(c)
+		}
+		sb.WriteByte('"')
+	} else {
+		sb.WriteString(strconv.Itoa(int(info.GlyphID)))
+	}
+
+	if flags&SerializeFlagNoClusters == 0 {
+		fmt.Fprintf(sb, `,"cl":%d`, info.Cluster)
+	}
+
+	if flags&SerializeFlagNoPositions == 0 {
+		fmt.Fprintf(sb, `,"dx":%d,"dy":%d`, x+int(pos.XOffset), y+int(pos.YOffset))
+		if flags&SerializeFlagNoAdvances == 0 {
+			fmt.Fprintf(sb, `,"ax":%d,"ay":%d`, pos.XAdvance, pos.YAdvance)
+		}
+	}
+
+	if flags&SerializeFlagGlyphFlags != 0 && info.Flags&GlyphFlagDefined != 0 {
+		fmt.Fprintf(sb, `,"fl":%d`, uint32(info.Flags&GlyphFlagDefined))
+	}
+
+	if flags&SerializeFlagGlyphExtents != 0 {
+		fmt.Fprintf(sb, `,"xb":%d,"yb":%d,"w":%d,"h":%d`, ext.XBearing, ext.YBearing, ext.Width, ext.Height)
+	}
+	sb.WriteByte('}')
+}
+
+// fontGlyphExtents returns a function for the ink extents of the glyphs of
+// a font, from glyf or the CFF/CFF2 outlines.
+func fontGlyphExtents(font *Font) func(GlyphID) (GlyphExtents, bool) {
+	if font == nil {
+		return nil
+	}
+	if glyf, err := ParseGlyfFromFont(font); err == nil {
+		return glyf.GetGlyphExtents
+	}
+	if data, err := font.TableData(TagCFF); err == nil {
+		if cff, err := ParseCFF(data); err == nil {
+			return cff.GlyphExtents
+		}
+	}
+	if data, err := font.TableData(TagCFF2); err == nil {
+		if cff2, err := ParseCFF2(data); err == nil {
+			return func(gid GlyphID) (GlyphExtents, bool) { return cff2.GlyphExtents(gid, nil) }
+		}
+	}
+	return nil
+}
+
+// ParseSerialized appends the glyphs of a buffer serialized in the given
+// format to b. Glyph names are resolved with Font.GetGlyphFromName; with a
+// nil font only glyph IDs are accepted. Extents in the input are ignored.
+// HarfBuzz equivalent: hb_buffer_deserialize_glyphs() in hb-buffer-serialize.cc
+func (b *Buffer) ParseSerialized(s string, font *Font, format SerializeFormat) error {
+	s = strings.TrimSpace(s)
+	var err error
+	if format == SerializeFormatJSON {
+		err = b.parseSerializedJSON(s, font)
+	} else {
+		err = b.parseSerializedText(s, font)
+	}
+	if len(b.Pos) < len(b.Info) {
+		b.Pos = append(b.Pos, make([]GlyphPos, len(b.Info)-len(b.Pos))...)
+	}
+	return err
+}
+
+// parseSerializedText parses the text format.
+// HarfBuzz equivalent: _hb_buffer_deserialize_text_glyphs() in hb-buffer-deserialize-text-glyphs.hh
+func (b *Buffer) parseSerializedText(s string, font *Font) error {
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return fmt.Errorf("%w: missing brackets", ErrInvalidSerialization)
+	}
+	s = s[1 : len(s)-1]
+	if s == "" {
+		return nil
+	}
+
+	for _, item := range strings.Split(s, "|") {
+		info := GlyphInfo{Mask: MaskGlobal}
+		var pos GlyphPos
+
+		// The glyph name ends at the first field marker
+		end := strings.IndexAny(item, "=@+#<")
+		if end < 0 {
+			end = len(item)
+		}
+		gid, ok := glyphFromString(font, item[:end])
+		if !ok {
+			return fmt.Errorf("%w: unknown glyph %q", ErrInvalidSerialization, item[:end])
+		}
+		info.GlyphID = gid
+		item = item[end:]
+
+		for item != "" {
+			marker := item[0]
+			item = item[1:]
+			end := strings.IndexAny(item, "=@+#<")
+			if end < 0 {
+				end = len(item)
+			}
+			field := item[:end]
+			item = item[end:]
+
+			var err error
+			switch marker {
+			case '=':
+				info.Cluster, err = strconv.Atoi(field)
+			case '@':
+				err = parseInt32Pair(field, &pos.XOffset, &pos.YOffset)
+			case '+':
+				err = parseInt32Pair(field, &pos.XAdvance, &pos.YAdvance)
+			case '#':
+				var v uint64
+				v, err = strconv.ParseUint(field, 16, 32)
+				info.Flags = GlyphFlags(v) & GlyphFlagDefined
+			case '<':
+				if !strings.HasSuffix(field, ">") {
+					err = errors.New("unterminated extents")
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidSerialization, err)
+			}
+		}
+
+		b.Info = append(b.Info, info)
+		b.Pos = append(b.Pos, pos)
+	}
+	return nil
+}
+
+// parseInt32Pair parses "a" or "a,b".
+func parseInt32Pair(s string, a, b *int32) error {
+	first, second, hasSecond := strings.Cut(s, ",")
+	v, err := strconv.ParseInt(first, 10, 32)
+	if err != nil {
+		return err
+	}
+	*a = int32(v)
+	if hasSecond {
+		v, err = strconv.ParseInt(second, 10, 32)
+		if err != nil {
+			return err
+		}
+		*b = int32(v)
+	}
+	return nil
+}
+
+// serializedGlyph is a glyph of the JSON format.
+type serializedGlyph struct {
+	G  json.RawMessage `json:"g"`
+	Cl int             `json:"cl"`
+	Dx int32           `json:"dx"`
+	Dy int32           `json:"dy"`
+	Ax int32           `json:"ax"`
+	Ay int32           `json:"ay"`
+	Fl uint32          `json:"fl"`
+}
+
+// parseSerializedJSON parses the JSON format.
+// HarfBuzz equivalent: _hb_buffer_deserialize_json() in hb-buffer-deserialize-json.hh
+func (b *Buffer) parseSerializedJSON(s string, font *Font) error {
+	var glyphs []serializedGlyph
+	if err := json.Unmarshal([]byte(s), &glyphs); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSerialization, err)
+	}
+
+	for _, g := range glyphs {
+		// "g" is a glyph name or a glyph ID
+		var name string
+		if err := json.Unmarshal(g.G, &name); err != nil {
+			name = string(g.G)
+		}
+		gid, ok := glyphFromString(font, name)
+		if !ok {
+			return fmt.Errorf("%w: unknown glyph %s", ErrInvalidSerialization, g.G)
+		}
+		b.Info = append(b.Info, GlyphInfo{
+			GlyphID: gid,
+			Cluster: g.Cl,
+			Mask:    MaskGlobal,
+			Flags:   GlyphFlags(g.Fl) & GlyphFlagDefined,
+		})
+		b.Pos = append(b.Pos, GlyphPos{XAdvance: g.Ax, YAdvance: g.Ay, XOffset: g.Dx, YOffset: g.Dy})
+	}
+	return nil
+}
+
+// glyphFromString resolves a glyph name or ID.
+// HarfBuzz equivalent: hb_font_glyph_from_string() in hb-font.cc
+func glyphFromString(font *Font, s string) (GlyphID, bool) {
+	if font != nil {
+		return font.GetGlyphFromName(s)
+	}
+	v, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, false
+	}
+	return GlyphID(v), true
+}
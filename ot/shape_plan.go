@@ -0,0 +1,243 @@
+package ot
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Shape plans
+//
+// HarfBuzz equivalent: hb-shape-plan.cc and hb_ot_shape_plan_t in hb-ot-shape.cc
+//
+// A plan holds everything shaping derives from the segment properties, the
+// requested features and the variation coordinates: the selected shaper,
+// the features split by table, the compiled lookup maps and shaper data
+// such as Indic plans. Maps and shaper data are compiled on first use and
+// kept for every later run with the plan. Shape looks plans up in a cache
+// per Shaper; NewShapePlan and ShapeWithPlan let callers keep one.
+
+// maxCachedShapePlans limits the number of plans a Shaper caches. The
+// cache is dropped when it is full.
+const maxCachedShapePlans = 256
+
+// shapePlanKey identifies a cached plan.
+// HarfBuzz equivalent: hb_shape_plan_key_t in hb-shape-plan.hh
+type shapePlanKey struct {
+	props    SegmentProperties
+	features string
+	coords   string
+}
+
+// NewShapePlan compiles a plan for text with the given segment properties
+// and features. Nil features select the default features, as in Shape.
+// A zero direction is derived from the script. The plan captures the
+// current variation coordinates of the shaper and may be used from
+// several goroutines at once.
+// HarfBuzz equivalent: hb_shape_plan_create2() in hb-shape-plan.cc
+func (s *Shaper) NewShapePlan(props SegmentProperties, features []Feature) *ShapePlan {
+	if props.Direction == 0 {
+		props.Direction = GetHorizontalDirection(props.Script)
+		if props.Direction == 0 {
+			props.Direction = DirectionLTR
+		}
+	}
+
+	plan := &ShapePlan{
+		Props:        props,
+		owner:        s,
+		userFeatures: append([]Feature(nil), features...),
+		gsub:         s.gsub,
+		gpos:         s.gpos,
+		gdef:         s.gdef,
+		coords:       coordsKey(s.normalizedCoordsI),
+	}
+
+	plan.defaultFeatures = len(features) == 0
+	if plan.defaultFeatures {
+		features = s.defaultFeatures
+	}
+	if props.Direction.IsVertical() {
+		features = s.verticalFeatures(features, plan.defaultFeatures)
+	}
+	plan.features = append([]Feature(nil), features...)
+	plan.gsubFeatures, plan.gposFeatures = s.categorizeFeatures(plan.features)
+
+	// Select the shaper by script, direction and the font's script tag
+	// HarfBuzz: hb_ot_shaper_categorize() in hb-ot-shaper.hh
+	// The font's actual script tag (e.g., 'knd3' vs 'knd2') determines which shaper to use.
+	// For Indic scripts with version 3 tags, USE shaper is used instead of Indic shaper.
+	plan.gsubVariationsIndex = VariationsNotFoundIndex
+	if s.gsub != nil {
+		plan.Shaper = SelectShaperWithFont(props.Script, props.Direction, s.gsub.FindChosenScriptTag(props.Script))
+		plan.gsubVariationsIndex = s.gsub.FindVariationsIndex(s.normalizedCoordsI)
+	} else {
+		plan.Shaper = SelectShaper(props.Script, props.Direction)
+	}
+	return plan
+}
+
+// cachedShapePlan returns the cached plan for the properties and features,
+// creating it if necessary.
+// HarfBuzz equivalent: hb_shape_plan_create_cached2() in hb-shape-plan.cc
+func (s *Shaper) cachedShapePlan(props SegmentProperties, features []Feature) *ShapePlan {
+	key := shapePlanKey{
+		props:    props,
+		features: featuresKey(features),
+		coords:   coordsKey(s.normalizedCoordsI),
+	}
+
+	s.planMu.Lock()
+	plan := s.plans[key]
+	s.planMu.Unlock()
+	if plan != nil {
+		return plan
+	}
+
+	// Compiled outside the lock; a plan built twice by racing callers is
+	// equivalent, so the first one stored wins.
+	plan = s.NewShapePlan(props, features)
+
+	s.planMu.Lock()
+	defer s.planMu.Unlock()
+	if cached := s.plans[key]; cached != nil {
+		return cached
+	}
+	if s.plans == nil || len(s.plans) >= maxCachedShapePlans {
+		s.plans = make(map[shapePlanKey]*ShapePlan)
+	}
+	s.plans[key] = plan
+	return plan
+}
+
+// clearShapePlans drops the cached plans, for changes that plans do not
+// capture in their key.
+func (s *Shaper) clearShapePlans() {
+	s.planMu.Lock()
+	s.plans = nil
+	s.planMu.Unlock()
+}
+
+// featuresKey encodes features for a plan key.
+func featuresKey(features []Feature) string {
+	var sb strings.Builder
+	for _, f := range features {
+		sb.WriteString(strconv.FormatUint(uint64(f.Tag), 16))
+		sb.WriteByte('=')
+		sb.WriteString(strconv.FormatUint(uint64(f.Value), 10))
+		if !f.IsGlobal() {
+			sb.WriteByte('[')
+			sb.WriteString(strconv.FormatUint(uint64(f.Start), 10))
+			sb.WriteByte(':')
+			sb.WriteString(strconv.FormatUint(uint64(f.End), 10))
+			sb.WriteByte(']')
+		}
+		sb.WriteByte(',')
+	}
+	return sb.String()
+}
+
+// coordsKey encodes normalized variation coordinates for a plan key.
+func coordsKey(coords []int) string {
+	var sb strings.Builder
+	for _, c := range coords {
+		sb.WriteString(strconv.Itoa(c))
+		sb.WriteByte(',')
+	}
+	return sb.String()
+}
+
+// cachedMap returns the lookup map stored in the plan under key, building
+// it on first use. Cached maps are shared and must not be modified.
+func (p *ShapePlan) cachedMap(key string, build func() *OTMap) *OTMap {
+	p.mu.Lock()
+	m, ok := p.maps[key]
+	p.mu.Unlock()
+	if ok {
+		return m
+	}
+
+	m = build()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cached, ok := p.maps[key]; ok {
+		return cached
+	}
+	if p.maps == nil {
+		p.maps = make(map[string]*OTMap)
+	}
+	p.maps[key] = m
+	return m
+}
+
+// planMap returns the lookup map for key from the plan the buffer is
+// shaped with, or builds an uncached one outside of a plan.
+func (s *Shaper) planMap(buf *Buffer, key string, build func() *OTMap) *OTMap {
+	if buf.plan == nil {
+		return build()
+	}
+	return buf.plan.cachedMap(key, build)
+}
+
+// compileMap is CompileMap for the segment properties of the buffer,
+// cached in the plan the buffer is shaped with.
+func (s *Shaper) compileMap(buf *Buffer, gsub *GSUB, gpos *GPOS, features []Feature) *OTMap {
+	key := "gpos:"
+	if gsub != nil {
+		key = "gsub:"
+	}
+	return s.planMap(buf, key+featuresKey(features), func() *OTMap {
+		return CompileMap(gsub, gpos, features, buf.Script, buf.Language)
+	})
+}
+
+// planFeatures splits features into GSUB and GPOS features like
+// categorizeFeatures, using the split stored in the plan when features
+// are the plan's features. The results may be appended to.
+func (s *Shaper) planFeatures(buf *Buffer, features []Feature) (gsub, gpos []Feature) {
+	if p := buf.plan; p != nil && sameFeatures(p.features, features) {
+		return p.gsubFeatures[:len(p.gsubFeatures):len(p.gsubFeatures)],
+			p.gposFeatures[:len(p.gposFeatures):len(p.gposFeatures)]
+	}
+	return s.categorizeFeatures(features)
+}
+
+// sameFeatures reports whether a and b hold the same features.
+func sameFeatures(a, b []Feature) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// gsubVariationsIndex returns the FeatureVariations record matching the
+// variation coordinates, from the plan the buffer is shaped with.
+// HarfBuzz equivalent: hb_shape_plan_key_t::variations_index[] in hb-ot-shape.hh
+func (s *Shaper) gsubVariationsIndex(buf *Buffer) uint32 {
+	if buf.plan != nil {
+		return buf.plan.gsubVariationsIndex
+	}
+	return s.gsub.FindVariationsIndex(s.normalizedCoordsI)
+}
+
+// indicPlan returns the Indic plan for a script from the plan the buffer is
+// shaped with, building it on first use.
+// HarfBuzz equivalent: data_create_indic() called from hb_ot_shape_plan_t::init0()
+func (p *ShapePlan) indicPlan(script Tag, build func() *IndicPlan) *IndicPlan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ip, ok := p.indicPlans[script]
+	if !ok {
+		ip = build()
+		if p.indicPlans == nil {
+			p.indicPlans = make(map[Tag]*IndicPlan)
+		}
+		p.indicPlans[script] = ip
+	}
+	return ip
+}
@@ -29,21 +29,14 @@ import (
 	"fmt"
 	"sync"
 	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
-// Debug flag for GPOS debugging - set to true to enable debug output
-var debugGPOS = false
-
-// SetDebugGPOS enables or disables debug output for GPOS/Arabic processing.
-func SetDebugGPOS(enabled bool) {
-	debugGPOS = enabled
-}
-
-func debugPrintf(format string, args ...interface{}) {
-	if debugGPOS {
-		fmt.Printf(format, args...)
-	}
-}
+// SetDebugGPOS used to enable debug output for GPOS/Arabic processing.
+//
+// Deprecated: It has no effect. Use Buffer.SetMessageFunc to trace shaping.
+func SetDebugGPOS(enabled bool) {}
 
 // Note: Direction, DirectionLTR, DirectionRTL are defined in gpos.go
 
@@ -59,6 +52,10 @@ type GlyphInfo struct {
 	// Each feature has a unique mask bit. Lookups only apply to glyphs
 	// where (glyph.mask & lookup.mask) != 0.
 
+	// Flags are the output glyph flags set during shaping.
+	// HarfBuzz equivalent: hb_glyph_info_get_glyph_flags() in hb-buffer.h
+	Flags GlyphFlags
+
 	// GlyphProps holds glyph properties for GSUB/GPOS processing.
 	// HarfBuzz equivalent: glyph_props() in hb-ot-layout.hh
 	// Flags:
@@ -111,6 +108,10 @@ type GlyphInfo struct {
 	// MyanmarPosition holds the Myanmar character position for Myanmar shaping.
 	// HarfBuzz equivalent: myanmar_position() stored via ot_shaper_var_u8_auxiliary()
 	MyanmarPosition uint8
+
+	// HangulFeature holds the jamo feature (ljmo, vjmo, tjmo) for Hangul shaping.
+	// HarfBuzz equivalent: hangul_shaping_feature() stored via ot_shaper_var_u8_auxiliary()
+	HangulFeature uint8
 }
 
 // Glyph property constants.
@@ -226,10 +227,10 @@ func (g *GlyphInfo) GetLigNumComps() int {
 // GlyphPos holds positioning information for a shaped glyph.
 // HarfBuzz equivalent: hb_glyph_position_t in hb-buffer.h
 type GlyphPos struct {
-	XAdvance int16 // Horizontal advance
-	YAdvance int16 // Vertical advance
-	XOffset  int16 // Horizontal offset
-	YOffset  int16 // Vertical offset
+	XAdvance int32 // Horizontal advance
+	YAdvance int32 // Vertical advance
+	XOffset  int32 // Horizontal offset
+	YOffset  int32 // Vertical offset
 
 	// Attachment chain for mark/cursive positioning.
 	// HarfBuzz: var.i16[0] via attach_chain() macro in OT/Layout/GPOS/Common.hh
@@ -259,6 +260,25 @@ const (
 	BufferFlagRemoveDefaultIgnorables
 	// BufferFlagDoNotInsertDottedCircle prevents dotted circle insertion for invalid sequences.
 	BufferFlagDoNotInsertDottedCircle
+	// BufferFlagProduceUnsafeToConcat makes shaping compute GlyphFlagUnsafeToConcat.
+	// Without it only GlyphFlagUnsafeToBreak is reliable.
+	BufferFlagProduceUnsafeToConcat
+)
+
+// ClusterLevel controls how clusters are merged during shaping.
+// HarfBuzz equivalent: hb_buffer_cluster_level_t in hb-buffer.h
+type ClusterLevel int
+
+const (
+	// ClusterLevelMonotoneGraphemes merges base characters and their marks
+	// into one cluster and keeps cluster values monotone. This is the default.
+	ClusterLevelMonotoneGraphemes ClusterLevel = iota
+	// ClusterLevelMonotoneCharacters keeps marks in clusters of their own
+	// but still merges clusters to keep cluster values monotone.
+	ClusterLevelMonotoneCharacters
+	// ClusterLevelCharacters never merges clusters. Glyphs keep the cluster
+	// of the character they came from, so cluster values may be out of order.
+	ClusterLevelCharacters
 )
 
 // Buffer holds a sequence of glyphs being shaped.
@@ -268,6 +288,10 @@ type Buffer struct {
 	Direction Direction
 	Flags     BufferFlags
 
+	// ClusterLevel controls cluster merging.
+	// HarfBuzz: hb_buffer_t::cluster_level
+	ClusterLevel ClusterLevel
+
 	// Idx is the cursor into Info and Pos arrays.
 	// HarfBuzz: hb_buffer_t::idx (hb-buffer.hh line 97)
 	Idx int
@@ -289,14 +313,52 @@ type Buffer struct {
 	// ScratchFlags holds temporary flags used during shaping.
 	// HarfBuzz equivalent: scratch_flags in hb-buffer.hh
 	ScratchFlags ScratchFlags
+
+	// ReplacementCodepoint is added by AddUTF8 and AddUTF16 in place of
+	// invalid input. NewBuffer and Reset set it to U+FFFD, which the zero
+	// value selects as well.
+	// HarfBuzz: hb_buffer_t::replacement
+	ReplacementCodepoint Codepoint
+
+	// Text around the item: preContext holds the characters before it,
+	// nearest first, postContext the characters after it. contextGlyphs
+	// are their nominal glyphs, mapped when shaping starts.
+	// HarfBuzz: hb_buffer_t::context and context_len (hb-buffer.hh)
+	preContext    []Codepoint
+	postContext   []Codepoint
+	contextGlyphs [2][]GlyphID
+
+	// messageFunc receives the shaping messages, see SetMessageFunc.
+	// HarfBuzz: hb_buffer_t::message_func
+	messageFunc MessageFunc
+
+	// plan is the shape plan during ShapeWithPlan.
+	plan *ShapePlan
+
+	// reorderMarks is the script-specific mark reordering callback.
+	// Shapers that need mark reordering (e.g., Arabic, Hebrew) set it
+	// before calling normalizeBuffer and reset it to nil afterwards.
+	// HarfBuzz: plan->shaper->reorder_marks in hb-ot-shape-normalize.cc:394-395
+	reorderMarks ReorderMarksCallback
 }
 
+// DefaultReplacementCodepoint is the default ReplacementCodepoint of a buffer.
+// HarfBuzz: HB_BUFFER_REPLACEMENT_CODEPOINT_DEFAULT in hb-buffer.h
+const DefaultReplacementCodepoint Codepoint = 0xFFFD
+
+// bufferContextLength is the number of characters kept as context on each
+// side of the item.
+// HarfBuzz: HB_BUFFER_CONTEXT_LENGTH in hb-buffer.hh
+const bufferContextLength = 5
+
 // ScratchFlags are temporary flags used during shaping.
 type ScratchFlags uint32
 
 const (
 	// ScratchFlagArabicHasStch indicates buffer has STCH glyphs that need post-processing.
 	ScratchFlagArabicHasStch ScratchFlags = 1 << 0
+	// ScratchFlagHasGlyphFlags indicates some glyph has output flags set.
+	ScratchFlagHasGlyphFlags ScratchFlags = 1 << 1
 )
 
 // NewBuffer creates a new empty buffer.
@@ -304,73 +366,186 @@ const (
 func NewBuffer() *Buffer {
 	return &Buffer{
 		// Direction is 0 (unset) - will be determined by GuessSegmentProperties or shaper
+		ReplacementCodepoint: DefaultReplacementCodepoint,
 	}
 }
 
 // AddCodepoints adds Unicode codepoints to the buffer.
 // Marks (Unicode category M) are assigned to the same cluster as the preceding base character.
 func (b *Buffer) AddCodepoints(codepoints []Codepoint) {
-	// HarfBuzz: cluster = index into input text (hb-buffer.cc:1858)
-	// No mark grouping here - clusters are merged during shaping (ligatures, etc.)
-	for i, cp := range codepoints {
-		info := GlyphInfo{
-			Codepoint: cp,
-			Cluster:   i,
-			Mask:      MaskGlobal, // HarfBuzz: glyphs start with global_mask
-		}
-		// HarfBuzz: _hb_glyph_info_set_unicode_props() sets UPROPS_MASK_IGNORABLE and Cf flags
-		if IsDefaultIgnorable(cp) {
-			info.GlyphProps |= GlyphPropsDefaultIgnorable
-		}
-		if cp == 0x200C { // ZWNJ
-			info.GlyphProps |= GlyphPropsZWNJ
-		}
-		if cp == 0x200D { // ZWJ
-			info.GlyphProps |= GlyphPropsZWJ
-		}
-		// HarfBuzz: UPROPS_MASK_HIDDEN for CGJ, Mongolian FVS, TAG chars
-		// These should NOT be skipped during GSUB context matching
-		if isHiddenDefaultIgnorable(cp) {
-			info.GlyphProps |= GlyphPropsHidden
-		}
-		b.Info = append(b.Info, info)
-	}
-	b.Pos = make([]GlyphPos, len(b.Info))
+	b.AddCodepointsWithContext(codepoints, 0, -1)
 }
 
 // AddString adds a string to the buffer.
 // Marks (Unicode category M) are assigned to the same cluster as the preceding base character.
 func (b *Buffer) AddString(s string) {
-	// HarfBuzz: cluster = index into input text (hb-buffer.cc:1858)
-	// No mark grouping here - clusters are merged during shaping (ligatures, etc.)
+	b.AddStringWithContext(s, 0, -1)
+}
+
+// AddCodepointsWithContext adds the item text[itemOffset:itemOffset+itemLength]
+// to the buffer and keeps the codepoints around it as context, so a
+// substring of a paragraph shapes as it does within the paragraph.
+// A negative itemLength extends the item to the end of text. Clusters are
+// indices into text. The pre-context is only taken when the buffer is
+// empty; the post-context is replaced on every call.
+// HarfBuzz equivalent: hb_buffer_add_codepoints() in hb-buffer.cc
+func (b *Buffer) AddCodepointsWithContext(text []Codepoint, itemOffset, itemLength int) {
+	b.addText(len(text), itemOffset, itemLength,
+		func(i, end int) (Codepoint, int) { return text[i], 1 },
+		func(i int) (Codepoint, int) { return text[i-1], 1 })
+}
+
+// AddStringWithContext is AddCodepointsWithContext for a string. Offsets,
+// lengths and clusters count runes.
+func (b *Buffer) AddStringWithContext(s string, itemOffset, itemLength int) {
 	runes := []rune(s)
+	text := make([]Codepoint, len(runes))
 	for i, r := range runes {
-		cp := Codepoint(r)
-		info := GlyphInfo{
-			Codepoint: cp,
-			Cluster:   i,
-			Mask:      MaskGlobal, // HarfBuzz: glyphs start with global_mask
-		}
-		// HarfBuzz: _hb_glyph_info_set_unicode_props() sets UPROPS_MASK_IGNORABLE and Cf flags
-		if IsDefaultIgnorable(cp) {
-			info.GlyphProps |= GlyphPropsDefaultIgnorable
-		}
-		if cp == 0x200C { // ZWNJ
-			info.GlyphProps |= GlyphPropsZWNJ
-		}
-		if cp == 0x200D { // ZWJ
-			info.GlyphProps |= GlyphPropsZWJ
-		}
-		// HarfBuzz: UPROPS_MASK_HIDDEN for CGJ, Mongolian FVS, TAG chars
-		// These should NOT be skipped during GSUB context matching
-		if isHiddenDefaultIgnorable(cp) {
-			info.GlyphProps |= GlyphPropsHidden
+		text[i] = Codepoint(r)
+	}
+	b.AddCodepointsWithContext(text, itemOffset, itemLength)
+}
+
+// AddUTF8 adds the item text[itemOffset:itemOffset+itemLength] of UTF-8
+// encoded text to the buffer, with the text around it as context.
+// Offsets, lengths and clusters are byte offsets into text, so feature
+// ranges are byte offsets as well. Each invalid byte is added as
+// ReplacementCodepoint. A negative itemLength extends the item to the end
+// of text.
+// HarfBuzz equivalent: hb_buffer_add_utf8() in hb-buffer.cc
+func (b *Buffer) AddUTF8(text []byte, itemOffset, itemLength int) {
+	b.addText(len(text), itemOffset, itemLength,
+		func(i, end int) (Codepoint, int) {
+			r, size := utf8.DecodeRune(text[i:end])
+			return b.validRune(r, size), size
+		},
+		func(i int) (Codepoint, int) {
+			r, size := utf8.DecodeLastRune(text[:i])
+			return b.validRune(r, size), size
+		})
+}
+
+// AddUTF16 adds the item text[itemOffset:itemOffset+itemLength] of UTF-16
+// encoded text to the buffer, with the text around it as context.
+// Offsets, lengths and clusters count 16-bit code units. Unpaired
+// surrogates are added as ReplacementCodepoint. A negative itemLength
+// extends the item to the end of text.
+// HarfBuzz equivalent: hb_buffer_add_utf16() in hb-buffer.cc
+func (b *Buffer) AddUTF16(text []uint16, itemOffset, itemLength int) {
+	b.addText(len(text), itemOffset, itemLength,
+		func(i, end int) (Codepoint, int) {
+			c := rune(text[i])
+			if utf16.IsSurrogate(c) {
+				if c < 0xDC00 && i+1 < end {
+					if r := utf16.DecodeRune(c, rune(text[i+1])); r != unicode.ReplacementChar {
+						return Codepoint(r), 2
+					}
+				}
+				return b.replacement(), 1
+			}
+			return Codepoint(c), 1
+		},
+		func(i int) (Codepoint, int) {
+			c := rune(text[i-1])
+			if utf16.IsSurrogate(c) {
+				if c >= 0xDC00 && i >= 2 {
+					if r := utf16.DecodeRune(rune(text[i-2]), c); r != unicode.ReplacementChar {
+						return Codepoint(r), 2
+					}
+				}
+				return b.replacement(), 1
+			}
+			return Codepoint(c), 1
+		})
+}
+
+// validRune maps a decoding error to ReplacementCodepoint. A RuneError of
+// size 1 is an invalid byte, anything longer an encoded U+FFFD.
+func (b *Buffer) validRune(r rune, size int) Codepoint {
+	if r == utf8.RuneError && size <= 1 {
+		return b.replacement()
+	}
+	return Codepoint(r)
+}
+
+// replacement returns ReplacementCodepoint, or U+FFFD for a buffer that
+// was not created by NewBuffer.
+func (b *Buffer) replacement() Codepoint {
+	if b.ReplacementCodepoint == 0 {
+		return DefaultReplacementCodepoint
+	}
+	return b.ReplacementCodepoint
+}
+
+// addText adds the item [itemOffset, itemOffset+itemLength) of a text of n
+// code units and stores the context around it. next decodes the character
+// starting at code unit i from the code units before end, prev the
+// character ending before code unit i; both return the character and its
+// length in code units. Characters of the item are decoded within the item,
+// so one that straddles its end is invalid. Clusters are the code unit
+// offsets of the characters.
+// HarfBuzz equivalent: hb_buffer_add_utf() in hb-buffer.cc
+func (b *Buffer) addText(n, itemOffset, itemLength int, next func(i, end int) (Codepoint, int), prev func(i int) (Codepoint, int)) {
+	itemOffset = max(0, min(itemOffset, n))
+	if itemLength < 0 || itemOffset+itemLength > n {
+		itemLength = n - itemOffset
+	}
+	itemEnd := itemOffset + itemLength
+
+	// HarfBuzz: pre-context is only stored for the first item
+	if len(b.Info) == 0 && itemOffset > 0 {
+		b.preContext = b.preContext[:0]
+		for i := itemOffset; i > 0 && len(b.preContext) < bufferContextLength; {
+			cp, size := prev(i)
+			b.preContext = append(b.preContext, cp)
+			i -= size
 		}
-		b.Info = append(b.Info, info)
 	}
+
+	// HarfBuzz: cluster = index into input text (hb-buffer.cc:1858)
+	// No mark grouping here - clusters are merged during shaping (ligatures, etc.)
+	for i := itemOffset; i < itemEnd; {
+		cp, size := next(i, itemEnd)
+		b.add(cp, i)
+		i += size
+	}
+
+	b.postContext = b.postContext[:0]
+	for i := itemEnd; i < n && len(b.postContext) < bufferContextLength; {
+		cp, size := next(i, n)
+		b.postContext = append(b.postContext, cp)
+		i += size
+	}
+
 	b.Pos = make([]GlyphPos, len(b.Info))
 }
 
+// add appends a character to the buffer.
+// HarfBuzz equivalent: hb_buffer_t::add() in hb-buffer.cc
+func (b *Buffer) add(cp Codepoint, cluster int) {
+	info := GlyphInfo{
+		Codepoint: cp,
+		Cluster:   cluster,
+		Mask:      MaskGlobal, // HarfBuzz: glyphs start with global_mask
+	}
+	// HarfBuzz: _hb_glyph_info_set_unicode_props() sets UPROPS_MASK_IGNORABLE and Cf flags
+	if IsDefaultIgnorable(cp) {
+		info.GlyphProps |= GlyphPropsDefaultIgnorable
+	}
+	if cp == 0x200C { // ZWNJ
+		info.GlyphProps |= GlyphPropsZWNJ
+	}
+	if cp == 0x200D { // ZWJ
+		info.GlyphProps |= GlyphPropsZWJ
+	}
+	// HarfBuzz: UPROPS_MASK_HIDDEN for CGJ, Mongolian FVS, TAG chars
+	// These should NOT be skipped during GSUB context matching
+	if isHiddenDefaultIgnorable(cp) {
+		info.GlyphProps |= GlyphPropsHidden
+	}
+	b.Info = append(b.Info, info)
+}
+
 // SetDirection sets the text direction.
 func (b *Buffer) SetDirection(dir Direction) {
 	b.Direction = dir
@@ -381,10 +556,12 @@ func (b *Buffer) Len() int {
 	return len(b.Info)
 }
 
-// Clear removes all glyphs from the buffer.
+// Clear removes all glyphs and the context from the buffer.
 func (b *Buffer) Clear() {
 	b.Info = b.Info[:0]
 	b.Pos = b.Pos[:0]
+	b.preContext = b.preContext[:0]
+	b.postContext = b.postContext[:0]
 }
 
 // Reset clears the buffer and resets all properties to defaults.
@@ -393,10 +570,14 @@ func (b *Buffer) Reset() {
 	b.Pos = b.Pos[:0]
 	b.Direction = 0 // Unset - will be determined by GuessSegmentProperties or shaper
 	b.Flags = BufferFlagDefault
+	b.ClusterLevel = ClusterLevelMonotoneGraphemes
 	b.Script = 0
 	b.Language = 0
 	b.serial = 0
 	b.ScratchFlags = 0
+	b.ReplacementCodepoint = DefaultReplacementCodepoint
+	b.preContext = b.preContext[:0]
+	b.postContext = b.postContext[:0]
 }
 
 // Reverse reverses the order of glyphs in the buffer.
@@ -438,11 +619,17 @@ func (b *Buffer) AllocateLigID() uint8 {
 
 // MergeClusters merges clusters in the range [start, end).
 // All glyphs in the range are assigned the minimum cluster value found in the range.
+// At ClusterLevelCharacters clusters are left alone and the range is marked
+// unsafe to break instead.
 // HarfBuzz equivalent: hb_buffer_t::merge_clusters_impl() in hb-buffer.cc:547-582
 func (b *Buffer) MergeClusters(start, end int) {
 	if end-start < 2 {
 		return
 	}
+	if b.ClusterLevel == ClusterLevelCharacters {
+		b.unsafeToBreak(start, end)
+		return
+	}
 	if start < 0 || end > len(b.Info) {
 		return
 	}
@@ -466,40 +653,7 @@ func (b *Buffer) MergeClusters(start, end int) {
 
 	// Set all glyphs in extended range to the minimum cluster
 	for i := start; i < end; i++ {
-		b.Info[i].Cluster = minCluster
-	}
-}
-
-// mergeClustersSlice merges clusters in a GlyphInfo slice (used during normalization).
-// HarfBuzz equivalent: hb_buffer_t::merge_clusters_impl() in hb-buffer.cc:547-582
-// This is a standalone version for use with temporary slices during normalization.
-func mergeClustersSlice(info []GlyphInfo, start, end int) {
-	if end-start < 2 {
-		return
-	}
-	if start < 0 || end > len(info) {
-		return
-	}
-
-	// Find minimum cluster in range
-	minCluster := info[start].Cluster
-	for i := start + 1; i < end; i++ {
-		if info[i].Cluster < minCluster {
-			minCluster = info[i].Cluster
-		}
-	}
-
-	// Extend end: If the last glyph in range has a different cluster than the minimum,
-	// extend the range to include following glyphs with the same cluster.
-	if minCluster != info[end-1].Cluster {
-		for end < len(info) && info[end-1].Cluster == info[end].Cluster {
-			end++
-		}
-	}
-
-	// Set all glyphs in extended range to the minimum cluster
-	for i := start; i < end; i++ {
-		info[i].Cluster = minCluster
+		setCluster(&b.Info[i], minCluster, 0)
 	}
 }
 
@@ -539,10 +693,15 @@ func isContinuation(cp Codepoint) bool {
 // formClusters merges clusters for grapheme groups (base + continuations).
 // HarfBuzz equivalent: hb_form_clusters() in hb-ot-shape.cc:577-589
 // This ensures that a base character and its continuations share the same cluster.
+// At the other cluster levels graphemes are only marked unsafe to break.
 func formClusters(buf *Buffer) {
 	if len(buf.Info) < 2 {
 		return
 	}
+	merge := buf.MergeClusters
+	if buf.ClusterLevel != ClusterLevelMonotoneGraphemes {
+		merge = buf.unsafeToBreak
+	}
 
 	// Find grapheme boundaries and merge clusters
 	// A grapheme is: base character + any following continuations
@@ -556,13 +715,13 @@ func formClusters(buf *Buffer) {
 		}
 		// This is a new base - merge the previous grapheme's clusters
 		if i > start+1 {
-			buf.MergeClusters(start, i)
+			merge(start, i)
 		}
 		start = i
 	}
 	// Merge the last grapheme
 	if len(buf.Info) > start+1 {
-		buf.MergeClusters(start, len(buf.Info))
+		merge(start, len(buf.Info))
 	}
 }
 
@@ -699,6 +858,48 @@ func (b *Buffer) outputInfo(info GlyphInfo) {
 	b.outLen++
 }
 
+// replaceGlyphs consumes numIn glyphs from the input and outputs one glyph per
+// codepoint. The consumed clusters are merged and the output glyphs inherit
+// the properties of the current glyph. Used before glyph mapping, so the
+// GlyphID holds the codepoint.
+// HarfBuzz equivalent: hb_buffer_t::replace_glyphs() in hb-buffer.hh:305-322
+func (b *Buffer) replaceGlyphs(numIn int, codepoints []Codepoint) {
+	b.MergeClusters(b.Idx, b.Idx+numIn)
+	orig := b.Info[b.Idx]
+	for _, cp := range codepoints {
+		info := orig
+		info.Codepoint = cp
+		info.GlyphID = GlyphID(cp)
+		b.outputInfo(info)
+	}
+	b.Idx += numIn
+}
+
+// deleteGlyph consumes the current glyph without output. Its cluster is
+// merged into a neighbouring glyph unless another glyph of the cluster
+// survives, so the character stays reachable from the glyph run.
+// HarfBuzz equivalent: hb_buffer_t::delete_glyph() in hb-buffer.cc
+func (b *Buffer) deleteGlyph() {
+	cluster := b.Info[b.Idx].Cluster
+	switch {
+	case b.Idx+1 < len(b.Info) && cluster == b.Info[b.Idx+1].Cluster,
+		b.outLen > 0 && cluster == b.outInfo[b.outLen-1].Cluster:
+		// Cluster survives; do nothing
+	case b.outLen > 0:
+		// Merge cluster backward
+		if oldCluster := b.outInfo[b.outLen-1].Cluster; cluster < oldCluster {
+			flags := b.Info[b.Idx].Flags
+			for i := b.outLen; i > 0 && b.outInfo[i-1].Cluster == oldCluster; i-- {
+				setCluster(&b.outInfo[i-1], cluster, flags)
+			}
+		}
+	case b.Idx+1 < len(b.Info):
+		// Merge cluster forward
+		b.MergeClusters(b.Idx, b.Idx+2)
+	}
+	b.Idx++
+}
+
 // sync finalizes the output buffer and replaces Info with the output.
 // HarfBuzz equivalent: hb_buffer_t::sync() in hb-buffer.cc:416
 func (b *Buffer) sync() {
@@ -744,11 +945,10 @@ func (b *Buffer) deleteGlyphsInplace(filter func(*GlyphInfo) bool) {
 			if j > 0 {
 				// Merge cluster backward.
 				if cluster < b.Info[j-1].Cluster {
-					mask := b.Info[i].Mask
+					flags := b.Info[i].Flags
 					oldCluster := b.Info[j-1].Cluster
 					for k := j; k > 0 && b.Info[k-1].Cluster == oldCluster; k-- {
-						b.Info[k-1].Cluster = cluster
-						b.Info[k-1].Mask = mask
+						setCluster(&b.Info[k-1], cluster, flags)
 					}
 				}
 				continue
@@ -875,10 +1075,10 @@ func (b *Buffer) moveTo(i int) bool {
 // ReorderMarksCallback is a function that performs script-specific mark reordering.
 // HarfBuzz equivalent: hb_ot_shaper_t::reorder_marks callback
 // Parameters:
-//   - info: The slice of glyph info to reorder
+//   - buf: The buffer holding the normalized glyphs
 //   - start: Start index of the mark sequence
 //   - end: End index of the mark sequence (exclusive)
-type ReorderMarksCallback func(info []GlyphInfo, start, end int)
+type ReorderMarksCallback func(buf *Buffer, start, end int)
 
 // HasArabicFallbackPlan returns true if the shaper has an Arabic fallback plan.
 // Used for debugging and testing.
@@ -922,6 +1122,14 @@ func (s *Shaper) DebugArabicFallbackPlan() {
 }
 
 // Shaper holds font data and performs text shaping.
+//
+// A Shaper is safe for concurrent use by multiple goroutines, each shaping
+// its own Buffer. All state of a shaping call lives in the buffer and the
+// shape plan; caches filled during shaping are guarded by locks. The
+// configuration methods (SetVariations, SetVariation, SetNamedInstance,
+// SetScale, SetPpem, SetPtem, SetSyntheticBold, SetSyntheticSlant,
+// SetDefaultFeatures) must not be called while the shaper is in use by
+// other goroutines.
 type Shaper struct {
 	font *Font
 	face *Face // Font metrics (ascender, descender, upem, etc.) - like HarfBuzz hb_font_t
@@ -932,9 +1140,15 @@ type Shaper struct {
 	kern *Kern // TrueType kern table (fallback for GPOS)
 	hmtx *Hmtx
 	glyf *Glyf // TrueType glyph data (for fallback mark positioning)
+	cff  *CFF  // CFF glyph data (for fallback mark positioning and vertical origins)
+	cff2 *CFF2 // CFF2 glyph data (for fallback mark positioning)
+	vmtx *Vmtx // Vertical metrics (for vertical text)
+	vorg *VORG // Vertical origins of CFF fonts
 	fvar *Fvar
 	avar *Avar
 	hvar *Hvar
+	vvar *Vvar
+	gvar *Gvar // Glyph variations (for contour-point anchors)
 
 	// Default features to apply when nil is passed to Shape
 	defaultFeatures []Feature
@@ -944,21 +1158,38 @@ type Shaper struct {
 	normalizedCoords  []float32 // Normalized coordinates [-1, 1]
 	normalizedCoordsI []int     // Normalized coords in F2DOT14 format, after avar mapping
 
-	// Script-specific mark reordering callback.
-	// HarfBuzz equivalent: plan->shaper->reorder_marks in hb-ot-shape-normalize.cc:394-395
-	// Set this before calling normalizeBuffer for scripts that need mark reordering
-	// (e.g., Arabic, Hebrew). Reset to nil after normalization.
-	reorderMarksCallback ReorderMarksCallback
+	// Pixels per em for hinting Device tables (0: no hinting deltas)
+	// HarfBuzz equivalent: hb_font_t::x_ppem, y_ppem
+	xPpem, yPpem uint16
+
+	// Font scale, see SetScale (0: upem)
+	// HarfBuzz equivalent: hb_font_t::x_scale, y_scale
+	xScale, yScale int32
+
+	// Point size for the optical size (0: unset)
+	// HarfBuzz equivalent: hb_font_t::ptem
+	ptem float32
+
+	// opszSet is true when the 'opsz' axis was set explicitly, so the
+	// size of the font does not select the optical size.
+	opszSet bool
+
+	// Synthetic bold and slant, see SetSyntheticBold and SetSyntheticSlant
+	// HarfBuzz equivalent: hb_font_t::x_embolden, y_embolden,
+	// embolden_in_place and slant
+	xEmbolden, yEmbolden float32
+	emboldenInPlace      bool
+	slant                float32
 
 	// Arabic fallback shaping plan.
 	// Used when font has no GSUB but has Unicode Arabic Presentation Forms.
 	// HarfBuzz equivalent: arabic_fallback_plan_t in hb-ot-shaper-arabic-fallback.hh
 	arabicFallbackPlan *arabicFallbackPlan
 
-	// Indic shaping plans - one per script.
-	// HarfBuzz equivalent: indic_shape_plan_t in hb-ot-shaper-indic.cc:289-308
-	// Lazily initialized when first shaping Indic text.
-	indicPlans map[Tag]*IndicPlan
+	// Cached shape plans, see cachedShapePlan.
+	// HarfBuzz equivalent: hb_face_t::shape_plans
+	planMu sync.Mutex
+	plans  map[shapePlanKey]*ShapePlan
 }
 
 // NewShaper creates a shaper from a parsed font.
@@ -1067,6 +1298,22 @@ func NewShaperFromFace(face *Face) (*Shaper, error) {
 		}
 	}
 
+	// Parse CFF (optional, for glyph extents)
+	if font.HasTable(TagCFF) {
+		data, err := font.TableData(TagCFF)
+		if err == nil {
+			s.cff, _ = ParseCFF(data)
+		}
+	}
+
+	// Parse CFF2 (optional, for fallback mark positioning)
+	if font.HasTable(TagCFF2) {
+		data, err := font.TableData(TagCFF2)
+		if err == nil {
+			s.cff2, _ = ParseCFF2(data)
+		}
+	}
+
 	// Parse fvar (variable fonts)
 	if font.HasTable(TagFvar) {
 		data, err := font.TableData(TagFvar)
@@ -1102,6 +1349,31 @@ func NewShaperFromFace(face *Face) (*Shaper, error) {
 		}
 	}
 
+	// Parse gvar (glyph variations, for contour-point anchors)
+	if s.glyf != nil && font.HasTable(TagGvar) {
+		data, err := font.TableData(TagGvar)
+		if err == nil {
+			s.gvar, _ = ParseGvar(data)
+		}
+	}
+
+	// Parse vertical metrics (optional, for vertical text)
+	if font.HasTable(TagVmtx) && font.HasTable(TagVhea) {
+		s.vmtx, _ = ParseVmtxFromFont(font)
+	}
+	if font.HasTable(TagVORG) {
+		data, err := font.TableData(TagVORG)
+		if err == nil {
+			s.vorg, _ = ParseVORG(data)
+		}
+	}
+	if font.HasTable(TagVvar) {
+		data, err := font.TableData(TagVvar)
+		if err == nil {
+			s.vvar, _ = ParseVvar(data)
+		}
+	}
+
 	// Initialize Arabic fallback plan if needed
 	// HarfBuzz: arabic_fallback_plan_create() in hb-ot-shaper-arabic-fallback.hh:323-347
 	// Only creates plan for Arabic script fonts without GSUB positional features
@@ -1128,6 +1400,7 @@ func (s *Shaper) HasVariations() bool {
 
 // SetVariations sets the variation axis values.
 // This overrides all existing variations. Axes not included will be set to their default values.
+// Without an 'opsz' value the optical size follows the size of the font, see SetPtem.
 func (s *Shaper) SetVariations(variations []Variation) {
 	if s.fvar == nil || s.fvar.AxisCount() == 0 {
 		return
@@ -1140,8 +1413,8 @@ func (s *Shaper) SetVariations(variations []Variation) {
 	for i := 0; i < axisCount; i++ {
 		s.designCoords[i] = axes[i].DefaultValue
 		s.normalizedCoords[i] = 0
-		s.normalizedCoordsI[i] = 0
 	}
+	s.opszSet = false
 
 	// Apply specified variations
 	for _, v := range variations {
@@ -1149,7 +1422,7 @@ func (s *Shaper) SetVariations(variations []Variation) {
 			if axes[i].Tag == v.Tag {
 				s.designCoords[i] = clampFloat32(v.Value, axes[i].MinValue, axes[i].MaxValue)
 				s.normalizedCoords[i] = s.fvar.NormalizeAxisValue(i, v.Value)
-				s.normalizedCoordsI[i] = floatToF2DOT14(s.normalizedCoords[i])
+				s.opszSet = s.opszSet || v.Tag == TagAxisOpticalSize
 				break
 			}
 		}
@@ -1157,6 +1430,7 @@ func (s *Shaper) SetVariations(variations []Variation) {
 
 	// Apply avar mapping
 	s.applyAvarMapping()
+	s.applyOpticalSize()
 }
 
 // SetVariation sets a single variation axis value.
@@ -1171,7 +1445,7 @@ func (s *Shaper) SetVariation(tag Tag, value float32) {
 		if axis.Tag == tag {
 			s.designCoords[i] = clampFloat32(value, axis.MinValue, axis.MaxValue)
 			s.normalizedCoords[i] = s.fvar.NormalizeAxisValue(i, value)
-			s.normalizedCoordsI[i] = floatToF2DOT14(s.normalizedCoords[i])
+			s.opszSet = s.opszSet || tag == TagAxisOpticalSize
 			// Apply avar mapping
 			s.applyAvarMapping()
 			return
@@ -1180,6 +1454,7 @@ func (s *Shaper) SetVariation(tag Tag, value float32) {
 }
 
 // SetNamedInstance sets the variation to a named instance (e.g., "Bold", "Light").
+// With a size set, the optical size follows the size, see SetPtem.
 func (s *Shaper) SetNamedInstance(index int) {
 	if s.fvar == nil {
 		return
@@ -1195,11 +1470,14 @@ func (s *Shaper) SetNamedInstance(index int) {
 	for i := 0; i < axisCount && i < len(instance.Coords); i++ {
 		s.designCoords[i] = instance.Coords[i]
 		s.normalizedCoords[i] = s.fvar.NormalizeAxisValue(i, instance.Coords[i])
-		s.normalizedCoordsI[i] = floatToF2DOT14(s.normalizedCoords[i])
 	}
+	s.opszSet = false
 
 	// Apply avar mapping
 	s.applyAvarMapping()
+	if s.ptem != 0 || s.yPpem != 0 {
+		s.applyOpticalSize()
+	}
 }
 
 // DesignCoords returns the current design-space coordinates.
@@ -1224,6 +1502,76 @@ func (s *Shaper) NormalizedCoords() []float32 {
 	return result
 }
 
+// SetPpem sets the pixels per em that hinting Device tables in GPOS are
+// evaluated at. Zero (the default) disables hinting deltas. Without a point
+// size, the vertical ppem also selects the optical size, see SetPtem.
+// Device deltas are converted to positions with the font scale, so set
+// the scale that matches the ppem as well, see SetScale.
+// HarfBuzz equivalent: hb_font_set_ppem()
+func (s *Shaper) SetPpem(xPpem, yPpem uint16) {
+	s.xPpem = xPpem
+	s.yPpem = yPpem
+	if s.ptem == 0 {
+		s.applyOpticalSize()
+	}
+}
+
+// Ppem returns the pixels per em set with SetPpem.
+func (s *Shaper) Ppem() (xPpem, yPpem uint16) {
+	return s.xPpem, s.yPpem
+}
+
+// hasNonZeroCoords returns true if any normalized coordinate is not at the default.
+// HarfBuzz equivalent: hb_font_t::has_nonzero_coords
+func (s *Shaper) hasNonZeroCoords() bool {
+	for _, c := range s.normalizedCoordsI {
+		if c != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceContext returns the state GPOS Device and VariationIndex tables are
+// resolved against, or nil if they cannot contribute anything.
+// HarfBuzz: use_x_device/use_y_device in ValueFormat::apply_value()
+func (s *Shaper) deviceContext() *DeviceContext {
+	hasCoords := s.hasNonZeroCoords()
+	upem := int32(s.face.Upem())
+	xScale, yScale := s.Scale()
+	if s.xPpem == 0 && s.yPpem == 0 && !hasCoords && xScale == upem && yScale == upem {
+		return nil
+	}
+	dc := &DeviceContext{
+		XPpem:  s.xPpem,
+		YPpem:  s.yPpem,
+		XScale: xScale,
+		YScale: yScale,
+		Upem:   upem,
+	}
+	if hasCoords {
+		dc.Coords = s.normalizedCoordsI
+		if s.gdef != nil {
+			dc.VarStore = s.gdef.VarStore()
+		}
+	}
+	if s.glyf != nil {
+		glyf, gvar := s.glyf, s.gvar
+		coords := s.normalizedCoordsI
+		if !hasCoords {
+			gvar = nil
+		}
+		dc.ContourPoint = func(gid GlyphID, index uint16) (x, y float64, ok bool) {
+			points, _ := glyf.GlyphPoints(gid, gvar, coords)
+			if int(index) >= len(points) {
+				return 0, 0, false
+			}
+			return points[index].X, points[index].Y, true
+		}
+	}
+	return dc
+}
+
 // Fvar returns the parsed fvar table, or nil if not present.
 func (s *Shaper) Fvar() *Fvar {
 	return s.fvar
@@ -1239,8 +1587,12 @@ func (s *Shaper) HasHvar() bool {
 	return s.hvar != nil && s.hvar.HasData()
 }
 
-// applyAvarMapping applies avar non-linear mapping to normalizedCoordsI.
+// applyAvarMapping sets normalizedCoordsI from normalizedCoords, with the
+// avar non-linear mapping applied.
 func (s *Shaper) applyAvarMapping() {
+	for i, v := range s.normalizedCoords {
+		s.normalizedCoordsI[i] = floatToF2DOT14(v)
+	}
 	if s.avar == nil || !s.avar.HasData() {
 		return
 	}
@@ -1258,15 +1610,58 @@ func (s *Shaper) Shape(buf *Buffer, features []Feature) {
 		return
 	}
 
-	// Use default features if none specified
-	if len(features) == 0 {
-		features = s.defaultFeatures
-	}
-
 	// Step 1: Guess segment properties (script, direction, language)
 	// HarfBuzz equivalent: hb_buffer_guess_segment_properties() in hb-buffer.cc
 	buf.GuessSegmentProperties()
 
+	props := SegmentProperties{Direction: buf.Direction, Script: buf.Script, Language: buf.Language}
+	s.ShapeWithPlan(s.cachedShapePlan(props, features), buf)
+}
+
+// ShapeWithPlan shapes the text in the buffer with a plan created by
+// NewShapePlan of the same Shaper. The buffer takes the segment properties
+// of the plan. A plan of another Shaper, or of other variation coordinates,
+// is replaced by the matching cached plan.
+// HarfBuzz equivalent: hb_shape_plan_execute() in hb-shape-plan.cc
+func (s *Shaper) ShapeWithPlan(plan *ShapePlan, buf *Buffer) {
+	if buf.Len() == 0 {
+		return
+	}
+	if plan.owner != s || plan.coords != coordsKey(s.normalizedCoordsI) {
+		// The maps of a plan refer to the tables of its own font, the
+		// feature variations to its coordinates
+		plan = s.cachedShapePlan(plan.Props, plan.userFeatures)
+	}
+
+	buf.Direction = plan.Props.Direction
+	buf.Script = plan.Props.Script
+	buf.Language = plan.Props.Language
+	buf.plan = plan
+	defer func() { buf.plan = nil }()
+
+	features := plan.features
+	defaultFeatures := plan.defaultFeatures
+
+	// Glyph flags are recomputed by every run
+	// HarfBuzz: masks are reset in hb_ot_shape_setup_masks()
+	buf.ScratchFlags &^= ScratchFlagHasGlyphFlags
+	for i := range buf.Info {
+		buf.Info[i].Flags = 0
+	}
+
+	// Map the text context, so contextual lookups can see across the
+	// item boundaries
+	for k, text := range [2][]Codepoint{buf.preContext, buf.postContext} {
+		buf.contextGlyphs[k] = buf.contextGlyphs[k][:0]
+		for _, cp := range text {
+			var gid GlyphID
+			if s.cmap != nil {
+				gid, _ = s.cmap.Lookup(cp)
+			}
+			buf.contextGlyphs[k] = append(buf.contextGlyphs[k], gid)
+		}
+	}
+
 	// Step 1.5: Form clusters - merge grapheme clusters (base + marks)
 	// HarfBuzz equivalent: hb_form_clusters() in hb-ot-shape.cc:577-589
 	// This is called BEFORE shaping to group base characters with their marks
@@ -1277,17 +1672,9 @@ func (s *Shaper) Shape(buf *Buffer, features []Feature) {
 	// This happens BEFORE shaper dispatch so it works for all shapers!
 	s.insertDottedCircle(buf)
 
-	// Step 3: Select the appropriate shaper based on script, direction, and font script tag
-	// HarfBuzz equivalent: hb_ot_shaper_categorize() in hb-ot-shaper.hh
-	// The font's actual script tag (e.g., 'knd3' vs 'knd2') determines which shaper to use.
-	// For Indic scripts with version 3 tags, USE shaper is used instead of Indic shaper.
-	var shaper *OTShaper
-	if s.gsub != nil {
-		fontScriptTag := s.gsub.FindChosenScriptTag(buf.Script)
-		shaper = SelectShaperWithFont(buf.Script, buf.Direction, fontScriptTag)
-	} else {
-		shaper = SelectShaper(buf.Script, buf.Direction)
-	}
+	// Step 3: The shaper for script, direction and font script tag was
+	// selected by the plan
+	shaper := plan.Shaper
 
 	// Step 4: Dispatch to the appropriate shaping function based on shaper
 	// HarfBuzz: Uses function pointers in hb_ot_shaper_t
@@ -1315,8 +1702,9 @@ func (s *Shaper) Shape(buf *Buffer, features []Feature) {
 		// Hebrew shaper with mark reordering
 		s.shapeHebrew(buf, features)
 	case "hangul":
-		// Hangul shaper (currently falls back to default)
-		s.shapeDefault(buf, features)
+		// Hangul shaper with jamo composition and tone marks
+		// HarfBuzz equivalent: _hb_ot_shaper_hangul in hb-ot-shaper-hangul.cc
+		s.shapeHangul(buf, features, defaultFeatures)
 	case "qaag":
 		// Zawgyi (Myanmar visual encoding) shaper
 		// HarfBuzz equivalent: _hb_ot_shaper_myanmar_zawgyi in hb-ot-shaper-myanmar.cc
@@ -1326,9 +1714,16 @@ func (s *Shaper) Shape(buf *Buffer, features []Feature) {
 		s.shapeDefault(buf, features)
 	}
 
+	// HarfBuzz: synthetic slant at the end of hb_ot_position()
+	s.applySyntheticSlant(buf)
+
 	// Step 4: Handle default ignorables (after all shaping)
 	// HarfBuzz: hb-ot-shape.cc:828-851 (hb_ot_hide_default_ignorables)
 	s.hideDefaultIgnorables(buf)
+
+	// Step 5: Give all glyphs of a cluster the same glyph flags
+	// HarfBuzz: hb_ot_shape_propagate_flags() in hb-ot-shape.cc
+	propagateFlags(buf)
 }
 
 // insertDottedCircle inserts U+25CC dotted circle before orphaned marks.
@@ -1342,8 +1737,9 @@ func (s *Shaper) insertDottedCircle(buf *Buffer) {
 	}
 
 	// 2. Check if buffer starts with a mark (BOT flag + first char is mark)
-	// BOT = Beginning Of Text
+	// BOT = Beginning Of Text. A mark after pre-context has a base there.
 	if buf.Flags&BufferFlagBOT == 0 ||
+		len(buf.preContext) > 0 ||
 		buf.Len() == 0 ||
 		!IsUnicodeMark(buf.Info[0].Codepoint) {
 		return
@@ -1482,7 +1878,7 @@ func (s *Shaper) shapeDefault(buf *Buffer, features []Feature) {
 	s.setGlyphClasses(buf)
 
 	// Step 5: Categorize and apply features
-	gsubFeatures, gposFeatures := s.categorizeFeatures(features)
+	gsubFeatures, gposFeatures := s.planFeatures(buf, features)
 
 	// Add direction-dependent features (HarfBuzz: hb-ot-shape.cc:332-347)
 	switch buf.Direction {
@@ -1527,9 +1923,9 @@ func (s *Shaper) shapeDefault(buf *Buffer, features []Feature) {
 func (s *Shaper) shapeHebrew(buf *Buffer, features []Feature) {
 	// Step 1: Normalize Unicode with Hebrew mark reordering
 	// HarfBuzz: reorder_marks_hebrew() callback during normalization
-	s.reorderMarksCallback = reorderMarksHebrewSlice
+	buf.reorderMarks = reorderHebrewMarks
 	s.normalizeBuffer(buf, NormalizationModeAuto)
-	s.reorderMarksCallback = nil
+	buf.reorderMarks = nil
 
 	// Step 2: Initialize masks
 	buf.ResetMasks(MaskGlobal)
@@ -1541,7 +1937,7 @@ func (s *Shaper) shapeHebrew(buf *Buffer, features []Feature) {
 	s.setGlyphClasses(buf)
 
 	// Step 5: Categorize and apply features
-	gsubFeatures, gposFeatures := s.categorizeFeatures(features)
+	gsubFeatures, gposFeatures := s.planFeatures(buf, features)
 
 	// Add RTL features (Hebrew is RTL)
 	gsubFeatures = append(gsubFeatures, Feature{Tag: MakeTag('r', 't', 'l', 'a'), Value: 1})
@@ -1582,7 +1978,7 @@ func (s *Shaper) shapeQaag(buf *Buffer, features []Feature) {
 	s.setGlyphClasses(buf)
 
 	// Step 5: Categorize and apply features
-	gsubFeatures, gposFeatures := s.categorizeFeatures(features)
+	gsubFeatures, gposFeatures := s.planFeatures(buf, features)
 
 	// Add direction-dependent features
 	switch buf.Direction {
@@ -1729,9 +2125,9 @@ func (s *Shaper) shapeArabic(buf *Buffer, features []Feature) {
 	// Arabic requires special mark reordering: MCMs (Modifier Combining Marks) like
 	// HAMZA ABOVE/BELOW need to be moved to the beginning of the mark sequence.
 	// HarfBuzz equivalent: plan->shaper->reorder_marks in hb-ot-shape-normalize.cc:394-395
-	s.reorderMarksCallback = reorderMarksArabicSlice
+	buf.reorderMarks = reorderArabicMarks
 	s.normalizeBuffer(buf, NormalizationModeComposedDiacritics)
-	s.reorderMarksCallback = nil // Reset callback after normalization
+	buf.reorderMarks = nil // Reset callback after normalization
 
 	// Step 0.5: Initialize masks after normalization
 	// HarfBuzz equivalent: hb_ot_shape_initialize_masks()
@@ -1754,7 +2150,7 @@ func (s *Shaper) shapeArabic(buf *Buffer, features []Feature) {
 	//
 	// User GSUB features are passed to applyArabicFeatures, which filters out
 	// standard Arabic features (ccmp, rlig, calt, liga, etc.) and applies the rest.
-	gsubFeatures, _ := s.categorizeFeatures(features)
+	gsubFeatures, _ := s.planFeatures(buf, features)
 	s.applyArabicFeatures(buf, gsubFeatures)
 
 	// Step 1.5: Set glyph classes from GDEF AFTER GSUB (CRITICAL!)
@@ -1768,7 +2164,7 @@ func (s *Shaper) shapeArabic(buf *Buffer, features []Feature) {
 
 	// Step 3: Apply GPOS features
 	// Arabic shaper uses LATE zero width marks (HarfBuzz: HB_OT_SHAPE_ZERO_WIDTH_MARKS_BY_GDEF_LATE)
-	_, gposFeatures := s.categorizeFeatures(features)
+	_, gposFeatures := s.planFeatures(buf, features)
 	s.applyGPOSWithZeroWidthMarks(buf, gposFeatures, ZeroWidthMarksByGDEFLate)
 	s.applyKernTableFallback(buf, features) // Fallback if no GPOS kern
 
@@ -1910,6 +2306,54 @@ func (s *Shaper) getDefaultGSUBFeatures(direction Direction) []Feature {
 	return features
 }
 
+// horizontalOnlyFeatures are the default features HarfBuzz enables for
+// horizontal text only.
+// HarfBuzz equivalent: horizontal_features[] in hb-ot-shape.cc:308-318
+var horizontalOnlyFeatures = []Tag{TagCalt, TagClig, TagCurs, TagDist, TagKern, TagLiga, MakeTag('r', 'c', 'l', 't')}
+
+// verticalFeatures returns the features for vertical text. Horizontal-only
+// features are removed if the features are the defaults, and the vertical
+// features are added unless already given:
+// - vrt2 if the font has it, otherwise vert (vrt2 replaces vert)
+// - vkna (vertical kana alternates)
+// - vkrn (vertical kerning)
+// HarfBuzz equivalent: hb_ot_shape_collect_features() in hb-ot-shape.cc:320-327,
+// which only enables vert.
+func (s *Shaper) verticalFeatures(features []Feature, defaults bool) []Feature {
+	result := make([]Feature, 0, len(features)+3)
+	has := make(map[Tag]bool, len(features))
+	for _, f := range features {
+		if defaults && tagInList(f.Tag, horizontalOnlyFeatures) {
+			continue
+		}
+		has[f.Tag] = true
+		result = append(result, f)
+	}
+
+	vert := TagVert
+	if s.gsub != nil {
+		if featureList, err := s.gsub.ParseFeatureList(); err == nil && featureList.FindFeature(TagVrt2) != nil {
+			vert = TagVrt2
+		}
+	}
+	for _, tag := range []Tag{vert, TagVkna, TagVkrn} {
+		if !has[tag] {
+			result = append(result, NewFeatureOn(tag))
+		}
+	}
+	return result
+}
+
+// tagInList reports whether tag is in tags.
+func tagInList(tag Tag, tags []Tag) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
 // mapCodepointsToGlyphs converts Unicode codepoints to glyph IDs.
 // This function also handles Variation Selectors by combining base + VS
 // into a single variant glyph when the font supports it (cmap format 14).
@@ -2067,32 +2511,114 @@ func (s *Shaper) synthesizeGlyphClasses(buf *Buffer) {
 // HarfBuzz equivalent: hb_ot_get_glyph_h_advances() in hb-ot-font.cc
 //
 // If hmtx is not available, uses upem/2 as default advance (HarfBuzz behavior).
+// Vertical text gets advance heights instead, see setBaseVAdvances.
 func (s *Shaper) setBaseAdvances(buf *Buffer) {
+	if buf.Direction.IsVertical() {
+		s.setBaseVAdvances(buf)
+		return
+	}
+	for i := range buf.Info {
+		buf.Pos[i].XAdvance = s.glyphHAdvance(buf.Info[i].GlyphID)
+	}
+}
+
+// glyphHAdvance returns the scaled horizontal advance of a glyph, with HVAR
+// deltas and synthetic bold.
+func (s *Shaper) glyphHAdvance(glyph GlyphID) int32 {
+	xStrength, _ := s.emboldenStrength()
+	return s.emboldenAdvance(s.glyphHAdvanceUnemboldened(glyph), xStrength)
+}
+
+// glyphHAdvanceUnemboldened returns the scaled horizontal advance of a
+// glyph, with HVAR deltas.
+func (s *Shaper) glyphHAdvanceUnemboldened(glyph GlyphID) int32 {
 	// HarfBuzz: default_advance = hb_face_get_upem (face) / 2 for horizontal
 	// See hb-ot-hmtx-table.hh:272
 	if s.hmtx == nil {
-		// No hmtx table - use default advance of upem/2
-		defaultAdvance := int16(s.face.Upem() / 2)
-		for i := range buf.Info {
-			buf.Pos[i].XAdvance = defaultAdvance
-		}
-		return
+		return s.emScaleX(int32(s.face.Upem() / 2))
 	}
+	adv := int32(s.hmtx.GetAdvanceWidth(glyph))
 
-	// Check if we need to apply HVAR deltas
-	applyHvar := s.hvar != nil && s.hvar.HasData() && s.normalizedCoordsI != nil
+	// Apply HVAR delta if available
+	if s.hvar != nil && s.hvar.HasData() && s.normalizedCoordsI != nil {
+		xScale, _ := s.Scale()
+		return s.emScaleVar(adv, s.hvar.GetAdvanceDelta(glyph, s.normalizedCoordsI), xScale)
+	}
+	return s.emScaleX(adv)
+}
 
+// setBaseVAdvances sets the base advance heights from vmtx and moves every
+// glyph from its vertical origin to the pen position.
+// For variable fonts, it also applies VVAR deltas.
+// HarfBuzz equivalent: vertical branch of hb_ot_position_default() in hb-ot-shape.cc
+//
+// Advances are negative since y grows upwards.
+func (s *Shaper) setBaseVAdvances(buf *Buffer) {
 	for i := range buf.Info {
-		adv := s.hmtx.GetAdvanceWidth(buf.Info[i].GlyphID)
+		glyph := buf.Info[i].GlyphID
+		x, y := s.glyphVOrigin(glyph)
+		buf.Pos[i].XAdvance = 0
+		buf.Pos[i].YAdvance = -s.glyphVAdvance(glyph)
+		buf.Pos[i].XOffset = -x
+		buf.Pos[i].YOffset = -y
+	}
+}
+
+// glyphVAdvance returns the scaled vertical advance of a glyph, with VVAR
+// deltas and synthetic bold.
+// HarfBuzz equivalent: hb_ot_get_glyph_v_advances() in hb-ot-font.cc
+func (s *Shaper) glyphVAdvance(glyph GlyphID) int32 {
+	_, yStrength := s.emboldenStrength()
+	return s.emboldenAdvance(s.glyphVAdvanceUnemboldened(glyph), yStrength)
+}
+
+// glyphVAdvanceUnemboldened returns the scaled vertical advance of a
+// glyph, with VVAR deltas.
+//
+// If vmtx is not available, the advance is ascender - descender.
+func (s *Shaper) glyphVAdvanceUnemboldened(glyph GlyphID) int32 {
+	if s.vmtx == nil {
+		return s.emScaleY(int32(s.face.Ascender())) - s.emScaleY(int32(s.face.Descender()))
+	}
+	adv := int32(s.vmtx.GetAdvanceHeight(glyph))
+	if s.vvar.HasData() && s.normalizedCoordsI != nil {
+		_, yScale := s.Scale()
+		return s.emScaleVar(adv, s.vvar.GetAdvanceDelta(glyph, s.normalizedCoordsI), yScale)
+	}
+	return s.emScaleY(adv)
+}
+
+// glyphVOrigin returns the scaled vertical origin of a glyph relative to its
+// horizontal origin. x is half the horizontal advance; y comes from, in order:
+//  1. VORG (with VVAR deltas)
+//  2. the top of the glyph extents plus the top side bearing from vmtx
+//  3. the glyph extents centered on the line height
+//  4. the ascender
+//
+// HarfBuzz equivalent: hb_ot_get_glyph_v_origin() in hb-ot-font.cc
+func (s *Shaper) glyphVOrigin(glyph GlyphID) (x, y int32) {
+	x = s.glyphHAdvance(glyph) / 2
 
-		// Apply HVAR delta if available
-		if applyHvar {
-			delta := s.hvar.GetAdvanceDelta(buf.Info[i].GlyphID, s.normalizedCoordsI)
-			adv = uint16(int32(adv) + roundToInt(delta))
+	if s.vorg != nil {
+		y = int32(s.vorg.GetVertOriginY(glyph))
+		if s.vvar.HasData() && s.normalizedCoordsI != nil {
+			_, yScale := s.Scale()
+			return x, s.emScaleVar(y, s.vvar.GetVertOriginDelta(glyph, s.normalizedCoordsI), yScale)
 		}
+		return x, s.emScaleY(y)
+	}
 
-		buf.Pos[i].XAdvance = int16(adv)
+	ascender := s.emScaleY(int32(s.face.Ascender()))
+	if extents, ok := s.scaledGlyphExtents(glyph); ok {
+		if s.vmtx != nil {
+			return x, extents.YBearing + s.emScaleY(int32(s.vmtx.GetTsb(glyph)))
+		}
+		advance := ascender - s.emScaleY(int32(s.face.Descender()))
+		diff := advance + extents.Height
+		return x, extents.YBearing + diff>>1
 	}
+
+	return x, ascender
 }
 
 // roundToInt rounds a float32 to the nearest int32.
@@ -2107,13 +2633,21 @@ func roundToInt(v float32) int32 {
 // HarfBuzz equivalent: hb_ot_substitute_pre() in hb-ot-shape.cc
 // This version works directly on the Buffer to preserve cluster information.
 func (s *Shaper) applyGSUB(buf *Buffer, features []Feature) {
+	s.applyGSUBWithMasks(buf, features, nil)
+}
+
+// applyGSUBWithMasks applies GSUB features to the buffer. Features listed in
+// masks only apply to glyphs carrying their mask, all other features use
+// MaskGlobal.
+// HarfBuzz equivalent: hb_ot_map_t::get_1_mask() for features added without F_GLOBAL
+func (s *Shaper) applyGSUBWithMasks(buf *Buffer, features []Feature, masks map[Tag]uint32) {
 	if s.gsub == nil {
 		return
 	}
 
 	// Compute variations_index once for the entire GSUB application
 	// HarfBuzz: hb_ot_shape_plan_key_t::variations_index[] in hb-ot-shape.hh
-	variationsIndex := s.gsub.FindVariationsIndex(s.normalizedCoordsI)
+	variationsIndex := s.gsubVariationsIndex(buf)
 
 	// Apply 'rvrn' feature first (Required Variation Alternates)
 	// HarfBuzz: hb-ot-shape.cc - setup_masks_features() adds rvrn with F_GLOBAL|F_HAS_FALLBACK
@@ -2134,7 +2668,11 @@ func (s *Shaper) applyGSUB(buf *Buffer, features []Feature) {
 			continue // Feature disabled
 		}
 		// TODO: Respect f.Start/f.End for partial feature application
-		s.gsub.ApplyFeatureToBufferWithMaskAndVariations(f.Tag, buf, s.gdef, MaskGlobal, s.font, variationsIndex)
+		mask := MaskGlobal
+		if m, ok := masks[f.Tag]; ok {
+			mask = m
+		}
+		s.gsub.ApplyFeatureToBufferWithMaskAndVariations(f.Tag, buf, s.gdef, mask, s.font, variationsIndex)
 	}
 }
 
@@ -2364,7 +2902,11 @@ func (s *Shaper) applyRequiredGSUBFeaturesToBufferWithVariations(buf *Buffer, va
 
 			// Apply all lookups from the required feature
 			for _, lookupIdx := range lookups {
+				if !buf.message(s.font, "start GSUB lookup %d feature '%s'", lookupIdx, feature.Tag) {
+					continue
+				}
 				s.gsub.ApplyLookupToBuffer(int(lookupIdx), buf, s.gdef, s.font)
+				buf.message(s.font, "end GSUB lookup %d feature '%s'", lookupIdx, feature.Tag)
 			}
 		}
 	}
@@ -2464,7 +3006,7 @@ func (s *Shaper) applyGPOSWithZeroWidthMarks(buf *Buffer, features []Feature, ze
 		// h_origin defaults to zero; only apply it if the font has it.
 		// For most horizontal fonts, h_origins are (0, 0), so this is a no-op.
 		// For fonts with v_origins (vertical fonts), we convert v_origins to h_origins.
-		if s.hasGlyphHOrigins() {
+		if s.hasGlyphHOrigins(buf) {
 			s.addGlyphHOrigins(buf)
 			addedHOrigins = true
 		}
@@ -2472,8 +3014,8 @@ func (s *Shaper) applyGPOSWithZeroWidthMarks(buf *Buffer, features []Feature, ze
 		// Compile OTMap and apply all GPOS lookups
 		// HarfBuzz equivalent: hb_ot_map_t::apply() in hb-ot-layout.cc:2010-2060
 		// CRITICAL: Pass script/language for script-specific feature selection
-		otMap := CompileMap(nil, s.gpos, features, buf.Script, buf.Language)
-		otMap.ApplyGPOS(s.gpos, buf, s.font, s.gdef)
+		otMap := s.compileMap(buf, nil, s.gpos, features)
+		otMap.ApplyGPOSWithDevice(s.gpos, buf, s.font, s.gdef, s.deviceContext())
 	}
 
 	// Zero mark widths by GDEF (LATE mode)
@@ -2488,31 +3030,16 @@ func (s *Shaper) applyGPOSWithZeroWidthMarks(buf *Buffer, features []Feature, ze
 	// HarfBuzz: hb_ot_zero_width_default_ignorables() in hb-ot-shape.cc:1085
 	zeroWidthDefaultIgnorables(buf)
 
-	// DEBUG: Print state before PropagateAttachmentOffsets
-	if debugGPOS {
-		for i := range buf.Info {
-			if buf.Pos[i].AttachChain != 0 || buf.Pos[i].XOffset != 0 {
-				debugPrintf("Before PropagateAttachmentOffsets: [%d] gid=%d cluster=%d xoff=%d chain=%d type=%d xadv=%d\n",
-					i, buf.Info[i].GlyphID, buf.Info[i].Cluster, buf.Pos[i].XOffset,
-					buf.Pos[i].AttachChain, buf.Pos[i].AttachType, buf.Pos[i].XAdvance)
-			}
-		}
-	}
-
 	// Propagate attachment offsets (cursive → marks)
 	// This must be done after all GPOS lookups have set up the attachment chains
 	// AND after mark advances have been zeroed!
 	// HarfBuzz: GPOS::position_finish_offsets() in hb-ot-shape.cc:1086
 	PropagateAttachmentOffsets(buf.Pos, buf.Direction)
 
-	// DEBUG: Print state after PropagateAttachmentOffsets
-	if debugGPOS {
-		for i := range buf.Info {
-			if buf.Pos[i].XOffset != 0 {
-				debugPrintf("After PropagateAttachmentOffsets: [%d] gid=%d cluster=%d xoff=%d\n",
-					i, buf.Info[i].GlyphID, buf.Info[i].Cluster, buf.Pos[i].XOffset)
-			}
-		}
+	// Subtract h_origins back (change from GPOS horizontal coordinate system to original)
+	// HarfBuzz: hb-ot-shape.cc:1088-1090
+	if addedHOrigins {
+		s.subtractGlyphHOrigins(buf)
 	}
 
 	// Fallback mark positioning when GPOS is not available
@@ -2521,14 +3048,9 @@ func (s *Shaper) applyGPOSWithZeroWidthMarks(buf *Buffer, features []Feature, ze
 	//
 	// Only apply fallback positioning for shapers that support it.
 	// Shapers with ZeroWidthMarksNone (like Qaag) typically have fallback_position = false.
-	if s.gpos == nil && zeroWidthMarksMode != ZeroWidthMarksNone {
+	if s.gpos == nil && zeroWidthMarksMode != ZeroWidthMarksNone && buf.message(s.font, "start fallback mark") {
 		s.fallbackMarkPosition(buf)
-	}
-
-	// Subtract h_origins back (change from GPOS horizontal coordinate system to original)
-	// HarfBuzz: hb-ot-shape.cc:1088-1090
-	if addedHOrigins {
-		s.subtractGlyphHOrigins(buf)
+		buf.message(s.font, "end fallback mark")
 	}
 }
 
@@ -2579,19 +3101,26 @@ func (s *Shaper) zeroMarkWidthsByGDEF(buf *Buffer) {
 	}
 }
 
-// hasGlyphHOrigins returns true if the font has horizontal glyph origins.
+// hasGlyphHOrigins returns true if glyph positions have to be moved to the
+// horizontal origins for GPOS.
 // HarfBuzz equivalent: font->has_glyph_h_origin_func() in hb-font.hh
 //
-// For most horizontal fonts, h_origins are (0, 0), so this returns false.
-// For fonts with v_origins (vertical/CJK fonts), h_origins can be derived from v_origins.
-func (s *Shaper) hasGlyphHOrigins() bool {
-	// TODO: Implement proper h_origin detection.
-	// For now, return false since most fonts don't have h_origins.
-	// When we add vmtx support, check for vmtx table here.
-	//
-	// HarfBuzz checks: font->has_glyph_h_origin_func() || font->has_glyph_v_origins_func()
-	// If vmtx exists, we can derive h_origins from v_origins.
-	return false
+// Fonts have no h_origins of their own; they are derived from the v_origins,
+// which are only in use for vertical text. For horizontal text h_origins
+// are (0, 0).
+func (s *Shaper) hasGlyphHOrigins(buf *Buffer) bool {
+	return buf.Direction.IsVertical()
+}
+
+// glyphHOrigin returns the horizontal origin of a glyph relative to its
+// vertical origin.
+// HarfBuzz equivalent: get_glyph_h_origin_with_fallback() in hb-font.hh
+//
+// The h_origin is derived from the v_origin:
+// origin.x -= advance / 2, origin.y -= ascender
+func (s *Shaper) glyphHOrigin(glyph GlyphID) (x, y int32) {
+	x, y = s.glyphVOrigin(glyph)
+	return x - s.glyphHAdvance(glyph)/2, y - s.emScaleY(int32(s.face.Ascender()))
 }
 
 // addGlyphHOrigins adds horizontal glyph origins to buffer positions.
@@ -2600,19 +3129,11 @@ func (s *Shaper) hasGlyphHOrigins() bool {
 // This transforms positions from font coordinate space to GPOS coordinate space.
 // GPOS expects positions in horizontal origin space.
 func (s *Shaper) addGlyphHOrigins(buf *Buffer) {
-	// For most fonts, h_origins are (0, 0), so this is a no-op.
-	// This is called when hasGlyphHOrigins() returns true.
-	//
-	// HarfBuzz implementation (apply_glyph_h_origins_with_fallback):
-	// 1. Try to get h_origins for each glyph
-	// 2. If no h_origins, try v_origins and convert:
-	//    origin.x -= advance / 2
-	//    origin.y -= ascender
-	// 3. If neither, use (0, 0)
-	// 4. Add origins to x_offset and y_offset
-	//
-	// Since hasGlyphHOrigins() returns false, this function is never called.
-	// When we implement vmtx support, we'll implement this properly.
+	for i := range buf.Info {
+		x, y := s.glyphHOrigin(buf.Info[i].GlyphID)
+		buf.Pos[i].XOffset += x
+		buf.Pos[i].YOffset += y
+	}
 }
 
 // subtractGlyphHOrigins subtracts horizontal glyph origins from buffer positions.
@@ -2620,15 +3141,11 @@ func (s *Shaper) addGlyphHOrigins(buf *Buffer) {
 //
 // This transforms positions from GPOS coordinate space back to font coordinate space.
 func (s *Shaper) subtractGlyphHOrigins(buf *Buffer) {
-	// For most fonts, h_origins are (0, 0), so this is a no-op.
-	// This is called when hasGlyphHOrigins() returns true.
-	//
-	// HarfBuzz implementation:
-	// 1. Get the same h_origins as addGlyphHOrigins()
-	// 2. Subtract origins from x_offset and y_offset
-	//
-	// Since hasGlyphHOrigins() returns false, this function is never called.
-	// When we implement vmtx support, we'll implement this properly.
+	for i := range buf.Info {
+		x, y := s.glyphHOrigin(buf.Info[i].GlyphID)
+		buf.Pos[i].XOffset -= x
+		buf.Pos[i].YOffset -= y
+	}
 }
 
 // scriptAllowsKernFallback returns true if the script allows legacy kern table fallback.
@@ -2714,6 +3231,11 @@ func (s *Shaper) applyKernTableFallback(buf *Buffer, features []Feature) {
 		}
 	}
 
+	if !buf.message(s.font, "start fallback kern") {
+		return
+	}
+	defer buf.message(s.font, "end fallback kern")
+
 	// Apply kern table kerning like HarfBuzz
 	horizontal := buf.Direction.IsHorizontal()
 	glyphs := buf.GlyphIDs()
@@ -2733,10 +3255,18 @@ func (s *Shaper) applyKernTableFallback(buf *Buffer, features []Feature) {
 			break
 		}
 
-		kern := s.kern.KernPair(glyphs[i], glyphs[j])
+		kern := int32(s.kern.KernPair(glyphs[i], glyphs[j]))
 		if kern == 0 {
+			buf.unsafeToConcat(i, j+1)
 			continue
 		}
+		// HarfBuzz: hb_kern_machine_t::kern()
+		buf.unsafeToBreak(i, j+1)
+		if horizontal {
+			kern = s.emScaleX(kern)
+		} else {
+			kern = s.emScaleY(kern)
+		}
 
 		// Split kern value like HarfBuzz
 		kern1 := kern >> 1
@@ -2808,6 +3338,7 @@ func (s *Shaper) GDEF() *GDEF {
 // SetDefaultFeatures sets the default features to apply when Shape is called with nil.
 func (s *Shaper) SetDefaultFeatures(features []Feature) {
 	s.defaultFeatures = features
+	s.clearShapePlans()
 }
 
 // DefaultFeatures returns the current default features.
@@ -2820,6 +3351,11 @@ func (s *Shaper) Font() *Font {
 	return s.font
 }
 
+// Face returns the face of the shaper, with the font metrics.
+func (s *Shaper) Face() *Face {
+	return s.face
+}
+
 // GetGlyphName returns a debug name for a glyph (just the ID as string).
 func GetGlyphName(glyph GlyphID) string {
 	return string(rune('A' + int(glyph)%26)) // Simple debug representation
@@ -2830,7 +3366,8 @@ var shaperCache = make(map[*Font]*Shaper)
 var shaperCacheMu sync.RWMutex
 
 // Shape is a convenience function that shapes text in a buffer using a font.
-// It caches shapers internally for efficiency.
+// It caches shapers internally for efficiency. The cached shaper of a font
+// is shared by all goroutines, so Shape may be called concurrently.
 // This is similar to HarfBuzz's hb_shape() function.
 func Shape(font *Font, buf *Buffer, features []Feature) error {
 	shaperCacheMu.RLock()
@@ -2844,8 +3381,14 @@ func Shape(font *Font, buf *Buffer, features []Feature) error {
 			return err
 		}
 
+		// Keep the shaper of a goroutine that got here first, so all
+		// callers share one shaper and its plan cache.
 		shaperCacheMu.Lock()
-		shaperCache[font] = shaper
+		if cached, ok := shaperCache[font]; ok {
+			shaper = cached
+		} else {
+			shaperCache[font] = shaper
+		}
 		shaperCacheMu.Unlock()
 	}
 
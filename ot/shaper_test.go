@@ -1,7 +1,12 @@
 package ot
 
 import (
+	"encoding/binary"
+	"fmt"
+	"math"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -399,7 +404,7 @@ func TestShaperMultipleWords(t *testing.T) {
 	t.Logf("Shaped %q: %d glyphs", text, len(glyphs))
 
 	// Calculate total advance
-	totalAdvance := int16(0)
+	totalAdvance := int32(0)
 	for _, p := range positions {
 		totalAdvance += p.XAdvance
 	}
@@ -448,3 +453,1768 @@ func TestShaperHasTables(t *testing.T) {
 		t.Error("Expected GDEF to be present")
 	}
 }
+
+func TestShaperVertical(t *testing.T) {
+	fontPath := findTestFont("SourceSansPro-Regular.otf")
+	if fontPath == "" {
+		t.Skip("SourceSansPro-Regular.otf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("Failed to create shaper: %v", err)
+	}
+
+	horizontal := NewBuffer()
+	horizontal.AddString("AV")
+	shaper.Shape(horizontal, nil)
+
+	buf := NewBuffer()
+	buf.AddString("AV")
+	buf.SetDirection(DirectionTTB)
+	shaper.Shape(buf, nil)
+
+	if buf.Len() != 2 {
+		t.Fatalf("Shaped 'AV' vertically: %d glyphs, want 2", buf.Len())
+	}
+
+	// Without vmtx, the advance is the line height and the glyphs are
+	// centered horizontally and vertically on it (the font has no VORG).
+	// The glyphs are not kerned: kern only applies to horizontal text.
+	lineHeight := int32(shaper.face.Ascender() - shaper.face.Descender())
+	for i, pos := range buf.Pos {
+		glyph := buf.Info[i].GlyphID
+		if pos.XAdvance != 0 || pos.YAdvance != -lineHeight {
+			t.Errorf("[%d] advance = (%d, %d), want (0, %d)", i, pos.XAdvance, pos.YAdvance, -lineHeight)
+		}
+		hAdvance := shaper.glyphHAdvance(glyph)
+		if pos.XOffset != -hAdvance/2 {
+			t.Errorf("[%d] x offset = %d, want %d", i, pos.XOffset, -hAdvance/2)
+		}
+		extents, ok := shaper.cff.GlyphExtents(glyph)
+		if !ok {
+			t.Fatalf("[%d] no extents for glyph %d", i, glyph)
+		}
+		wantY := extents.YBearing + (lineHeight+extents.Height)>>1
+		if pos.YOffset != -wantY {
+			t.Errorf("[%d] y offset = %d, want %d", i, pos.YOffset, -wantY)
+		}
+	}
+	// kern is a horizontal feature: the same pair is kerned horizontally
+	if horizontal.Pos[0].XAdvance == shaper.glyphHAdvance(horizontal.Info[0].GlyphID) {
+		t.Error("expected 'AV' to be kerned horizontally")
+	}
+}
+
+// layoutTable returns a GSUB or GPOS table with a DFLT script that enables
+// one feature per lookup. Every lookup has a single subtable.
+func layoutTable(tags []Tag, lookupType uint16, subtables [][]byte) []byte {
+	u16 := binary.BigEndian.AppendUint16
+	n := len(tags)
+
+	// ScriptList with the default language system of DFLT
+	scriptList := u16(nil, 1)
+	scriptList = binary.BigEndian.AppendUint32(scriptList, uint32(MakeTag('D', 'F', 'L', 'T')))
+	scriptList = u16(u16(u16(scriptList, 8), 4), 0)
+	scriptList = u16(u16(u16(scriptList, 0), 0xFFFF), uint16(n))
+	for i := range tags {
+		scriptList = u16(scriptList, uint16(i))
+	}
+
+	featureList := u16(nil, uint16(n))
+	for i, tag := range tags {
+		featureList = binary.BigEndian.AppendUint32(featureList, uint32(tag))
+		featureList = u16(featureList, uint16(2+6*n+6*i))
+	}
+	for i := range tags {
+		featureList = u16(u16(u16(featureList, 0), 1), uint16(i))
+	}
+
+	lookupList := u16(nil, uint16(n))
+	off := 2 + 2*n
+	for _, st := range subtables {
+		lookupList = u16(lookupList, uint16(off))
+		off += 8 + len(st)
+	}
+	for _, st := range subtables {
+		lookupList = u16(u16(u16(u16(lookupList, lookupType), 0), 1), 8)
+		lookupList = append(lookupList, st...)
+	}
+
+	data := u16(u16(nil, 1), 0)
+	data = u16(data, 10)
+	data = u16(data, uint16(10+len(scriptList)))
+	data = u16(data, uint16(10+len(scriptList)+len(featureList)))
+	data = append(data, scriptList...)
+	data = append(data, featureList...)
+	return append(data, lookupList...)
+}
+
+func TestShaperVerticalFeatures(t *testing.T) {
+	fontPath := findTestFont("SourceSansPro-Regular.otf")
+	if fontPath == "" {
+		t.Skip("SourceSansPro-Regular.otf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("Failed to create shaper: %v", err)
+	}
+
+	a, _ := shaper.cmap.Lookup('A')
+	b, _ := shaper.cmap.Lookup('B')
+	c, _ := shaper.cmap.Lookup('C')
+	u16 := binary.BigEndian.AppendUint16
+
+	// vert maps A to C, vrt2 A to B; vkrn moves B away from a following B
+	singleSubst := func(from, to GlyphID) []byte {
+		return u16(u16(u16(u16(u16(u16(nil, 1), 6), uint16(to-from)), 1), 1), uint16(from))
+	}
+	gsub, err := ParseGSUB(layoutTable([]Tag{TagVert, TagVrt2}, 1, [][]byte{singleSubst(a, c), singleSubst(a, b)}))
+	if err != nil {
+		t.Fatalf("ParseGSUB: %v", err)
+	}
+	pairPos := u16(u16(u16(u16(u16(u16(nil, 1), 18), ValueFormatYAdvance), 0), 1), 12)
+	pairPos = u16(u16(u16(pairPos, 1), uint16(b)), 100)
+	pairPos = u16(u16(u16(pairPos, 1), 1), uint16(b))
+	gpos, err := ParseGPOS(layoutTable([]Tag{TagVkrn}, 2, [][]byte{pairPos}))
+	if err != nil {
+		t.Fatalf("ParseGPOS: %v", err)
+	}
+	shaper.gsub, shaper.gpos = gsub, gpos
+
+	// vmtx: B has an advance of 900 and a top side bearing of 50
+	numGlyphs := shaper.font.NumGlyphs()
+	var vmtxData []byte
+	for g := 0; g < numGlyphs; g++ {
+		if GlyphID(g) == b {
+			vmtxData = u16(u16(vmtxData, 900), 50)
+		} else {
+			vmtxData = u16(u16(vmtxData, 1000), 100)
+		}
+	}
+	if shaper.vmtx, err = ParseVmtx(vmtxData, numGlyphs, numGlyphs); err != nil {
+		t.Fatalf("ParseVmtx: %v", err)
+	}
+
+	extents, ok := shaper.cff.GlyphExtents(b)
+	if !ok {
+		t.Fatal("no extents for B")
+	}
+	xOffset := -shaper.glyphHAdvance(b) / 2
+	check := func(name string, advances [2]int32, yOffset int32) {
+		t.Helper()
+		buf := NewBuffer()
+		buf.AddString("AA")
+		buf.SetDirection(DirectionTTB)
+		shaper.Shape(buf, nil)
+		for i, pos := range buf.Pos {
+			if buf.Info[i].GlyphID != b {
+				t.Errorf("%s: [%d] glyph %d, want %d from vrt2", name, i, buf.Info[i].GlyphID, b)
+			}
+			if pos.XAdvance != 0 || pos.YAdvance != advances[i] {
+				t.Errorf("%s: [%d] advance = (%d, %d), want (0, %d)", name, i, pos.XAdvance, pos.YAdvance, advances[i])
+			}
+			if pos.XOffset != xOffset || pos.YOffset != yOffset {
+				t.Errorf("%s: [%d] offset = (%d, %d), want (%d, %d)", name, i, pos.XOffset, pos.YOffset, xOffset, yOffset)
+			}
+		}
+	}
+
+	// The origin is the top side bearing above the glyph; y advances of
+	// vkrn grow downwards
+	check("vmtx", [2]int32{-1000, -900}, -(extents.YBearing + 50))
+
+	// VORG gives the origin directly: default 880, B at 860
+	if shaper.vorg, err = ParseVORG(u16(u16(u16(u16(u16(u16(nil, 1), 0), 880), 1), uint16(b)), 860)); err != nil {
+		t.Fatalf("ParseVORG: %v", err)
+	}
+	check("VORG", [2]int32{-1000, -900}, -860)
+
+	// VVAR adds 20 to the advance and 10 to the origin at the peak of its
+	// single region. Both DeltaSetIndexMaps map all glyphs to one item.
+	vvarData := []byte{
+		0, 1, 0, 0, 0, 0, 0, 34, 0, 0, 0, 24, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 29, // header
+		0, 0, 0, 1, 0, // advance heights: item 0
+		0, 0, 0, 1, 1, // vertical origins: item 1
+		0, 1, 0, 0, 0, 12, 0, 1, 0, 0, 0, 22, // ItemVariationStore
+		0, 1, 0, 1, 0, 0, 0x40, 0, 0x40, 0, // region: axis 0 peak 1
+		0, 2, 0, 0, 0, 1, 0, 0, 20, 10, // ItemVariationData
+	}
+	if shaper.vvar, err = ParseVvar(vvarData); err != nil {
+		t.Fatalf("ParseVvar: %v", err)
+	}
+	shaper.normalizedCoordsI = []int{1 << 14}
+	check("VVAR", [2]int32{-1020, -920}, -870)
+}
+
+func TestParseVerticalMetrics(t *testing.T) {
+	// vmtx with 2 long metrics for 3 glyphs
+	vmtx, err := ParseVmtx([]byte{3, 0xE8, 0, 50, 3, 0x20, 0, 60, 0, 70}, 2, 3)
+	if err != nil {
+		t.Fatalf("ParseVmtx: %v", err)
+	}
+	for _, tc := range []struct {
+		glyph   GlyphID
+		advance uint16
+		tsb     int16
+	}{{0, 1000, 50}, {1, 800, 60}, {2, 800, 70}} {
+		if adv, tsb := vmtx.GetAdvanceHeight(tc.glyph), vmtx.GetTsb(tc.glyph); adv != tc.advance || tsb != tc.tsb {
+			t.Errorf("glyph %d: advance %d, tsb %d; want %d, %d", tc.glyph, adv, tsb, tc.advance, tc.tsb)
+		}
+	}
+
+	// VORG with default 880 and glyph 5 at 900
+	vorg, err := ParseVORG([]byte{0, 1, 0, 0, 3, 0x70, 0, 1, 0, 5, 3, 0x84})
+	if err != nil {
+		t.Fatalf("ParseVORG: %v", err)
+	}
+	if y := vorg.GetVertOriginY(5); y != 900 {
+		t.Errorf("VORG glyph 5 = %d, want 900", y)
+	}
+	if y := vorg.GetVertOriginY(4); y != 880 {
+		t.Errorf("VORG glyph 4 = %d, want 880 (default)", y)
+	}
+}
+
+// testCmap maps codepoints to glyphs for shaper tests without a font.
+type testCmap map[Codepoint]GlyphID
+
+func (c testCmap) Lookup(cp Codepoint) (GlyphID, bool) {
+	gid, ok := c[cp]
+	return gid, ok
+}
+
+func TestPreprocessTextHangul(t *testing.T) {
+	jamo := testCmap{0x1100: 1, 0x1161: 2, 0x11A8: 3, 0x11EB: 4, 0x1112: 5, 0x11AB: 6, 0x25CC: 7}
+	syllables := testCmap{0xAC00: 1, 0xD55C: 2, 0xAC01: 3, 0x25CC: 4}
+
+	for _, tc := range []struct {
+		name     string
+		cmap     testCmap
+		input    []Codepoint
+		want     []Codepoint
+		features []uint8
+		clusters []int
+	}{
+		{
+			name:     "compose LVT",
+			cmap:     syllables,
+			input:    []Codepoint{0x1112, 0x1161, 0x11AB},
+			want:     []Codepoint{0xD55C},
+			features: []uint8{hangulFeatureNone},
+			clusters: []int{0},
+		},
+		{
+			name:     "compose LV,T",
+			cmap:     syllables,
+			input:    []Codepoint{0xAC00, 0x11A8},
+			want:     []Codepoint{0xAC01},
+			features: []uint8{hangulFeatureNone},
+			clusters: []int{0},
+		},
+		{
+			name:     "decompose LV",
+			cmap:     jamo,
+			input:    []Codepoint{0xAC00},
+			want:     []Codepoint{0x1100, 0x1161},
+			features: []uint8{hangulFeatureLJMO, hangulFeatureVJMO},
+			clusters: []int{0, 0},
+		},
+		{
+			name:     "old hangul",
+			cmap:     syllables,
+			input:    []Codepoint{0x1100, 0x1161, 0x11EB, 0x1100},
+			want:     []Codepoint{0x1100, 0x1161, 0x11EB, 0x1100},
+			features: []uint8{hangulFeatureLJMO, hangulFeatureVJMO, hangulFeatureTJMO, hangulFeatureNone},
+			clusters: []int{0, 0, 0, 3},
+		},
+		{
+			name:     "tone mark",
+			cmap:     syllables,
+			input:    []Codepoint{0xAC00, 0x302E},
+			want:     []Codepoint{0x302E, 0xAC00},
+			features: []uint8{hangulFeatureNone, hangulFeatureNone},
+			clusters: []int{0, 0},
+		},
+		{
+			name:     "tone mark without syllable",
+			cmap:     syllables,
+			input:    []Codepoint{0x302F},
+			want:     []Codepoint{0x302F, 0x25CC},
+			features: []uint8{hangulFeatureNone, hangulFeatureNone},
+			clusters: []int{0, 0},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			shaper := &Shaper{cmap: &Cmap{subtable: tc.cmap}}
+			buf := NewBuffer()
+			buf.AddCodepoints(tc.input)
+			shaper.preprocessTextHangul(buf)
+
+			if got := buf.Codepoints(); !equalCodepoints(got, tc.want) {
+				t.Fatalf("codepoints = %04X, want %04X", got, tc.want)
+			}
+			for i, info := range buf.Info {
+				if info.HangulFeature != tc.features[i] {
+					t.Errorf("[%d] feature = %d, want %d", i, info.HangulFeature, tc.features[i])
+				}
+				if info.Cluster != tc.clusters[i] {
+					t.Errorf("[%d] cluster = %d, want %d", i, info.Cluster, tc.clusters[i])
+				}
+			}
+		})
+	}
+}
+
+func equalCodepoints(a, b []Codepoint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestShaperVariableKerning(t *testing.T) {
+	data, err := os.ReadFile("testdata/Roboto-Variable.ttf")
+	if err != nil {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("ParseFont: %v", err)
+	}
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("NewShaper: %v", err)
+	}
+	if shaper.gdef == nil || shaper.gdef.VarStore() == nil {
+		t.Fatal("expected GDEF with an ItemVariationStore")
+	}
+
+	kerning := func(weight float32) int32 {
+		shaper.SetVariations([]Variation{{Tag: MakeTag('w', 'g', 'h', 't'), Value: weight}})
+		buf := NewBuffer()
+		buf.AddString("To")
+		shaper.Shape(buf, nil)
+		return buf.Pos[0].XAdvance - shaper.glyphHAdvance(buf.Info[0].GlyphID)
+	}
+
+	regular, black := kerning(400), kerning(900)
+	if regular >= 0 || black >= 0 {
+		t.Fatalf("expected 'To' to be kerned, got %d and %d", regular, black)
+	}
+	if regular == black {
+		t.Errorf("kerning does not follow the wght axis: %d at 400 and 900", regular)
+	}
+}
+
+func TestDeviceTable(t *testing.T) {
+	// Format 2 (4-bit deltas) for ppem 12..15: +1, -2, 0, +7
+	data := []byte{0, 0, 0, 12, 0, 15, 0, 2, 0x1E, 0x07}
+	dev := parseDevice(data, 2)
+	if dev == nil {
+		t.Fatal("parseDevice returned nil")
+	}
+	dc := &DeviceContext{XScale: 1000, YScale: 1000}
+	for _, tc := range []struct {
+		ppem uint16
+		want int32
+	}{{0, 0}, {11, 0}, {12, 1000 / 12}, {13, -2000 / 13}, {14, 0}, {15, 7000 / 15}, {16, 0}} {
+		dc.XPpem = tc.ppem
+		if got := dc.XDelta(dev); got != tc.want {
+			t.Errorf("ppem %d: delta %d, want %d", tc.ppem, got, tc.want)
+		}
+	}
+
+	// VariationIndex table
+	if dev := parseDevice([]byte{0, 1, 0, 2, 0x80, 0}, 0); dev != nil {
+		t.Error("expected nil for offset 0")
+	}
+	dev = parseDevice([]byte{0, 0, 0, 1, 0, 2, 0x80, 0}, 2)
+	if dev == nil || dev.Format() != DeviceFormatVariationIndex || dev.VariationIndex() != 1<<16|2 {
+		t.Errorf("unexpected VariationIndex table %+v", dev)
+	}
+}
+
+func TestAnchorResolve(t *testing.T) {
+	// Format 3 anchor (100, 200) with an XDevice at offset 10:
+	// 8-bit deltas for ppem 10..11: +3, -1
+	data := []byte{0, 3, 0, 100, 0, 200, 0, 10, 0, 0, 0, 10, 0, 11, 0, 3, 0x03, 0xFF}
+	a, err := parseAnchor(data, 0)
+	if err != nil {
+		t.Fatalf("parseAnchor: %v", err)
+	}
+	if a.XDevice == nil || a.YDevice != nil {
+		t.Fatalf("unexpected device tables %+v %+v", a.XDevice, a.YDevice)
+	}
+	dc := &DeviceContext{XScale: 1000, YScale: 1000}
+	for _, tc := range []struct {
+		ppem  uint16
+		wantX float64
+	}{{9, 100}, {10, 100 + 3000/10}, {11, 100 - 1000/11}} {
+		dc.XPpem, dc.YPpem = tc.ppem, tc.ppem
+		if x, y := a.resolve(dc, 1); x != tc.wantX || y != 200 {
+			t.Errorf("ppem %d: anchor (%v, %v), want (%v, 200)", tc.ppem, x, y, tc.wantX)
+		}
+	}
+	if x, y := a.resolve(nil, 1); x != 100 || y != 200 {
+		t.Errorf("unscaled anchor (%v, %v), want (100, 200)", x, y)
+	}
+
+	// Format 2 anchor on contour point 5
+	a, err = parseAnchor([]byte{0, 2, 0, 100, 0, 200, 0, 5}, 0)
+	if err != nil {
+		t.Fatalf("parseAnchor: %v", err)
+	}
+	dc = &DeviceContext{
+		Coords: []int{1 << 14},
+		ContourPoint: func(gid GlyphID, index uint16) (float64, float64, bool) {
+			return float64(gid) * 10, float64(index) * 10, index == 5
+		},
+	}
+	if x, y := a.resolve(dc, 7); x != 70 || y != 50 {
+		t.Errorf("contour point anchor (%v, %v), want (70, 50)", x, y)
+	}
+	// Without ppem and variations the design coordinates are used
+	dc.Coords = nil
+	if x, y := a.resolve(dc, 7); x != 100 || y != 200 {
+		t.Errorf("default anchor (%v, %v), want (100, 200)", x, y)
+	}
+}
+
+func TestGlyphPointsVariable(t *testing.T) {
+	data, err := os.ReadFile("testdata/Roboto-Variable.ttf")
+	if err != nil {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("ParseFont: %v", err)
+	}
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("NewShaper: %v", err)
+	}
+	if shaper.glyf == nil || shaper.gvar == nil {
+		t.Fatal("expected glyf and gvar")
+	}
+
+	width := func(points []GlyphOutlinePoint) float64 {
+		xMin, xMax := points[0].X, points[0].X
+		for _, p := range points {
+			xMin, xMax = math.Min(xMin, p.X), math.Max(xMax, p.X)
+		}
+		return xMax - xMin
+	}
+
+	gid, _ := shaper.cmap.Lookup('l')
+	regular, ends := shaper.glyf.GlyphPoints(gid, shaper.gvar, nil)
+	if len(regular) == 0 || len(ends) == 0 || ends[len(ends)-1] != len(regular)-1 {
+		t.Fatalf("unexpected outline: %d points, contour ends %v", len(regular), ends)
+	}
+	shaper.SetVariations([]Variation{{Tag: MakeTag('w', 'g', 'h', 't'), Value: 900}})
+	black, _ := shaper.glyf.GlyphPoints(gid, shaper.gvar, shaper.normalizedCoordsI)
+	if len(black) != len(regular) {
+		t.Fatalf("point count changed: %d vs %d", len(black), len(regular))
+	}
+	if width(black) <= width(regular) {
+		t.Errorf("stem of 'l' not wider at wght 900: %v vs %v", width(black), width(regular))
+	}
+
+	// The gvar deltas are interpolated like the outline
+	orig := make([]GlyphPoint, len(regular))
+	for i, p := range regular {
+		orig[i] = GlyphPoint{X: int16(p.X), Y: int16(p.Y)}
+	}
+	deltas := shaper.gvar.GetGlyphDeltasWithCoords(gid, shaper.normalizedCoordsI, len(regular)+4, orig)
+	if len(ends) == 1 && deltas != nil {
+		for i := range regular {
+			dx, dy := black[i].X-regular[i].X, black[i].Y-regular[i].Y
+			if math.Abs(dx-float64(deltas.XDeltas[i])) > 0.5 || math.Abs(dy-float64(deltas.YDeltas[i])) > 0.5 {
+				t.Errorf("point %d: delta (%d, %d), outline moved (%v, %v)", i, deltas.XDeltas[i], deltas.YDeltas[i], dx, dy)
+			}
+		}
+	}
+
+	// Contour point anchors follow the variations without GDEF
+	gdef := shaper.gdef
+	shaper.gdef = nil
+	if dc := shaper.deviceContext(); dc == nil || len(dc.Coords) == 0 || dc.ContourPoint == nil {
+		t.Errorf("device context without GDEF: %+v", dc)
+	}
+	shaper.gdef = gdef
+
+	// Composite glyphs are flattened in component order
+	gid, _ = shaper.cmap.Lookup(0xE9)
+	components := shaper.glyf.GetComponents(gid)
+	if len(components) == 0 {
+		t.Skip("eacute is not a composite glyph")
+	}
+	points, _ := shaper.glyf.GlyphPoints(gid, nil, nil)
+	total := 0
+	for _, c := range components {
+		p, _ := shaper.glyf.GlyphPoints(c, nil, nil)
+		total += len(p)
+	}
+	if len(points) != total {
+		t.Errorf("composite has %d points, components %d", len(points), total)
+	}
+}
+
+func TestGlyphExtentsVariable(t *testing.T) {
+	fontPath := findTestFont("Roboto-Variable.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("Failed to create shaper: %v", err)
+	}
+
+	gid, _ := shaper.cmap.Lookup('o')
+
+	// The extents follow the outline at every weight
+	var widths []int32
+	for _, weight := range []float32{100, 900} {
+		shaper.SetVariations([]Variation{{Tag: TagAxisWeight, Value: weight}})
+		ext, ok := shaper.GlyphExtents(gid)
+		if !ok {
+			t.Fatalf("no extents at wght %v", weight)
+		}
+		path, err := shaper.GlyphOutline(gid)
+		if err != nil {
+			t.Fatalf("GlyphOutline: %v", err)
+		}
+		xMin, yMin, xMax, yMax, _ := path.Bounds()
+		left, top := float64(ext.XBearing), float64(ext.YBearing)
+		right, bottom := left+float64(ext.Width), top+float64(ext.Height)
+		if math.Abs(left-float64(xMin)) > 1 || math.Abs(right-float64(xMax)) > 1 ||
+			math.Abs(top-float64(yMax)) > 1 || math.Abs(bottom-float64(yMin)) > 1 {
+			t.Errorf("wght %v: extents %+v, outline bounds (%v, %v)-(%v, %v)", weight, ext, xMin, yMin, xMax, yMax)
+		}
+		widths = append(widths, ext.Width)
+	}
+	if widths[1] <= widths[0] {
+		t.Errorf("'o' not wider at wght 900: %v", widths)
+	}
+}
+
+func TestClusterLevels(t *testing.T) {
+	fontPath := findTestFont("Roboto-Regular.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Regular.ttf not found")
+	}
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("Failed to create shaper: %v", err)
+	}
+
+	// x + acute + dot below (the marks are reordered by normalization) + fi ligature
+	text := "x\u0301\u0323fi"
+	for _, tc := range []struct {
+		level ClusterLevel
+		want  []int
+	}{
+		{ClusterLevelMonotoneGraphemes, []int{0, 0, 0, 3}},
+		{ClusterLevelMonotoneCharacters, []int{0, 1, 1, 3}},
+		{ClusterLevelCharacters, []int{0, 2, 1, 3}},
+	} {
+		buf := NewBuffer()
+		buf.ClusterLevel = tc.level
+		buf.AddString(text)
+		shaper.Shape(buf, nil)
+		var got []int
+		for _, info := range buf.Info {
+			got = append(got, info.Cluster)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("level %d: clusters %v, want %v", tc.level, got, tc.want)
+		}
+	}
+}
+
+func TestBufferDeleteGlyphCluster(t *testing.T) {
+	buf := NewBuffer()
+	buf.AddCodepoints([]Codepoint{'a', 'b', 'c'})
+	buf.Info[0].Cluster, buf.Info[1].Cluster, buf.Info[2].Cluster = 0, 2, 1
+	buf.clearOutput()
+	buf.nextGlyph()
+	buf.nextGlyph()
+	// Deleting cluster 1 merges it backward into the output
+	buf.deleteGlyph()
+	buf.sync()
+	if len(buf.Info) != 2 || buf.Info[0].Cluster != 0 || buf.Info[1].Cluster != 1 {
+		t.Errorf("unexpected clusters after deletion: %+v", buf.Info)
+	}
+
+	buf = NewBuffer()
+	buf.AddCodepoints([]Codepoint{'a', 'b'})
+	buf.clearOutput()
+	// Nothing before: cluster 0 merges forward
+	buf.deleteGlyph()
+	buf.sync()
+	if len(buf.Info) != 1 || buf.Info[0].Cluster != 0 {
+		t.Errorf("unexpected clusters after deletion: %+v", buf.Info)
+	}
+}
+
+func TestGlyphFlags(t *testing.T) {
+	fontPath := findTestFont("Roboto-Regular.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Regular.ttf not found")
+	}
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("Failed to create shaper: %v", err)
+	}
+
+	shape := func(text string, flags BufferFlags) []GlyphFlags {
+		buf := NewBuffer()
+		buf.Flags = flags
+		buf.AddString(text)
+		shaper.Shape(buf, nil)
+		var got []GlyphFlags
+		for _, info := range buf.Info {
+			got = append(got, info.Flags)
+		}
+		return got
+	}
+
+	// The T-o kerning pair can't be broken up
+	if got := shape("To", BufferFlagDefault); fmt.Sprint(got) != fmt.Sprint([]GlyphFlags{0, GlyphFlagDefined}) {
+		t.Errorf("To: flags %v, want [0 3]", got)
+	}
+	if got := shape("abc", BufferFlagDefault); fmt.Sprint(got) != "[0 0 0]" {
+		t.Errorf("abc: flags %v, want none", got)
+	}
+	// Failed pair lookups make glyphs unsafe to concat, not to break
+	for i, f := range shape("abc", BufferFlagProduceUnsafeToConcat) {
+		if f&GlyphFlagUnsafeToBreak != 0 {
+			t.Errorf("abc: glyph %d is unsafe to break", i)
+		}
+	}
+}
+
+func TestSetGlyphFlagsClusters(t *testing.T) {
+	makeBuf := func(level ClusterLevel, clusters ...int) *Buffer {
+		buf := NewBuffer()
+		buf.ClusterLevel = level
+		for _, c := range clusters {
+			buf.Info = append(buf.Info, GlyphInfo{Cluster: c})
+		}
+		return buf
+	}
+	flags := func(buf *Buffer) string {
+		s := ""
+		for _, info := range buf.Info {
+			if info.UnsafeToBreak() {
+				s += "B"
+			} else {
+				s += "."
+			}
+		}
+		return s
+	}
+
+	for _, tc := range []struct {
+		level      ClusterLevel
+		clusters   []int
+		start, end int
+		want       string
+	}{
+		// Glyphs of the cluster at the start of the range stay safe
+		{ClusterLevelMonotoneGraphemes, []int{0, 0, 1, 2, 2}, 0, 5, "..BBB"},
+		{ClusterLevelMonotoneGraphemes, []int{0, 0, 1, 2, 2}, 1, 4, "..BB."},
+		// A range within one cluster has no break opportunity
+		{ClusterLevelMonotoneGraphemes, []int{0, 1, 1, 2}, 1, 3, "...."},
+		// Right-to-left clusters: the minimum is at the end
+		{ClusterLevelMonotoneGraphemes, []int{2, 1, 0, 0}, 0, 4, "BB.."},
+		// Only the minimum cluster is safe at ClusterLevelCharacters
+		{ClusterLevelCharacters, []int{2, 0, 1}, 0, 3, "B.B"},
+	} {
+		buf := makeBuf(tc.level, tc.clusters...)
+		buf.unsafeToBreak(tc.start, tc.end)
+		if got := flags(buf); got != tc.want {
+			t.Errorf("clusters %v [%d,%d): got %s, want %s", tc.clusters, tc.start, tc.end, got, tc.want)
+		}
+	}
+
+	// Flags are shared by all glyphs of a cluster
+	buf := makeBuf(ClusterLevelMonotoneGraphemes, 0, 1, 1, 2)
+	buf.Info[1].Flags = GlyphFlagUnsafeToBreak
+	buf.ScratchFlags |= ScratchFlagHasGlyphFlags
+	propagateFlags(buf)
+	if got := flags(buf); got != ".BB." {
+		t.Errorf("propagateFlags: got %s, want .BB.", got)
+	}
+}
+
+func TestBufferAddWithContext(t *testing.T) {
+	buf := NewBuffer()
+	buf.AddStringWithContext("abcdefghijk", 7, 2)
+	if got := string(runesOf(buf.Codepoints())); got != "hi" {
+		t.Errorf("item %q, want \"hi\"", got)
+	}
+	if buf.Info[0].Cluster != 7 || buf.Info[1].Cluster != 8 {
+		t.Errorf("clusters %d %d, want 7 8", buf.Info[0].Cluster, buf.Info[1].Cluster)
+	}
+	if got := string(runesOf(buf.preContext)); got != "gfedc" {
+		t.Errorf("pre-context %q, want \"gfedc\"", got)
+	}
+	if got := string(runesOf(buf.postContext)); got != "jk" {
+		t.Errorf("post-context %q, want \"jk\"", got)
+	}
+
+	// A second item keeps the pre-context and replaces the post-context
+	buf.AddStringWithContext("xyz", 1, 1)
+	if got := string(runesOf(buf.preContext)); got != "gfedc" {
+		t.Errorf("pre-context after second item %q, want \"gfedc\"", got)
+	}
+	if got := string(runesOf(buf.postContext)); got != "z" {
+		t.Errorf("post-context after second item %q, want \"z\"", got)
+	}
+
+	buf.Reset()
+	if len(buf.preContext) != 0 || len(buf.postContext) != 0 {
+		t.Error("Reset kept the context")
+	}
+}
+
+func runesOf(cps []Codepoint) []rune {
+	r := make([]rune, len(cps))
+	for i, cp := range cps {
+		r[i] = rune(cp)
+	}
+	return r
+}
+
+func TestArabicJoiningContext(t *testing.T) {
+	const beh = "ببب"
+	s := &Shaper{}
+	for _, tc := range []struct {
+		offset int
+		want   ArabicAction
+	}{
+		{0, arabicActionINIT},
+		{1, arabicActionMEDI},
+		{2, arabicActionFINA},
+	} {
+		buf := NewBuffer()
+		buf.AddStringWithContext(beh, tc.offset, 1)
+		if got := s.arabicJoining(buf); got[0] != tc.want {
+			t.Errorf("beh at %d: action %d, want %d", tc.offset, got[0], tc.want)
+		}
+	}
+
+	buf := NewBuffer()
+	buf.AddString("ب")
+	if got := s.arabicJoining(buf); got[0] != arabicActionISOL {
+		t.Errorf("isolated beh: action %d, want %d", got[0], arabicActionISOL)
+	}
+
+	// Joining letters without a previous action are unsafe to concat
+	for _, tc := range []struct {
+		text  string
+		flags BufferFlags
+		want  string
+	}{
+		{"اب", BufferFlagProduceUnsafeToConcat, "CC"},
+		{"اب", BufferFlagDefault, ".."},
+		{"a", BufferFlagProduceUnsafeToConcat, "."},
+	} {
+		buf := NewBuffer()
+		buf.Flags = tc.flags
+		buf.AddString(tc.text)
+		s.arabicJoining(buf)
+		got := ""
+		for _, info := range buf.Info {
+			switch {
+			case info.UnsafeToBreak():
+				got += "B"
+			case info.UnsafeToConcat():
+				got += "C"
+			default:
+				got += "."
+			}
+		}
+		if got != tc.want {
+			t.Errorf("%q with flags %d: %s, want %s", tc.text, tc.flags, got, tc.want)
+		}
+	}
+}
+
+func TestMatchTextContext(t *testing.T) {
+	buf := NewBuffer()
+	buf.contextGlyphs[0] = []GlyphID{5, 4, 3}
+	buf.contextGlyphs[1] = []GlyphID{7}
+	ctx := &OTApplyContext{Buffer: buf}
+	equal := func(want []GlyphID) func(i int, gid GlyphID) bool {
+		return func(i int, gid GlyphID) bool { return want[i] == gid }
+	}
+
+	// Backtrack items 1 and 2 continue in the pre-context
+	if !ctx.matchPreContext(1, 3, equal([]GlyphID{9, 5, 4})) {
+		t.Error("pre-context did not match")
+	}
+	if ctx.matchPreContext(0, 2, equal([]GlyphID{5, 3})) {
+		t.Error("pre-context matched out of order")
+	}
+	if !ctx.matchPostContext(0, 1, equal([]GlyphID{7})) {
+		t.Error("post-context did not match")
+	}
+	if ctx.matchPostContext(0, 2, equal([]GlyphID{7, 8})) {
+		t.Error("lookahead matched past the post-context")
+	}
+}
+
+func TestBufferAddUTF8(t *testing.T) {
+	buf := NewBuffer()
+	buf.AddUTF8([]byte("xaé€😀\xffy"), 1, 11)
+	wantCps := []Codepoint{'a', 0xE9, 0x20AC, 0x1F600, DefaultReplacementCodepoint}
+	wantClusters := []int{1, 2, 4, 7, 11}
+	if len(buf.Info) != len(wantCps) {
+		t.Fatalf("got %d glyphs, want %d", len(buf.Info), len(wantCps))
+	}
+	for i, info := range buf.Info {
+		if info.Codepoint != wantCps[i] || info.Cluster != wantClusters[i] {
+			t.Errorf("glyph %d: U+%04X cluster %d, want U+%04X cluster %d",
+				i, info.Codepoint, info.Cluster, wantCps[i], wantClusters[i])
+		}
+	}
+	if len(buf.preContext) != 1 || buf.preContext[0] != 'x' {
+		t.Errorf("pre-context %v, want [x]", buf.preContext)
+	}
+	if len(buf.postContext) != 1 || buf.postContext[0] != 'y' {
+		t.Errorf("post-context %v, want [y]", buf.postContext)
+	}
+
+	buf = NewBuffer()
+	buf.ReplacementCodepoint = '?'
+	buf.AddUTF8([]byte("\xc3\xef\xbf\xbd"), 0, -1)
+	if len(buf.Info) != 2 || buf.Info[0].Codepoint != '?' || buf.Info[1].Codepoint != 0xFFFD {
+		t.Errorf("invalid byte and encoded U+FFFD: got %v", buf.Codepoints())
+	}
+
+	// A character across the end of the item is decoded within the item
+	// only; a zero buffer replaces it with U+FFFD
+	buf = &Buffer{}
+	buf.AddUTF8([]byte("aé"), 0, 2)
+	if len(buf.Info) != 2 || buf.Info[1].Codepoint != DefaultReplacementCodepoint || buf.Info[1].Cluster != 1 {
+		t.Errorf("truncated é: got %v", buf.Codepoints())
+	}
+	if len(buf.postContext) != 1 || buf.postContext[0] != DefaultReplacementCodepoint {
+		t.Errorf("post-context %v, want [U+FFFD]", buf.postContext)
+	}
+}
+
+func TestBufferAddUTF16(t *testing.T) {
+	// 'a', U+1F600 as a surrogate pair, an unpaired low surrogate, 'b'
+	text := []uint16{'a', 0xD83D, 0xDE00, 0xDC00, 'b'}
+	buf := NewBuffer()
+	buf.AddUTF16(text, 1, 3)
+	if len(buf.Info) != 2 {
+		t.Fatalf("got %d glyphs, want 2", len(buf.Info))
+	}
+	if buf.Info[0].Codepoint != 0x1F600 || buf.Info[0].Cluster != 1 {
+		t.Errorf("glyph 0: U+%04X cluster %d, want U+1F600 cluster 1", buf.Info[0].Codepoint, buf.Info[0].Cluster)
+	}
+	if buf.Info[1].Codepoint != DefaultReplacementCodepoint || buf.Info[1].Cluster != 3 {
+		t.Errorf("glyph 1: U+%04X cluster %d, want U+FFFD cluster 3", buf.Info[1].Codepoint, buf.Info[1].Cluster)
+	}
+
+	// The pre-context decodes the surrogate pair backwards
+	buf = NewBuffer()
+	buf.AddUTF16(text, 4, -1)
+	if len(buf.preContext) != 3 || buf.preContext[1] != 0x1F600 || buf.preContext[2] != 'a' {
+		t.Errorf("pre-context %v, want [U+FFFD U+1F600 a]", buf.preContext)
+	}
+
+	// A surrogate pair across the end of the item is unpaired within it
+	buf = &Buffer{}
+	buf.AddUTF16(text, 0, 2)
+	if len(buf.Info) != 2 || buf.Info[1].Codepoint != DefaultReplacementCodepoint || buf.Info[1].Cluster != 1 {
+		t.Errorf("split surrogate pair: got %v", buf.Codepoints())
+	}
+	if len(buf.postContext) == 0 || buf.postContext[0] != DefaultReplacementCodepoint {
+		t.Errorf("post-context %v, want U+FFFD first", buf.postContext)
+	}
+}
+
+func TestBufferSerialize(t *testing.T) {
+	fontPath := findTestFont("SourceSansPro-Regular.otf")
+	if fontPath == "" {
+		t.Skip("SourceSansPro-Regular.otf not found")
+	}
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("Failed to create shaper: %v", err)
+	}
+
+	buf := NewBuffer()
+	buf.AddString("To")
+	buf.GuessSegmentProperties()
+	shaper.Shape(buf, nil)
+
+	for _, format := range []SerializeFormat{SerializeFormatText, SerializeFormatJSON} {
+		s := buf.Serialize(font, format, SerializeFlagGlyphFlags)
+
+		parsed := NewBuffer()
+		if err := parsed.ParseSerialized(s, font, format); err != nil {
+			t.Fatalf("ParseSerialized(%q): %v", s, err)
+		}
+		if len(parsed.Info) != len(buf.Info) {
+			t.Fatalf("parsed %d glyphs, want %d", len(parsed.Info), len(buf.Info))
+		}
+		for i := range buf.Info {
+			if parsed.Info[i].GlyphID != buf.Info[i].GlyphID ||
+				parsed.Info[i].Cluster != buf.Info[i].Cluster ||
+				parsed.Info[i].Flags != buf.Info[i].Flags ||
+				parsed.Pos[i].XAdvance != buf.Pos[i].XAdvance ||
+				parsed.Pos[i].XOffset != buf.Pos[i].XOffset {
+				t.Errorf("format %d glyph %d: round trip %+v %+v, want %+v %+v",
+					format, i, parsed.Info[i], parsed.Pos[i], buf.Info[i], buf.Pos[i])
+			}
+		}
+		if got := parsed.Serialize(font, format, SerializeFlagGlyphFlags); got != s {
+			t.Errorf("re-serialized %q, want %q", got, s)
+		}
+	}
+
+	if got, want := buf.Serialize(font, SerializeFormatText, SerializeFlagDefault), "[T=0+470|o=1+542]"; got != want {
+		t.Errorf("Serialize = %q, want %q", got, want)
+	}
+	flags := SerializeFlagNoGlyphNames | SerializeFlagNoClusters | SerializeFlagNoAdvances
+	if got, want := buf.Serialize(font, SerializeFormatText, flags), fmt.Sprintf("[%d|%d@%d,0]",
+		buf.Info[0].GlyphID, buf.Info[1].GlyphID, buf.Pos[0].XAdvance); got != want {
+		t.Errorf("Serialize without advances = %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"T=0+500", "[T=x]", "[nosuchglyph=0]", "[T=0+9999999999]"} {
+		if err := NewBuffer().ParseSerialized(bad, font, SerializeFormatText); err == nil {
+			t.Errorf("ParseSerialized(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestBufferMessageFunc(t *testing.T) {
+	fontPath := findTestFont("Roboto-Regular.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Regular.ttf not found")
+	}
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("Failed to create shaper: %v", err)
+	}
+
+	var messages []string
+	buf := NewBuffer()
+	buf.AddString("To")
+	buf.SetMessageFunc(func(b *Buffer, f *Font, message string) bool {
+		if b != buf || f != font {
+			t.Errorf("%s: wrong buffer or font", message)
+		}
+		messages = append(messages, message)
+		return true
+	})
+	shaper.Shape(buf, nil)
+
+	open := ""
+	sawKern, sawNormalize := false, false
+	for _, m := range messages {
+		switch {
+		case strings.HasPrefix(m, "start "):
+			if open != "" {
+				t.Errorf("%q while %q is open", m, open)
+			}
+			open = strings.TrimPrefix(m, "start ")
+		case strings.HasPrefix(m, "end "):
+			if strings.TrimPrefix(m, "end ") != open {
+				t.Errorf("%q does not end %q", m, open)
+			}
+			open = ""
+		default:
+			t.Errorf("unexpected message %q", m)
+		}
+		sawKern = sawKern || strings.HasPrefix(m, "start GPOS lookup") && strings.HasSuffix(m, "feature 'kern'")
+		sawNormalize = sawNormalize || m == "start normalize"
+	}
+	if !sawKern || !sawNormalize {
+		t.Errorf("missing kern lookup or normalize message in %q", messages)
+	}
+	kerned := buf.Pos[0].XAdvance
+
+	// Skipping all GPOS lookups leaves the nominal advances
+	buf = NewBuffer()
+	buf.AddString("To")
+	buf.SetMessageFunc(func(b *Buffer, f *Font, message string) bool {
+		return !strings.HasPrefix(message, "start GPOS")
+	})
+	shaper.Shape(buf, nil)
+	if got, want := int32(buf.Pos[0].XAdvance), shaper.glyphHAdvance(buf.Info[0].GlyphID); got != want || got == int32(kerned) {
+		t.Errorf("advance with GPOS skipped = %d, want %d (kerned %d)", got, want, kerned)
+	}
+}
+
+func TestShapePlan(t *testing.T) {
+	fontPath := findTestFont("Roboto-Regular.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Regular.ttf not found")
+	}
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("Failed to create shaper: %v", err)
+	}
+
+	shape := func(text string) *Buffer {
+		buf := NewBuffer()
+		buf.AddString(text)
+		shaper.Shape(buf, nil)
+		return buf
+	}
+	want := shape("office To").Serialize(font, SerializeFormatText, SerializeFlagDefault)
+
+	props := SegmentProperties{Script: MakeTag('L', 'a', 't', 'n')}
+	plan := shaper.NewShapePlan(props, nil)
+	if plan.Props.Direction != DirectionLTR {
+		t.Errorf("plan direction %v, want LTR", plan.Props.Direction)
+	}
+	for i := 0; i < 2; i++ {
+		buf := NewBuffer()
+		buf.AddString("office To")
+		shaper.ShapeWithPlan(plan, buf)
+		if got := buf.Serialize(font, SerializeFormatText, SerializeFlagDefault); got != want {
+			t.Errorf("run %d: ShapeWithPlan = %s, want %s", i, got, want)
+		}
+		if buf.Script != props.Script || buf.Direction != DirectionLTR || buf.plan != nil {
+			t.Errorf("run %d: buffer props %v %v, plan %p", i, buf.Script, buf.Direction, buf.plan)
+		}
+	}
+	if len(plan.maps) == 0 {
+		t.Error("plan did not cache any lookup map")
+	}
+
+	// Shape reuses cached plans per properties and features
+	p1 := shaper.cachedShapePlan(plan.Props, nil)
+	if p2 := shaper.cachedShapePlan(plan.Props, nil); p1 != p2 {
+		t.Error("same properties and features gave different plans")
+	}
+	if p3 := shaper.cachedShapePlan(plan.Props, []Feature{NewFeatureOff(TagLiga)}); p3 == p1 {
+		t.Error("different features gave the same plan")
+	}
+	shaper.SetDefaultFeatures(shaper.GetDefaultFeatures())
+	if p4 := shaper.cachedShapePlan(plan.Props, nil); p4 == p1 {
+		t.Error("SetDefaultFeatures kept the cached plans")
+	}
+
+	// A plan of other variation coordinates is resolved again
+	varPath := findTestFont("Roboto-Variable.ttf")
+	if varPath == "" {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+	varData, err := os.ReadFile(varPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	varFont, err := ParseFont(varData, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+	varShaper, err := NewShaper(varFont)
+	if err != nil {
+		t.Fatalf("Failed to create shaper: %v", err)
+	}
+	plan = varShaper.NewShapePlan(props, nil)
+	varShaper.SetVariation(TagAxisWeight, 900)
+	buf := NewBuffer()
+	buf.AddString("office To")
+	varShaper.ShapeWithPlan(plan, buf)
+	key := shapePlanKey{props: plan.Props, features: featuresKey(nil), coords: coordsKey(varShaper.normalizedCoordsI)}
+	if varShaper.plans[key] == nil {
+		t.Error("ShapeWithPlan kept a plan of other coordinates")
+	}
+}
+
+func TestShaperConcurrent(t *testing.T) {
+	texts := []string{
+		"office To AVAV",      // Latin
+		"Ωμέγα καλημέρα",      // Greek
+		"Привет мир",          // Cyrillic
+		"שָׁלוֹם עוֹלָם",      // Hebrew
+		"مرحبا بالعالم",       // Arabic
+		"ܫܠܡܐ",                // Syriac
+		"नमस्ते क्षत्रिय",     // Devanagari
+		"আমি বাংলায় গান গাই", // Bengali
+		"ਸਤਿ ਸ੍ਰੀ ਅਕਾਲ",       // Gurmukhi
+		"สวัสดีครับ",          // Thai
+		"ជំរាបសួរ",            // Khmer
+		"မင်္ဂလာပါ",           // Myanmar
+		"안녕하세요 가",            // Hangul
+		"ꦲꦤꦕꦫꦏ",               // Javanese (USE)
+	}
+	featureSets := [][]Feature{nil, {NewFeatureOff(TagLiga), NewFeatureOff(TagKern)}}
+
+	var fonts []*Font
+	for _, name := range []string{"Roboto-Regular.ttf", "SourceSansPro-Regular.otf", "AnekBangla-subset.ttf"} {
+		fontPath := findTestFont(name)
+		if fontPath == "" {
+			continue
+		}
+		data, err := os.ReadFile(fontPath)
+		if err != nil {
+			t.Fatalf("Failed to read font: %v", err)
+		}
+		font, err := ParseFont(data, 0)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", name, err)
+		}
+		fonts = append(fonts, font)
+	}
+	if len(fonts) == 0 {
+		t.Skip("no test fonts found")
+	}
+
+	shape := func(font *Font, text string, features []Feature) string {
+		buf := NewBuffer()
+		buf.AddString(text)
+		if err := Shape(font, buf, features); err != nil {
+			t.Error(err)
+		}
+		return buf.Serialize(font, SerializeFormatText, SerializeFlagGlyphFlags)
+	}
+
+	// Results with one call at a time
+	want := make(map[string]string)
+	for fi, font := range fonts {
+		for ti, text := range texts {
+			for si, features := range featureSets {
+				want[fmt.Sprint(fi, ti, si)] = shape(font, text, features)
+			}
+		}
+	}
+	ClearShaperCache()
+
+	// All goroutines share one cached Shaper per font and start shaping
+	// with empty plan caches.
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for round := 0; round < 3; round++ {
+				for fi := range fonts {
+					for ti := range texts {
+						ti = (ti + g) % len(texts)
+						for si, features := range featureSets {
+							got := shape(fonts[fi], texts[ti], features)
+							if key := fmt.Sprint(fi, ti, si); got != want[key] {
+								t.Errorf("goroutine %d: %q = %s, want %s", g, texts[ti], got, want[key])
+							}
+						}
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestShaperScale(t *testing.T) {
+	data, err := os.ReadFile("testdata/Roboto-Variable.ttf")
+	if err != nil {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("ParseFont: %v", err)
+	}
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("NewShaper: %v", err)
+	}
+	upem := int32(shaper.face.Upem())
+	shape := func() *Buffer {
+		buf := NewBuffer()
+		buf.AddString("To AVAVA fi")
+		shaper.Shape(buf, nil)
+		return buf
+	}
+
+	if x, y := shaper.Scale(); x != upem || y != upem {
+		t.Fatalf("default scale (%d, %d), want upem %d", x, y, upem)
+	}
+	units := shape()
+
+	// Twice the upem doubles every position exactly
+	shaper.SetScale(2*upem, 2*upem)
+	for i, pos := range shape().Pos {
+		want := units.Pos[i]
+		if pos.XAdvance != 2*want.XAdvance || pos.XOffset != 2*want.XOffset || pos.YOffset != 2*want.YOffset {
+			t.Errorf("[%d] scaled position %+v, want twice %+v", i, pos, want)
+		}
+	}
+
+	// Positions beyond the int16 range
+	shaper.SetScale(upem*64, upem*64)
+	var total int64
+	for i, pos := range shape().Pos {
+		if pos.XAdvance != 64*units.Pos[i].XAdvance {
+			t.Errorf("[%d] advance %d, want %d", i, pos.XAdvance, 64*units.Pos[i].XAdvance)
+		}
+		total += int64(pos.XAdvance)
+	}
+	if total <= math.MaxInt16 {
+		t.Errorf("total advance %d should exceed the int16 range", total)
+	}
+
+	// Variation deltas keep their fractional part with a larger scale. In
+	// font units the advance and the kerning are rounded separately.
+	shaper.SetVariations([]Variation{{Tag: MakeTag('w', 'g', 'h', 't'), Value: 555}})
+	fine := shape()
+	shaper.SetScale(0, 0)
+	coarse := shape()
+	fractional := false
+	for i := range fine.Pos {
+		adv := float64(fine.Pos[i].XAdvance) / 64
+		if math.Abs(adv-float64(coarse.Pos[i].XAdvance)) > 1+1.0/64 {
+			t.Errorf("[%d] fine advance %v, font units %d", i, adv, coarse.Pos[i].XAdvance)
+		}
+		fractional = fractional || fine.Pos[i].XAdvance%64 != 0
+	}
+	if !fractional {
+		t.Error("expected fractional advances at wght 555")
+	}
+}
+
+func TestShaperOpticalSize(t *testing.T) {
+	fontPath := findTestFont("Roboto-Regular.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Regular.ttf not found")
+	}
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("Failed to create shaper: %v", err)
+	}
+
+	// An fvar with a single 'opsz' axis 8..12..72
+	fvarData := []byte{
+		0, 1, 0, 0, 0, 16, 0, 2, 0, 1, 0, 20, 0, 0, 0, 8,
+		'o', 'p', 's', 'z', 0, 8, 0, 0, 0, 12, 0, 0, 0, 72, 0, 0, 0, 0, 1, 0,
+	}
+	shaper.fvar, err = ParseFvar(fvarData)
+	if err != nil {
+		t.Fatalf("ParseFvar: %v", err)
+	}
+	shaper.designCoords = []float32{12}
+	shaper.normalizedCoords = make([]float32, 1)
+	shaper.normalizedCoordsI = make([]int, 1)
+
+	opsz := func() float32 { return shaper.DesignCoords()[0] }
+	shaper.SetPpem(18, 18)
+	if got := opsz(); got != 18 {
+		t.Errorf("opsz at ppem 18 = %v, want 18", got)
+	}
+	shaper.SetPtem(100)
+	if got := opsz(); got != 72 {
+		t.Errorf("opsz at 100pt = %v, want 72", got)
+	}
+	if shaper.normalizedCoordsI[0] != 1<<14 {
+		t.Errorf("normalized opsz %d, want %d", shaper.normalizedCoordsI[0], 1<<14)
+	}
+	shaper.SetPtem(0)
+	if got := opsz(); got != 18 {
+		t.Errorf("opsz without ptem = %v, want ppem 18", got)
+	}
+
+	// An explicit opsz is kept
+	shaper.SetVariations([]Variation{{Tag: TagAxisOpticalSize, Value: 10}})
+	shaper.SetPtem(36)
+	if got := opsz(); got != 10 {
+		t.Errorf("explicit opsz = %v, want 10", got)
+	}
+	shaper.SetVariations(nil)
+	if got := opsz(); got != 36 {
+		t.Errorf("opsz after reset = %v, want 36", got)
+	}
+	shaper.SetPtem(0)
+	shaper.SetPpem(0, 0)
+	if got := opsz(); got != 12 {
+		t.Errorf("opsz without size = %v, want default 12", got)
+	}
+}
+
+func TestShaperSyntheticBold(t *testing.T) {
+	fontPath := findTestFont("Roboto-Regular.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Regular.ttf not found")
+	}
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("ParseFont: %v", err)
+	}
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("NewShaper: %v", err)
+	}
+	upem := int32(shaper.face.Upem())
+	shape := func() *Buffer {
+		buf := NewBuffer()
+		buf.AddString("Hello")
+		shaper.Shape(buf, nil)
+		return buf
+	}
+	regular := shape()
+	glyph := regular.Info[0].GlyphID
+	regularExtents, ok := shaper.GlyphExtents(glyph)
+	if !ok {
+		t.Fatal("no extents for H")
+	}
+
+	shaper.SetScale(2*upem, 2*upem)
+	shaper.SetSyntheticBold(0.02, 0.02, false)
+	if x, y, inPlace := shaper.SyntheticBold(); x != 0.02 || y != 0.02 || inPlace {
+		t.Errorf("SyntheticBold() = %v, %v, %v", x, y, inPlace)
+	}
+	strength := int32(math.Round(float64(2*upem) * 0.02))
+	for i, pos := range shape().Pos {
+		if want := 2*regular.Pos[i].XAdvance + strength; pos.XAdvance != want {
+			t.Errorf("[%d] bold advance %d, want %d", i, pos.XAdvance, want)
+		}
+	}
+	bold, _ := shaper.GlyphExtents(glyph)
+	want := GlyphExtents{
+		XBearing: 2 * regularExtents.XBearing,
+		YBearing: 2*regularExtents.YBearing + strength,
+		Width:    2*regularExtents.Width + strength,
+		Height:   2*regularExtents.Height - strength,
+	}
+	if bold != want {
+		t.Errorf("bold extents %+v, want %+v", bold, want)
+	}
+
+	// In place the advances are kept and the ink grows on both sides
+	shaper.SetSyntheticBold(0.02, 0.02, true)
+	for i, pos := range shape().Pos {
+		if pos.XAdvance != 2*regular.Pos[i].XAdvance {
+			t.Errorf("[%d] in-place advance %d, want %d", i, pos.XAdvance, 2*regular.Pos[i].XAdvance)
+		}
+	}
+	inPlace, _ := shaper.GlyphExtents(glyph)
+	want.XBearing -= strength / 2
+	if inPlace != want {
+		t.Errorf("in-place extents %+v, want %+v", inPlace, want)
+	}
+}
+
+func TestShaperSyntheticSlant(t *testing.T) {
+	fontPath := findTestFont("SourceSansPro-Regular.otf")
+	if fontPath == "" {
+		t.Skip("SourceSansPro-Regular.otf not found")
+	}
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("ParseFont: %v", err)
+	}
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("NewShaper: %v", err)
+	}
+	shape := func() *Buffer {
+		buf := NewBuffer()
+		buf.AddString("b\u0302H")
+		shaper.Shape(buf, nil)
+		return buf
+	}
+	upright := shape()
+	hGlyph := upright.Info[len(upright.Info)-1].GlyphID
+	uprightExtents, _ := shaper.GlyphExtents(hGlyph)
+
+	shaper.SetSyntheticSlant(0.2)
+	if got := shaper.SyntheticSlant(); got != 0.2 {
+		t.Errorf("SyntheticSlant() = %v", got)
+	}
+	slanted := shape()
+	raised := false
+	for i, pos := range slanted.Pos {
+		want := upright.Pos[i]
+		want.XOffset += int32(math.Round(0.2 * float64(want.YOffset)))
+		if pos != want {
+			t.Errorf("[%d] slanted position %+v, want %+v", i, pos, want)
+		}
+		raised = raised || want.YOffset != 0
+	}
+	if !raised {
+		t.Error("expected a raised mark")
+	}
+
+	// The extents are sheared: the top moves right by slant*height
+	extents, _ := shaper.GlyphExtents(hGlyph)
+	top := float64(uprightExtents.YBearing) * 0.2
+	if extents.YBearing != uprightExtents.YBearing || extents.Height != uprightExtents.Height ||
+		extents.XBearing != uprightExtents.XBearing ||
+		extents.Width != int32(math.Ceil(float64(uprightExtents.XBearing+uprightExtents.Width)+top))-uprightExtents.XBearing {
+		t.Errorf("slanted extents %+v, upright %+v", extents, uprightExtents)
+	}
+
+	// Vertical text is not slanted
+	buf := NewBuffer()
+	buf.AddString("b\u0302")
+	buf.Direction = DirectionTTB
+	shaper.Shape(buf, nil)
+	shaper.SetSyntheticSlant(0)
+	vertical := NewBuffer()
+	vertical.AddString("b\u0302")
+	vertical.Direction = DirectionTTB
+	shaper.Shape(vertical, nil)
+	for i := range buf.Pos {
+		if buf.Pos[i] != vertical.Pos[i] {
+			t.Errorf("[%d] vertical position %+v changed by the slant, want %+v", i, buf.Pos[i], vertical.Pos[i])
+		}
+	}
+}
+
+func TestPathEmbolden(t *testing.T) {
+	square := func(clockwise bool) Path {
+		var p Path
+		p.MoveTo(0, 0)
+		if clockwise {
+			p.LineTo(0, 100)
+			p.LineTo(100, 100)
+			p.LineTo(100, 0)
+		} else {
+			p.LineTo(100, 0)
+			p.LineTo(100, 100)
+			p.LineTo(0, 100)
+		}
+		p.Close()
+		return p
+	}
+
+	for _, clockwise := range []bool{false, true} {
+		p := square(clockwise)
+		p.Embolden(20, 10, false)
+		xMin, yMin, xMax, yMax, _ := p.Bounds()
+		if xMin != 0 || xMax != 120 || yMin != 0 || yMax != 110 {
+			t.Errorf("clockwise=%v: emboldened bounds (%v %v %v %v), want (0 0 120 110)", clockwise, xMin, yMin, xMax, yMax)
+		}
+
+		p = square(clockwise)
+		p.Embolden(20, 10, true)
+		xMin, yMin, xMax, yMax, _ = p.Bounds()
+		if xMin != -10 || xMax != 110 || yMin != 0 || yMax != 110 {
+			t.Errorf("clockwise=%v: in-place bounds (%v %v %v %v), want (-10 0 110 110)", clockwise, xMin, yMin, xMax, yMax)
+		}
+	}
+
+	p := square(false)
+	p.Slant(0.25)
+	xMin, yMin, xMax, yMax, _ := p.Bounds()
+	if xMin != 0 || xMax != 125 || yMin != 0 || yMax != 100 {
+		t.Errorf("slanted bounds (%v %v %v %v), want (0 0 125 100)", xMin, yMin, xMax, yMax)
+	}
+}
+
+func TestFaceGlyphOutline(t *testing.T) {
+	for _, name := range []string{"Roboto-Regular.ttf", "SourceSansPro-Regular.otf"} {
+		fontPath := findTestFont(name)
+		if fontPath == "" {
+			t.Skipf("%s not found", name)
+		}
+		data, err := os.ReadFile(fontPath)
+		if err != nil {
+			t.Fatalf("Failed to read font: %v", err)
+		}
+		face, err := LoadFaceFromData(data, 0)
+		if err != nil {
+			t.Fatalf("LoadFaceFromData: %v", err)
+		}
+		shaper, err := NewShaper(face.Font)
+		if err != nil {
+			t.Fatalf("NewShaper: %v", err)
+		}
+
+		// 'Á' is a composite glyph in Roboto
+		for _, r := range "HOÁ" {
+			gid, _ := face.Cmap().Lookup(Codepoint(r))
+			path, err := face.GlyphOutline(gid, nil)
+			if err != nil {
+				t.Fatalf("%s %q: %v", name, r, err)
+			}
+			got, ok := path.Extents()
+			want, _ := shaper.glyphExtents(gid)
+			if !ok || got != want {
+				t.Errorf("%s %q: outline extents %+v, want %+v", name, r, got, want)
+			}
+			curves := 0
+			for _, seg := range path {
+				if seg.Op == PathQuadTo || seg.Op == PathCubeTo {
+					curves++
+				}
+			}
+			if r != 'Á' && (r == 'O') != (curves > 0) {
+				t.Errorf("%s %q: %d curves", name, r, curves)
+			}
+		}
+		if _, err := face.GlyphOutline(GlyphID(face.Font.NumGlyphs()), nil); err == nil {
+			t.Errorf("%s: expected an error for a glyph out of range", name)
+		}
+	}
+}
+
+func TestFaceGlyphOutlineVariations(t *testing.T) {
+	data, err := os.ReadFile("testdata/Roboto-Variable.ttf")
+	if err != nil {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+	face, err := LoadFaceFromData(data, 0)
+	if err != nil {
+		t.Fatalf("LoadFaceFromData: %v", err)
+	}
+	gid, _ := face.Cmap().Lookup('l')
+	width := func(coords []int) float32 {
+		path, err := face.GlyphOutline(gid, coords)
+		if err != nil {
+			t.Fatalf("GlyphOutline: %v", err)
+		}
+		xMin, _, xMax, _, _ := path.Bounds()
+		return xMax - xMin
+	}
+	regular := width(nil)
+	if black := width([]int{1 << 14, 0}); black <= regular {
+		t.Errorf("stem width at wght=900 %v, regular %v", black, regular)
+	}
+	if thin := width([]int{-1 << 14, 0}); thin >= regular {
+		t.Errorf("stem width at wght=100 %v, regular %v", thin, regular)
+	}
+
+	// The shaper draws at its own coordinates
+	shaper, err := NewShaper(face.Font)
+	if err != nil {
+		t.Fatalf("NewShaper: %v", err)
+	}
+	shaper.SetVariations([]Variation{{Tag: MakeTag('w', 'g', 'h', 't'), Value: 900}})
+	path, _ := shaper.GlyphOutline(gid)
+	xMin, _, xMax, _, _ := path.Bounds()
+	if black := width([]int{1 << 14, 0}); xMax-xMin != black {
+		t.Errorf("shaper stem width %v, want %v", xMax-xMin, black)
+	}
+}
+
+func TestCFFSeacOutline(t *testing.T) {
+	fontPath := findTestFont("SourceSansPro-Regular.otf")
+	if fontPath == "" {
+		t.Skip("SourceSansPro-Regular.otf not found")
+	}
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("ParseFont: %v", err)
+	}
+	cffData, err := font.TableData(TagCFF)
+	if err != nil {
+		t.Fatalf("TableData: %v", err)
+	}
+	cff, err := ParseCFF(cffData)
+	if err != nil {
+		t.Fatalf("ParseCFF: %v", err)
+	}
+	base, ok := cff.GetGlyphFromName("A")
+	accent, ok2 := cff.GetGlyphFromName("acute")
+	if !ok || !ok2 {
+		t.Skip("no A or acute glyph")
+	}
+
+	// 100 20 65 194 endchar: 'A' (code 65) with 'acute' (code 194)
+	// moved by (100, 20)
+	seac := GlyphID(len(cff.CharStrings))
+	cff.CharStrings = append(cff.CharStrings, []byte{239, 159, 204, 247, 86, csEndchar})
+
+	var want Path
+	if err := cff.GlyphOutline(base, &want); err != nil {
+		t.Fatalf("GlyphOutline(A): %v", err)
+	}
+	var accentPath Path
+	if err := cff.GlyphOutline(accent, &accentPath); err != nil {
+		t.Fatalf("GlyphOutline(acute): %v", err)
+	}
+	for _, seg := range accentPath {
+		for j := 0; j < seg.numPoints(); j++ {
+			seg.Args[2*j] += 100
+			seg.Args[2*j+1] += 20
+		}
+		want = append(want, seg)
+	}
+
+	var got Path
+	if err := cff.GlyphOutline(seac, &got); err != nil {
+		t.Fatalf("GlyphOutline(seac): %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("seac outline has %d segments, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("[%d] segment %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestShaperGlyphOutline(t *testing.T) {
+	fontPath := findTestFont("Roboto-Regular.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Regular.ttf not found")
+	}
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	font, err := ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("ParseFont: %v", err)
+	}
+	shaper, err := NewShaper(font)
+	if err != nil {
+		t.Fatalf("NewShaper: %v", err)
+	}
+	upem := int32(shaper.face.Upem())
+	gid, _ := shaper.face.Cmap().Lookup('H')
+	bounds := func() [4]float32 {
+		path, err := shaper.GlyphOutline(gid)
+		if err != nil {
+			t.Fatalf("GlyphOutline: %v", err)
+		}
+		xMin, yMin, xMax, yMax, _ := path.Bounds()
+		return [4]float32{xMin, yMin, xMax, yMax}
+	}
+	units := bounds()
+
+	shaper.SetScale(2*upem, 2*upem)
+	scaled := bounds()
+	for i := range units {
+		if scaled[i] != 2*units[i] {
+			t.Errorf("scaled bounds %v, want twice %v", scaled, units)
+			break
+		}
+	}
+
+	// 'H' has straight stems, so bold grows the box by the strength and
+	// the slant moves the top right
+	shaper.SetSyntheticBold(0.02, 0.02, false)
+	strength := float32(math.Round(float64(2*upem) * 0.02))
+	bold := bounds()
+	want := [4]float32{scaled[0], scaled[1], scaled[2] + strength, scaled[3] + strength}
+	for i := range bold {
+		if math.Abs(float64(bold[i]-want[i])) > 0.01 {
+			t.Errorf("bold bounds %v, want %v", bold, want)
+			break
+		}
+	}
+	shaper.SetSyntheticBold(0, 0, false)
+	shaper.SetSyntheticSlant(0.25)
+	slanted := bounds()
+	if want := scaled[2] + 0.25*scaled[3]; math.Abs(float64(slanted[2]-want)) > 0.01 {
+		t.Errorf("slanted xMax %v, want %v", slanted[2], want)
+	}
+
+	var path Path
+	if err := shaper.DrawGlyph(gid, &path); err != nil {
+		t.Fatalf("DrawGlyph: %v", err)
+	}
+	if outline, _ := shaper.GlyphOutline(gid); len(path) != len(outline) {
+		t.Errorf("DrawGlyph drew %d segments, GlyphOutline %d", len(path), len(outline))
+	}
+}
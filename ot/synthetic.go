@@ -0,0 +1,296 @@
+package ot
+
+import "math"
+
+// Synthetic bold and slant
+//
+// HarfBuzz equivalent: hb_font_set_synthetic_bold() and
+// hb_font_set_synthetic_slant() in hb-font.cc
+//
+// A family without a bold or italic face can be faked from the regular one.
+// Synthetic bold widens every non-zero advance by the emboldening strength
+// (unless emboldening in place) and grows the glyph extents; outlines are
+// thickened with Path.Embolden. Synthetic slant shears glyphs to the right:
+// x' = x + slant*y. It moves the offsets of raised or lowered glyphs such as
+// marks and shears the extents; outlines are sheared with Path.Slant.
+
+// SetSyntheticBold sets the emboldening strength as a fraction of the em
+// in both directions, e.g. 0.02. With inPlace the advances are kept and the
+// outline grows around its center; otherwise the advances widen by the
+// strength and the glyphs stay left-aligned.
+// HarfBuzz equivalent: hb_font_set_synthetic_bold()
+func (s *Shaper) SetSyntheticBold(xEmbolden, yEmbolden float32, inPlace bool) {
+	s.xEmbolden = xEmbolden
+	s.yEmbolden = yEmbolden
+	s.emboldenInPlace = inPlace
+}
+
+// SyntheticBold returns the settings of SetSyntheticBold.
+// HarfBuzz equivalent: hb_font_get_synthetic_bold()
+func (s *Shaper) SyntheticBold() (xEmbolden, yEmbolden float32, inPlace bool) {
+	return s.xEmbolden, s.yEmbolden, s.emboldenInPlace
+}
+
+// SetSyntheticSlant sets the slant as the horizontal shift per vertical
+// unit, e.g. 0.2 for about 11 degrees. Zero disables the slant.
+// HarfBuzz equivalent: hb_font_set_synthetic_slant()
+func (s *Shaper) SetSyntheticSlant(slant float32) {
+	s.slant = slant
+}
+
+// SyntheticSlant returns the slant set with SetSyntheticSlant.
+// HarfBuzz equivalent: hb_font_get_synthetic_slant()
+func (s *Shaper) SyntheticSlant() float32 {
+	return s.slant
+}
+
+// emboldenStrength returns the emboldening strength in scaled units.
+// HarfBuzz equivalent: hb_font_t::x_strength and y_strength
+func (s *Shaper) emboldenStrength() (x, y int32) {
+	xScale, yScale := s.Scale()
+	x = int32(math.Abs(math.Round(float64(xScale) * float64(s.xEmbolden))))
+	y = int32(math.Abs(math.Round(float64(yScale) * float64(s.yEmbolden))))
+	return x, y
+}
+
+// slantXY returns the slant in scaled units.
+// HarfBuzz equivalent: hb_font_t::slant_xy
+func (s *Shaper) slantXY() float64 {
+	xScale, yScale := s.Scale()
+	if yScale == 0 {
+		return 0
+	}
+	return float64(s.slant) * float64(xScale) / float64(yScale)
+}
+
+// emboldenAdvance widens a non-zero advance by the emboldening strength.
+// HarfBuzz equivalent: emboldening in hb_font_t::get_glyph_h_advances()
+// and get_glyph_v_advances()
+func (s *Shaper) emboldenAdvance(advance, strength int32) int32 {
+	if advance == 0 || s.emboldenInPlace {
+		return advance
+	}
+	return advance + strength
+}
+
+// syntheticExtents applies the slant and the emboldening to scaled glyph
+// extents given as the corners (x1, y1) and (x2, y2).
+// HarfBuzz equivalent: hb_font_t::scale_glyph_extents()
+func (s *Shaper) syntheticExtents(x1, y1, x2, y2 float64) GlyphExtents {
+	if slant := s.slantXY(); slant != 0 {
+		x1 += math.Min(y1*slant, y2*slant)
+		x2 += math.Max(y1*slant, y2*slant)
+	}
+
+	xBearing := int32(math.Floor(x1))
+	yBearing := int32(math.Floor(y1))
+	extents := GlyphExtents{
+		XBearing: xBearing,
+		YBearing: yBearing,
+		Width:    int32(math.Ceil(x2)) - xBearing,
+		Height:   int32(math.Ceil(y2)) - yBearing,
+	}
+
+	xStrength, yStrength := s.emboldenStrength()
+	extents.YBearing += yStrength
+	extents.Height -= yStrength
+	if s.emboldenInPlace {
+		extents.XBearing -= xStrength / 2
+	}
+	extents.Width += xStrength
+	return extents
+}
+
+// GlyphExtents returns the ink extents of a glyph in scaled units at the
+// current variation coordinates, with synthetic bold and slant applied.
+// It returns false for empty glyphs.
+// HarfBuzz equivalent: hb_font_get_glyph_extents()
+func (s *Shaper) GlyphExtents(glyph GlyphID) (GlyphExtents, bool) {
+	return s.scaledGlyphExtents(glyph)
+}
+
+// applySyntheticSlant moves raised and lowered glyphs of horizontal text
+// along the slant.
+// HarfBuzz equivalent: synthetic slant in hb_ot_position() in hb-ot-shape.cc
+func (s *Shaper) applySyntheticSlant(buf *Buffer) {
+	slant := s.slantXY()
+	if slant == 0 || !buf.Direction.IsHorizontal() {
+		return
+	}
+	for i := range buf.Pos {
+		if y := buf.Pos[i].YOffset; y != 0 {
+			buf.Pos[i].XOffset += int32(math.Round(slant * float64(y)))
+		}
+	}
+}
+
+// Slant shears the path to the right by slant horizontal units per
+// vertical unit.
+// HarfBuzz equivalent: the slant of hb_draw_session_t in hb-draw.hh
+func (p Path) Slant(slant float32) {
+	if slant == 0 {
+		return
+	}
+	for i := range p {
+		seg := &p[i]
+		for j := 0; j < seg.numPoints(); j++ {
+			seg.Args[2*j] += slant * seg.Args[2*j+1]
+		}
+	}
+}
+
+// Embolden thickens the path by xStrength horizontally and yStrength
+// vertically, half of it on each side of the outline. Unless inPlace, the
+// result is moved right by half of xStrength so the left side bearing is
+// kept; it is always moved up by half of yStrength.
+// HarfBuzz equivalent: hb_outline_t::embolden() in hb-outline.cc, a port of
+// FreeType's FT_Outline_EmboldenXY()
+func (p Path) Embolden(xStrength, yStrength float32, inPlace bool) {
+	if xStrength == 0 && yStrength == 0 {
+		return
+	}
+	xShift, yShift := xStrength/2, yStrength/2
+	if inPlace {
+		xShift = 0
+	}
+	xStrength /= 2
+	yStrength /= 2
+
+	// Points of the path in order, and the contours as point ranges
+	type pointRef struct{ seg, idx int }
+	var points []pointRef
+	var contours [][2]int
+	start := 0
+	for si, seg := range p {
+		if seg.Op == PathMoveTo && len(points) > start {
+			contours = append(contours, [2]int{start, len(points)})
+			start = len(points)
+		}
+		for j := 0; j < seg.numPoints(); j++ {
+			points = append(points, pointRef{si, j})
+		}
+		if seg.Op == PathClose && len(points) > start {
+			contours = append(contours, [2]int{start, len(points)})
+			start = len(points)
+		}
+	}
+	if len(points) > start {
+		contours = append(contours, [2]int{start, len(points)})
+	}
+	if len(points) == 0 {
+		return
+	}
+	xy := make([][2]float32, len(points))
+	for i, r := range points {
+		xy[i] = [2]float32{p[r.seg].Args[2*r.idx], p[r.seg].Args[2*r.idx+1]}
+	}
+
+	// HarfBuzz: hb_outline_t::control_area()
+	var area float32
+	for _, c := range contours {
+		for i := c[0]; i < c[1]; i++ {
+			j := i + 1
+			if j == c[1] {
+				j = c[0]
+			}
+			area += xy[i][0]*xy[j][1] - xy[i][1]*xy[j][0]
+		}
+	}
+	negative := area < 0
+
+	normalize := func(v [2]float32) ([2]float32, float32) {
+		l := float32(math.Hypot(float64(v[0]), float64(v[1])))
+		if l != 0 {
+			v[0] /= l
+			v[1] /= l
+		}
+		return v, l
+	}
+
+	for _, c := range contours {
+		first, last := c[0], c[1]-1
+		var in, out, anchor, shift [2]float32
+		var lIn, lOut, lAnchor float32
+
+		// j cycles through the points; i advances only when points are
+		// moved; k marks the first moved point.
+		for i, j, k := last, first, -1; j != i && i != k; {
+			if j != k {
+				out, lOut = normalize([2]float32{xy[j][0] - xy[i][0], xy[j][1] - xy[i][1]})
+				if lOut == 0 {
+					j = nextPoint(j, first, last)
+					continue
+				}
+			} else {
+				out, lOut = anchor, lAnchor
+			}
+
+			if lIn != 0 {
+				if k < 0 {
+					k = i
+					anchor, lAnchor = in, lIn
+				}
+
+				d := in[0]*out[0] + in[1]*out[1]
+
+				// Shift only if the turn is less than ~160 degrees
+				if d > -15.0/16.0 {
+					d++
+
+					// Shift along the lateral bisector in proper orientation
+					shift = [2]float32{in[1] + out[1], in[0] + out[0]}
+					if negative {
+						shift[0] = -shift[0]
+					} else {
+						shift[1] = -shift[1]
+					}
+
+					// Restrict the shift to handle collapsing segments
+					q := out[0]*in[1] - out[1]*in[0]
+					if negative {
+						q = -q
+					}
+					l := lIn
+					if lOut < l {
+						l = lOut
+					}
+					if xStrength*q <= l*d {
+						shift[0] = shift[0] * xStrength / d
+					} else {
+						shift[0] = shift[0] * l / q
+					}
+					if yStrength*q <= l*d {
+						shift[1] = shift[1] * yStrength / d
+					} else {
+						shift[1] = shift[1] * l / q
+					}
+				} else {
+					shift = [2]float32{}
+				}
+
+				for ; i != j; i = nextPoint(i, first, last) {
+					xy[i][0] += xShift + shift[0]
+					xy[i][1] += yShift + shift[1]
+				}
+			} else {
+				i = j
+			}
+
+			in, lIn = out, lOut
+			j = nextPoint(j, first, last)
+		}
+	}
+
+	for i, r := range points {
+		p[r.seg].Args[2*r.idx] = xy[i][0]
+		p[r.seg].Args[2*r.idx+1] = xy[i][1]
+	}
+}
+
+// nextPoint returns the index after i in the contour [first, last].
+func nextPoint(i, first, last int) int {
+	if i < last {
+		return i + 1
+	}
+	return first
+}
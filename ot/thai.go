@@ -45,7 +45,7 @@ func isThaiAboveBaseMark(cp Codepoint) bool {
 // mergeOutClusters merges clusters in the output buffer range [start, end).
 // HarfBuzz equivalent: merge_out_clusters() in hb-buffer.cc:584-620
 func mergeOutClusters(buf *Buffer, start, end int) {
-	if end-start < 2 {
+	if end-start < 2 || buf.ClusterLevel == ClusterLevelCharacters {
 		return
 	}
 
@@ -69,7 +69,7 @@ func mergeOutClusters(buf *Buffer, start, end int) {
 
 	// Set all glyphs in range to minimum cluster
 	for i := start; i < end; i++ {
-		buf.outInfo[i].Cluster = cluster
+		setCluster(&buf.outInfo[i], cluster, 0)
 	}
 }
 
@@ -168,7 +168,7 @@ func (s *Shaper) shapeThai(buf *Buffer, features []Feature) {
 	s.setGlyphClasses(buf)
 
 	// Step 5: Categorize and apply features
-	gsubFeatures, gposFeatures := s.categorizeFeatures(features)
+	gsubFeatures, gposFeatures := s.planFeatures(buf, features)
 
 	// Add direction-dependent features (Thai is always LTR)
 	gsubFeatures = append(gsubFeatures, Feature{Tag: MakeTag('l', 't', 'r', 'a'), Value: 1})
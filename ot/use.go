@@ -162,8 +162,7 @@ func (s *Shaper) shapeUSE(buf *Buffer, features []Feature) {
 
 	// Step 5.5: Mark syllables as unsafe to break
 	// HarfBuzz equivalent: buffer->unsafe_to_break(start, end) in setup_syllables_use()
-	// Note: unsafe_to_break is a flag for line-breaking, not cluster merging
-	// We don't implement line-breaking, so this is a no-op for now
+	unsafeToBreakSyllables(buf, func(i int) uint32 { return uint32(syllables[i].Syllable) })
 
 	// Step 5: Apply pre-processing features
 	s.applyUSEPreProcessingFeatures(buf, syllables)
@@ -203,7 +202,7 @@ func (s *Shaper) shapeUSE(buf *Buffer, features []Feature) {
 	s.zeroMarkWidthsByGDEF(buf)
 
 	// Step 15: Apply GPOS features
-	_, gposFeatures := s.categorizeFeatures(features)
+	_, gposFeatures := s.planFeatures(buf, features)
 	gposFeatures = append(gposFeatures, s.getUSEGPOSFeatures()...)
 	s.applyGPOS(buf, gposFeatures)
 
@@ -241,7 +240,7 @@ func (s *Shaper) applyUSEPreProcessingFeatures(buf *Buffer, syllables []USESylla
 
 	// Use CompileMap to collect all lookups and sort them by index
 	// HarfBuzz: All features are enabled via map->enable_feature() and applied together
-	otMap := CompileMap(s.gsub, nil, features, buf.Script, buf.Language)
+	otMap := s.compileMap(buf, s.gsub, nil, features)
 	otMap.ApplyGSUB(s.gsub, buf, s.font, s.gdef)
 }
 
@@ -296,7 +295,7 @@ func (s *Shaper) applyRphfUSE(buf *Buffer, syllables []USESyllableInfo) {
 
 	// Apply rphf using buffer-based approach
 	// HarfBuzz: rphf is applied via OT map pipeline with mask
-	variationsIndex := s.gsub.FindVariationsIndex(s.normalizedCoordsI)
+	variationsIndex := s.gsubVariationsIndex(buf)
 	s.gsub.ApplyFeatureToBufferWithMaskAndVariations(useRphfFeature, buf, s.gdef, MaskGlobal, s.font, variationsIndex)
 
 	// Mark substituted rephas as USE_R
@@ -341,7 +340,7 @@ func (s *Shaper) applyPrefUSE(buf *Buffer, syllables []USESyllableInfo) {
 
 	// Apply pref using buffer-based approach
 	// HarfBuzz: pref is applied via OT map pipeline with mask
-	variationsIndex := s.gsub.FindVariationsIndex(s.normalizedCoordsI)
+	variationsIndex := s.gsubVariationsIndex(buf)
 	s.gsub.ApplyFeatureToBufferWithMaskAndVariations(usePrefFeature, buf, s.gdef, MaskGlobal, s.font, variationsIndex)
 
 	// Mark substituted pref as VPre
@@ -385,7 +384,7 @@ func (s *Shaper) applyUSEBasicFeatures(buf *Buffer, syllables []USESyllableInfo)
 
 	// Use CompileMap to collect all lookups and sort them by index
 	// HarfBuzz: All features are enabled via map->enable_feature() and applied together
-	otMap := CompileMap(s.gsub, nil, features, buf.Script, buf.Language)
+	otMap := s.compileMap(buf, s.gsub, nil, features)
 	otMap.ApplyGSUB(s.gsub, buf, s.font, s.gdef)
 }
 
@@ -606,7 +605,7 @@ func (s *Shaper) applyUSEOtherFeatures(buf *Buffer, syllables []USESyllableInfo)
 
 	// Use CompileMap to collect all lookups and sort them by index
 	// This replicates HarfBuzz's map.compile() which sorts all lookups together
-	otMap := CompileMap(s.gsub, nil, allFeatures, buf.Script, buf.Language)
+	otMap := s.compileMap(buf, s.gsub, nil, allFeatures)
 	otMap.ApplyGSUB(s.gsub, buf, s.font, s.gdef)
 }
 
@@ -667,7 +666,7 @@ func (s *Shaper) mergeSyllableClustersUSE(buf *Buffer, syllables []USESyllableIn
 				buf.MergeClusters(start, zwnjPos)
 			}
 			// Merge part starting with ZWNJ (including ZWNJ) to ZWNJ's cluster
-			if end > zwnjPos {
+			if end > zwnjPos && buf.ClusterLevel != ClusterLevelCharacters {
 				// The cluster after ZWNJ should all be set to ZWNJ's cluster
 				zwnjCluster := buf.Info[zwnjPos].Cluster
 				for j := zwnjPos; j < end; j++ {
@@ -0,0 +1,200 @@
+package ot
+
+import "encoding/binary"
+
+// Vmtx represents the vertical metrics table.
+type Vmtx struct {
+	// vMetrics contains advanceHeight and tsb for glyphs 0..numOfLongVerMetrics-1
+	vMetrics []LongVerMetric
+	// topSideBearings for glyphs numOfLongVerMetrics..numGlyphs-1
+	// (these glyphs share the last advanceHeight)
+	topSideBearings []int16
+	// lastAdvanceHeight is cached for glyphs >= numOfLongVerMetrics
+	lastAdvanceHeight uint16
+}
+
+// LongVerMetric contains the advance height and top side bearing for a glyph.
+type LongVerMetric struct {
+	AdvanceHeight uint16
+	Tsb           int16 // Top side bearing
+}
+
+// ParseVmtx parses the vmtx table.
+// It requires numOfLongVerMetrics from vhea and numGlyphs from maxp.
+func ParseVmtx(data []byte, numOfLongVerMetrics, numGlyphs int) (*Vmtx, error) {
+	if numOfLongVerMetrics <= 0 {
+		return nil, ErrInvalidTable
+	}
+	if numOfLongVerMetrics > numGlyphs {
+		numOfLongVerMetrics = numGlyphs
+	}
+
+	expectedSize := numOfLongVerMetrics*4 + (numGlyphs-numOfLongVerMetrics)*2
+	if len(data) < numOfLongVerMetrics*4 {
+		return nil, ErrInvalidTable
+	}
+
+	v := &Vmtx{
+		vMetrics: make([]LongVerMetric, numOfLongVerMetrics),
+	}
+
+	off := 0
+	for i := 0; i < numOfLongVerMetrics; i++ {
+		v.vMetrics[i].AdvanceHeight = binary.BigEndian.Uint16(data[off:])
+		v.vMetrics[i].Tsb = int16(binary.BigEndian.Uint16(data[off+2:]))
+		off += 4
+	}
+	v.lastAdvanceHeight = v.vMetrics[numOfLongVerMetrics-1].AdvanceHeight
+
+	// Some fonts omit the trailing top side bearings; treat them as zero.
+	if len(data) >= expectedSize {
+		v.topSideBearings = make([]int16, numGlyphs-numOfLongVerMetrics)
+		for i := range v.topSideBearings {
+			v.topSideBearings[i] = int16(binary.BigEndian.Uint16(data[off:]))
+			off += 2
+		}
+	}
+
+	return v, nil
+}
+
+// GetAdvanceHeight returns the advance height for a glyph.
+func (v *Vmtx) GetAdvanceHeight(glyph GlyphID) uint16 {
+	if int(glyph) < len(v.vMetrics) {
+		return v.vMetrics[glyph].AdvanceHeight
+	}
+	// Glyphs beyond numOfLongVerMetrics use the last advance height
+	return v.lastAdvanceHeight
+}
+
+// GetTsb returns the top side bearing for a glyph.
+func (v *Vmtx) GetTsb(glyph GlyphID) int16 {
+	if int(glyph) < len(v.vMetrics) {
+		return v.vMetrics[glyph].Tsb
+	}
+	idx := int(glyph) - len(v.vMetrics)
+	if idx >= 0 && idx < len(v.topSideBearings) {
+		return v.topSideBearings[idx]
+	}
+	return 0
+}
+
+// Vhea represents the vertical header table.
+type Vhea struct {
+	Version              uint32
+	Ascender             int16 // vertTypoAscender: distance from the centerline to the previous line's descent
+	Descender            int16 // vertTypoDescender: distance from the centerline to the next line's ascent
+	LineGap              int16
+	AdvanceHeightMax     uint16
+	MinTopSideBearing    int16
+	MinBottomSideBearing int16
+	YMaxExtent           int16
+	CaretSlopeRise       int16
+	CaretSlopeRun        int16
+	CaretOffset          int16
+	MetricDataFormat     int16
+	NumOfLongVerMetrics  uint16
+}
+
+// ParseVhea parses the vhea (vertical header) table.
+func ParseVhea(data []byte) (*Vhea, error) {
+	if len(data) < 36 {
+		return nil, ErrInvalidTable
+	}
+
+	v := &Vhea{
+		Version:              binary.BigEndian.Uint32(data[0:]),
+		Ascender:             int16(binary.BigEndian.Uint16(data[4:])),
+		Descender:            int16(binary.BigEndian.Uint16(data[6:])),
+		LineGap:              int16(binary.BigEndian.Uint16(data[8:])),
+		AdvanceHeightMax:     binary.BigEndian.Uint16(data[10:]),
+		MinTopSideBearing:    int16(binary.BigEndian.Uint16(data[12:])),
+		MinBottomSideBearing: int16(binary.BigEndian.Uint16(data[14:])),
+		YMaxExtent:           int16(binary.BigEndian.Uint16(data[16:])),
+		CaretSlopeRise:       int16(binary.BigEndian.Uint16(data[18:])),
+		CaretSlopeRun:        int16(binary.BigEndian.Uint16(data[20:])),
+		CaretOffset:          int16(binary.BigEndian.Uint16(data[22:])),
+		// 24-30: reserved (4 int16)
+		MetricDataFormat:    int16(binary.BigEndian.Uint16(data[32:])),
+		NumOfLongVerMetrics: binary.BigEndian.Uint16(data[34:]),
+	}
+
+	return v, nil
+}
+
+// ParseVmtxFromFont is a convenience function that parses vmtx from a font,
+// automatically reading vhea and maxp for required values.
+func ParseVmtxFromFont(font *Font) (*Vmtx, error) {
+	vheaData, err := font.TableData(TagVhea)
+	if err != nil {
+		return nil, err
+	}
+	vhea, err := ParseVhea(vheaData)
+	if err != nil {
+		return nil, err
+	}
+
+	numGlyphs := font.NumGlyphs()
+	if numGlyphs == 0 {
+		return nil, ErrInvalidTable
+	}
+
+	vmtxData, err := font.TableData(TagVmtx)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseVmtx(vmtxData, int(vhea.NumOfLongVerMetrics), numGlyphs)
+}
+
+// VORG represents the vertical origin table of CFF fonts. It stores the
+// y coordinate of the vertical origin of every glyph.
+type VORG struct {
+	defaultVertOriginY int16
+	metrics            []vertOriginYMetric // sorted by glyph ID
+}
+
+type vertOriginYMetric struct {
+	glyph       GlyphID
+	vertOriginY int16
+}
+
+// ParseVORG parses the VORG table.
+func ParseVORG(data []byte) (*VORG, error) {
+	if len(data) < 8 {
+		return nil, ErrInvalidTable
+	}
+	if major := binary.BigEndian.Uint16(data[0:]); major != 1 {
+		return nil, ErrInvalidFormat
+	}
+
+	v := &VORG{defaultVertOriginY: int16(binary.BigEndian.Uint16(data[4:]))}
+	count := int(binary.BigEndian.Uint16(data[6:]))
+	if len(data) < 8+count*4 {
+		return nil, ErrInvalidTable
+	}
+	v.metrics = make([]vertOriginYMetric, count)
+	for i := range v.metrics {
+		off := 8 + i*4
+		v.metrics[i].glyph = GlyphID(binary.BigEndian.Uint16(data[off:]))
+		v.metrics[i].vertOriginY = int16(binary.BigEndian.Uint16(data[off+2:]))
+	}
+	return v, nil
+}
+
+// GetVertOriginY returns the y coordinate of the vertical origin of a glyph.
+func (v *VORG) GetVertOriginY(glyph GlyphID) int16 {
+	lo, hi := 0, len(v.metrics)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		switch g := v.metrics[mid].glyph; {
+		case g < glyph:
+			lo = mid + 1
+		case g > glyph:
+			hi = mid
+		default:
+			return v.metrics[mid].vertOriginY
+		}
+	}
+	return v.defaultVertOriginY
+}
@@ -0,0 +1,251 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/boxesandglue/textshape/internal/shapertest"
+	"github.com/boxesandglue/textshape/ot"
+)
+
+func coverage(mask *image.Alpha) int {
+	sum := 0
+	for _, v := range mask.Pix {
+		sum += int(v)
+	}
+	return sum
+}
+
+func TestRasterizerRectangle(t *testing.T) {
+	// A rectangle from x=1.5 to 3.5 covers half of columns 1 and 3
+	z := NewRasterizer(5, 4)
+	z.MoveTo(1.5, 1)
+	z.LineTo(3.5, 1)
+	z.LineTo(3.5, 3)
+	z.LineTo(1.5, 3)
+	z.Close()
+	mask := z.Alpha()
+
+	want := [][]uint8{
+		{0, 0, 0, 0, 0},
+		{0, 128, 255, 128, 0},
+		{0, 128, 255, 128, 0},
+		{0, 0, 0, 0, 0},
+	}
+	for y, row := range want {
+		for x, v := range row {
+			if got := mask.AlphaAt(x, y).A; got != v {
+				t.Errorf("(%d, %d) = %d, want %d", x, y, got, v)
+			}
+		}
+	}
+}
+
+func TestRasterizerWinding(t *testing.T) {
+	square := func(z *Rasterizer, clockwise bool) {
+		z.MoveTo(1, 1)
+		if clockwise {
+			z.LineTo(3, 1)
+			z.LineTo(3, 3)
+			z.LineTo(1, 3)
+		} else {
+			z.LineTo(1, 3)
+			z.LineTo(3, 3)
+			z.LineTo(3, 1)
+		}
+		z.Close()
+	}
+
+	// Overlapping contours of the same direction merge; a contour of the
+	// opposite direction cuts a hole
+	z := NewRasterizer(4, 4)
+	square(z, true)
+	square(z, true)
+	if got := z.Alpha().AlphaAt(2, 2).A; got != 255 {
+		t.Errorf("overlap = %d, want 255", got)
+	}
+	z.Reset(4, 4)
+	square(z, true)
+	square(z, false)
+	if got := coverage(z.Alpha()); got != 0 {
+		t.Errorf("hole coverage = %d, want 0", got)
+	}
+
+	// A diagonal halves the pixels it crosses
+	z.Reset(2, 2)
+	z.MoveTo(0, 0)
+	z.LineTo(2, 2)
+	z.LineTo(0, 2)
+	z.Close()
+	if got := z.Alpha().AlphaAt(1, 1).A; got != 128 {
+		t.Errorf("diagonal = %d, want 128", got)
+	}
+}
+
+func TestRasterizerClipping(t *testing.T) {
+	// Parts outside the image are cut off without disturbing the inside
+	z := NewRasterizer(4, 4)
+	z.MoveTo(-10, -10)
+	z.LineTo(2, -10)
+	z.LineTo(2, 10)
+	z.LineTo(-10, 10)
+	z.Close()
+	mask := z.Alpha()
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			want := uint8(0)
+			if x < 2 {
+				want = 255
+			}
+			if got := mask.AlphaAt(x, y).A; got != want {
+				t.Errorf("(%d, %d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestGlyphMask(t *testing.T) {
+	shaper := shapertest.Load(t, "Roboto-Regular.ttf")
+	r := NewRenderer(shaper, 32)
+	buf := ot.NewBuffer()
+	buf.AddString("H")
+	shaper.Shape(buf, nil)
+	glyph := buf.Info[0].GlyphID
+
+	mask, err := r.GlyphMask(glyph, 10, 40)
+	if err != nil {
+		t.Fatalf("GlyphMask: %v", err)
+	}
+	// 'H' sits on the baseline and reaches the cap height
+	ext, _ := shaper.GlyphExtents(glyph)
+	upem, _ := shaper.Scale()
+	scale := 32 / float64(upem)
+	if mask.Rect.Max.Y != 40 || mask.Rect.Min.Y != 40-int(float64(ext.YBearing)*scale+0.999) {
+		t.Errorf("mask bounds %v, extents %+v", mask.Rect, ext)
+	}
+	// The stems are solid
+	solid := 0
+	for _, v := range mask.Pix {
+		if v == 255 {
+			solid++
+		}
+	}
+	if solid == 0 {
+		t.Error("no solid pixels")
+	}
+
+	// Whole pixel moves shift the mask; subpixel moves keep the ink
+	moved, _ := r.GlyphMask(glyph, 13, 41)
+	if moved.Rect != mask.Rect.Add(image.Pt(3, 1)) {
+		t.Errorf("moved bounds %v, want %v", moved.Rect, mask.Rect.Add(image.Pt(3, 1)))
+	} else {
+		for i := range mask.Pix {
+			if mask.Pix[i] != moved.Pix[i] {
+				t.Fatalf("moved mask differs at %d", i)
+			}
+		}
+	}
+	half, _ := r.GlyphMask(glyph, 10.5, 40)
+	if a, b := coverage(mask), coverage(half); a-b > a/100 || b-a > a/100 {
+		t.Errorf("coverage %d at a subpixel position, %d at a pixel", b, a)
+	}
+	same := half.Rect == mask.Rect
+	for i := 0; same && i < len(mask.Pix); i++ {
+		same = mask.Pix[i] == half.Pix[i]
+	}
+	if same {
+		t.Error("subpixel position did not change the mask")
+	}
+
+	// Space has no outline
+	buf = ot.NewBuffer()
+	buf.AddString(" ")
+	shaper.Shape(buf, nil)
+	empty, err := r.GlyphMask(buf.Info[0].GlyphID, 0, 0)
+	if err != nil || !empty.Rect.Empty() {
+		t.Errorf("space mask %v, %v", empty.Rect, err)
+	}
+}
+
+func TestBufferMask(t *testing.T) {
+	shaper := shapertest.Load(t, "Roboto-Regular.ttf")
+	xScale, _ := shaper.Scale()
+	upem := float64(xScale)
+	r := NewRenderer(shaper, 20)
+
+	buf := ot.NewBuffer()
+	buf.AddString("Hello")
+	shaper.Shape(buf, nil)
+	mask, err := r.Mask(buf)
+	if err != nil {
+		t.Fatalf("Mask: %v", err)
+	}
+	var advance int32
+	for _, pos := range buf.Pos {
+		advance += pos.XAdvance
+	}
+	width := float64(advance) * 20 / upem
+	if dx := float64(mask.Rect.Dx()); dx < width*0.8 || dx > width+2 {
+		t.Errorf("mask width %d, advance %.1f px", mask.Rect.Dx(), width)
+	}
+	if mask.Rect.Max.Y <= 0 || mask.Rect.Min.Y >= 0 {
+		t.Errorf("mask bounds %v should straddle the baseline", mask.Rect)
+	}
+
+	// A scaled shaper renders the same pixels
+	shaper.SetScale(int32(upem)*64, int32(upem)*64)
+	scaled := ot.NewBuffer()
+	scaled.AddString("Hello")
+	shaper.Shape(scaled, nil)
+	scaledMask, err := NewRenderer(shaper, 20).Mask(scaled)
+	if err != nil {
+		t.Fatalf("Mask: %v", err)
+	}
+	if scaledMask.Rect != mask.Rect {
+		t.Errorf("scaled mask bounds %v, want %v", scaledMask.Rect, mask.Rect)
+	}
+	shaper.SetScale(0, 0)
+
+	// Vertical runs go down from the origin
+	vertical := ot.NewBuffer()
+	vertical.AddString("Hello")
+	vertical.Direction = ot.DirectionTTB
+	shaper.Shape(vertical, nil)
+	vmask, err := r.Mask(vertical)
+	if err != nil {
+		t.Fatalf("Mask: %v", err)
+	}
+	if vmask.Rect.Dy() <= vmask.Rect.Dx() || vmask.Rect.Min.Y < 0 {
+		t.Errorf("vertical mask bounds %v", vmask.Rect)
+	}
+}
+
+func TestDrawBuffer(t *testing.T) {
+	shaper := shapertest.Load(t, "SourceSansPro-Regular.otf")
+	r := NewRenderer(shaper, 24)
+
+	buf := ot.NewBuffer()
+	buf.AddString("Type")
+	shaper.Shape(buf, nil)
+
+	dst := image.NewRGBA(image.Rect(0, 0, 80, 32))
+	for i := range dst.Pix {
+		dst.Pix[i] = 255
+	}
+	red := image.NewUniform(color.RGBA{200, 0, 0, 255})
+	if err := r.DrawBuffer(dst, red, buf, 2, 24); err != nil {
+		t.Fatalf("DrawBuffer: %v", err)
+	}
+	mask, _ := r.Mask(buf)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 80; x++ {
+			a := mask.AlphaAt(x-2, y-24).A
+			c := dst.RGBAAt(x, y)
+			// Blue fades from white to the red's 0 with the coverage
+			if want := 255 - a; int(c.B) < int(want)-2 || int(c.B) > int(want)+2 {
+				t.Fatalf("(%d, %d) = %v, coverage %d", x, y, c, a)
+			}
+		}
+	}
+}
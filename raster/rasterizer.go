@@ -0,0 +1,254 @@
+// Package raster renders glyph outlines and shaped buffers to anti-aliased
+// images without cgo.
+package raster
+
+import (
+	"image"
+	"math"
+)
+
+// Rasterizer fills paths with anti-aliasing. Coverage is accumulated as
+// signed area per pixel, exact for straight edges; curves are flattened
+// into lines. Overlapping contours of the same direction are merged, so
+// glyphs with overlaps render as with the nonzero rule.
+//
+// A Rasterizer is an ot.Pen in pixel coordinates: x grows to the right and
+// y grows downwards, as in image.Image.
+//
+// Based on the accumulation rasterizer of font-rs, also used by
+// golang.org/x/image/vector.
+type Rasterizer struct {
+	width, height int
+	acc           []float32
+
+	// Start of the current contour and the current point
+	startX, startY float32
+	x, y           float32
+}
+
+// NewRasterizer returns a rasterizer for a width×height image.
+func NewRasterizer(width, height int) *Rasterizer {
+	r := &Rasterizer{}
+	r.Reset(width, height)
+	return r
+}
+
+// Reset clears the rasterizer and sets the image size.
+func (r *Rasterizer) Reset(width, height int) {
+	if width < 0 {
+		width = 0
+	}
+	if height < 0 {
+		height = 0
+	}
+	r.width, r.height = width, height
+	n := width*height + 2
+	if cap(r.acc) < n {
+		r.acc = make([]float32, n)
+	} else {
+		r.acc = r.acc[:n]
+		for i := range r.acc {
+			r.acc[i] = 0
+		}
+	}
+	r.startX, r.startY, r.x, r.y = 0, 0, 0, 0
+}
+
+// Size returns the image size.
+func (r *Rasterizer) Size() (width, height int) {
+	return r.width, r.height
+}
+
+// MoveTo starts a new contour at (x, y), closing the current one.
+func (r *Rasterizer) MoveTo(x, y float32) {
+	r.Close()
+	r.startX, r.startY = x, y
+	r.x, r.y = x, y
+}
+
+// LineTo adds a line to (x, y).
+func (r *Rasterizer) LineTo(x, y float32) {
+	r.line(r.x, r.y, x, y)
+	r.x, r.y = x, y
+}
+
+// QuadTo adds a quadratic Bézier curve to (x, y).
+func (r *Rasterizer) QuadTo(cx, cy, x, y float32) {
+	x0, y0 := r.x, r.y
+	n := segments(devsq(x0-2*cx+x, y0-2*cy+y))
+	for i := 1; i < n; i++ {
+		t := float32(i) / float32(n)
+		u := 1 - t
+		r.LineTo(u*u*x0+2*u*t*cx+t*t*x, u*u*y0+2*u*t*cy+t*t*y)
+	}
+	r.LineTo(x, y)
+}
+
+// CubeTo adds a cubic Bézier curve to (x, y).
+func (r *Rasterizer) CubeTo(c1x, c1y, c2x, c2y, x, y float32) {
+	x0, y0 := r.x, r.y
+	dev := devsq(x0-2*c1x+c2x, y0-2*c1y+c2y)
+	if d := devsq(c1x-2*c2x+x, c1y-2*c2y+y); d > dev {
+		dev = d
+	}
+	n := segments(dev)
+	for i := 1; i < n; i++ {
+		t := float32(i) / float32(n)
+		u := 1 - t
+		a, b, c, d := u*u*u, 3*u*u*t, 3*u*t*t, t*t*t
+		r.LineTo(a*x0+b*c1x+c*c2x+d*x, a*y0+b*c1y+c*c2y+d*y)
+	}
+	r.LineTo(x, y)
+}
+
+// Close closes the current contour with a line to its start.
+func (r *Rasterizer) Close() {
+	if r.x != r.startX || r.y != r.startY {
+		r.LineTo(r.startX, r.startY)
+	}
+}
+
+// devsq returns the squared length of the second difference of a curve.
+func devsq(dx, dy float32) float32 {
+	return dx*dx + dy*dy
+}
+
+// segments returns the number of lines a curve with the second difference
+// dev (squared) is flattened into, keeping the error well below a pixel.
+func segments(devsq float32) int {
+	if devsq < 1.0/3 {
+		return 1
+	}
+	const tolerance = 3
+	return 1 + int(math.Sqrt(math.Sqrt(float64(tolerance*devsq))))
+}
+
+// line accumulates the signed area of the line from (x0, y0) to (x1, y1).
+// Parts outside the image are clipped vertically and clamped to the left
+// or right edge horizontally, which keeps the winding of the rows.
+func (r *Rasterizer) line(x0, y0, x1, y1 float32) {
+	if y0 == y1 {
+		return
+	}
+	dir := float32(1)
+	if y0 > y1 {
+		dir = -1
+		x0, y0, x1, y1 = x1, y1, x0, y0
+	}
+	w := float32(r.width)
+	dxdy := (x1 - x0) / (y1 - y0)
+	x := x0
+	if y0 < 0 {
+		x -= y0 * dxdy
+	}
+	yStart := int(math.Max(0, math.Floor(float64(y0))))
+	yEnd := int(math.Min(float64(r.height), math.Ceil(float64(y1))))
+	for yi := yStart; yi < yEnd; yi++ {
+		fy := float32(yi)
+		dy := min32(fy+1, y1) - max32(fy, y0)
+		xNext := x + dxdy*dy
+		d := dy * dir
+
+		xa, xb := clamp32(x, 0, w), clamp32(xNext, 0, w)
+		if xa > xb {
+			xa, xb = xb, xa
+		}
+		row := r.acc[yi*r.width:]
+		xaFloor := float32(math.Floor(float64(xa)))
+		xai := int(xaFloor)
+		xbCeil := float32(math.Ceil(float64(xb)))
+		xbi := int(xbCeil)
+		if xbi <= xai+1 {
+			// Within one pixel: split by the mean x
+			xm := 0.5*(xa+xb) - xaFloor
+			row[xai] += d - d*xm
+			row[xai+1] += d * xm
+		} else {
+			s := 1 / (xb - xa)
+			xaf := xa - xaFloor
+			a0 := 0.5 * s * (1 - xaf) * (1 - xaf)
+			xbf := xb - xbCeil + 1
+			am := 0.5 * s * xbf * xbf
+			row[xai] += d * a0
+			if xbi == xai+2 {
+				row[xai+1] += d * (1 - a0 - am)
+			} else {
+				a1 := s * (1.5 - xaf)
+				row[xai+1] += d * (a1 - a0)
+				for xi := xai + 2; xi < xbi-1; xi++ {
+					row[xi] += d * s
+				}
+				a2 := a1 + float32(xbi-xai-3)*s
+				row[xbi-1] += d * (1 - a2 - am)
+			}
+			row[xbi] += d * am
+		}
+		x = xNext
+	}
+}
+
+// Alpha returns the coverage as a mask with bounds (0, 0)-(width, height).
+func (r *Rasterizer) Alpha() *image.Alpha {
+	dst := image.NewAlpha(image.Rect(0, 0, r.width, r.height))
+	r.Draw(dst)
+	return dst
+}
+
+// Draw writes the coverage into the top-left width×height pixels of dst,
+// starting at dst.Rect.Min. Coverage is combined with the pixels of dst
+// as alpha "over" alpha, so several rasterizations can share a mask.
+func (r *Rasterizer) Draw(dst *image.Alpha) {
+	w := r.width
+	if dw := dst.Rect.Dx(); dw < w {
+		w = dw
+	}
+	h := r.height
+	if dh := dst.Rect.Dy(); dh < h {
+		h = dh
+	}
+	var acc float32
+	for y := 0; y < r.height; y++ {
+		row := r.acc[y*r.width : (y+1)*r.width]
+		var pix []uint8
+		if y < h {
+			pix = dst.Pix[y*dst.Stride : y*dst.Stride+w]
+		}
+		for x, a := range row {
+			acc += a
+			if x >= len(pix) {
+				continue
+			}
+			c := acc
+			if c < 0 {
+				c = -c
+			}
+			if c > 1 {
+				c = 1
+			}
+			v := uint32(c*255 + 0.5)
+			if v == 0 {
+				continue
+			}
+			old := uint32(pix[x])
+			pix[x] = uint8(v + old - (v*old+127)/255)
+		}
+	}
+}
+
+func min32(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max32(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func clamp32(v, lo, hi float32) float32 {
+	return min32(max32(v, lo), hi)
+}
@@ -0,0 +1,164 @@
+package raster
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/boxesandglue/textshape/ot"
+)
+
+// Renderer draws the glyphs of a Shaper at a size in pixels per em. Glyph
+// outlines come from Shaper.DrawGlyph, so they follow the variations and
+// the synthetic bold and slant of the shaper. Positions are exact to the
+// subpixel: every glyph is rasterized at its fractional position.
+type Renderer struct {
+	shaper *ot.Shaper
+
+	// Pixels per scaled unit of the shaper
+	xFactor, yFactor float32
+}
+
+// NewRenderer returns a renderer for glyphs of shaper at ppem pixels per
+// em. The scale of the shaper (see ot.Shaper.SetScale) is read once, so
+// buffers must be shaped with the same scale.
+func NewRenderer(shaper *ot.Shaper, ppem float32) *Renderer {
+	xScale, yScale := shaper.Scale()
+	return &Renderer{
+		shaper:  shaper,
+		xFactor: ppem / float32(xScale),
+		yFactor: ppem / float32(yScale),
+	}
+}
+
+// pixelPen maps glyph outlines from scaled units (y up) to the pixels of
+// a rasterizer (y down), with the glyph origin at (x, y).
+type pixelPen struct {
+	r                *Rasterizer
+	x, y             float32
+	xFactor, yFactor float32
+}
+
+func (p *pixelPen) pt(x, y float32) (float32, float32) {
+	return p.x + x*p.xFactor, p.y - y*p.yFactor
+}
+
+func (p *pixelPen) MoveTo(x, y float32) {
+	p.r.MoveTo(p.pt(x, y))
+}
+
+func (p *pixelPen) LineTo(x, y float32) {
+	p.r.LineTo(p.pt(x, y))
+}
+
+func (p *pixelPen) QuadTo(cx, cy, x, y float32) {
+	cx, cy = p.pt(cx, cy)
+	x, y = p.pt(x, y)
+	p.r.QuadTo(cx, cy, x, y)
+}
+
+func (p *pixelPen) CubeTo(c1x, c1y, c2x, c2y, x, y float32) {
+	c1x, c1y = p.pt(c1x, c1y)
+	c2x, c2y = p.pt(c2x, c2y)
+	x, y = p.pt(x, y)
+	p.r.CubeTo(c1x, c1y, c2x, c2y, x, y)
+}
+
+func (p *pixelPen) Close() {
+	p.r.Close()
+}
+
+// GlyphMask renders a glyph with its origin at the pixel position (x, y),
+// y growing downwards. The bounds of the mask are the pixels the glyph
+// covers, in the same coordinates. Empty glyphs give an empty mask.
+func (r *Renderer) GlyphMask(glyph ot.GlyphID, x, y float32) (*image.Alpha, error) {
+	path, err := r.shaper.GlyphOutline(glyph)
+	if err != nil {
+		return nil, err
+	}
+	xMin, yMin, xMax, yMax, ok := path.Bounds()
+	if !ok {
+		return &image.Alpha{Rect: image.Rect(int(x), int(y), int(x), int(y))}, nil
+	}
+
+	// The control box contains the outline; y flips
+	bounds := image.Rect(
+		int(math.Floor(float64(x+xMin*r.xFactor))),
+		int(math.Floor(float64(y-yMax*r.yFactor))),
+		int(math.Ceil(float64(x+xMax*r.xFactor))),
+		int(math.Ceil(float64(y-yMin*r.yFactor))),
+	)
+	z := NewRasterizer(bounds.Dx(), bounds.Dy())
+	path.Draw(&pixelPen{
+		r:       z,
+		x:       x - float32(bounds.Min.X),
+		y:       y - float32(bounds.Min.Y),
+		xFactor: r.xFactor,
+		yFactor: r.yFactor,
+	})
+	z.Close()
+	mask := image.NewAlpha(bounds)
+	z.Draw(mask)
+	return mask, nil
+}
+
+// glyphOrigins calls fn with the pixel origin of every glyph of buf, for
+// a run starting at (x, y). Advances and offsets are in scaled units with
+// y growing upwards, as the shaper returns them.
+func (r *Renderer) glyphOrigins(buf *ot.Buffer, x, y float32, fn func(i int, x, y float32) error) error {
+	for i, pos := range buf.Pos {
+		gx := x + float32(pos.XOffset)*r.xFactor
+		gy := y - float32(pos.YOffset)*r.yFactor
+		if err := fn(i, gx, gy); err != nil {
+			return err
+		}
+		x += float32(pos.XAdvance) * r.xFactor
+		y -= float32(pos.YAdvance) * r.yFactor
+	}
+	return nil
+}
+
+// DrawGlyph draws a glyph with its origin at (x, y) into dst, filling the
+// covered pixels with src.
+func (r *Renderer) DrawGlyph(dst draw.Image, src image.Image, glyph ot.GlyphID, x, y float32) error {
+	mask, err := r.GlyphMask(glyph, x, y)
+	if err != nil {
+		return err
+	}
+	draw.DrawMask(dst, mask.Rect, src, mask.Rect.Min, mask, mask.Rect.Min, draw.Over)
+	return nil
+}
+
+// DrawBuffer draws a shaped buffer into dst, filling the covered pixels
+// with src. The run starts at (x, y): the left end of the baseline for
+// horizontal text, the top of the vertical line for vertical text. Glyphs
+// are drawn in buffer order, which is visual order for right-to-left text.
+func (r *Renderer) DrawBuffer(dst draw.Image, src image.Image, buf *ot.Buffer, x, y float32) error {
+	return r.glyphOrigins(buf, x, y, func(i int, gx, gy float32) error {
+		return r.DrawGlyph(dst, src, buf.Info[i].GlyphID, gx, gy)
+	})
+}
+
+// Mask renders a shaped buffer into a mask. The run starts at (0, 0), see
+// DrawBuffer; the bounds of the mask are the pixels the glyphs cover.
+func (r *Renderer) Mask(buf *ot.Buffer) (*image.Alpha, error) {
+	masks := make([]*image.Alpha, 0, len(buf.Info))
+	var bounds image.Rectangle
+	err := r.glyphOrigins(buf, 0, 0, func(i int, gx, gy float32) error {
+		mask, err := r.GlyphMask(buf.Info[i].GlyphID, gx, gy)
+		if err != nil {
+			return err
+		}
+		masks = append(masks, mask)
+		bounds = bounds.Union(mask.Rect)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	dst := image.NewAlpha(bounds)
+	for _, mask := range masks {
+		draw.DrawMask(dst, mask.Rect, image.Opaque, image.Point{}, mask, mask.Rect.Min, draw.Over)
+	}
+	return dst, nil
+}
@@ -55,6 +55,13 @@ func (r *sidRemap) add(sid int, origStrings []string) int {
 	return newIdx + numStdStrings
 }
 
+// addString adds a new string and returns its SID.
+func (r *sidRemap) addString(s string) int {
+	r.strings = append(r.strings, s)
+	r.next++
+	return r.next - 1 + numStdStrings
+}
+
 // get returns the remapped SID for an original SID.
 func (r *sidRemap) get(sid int) int {
 	if sid < numStdStrings || sid == 0 {
@@ -367,17 +374,16 @@ func (p *Plan) subsetCFF() ([]byte, error) {
 		return nil, nil
 	}
 
+	// CID-keyed fonts carry one Private DICT per Font DICT
+	if cff.IsCID {
+		return p.subsetCIDCFF()
+	}
+
 	// 1. Create SID remapping (like HarfBuzz's remap_sid_t)
 	sidmap := newSIDRemap()
 
 	// 2. Collect SIDs from TopDict first (like HarfBuzz: collect_sids_in_dicts)
-	newTopDictSIDs := topDictSIDs{
-		Version:    sidmap.add(cff.TopDict.Version, cff.Strings),
-		Notice:     sidmap.add(cff.TopDict.Notice, cff.Strings),
-		FullName:   sidmap.add(cff.TopDict.FullName, cff.Strings),
-		FamilyName: sidmap.add(cff.TopDict.FamilyName, cff.Strings),
-		Weight:     sidmap.add(cff.TopDict.Weight, cff.Strings),
-	}
+	newTopDictSIDs := collectTopDictSIDs(cff, sidmap)
 
 	// 3. Collect CharStrings for kept glyphs
 	// Like HarfBuzz: only glyphs in glyphSet get their original CharString,
@@ -547,7 +553,13 @@ func buildCFFCharsetWithRemap(origCharset []ot.GlyphID, reverseMap map[ot.GlyphI
 		sids[newGID-1] = sid
 	}
 
-	// 2. Build ranges (for Format 1/2)
+	return buildCharset(sids)
+}
+
+// buildCharset builds a charset from the SIDs (or CIDs) of glyphs 1..n,
+// choosing Format 0, 1, or 2 based on which is smallest.
+func buildCharset(sids []int) []byte {
+	// 1. Build ranges (for Format 1/2)
 	var ranges []charsetRange
 	needsTwoBytes := false
 	i := 0
@@ -565,12 +577,12 @@ func buildCFFCharsetWithRemap(origCharset []ot.GlyphID, reverseMap map[ot.GlyphI
 		i += count
 	}
 
-	// 3. Calculate sizes for each format
-	format0Size := 1 + (numGlyphs-1)*2
+	// 2. Calculate sizes for each format
+	format0Size := 1 + len(sids)*2
 	format1Size := 1 + len(ranges)*3 // first(2) + nLeft(1)
 	format2Size := 1 + len(ranges)*4 // first(2) + nLeft(2)
 
-	// 4. Choose smallest format (like HarfBuzz)
+	// 3. Choose smallest format (like HarfBuzz)
 	// Format 1 can only be used if all nLeft values fit in 1 byte
 	if !needsTwoBytes && format1Size < format0Size {
 		// Use Format 1
@@ -652,24 +664,9 @@ func serializeCFFWithSIDMap(original *ot.CFF, charStrings [][]byte,
 	charStringsINDEX := buildINDEX(charStrings)
 
 	// Private DICT
-	var privateDict bytes.Buffer
-	writePrivateDict(&privateDict, &original.PrivateDict, false, 0)
-
-	// Local Subrs offset calculation
+	privateDict := buildPrivateDict(&original.PrivateDict, len(localSubrs) > 0)
 	localSubrsINDEX := buildINDEX(localSubrs)
-	subrsOperatorSize := 0
-	if len(localSubrs) > 0 {
-		currentLen := privateDict.Len()
-		estimatedOffset := currentLen + 3
-		encodedSize := len(encodeCFFInt(estimatedOffset)) + 1
-		actualOffset := currentLen + encodedSize
-		if actualOffset != estimatedOffset {
-			encodedSize = len(encodeCFFInt(actualOffset)) + 1
-		}
-		subrsOperatorSize = encodedSize
-	}
-
-	privateDictSize := privateDict.Len() + subrsOperatorSize
+	privateDictSize := len(privateDict)
 
 	// Build Top DICT with remapped SIDs (like HarfBuzz)
 	topDictData := buildTopDictWithSIDs(original, topSIDs, 0, 0, privateDictSize, 0)
@@ -735,28 +732,8 @@ func serializeCFFWithSIDMap(original *ot.CFF, charStrings [][]byte,
 	// CharStrings INDEX
 	buf.Write(charStringsINDEX)
 
-	// Private DICT - write with correct Subrs offset
-	privateDict.Reset()
-	subrsOffset := 0
-	if len(localSubrs) > 0 {
-		writePrivateDict(&privateDict, &original.PrivateDict, false, 0)
-		baseSize := privateDict.Len()
-
-		estimatedOffset := baseSize + 3
-		encodedSize := len(encodeCFFInt(estimatedOffset)) + 1
-		actualOffset := baseSize + encodedSize
-		if actualOffset != estimatedOffset {
-			encodedSize = len(encodeCFFInt(actualOffset)) + 1
-			actualOffset = baseSize + encodedSize
-		}
-		subrsOffset = actualOffset
-
-		privateDict.Reset()
-		writePrivateDict(&privateDict, &original.PrivateDict, true, subrsOffset)
-	} else {
-		writePrivateDict(&privateDict, &original.PrivateDict, false, 0)
-	}
-	buf.Write(privateDict.Bytes())
+	// Private DICT
+	buf.Write(privateDict)
 
 	// Local Subrs INDEX
 	if len(localSubrs) > 0 {
@@ -766,6 +743,60 @@ func serializeCFFWithSIDMap(original *ot.CFF, charStrings [][]byte,
 	return buf.Bytes(), nil
 }
 
+// collectTopDictSIDs adds the string SIDs of the Top DICT to sidmap and
+// returns their remapped values.
+func collectTopDictSIDs(cff *ot.CFF, sidmap *sidRemap) topDictSIDs {
+	return topDictSIDs{
+		Version:    sidmap.add(cff.TopDict.Version, cff.Strings),
+		Notice:     sidmap.add(cff.TopDict.Notice, cff.Strings),
+		FullName:   sidmap.add(cff.TopDict.FullName, cff.Strings),
+		FamilyName: sidmap.add(cff.TopDict.FamilyName, cff.Strings),
+		Weight:     sidmap.add(cff.TopDict.Weight, cff.Strings),
+	}
+}
+
+// buildPrivateDict serializes a Private DICT. If hasSubrs is set, a Subrs
+// entry pointing to the Local Subrs INDEX directly after the dict is added.
+func buildPrivateDict(pd *ot.PrivateDict, hasSubrs bool) []byte {
+	var buf bytes.Buffer
+	writePrivateDict(&buf, pd, false, 0)
+	if !hasSubrs {
+		return buf.Bytes()
+	}
+
+	// The Subrs offset is relative to the Private DICT and points past its
+	// end, so the size of its own encoding is part of the value.
+	baseSize := buf.Len()
+	subrsOffset := baseSize + 2
+	for baseSize+len(encodeCFFInt(subrsOffset))+1 != subrsOffset {
+		subrsOffset = baseSize + len(encodeCFFInt(subrsOffset)) + 1
+	}
+	buf.Reset()
+	writePrivateDict(&buf, pd, true, subrsOffset)
+	return buf.Bytes()
+}
+
+// cffTopDictRewritten are the Top DICT operators that hold SIDs, offsets or
+// values that the subsetter writes itself. All other entries (FontMatrix,
+// ItalicAngle, UnderlinePosition, PaintType, ...) are copied as they are.
+var cffTopDictRewritten = []int{
+	0, 1, 2, 3, 4, 5, // version, Notice, FullName, FamilyName, Weight, FontBBox
+	15, 16, 17, 18, // charset, Encoding, CharStrings, Private
+	12<<8 | 0,  // Copyright
+	12<<8 | 20, // SyntheticBase
+	12<<8 | 21, // PostScript
+	12<<8 | 22, // BaseFontName
+	12<<8 | 30, // ROS
+	12<<8 | 34, // CIDCount
+	12<<8 | 36, // FDArray
+	12<<8 | 37, // FDSelect
+	12<<8 | 38, // FontName
+}
+
+// cffFontDictRewritten are the Font DICT operators that the subsetter
+// writes itself: FontName and Private.
+var cffFontDictRewritten = []int{12<<8 | 38, 18}
+
 // buildTopDictWithSIDs creates a Top DICT with remapped SIDs (like HarfBuzz).
 func buildTopDictWithSIDs(original *ot.CFF, sids topDictSIDs, charsetOff, charStringsOff, privateSize, privateOff int) []byte {
 	var buf bytes.Buffer
@@ -787,6 +818,9 @@ func buildTopDictWithSIDs(original *ot.CFF, sids topDictSIDs, charsetOff, charSt
 		writeDictInt(&buf, sids.Weight, 4) // Weight
 	}
 
+	// FontMatrix, ItalicAngle, UnderlinePosition, ... as they are
+	buf.Write(copyDict(original.TopDictData(), cffTopDictRewritten...))
+
 	// FontBBox (operator 5) - REQUIRED
 	writeIntArray(&buf, original.TopDict.FontBBox[:], 5)
 
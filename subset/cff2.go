@@ -0,0 +1,326 @@
+package subset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/boxesandglue/textshape/ot"
+)
+
+// CFF2 DICT operators that hold offsets and are rewritten when serializing.
+const (
+	cff2OpCharStrings = 17
+	cff2OpSubrs       = 19
+	cff2OpVStore      = 24
+	cff2OpFDArray     = 12<<8 | 36
+	cff2OpFDSelect    = 12<<8 | 37
+)
+
+// dictEntry is one operator of a DICT with its operands, as raw bytes.
+type dictEntry struct {
+	op   int
+	data []byte
+}
+
+// dictEntries splits raw DICT data into its entries without decoding the
+// operands, so that blended values can be copied unchanged.
+func dictEntries(data []byte) []dictEntry {
+	var entries []dictEntry
+	start, pos := 0, 0
+	for pos < len(data) {
+		b := data[pos]
+		switch {
+		case b == 28:
+			pos += 3
+		case b == 29 || b == 255:
+			pos += 5
+		case b == 30:
+			pos++
+			for pos < len(data) {
+				nibbles := data[pos]
+				pos++
+				if nibbles&0x0f == 0x0f || nibbles>>4 == 0x0f {
+					break
+				}
+			}
+		case b >= 32 && b <= 246:
+			pos++
+		case b >= 247:
+			pos += 2
+		default:
+			op := int(b)
+			pos++
+			if b == 12 && pos < len(data) {
+				op = 12<<8 | int(data[pos])
+				pos++
+			}
+			if pos > len(data) {
+				pos = len(data)
+			}
+			entries = append(entries, dictEntry{op: op, data: data[start:pos]})
+			start = pos
+		}
+	}
+	return entries
+}
+
+// copyDict returns the raw DICT data without the entries for the given
+// operators.
+func copyDict(data []byte, drop ...int) []byte {
+	var buf bytes.Buffer
+	for _, e := range dictEntries(data) {
+		dropped := false
+		for _, op := range drop {
+			if e.op == op {
+				dropped = true
+				break
+			}
+		}
+		if !dropped {
+			buf.Write(e.data)
+		}
+	}
+	return buf.Bytes()
+}
+
+// buildFDSelect4 builds a Format 4 FDSelect, which has 16-bit Font DICT
+// indices, from the Font DICT index of each glyph.
+func buildFDSelect4(fds []int) []byte {
+	var ranges [][2]int // first glyph, fd
+	for gid, fd := range fds {
+		if len(ranges) == 0 || ranges[len(ranges)-1][1] != fd {
+			ranges = append(ranges, [2]int{gid, fd})
+		}
+	}
+
+	buf := make([]byte, 5+len(ranges)*6+4)
+	buf[0] = 4 // Format 4
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(ranges)))
+	for i, r := range ranges {
+		binary.BigEndian.PutUint32(buf[5+i*6:], uint32(r[0]))
+		binary.BigEndian.PutUint16(buf[5+i*6+4:], uint16(r[1]))
+	}
+	binary.BigEndian.PutUint32(buf[5+len(ranges)*6:], uint32(len(fds))) // sentinel
+	return buf
+}
+
+// buildINDEX2 creates a CFF2 INDEX, which has a 32-bit count. Glyph IDs
+// are 16-bit, so the count always fits the CFF INDEX layout.
+func buildINDEX2(data [][]byte) []byte {
+	return append([]byte{0, 0}, buildINDEX(data)...)
+}
+
+// usedCFF2FontDicts returns the CharString of every output glyph together
+// with the kept Font DICTs and the new Font DICT index of every output
+// glyph. Padding slots (FlagRetainGIDs) get an empty CharString and use the
+// first kept Font DICT.
+func (p *Plan) usedCFF2FontDicts() (charStrings [][]byte, usedFDs []int, newFDs []int) {
+	cff2 := p.cff2
+	charStrings = make([][]byte, p.numOutputGlyphs)
+	glyphFDs := make([]int, p.numOutputGlyphs)
+	used := make(map[int]bool)
+	for newGID := 0; newGID < p.numOutputGlyphs; newGID++ {
+		oldGID, exists := p.reverseMap[ot.GlyphID(newGID)]
+		fd := cff2.FDIndex(oldGID)
+		if exists && p.glyphSet[oldGID] && int(oldGID) < len(cff2.CharStrings) && fd < len(cff2.FDArray) {
+			charStrings[newGID] = cff2.CharStrings[oldGID]
+			glyphFDs[newGID] = fd
+			used[fd] = true
+		} else {
+			glyphFDs[newGID] = -1
+		}
+	}
+
+	for fd := range used {
+		usedFDs = append(usedFDs, fd)
+	}
+	sort.Ints(usedFDs)
+	if len(usedFDs) == 0 && len(cff2.FDArray) > 0 {
+		usedFDs = append(usedFDs, 0)
+	}
+	fdMap := make(map[int]int, len(usedFDs))
+	for newFD, oldFD := range usedFDs {
+		fdMap[oldFD] = newFD
+	}
+
+	newFDs = make([]int, p.numOutputGlyphs)
+	for newGID, fd := range glyphFDs {
+		if fd >= 0 {
+			newFDs[newGID] = fdMap[fd]
+		}
+	}
+	return charStrings, usedFDs, newFDs
+}
+
+// subsetCFF2 creates a subsetted CFF2 table.
+// CharStrings and subroutines are copied unchanged: CFF2 subroutines may
+// contain blends whose stack effect depends on the Font DICT, so they are
+// kept whole. Unused Font DICTs are dropped and FDSelect is remapped. The
+// VariationStore, Top DICT and Private DICT values are copied as they are,
+// with their offsets rewritten.
+func (p *Plan) subsetCFF2() ([]byte, error) {
+	cff2 := p.cff2
+	charStrings, usedFDs, newFDs := p.usedCFF2FontDicts()
+
+	var fdSelect []byte
+	switch {
+	case len(usedFDs) > 256:
+		fdSelect = buildFDSelect4(newFDs)
+	case len(usedFDs) > 1:
+		fdSelect = buildFDSelect(newFDs)
+	}
+
+	// Private DICTs with a fixed-size Subrs offset pointing right behind them
+	privateDicts := make([][]byte, len(usedFDs))
+	localSubrsINDEXes := make([][]byte, len(usedFDs))
+	for i, fd := range usedFDs {
+		private := copyDict(cff2.PrivateDictData(fd), cff2OpSubrs)
+		if subrs := cff2.FDArray[fd].LocalSubrs; len(subrs) > 0 {
+			localSubrsINDEXes[i] = buildINDEX2(subrs)
+			var buf bytes.Buffer
+			buf.Write(private)
+			writeDictOffset(&buf, len(private)+6, cff2OpSubrs)
+			private = buf.Bytes()
+		}
+		privateDicts[i] = private
+	}
+
+	topDict := copyDict(cff2.TopDictData(), cff2OpCharStrings, cff2OpFDArray, cff2OpFDSelect, cff2OpVStore)
+	varStore := cff2.VarStoreData()
+	topSize := len(topDict) + 6 + 7 // CharStrings, FDArray
+	if fdSelect != nil {
+		topSize += 7
+	}
+	if varStore != nil {
+		topSize += 6
+	}
+
+	globalSubrsINDEX := buildINDEX2(cff2.GlobalSubrs)
+	charStringsINDEX := buildINDEX2(charStrings)
+
+	offset := 5 + topSize + len(globalSubrsINDEX)
+	varStoreOffset := offset
+	if varStore != nil {
+		offset += 2 + len(varStore)
+	}
+	fdSelectOffset := offset
+	offset += len(fdSelect)
+	charStringsOffset := offset
+	offset += len(charStringsINDEX)
+	fdArrayOffset := offset
+
+	fontDictData := make([][]byte, len(usedFDs))
+	for i := range usedFDs {
+		fontDictData[i] = buildCIDFontDict(0, nil, len(privateDicts[i]), 0)
+	}
+	offset += len(buildINDEX2(fontDictData))
+	for i := range usedFDs {
+		fontDictData[i] = buildCIDFontDict(0, nil, len(privateDicts[i]), offset)
+		offset += len(privateDicts[i]) + len(localSubrsINDEXes[i])
+	}
+	fdArrayINDEX := buildINDEX2(fontDictData)
+
+	var top bytes.Buffer
+	top.Write(topDict)
+	if varStore != nil {
+		writeDictOffset(&top, varStoreOffset, cff2OpVStore)
+	}
+	if fdSelect != nil {
+		writeDictOffset(&top, fdSelectOffset, cff2OpFDSelect)
+	}
+	writeDictOffset(&top, charStringsOffset, cff2OpCharStrings)
+	writeDictOffset(&top, fdArrayOffset, cff2OpFDArray)
+
+	var buf bytes.Buffer
+	buf.Grow(offset)
+
+	// Header: major, minor, headerSize, topDictLength
+	buf.Write([]byte{2, 0, 5, byte(top.Len() >> 8), byte(top.Len())})
+	buf.Write(top.Bytes())
+	buf.Write(globalSubrsINDEX)
+	if varStore != nil {
+		buf.Write([]byte{byte(len(varStore) >> 8), byte(len(varStore))})
+		buf.Write(varStore)
+	}
+	buf.Write(fdSelect)
+	buf.Write(charStringsINDEX)
+	buf.Write(fdArrayINDEX)
+	for i := range usedFDs {
+		buf.Write(privateDicts[i])
+		buf.Write(localSubrsINDEXes[i])
+	}
+
+	return buf.Bytes(), nil
+}
+
+// instanceCFF2 converts the CFF2 table to a static CID-keyed CFF table at
+// the pinned axis location, since PDF does not allow embedding CFF2.
+// CharStrings are flattened (subroutines inlined,
+// blends resolved) and get the instanced advance width. The CID of every
+// glyph is its original glyph ID.
+func (p *Plan) instanceCFF2() ([]byte, error) {
+	cff2 := p.cff2
+	_, usedFDs, newFDs := p.usedCFF2FontDicts()
+
+	charStrings := make([][]byte, p.numOutputGlyphs)
+	cids := make([]int, 0, p.numOutputGlyphs)
+	for newGID := 0; newGID < p.numOutputGlyphs; newGID++ {
+		oldGID, exists := p.reverseMap[ot.GlyphID(newGID)]
+		if !exists {
+			oldGID = ot.GlyphID(newGID)
+		}
+		if newGID > 0 {
+			cids = append(cids, int(oldGID))
+		}
+		if !exists || !p.glyphSet[oldGID] {
+			charStrings[newGID] = []byte{14} // endchar
+			continue
+		}
+		cs, err := cff2.InstanceCharString(oldGID, p.normalizedCoords)
+		if err != nil {
+			return nil, err
+		}
+		// Private DICTs have defaultWidthX = nominalWidthX = 0
+		if advance := int(p.GetInstancedAdvance(oldGID)); advance != 0 {
+			cs = append(encodeCharStringInt(advance), cs...)
+		}
+		charStrings[newGID] = cs
+	}
+
+	fontDicts := make([]cidFontDict, len(usedFDs))
+	for i, fd := range usedFDs {
+		pd := cff2.PrivateDict(fd, p.normalizedCoords)
+		pd.DefaultWidthX, pd.NominalWidthX = 0, 0
+		fontDicts[i] = cidFontDict{private: &pd}
+	}
+
+	sidmap := newSIDRemap()
+	top := cidTopDict{
+		name:     "Untitled",
+		ros:      [3]int{sidmap.addString("Adobe"), sidmap.addString("Identity"), 0},
+		cidCount: cff2.NumGlyphs(),
+	}
+	if data, err := p.source.TableData(ot.TagName); err == nil {
+		if name, err := ot.ParseName(data); err == nil && name.PostScriptName() != "" {
+			top.name = name.PostScriptName()
+		}
+	}
+	if data, err := p.source.TableData(ot.TagHead); err == nil {
+		if head, err := ot.ParseHead(data); err == nil {
+			top.fontBBox = [4]int{int(head.XMin), int(head.YMin), int(head.XMax), int(head.YMax)}
+		}
+	}
+	top.raw = copyDict(cff2.TopDictData(), cff2OpCharStrings, cff2OpFDArray, cff2OpFDSelect, cff2OpVStore)
+
+	return serializeCIDCFF(top, sidmap, charStrings, nil, buildCharset(cids), buildFDSelect(newFDs), fontDicts), nil
+}
+
+// instancedCFF2Lsb returns the left side bearing of a glyph of an instanced
+// CFF2 font.
+func (p *Plan) instancedCFF2Lsb(gid ot.GlyphID, lsb int16) int16 {
+	if ext, ok := p.cff2.GlyphExtents(gid, p.normalizedCoords); ok {
+		return int16(ext.XBearing)
+	}
+	return lsb
+}
@@ -0,0 +1,353 @@
+package subset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/boxesandglue/textshape/ot"
+)
+
+// cidTopDict holds the Top DICT values of a CID-keyed CFF table that do
+// not depend on the table layout.
+type cidTopDict struct {
+	name     string
+	ros      [3]int // remapped Registry and Ordering SIDs, Supplement
+	sids     topDictSIDs
+	fontBBox [4]int
+	cidCount int
+	raw      []byte // entries copied unchanged (FontMatrix, ItalicAngle, ...)
+}
+
+// cidFontDict is a Font DICT of the subsetted FDArray.
+type cidFontDict struct {
+	fontName   int    // remapped SID, 0 if absent
+	raw        []byte // entries copied unchanged (FontMatrix, ...)
+	private    *ot.PrivateDict
+	localSubrs [][]byte
+}
+
+// subsetCIDCFF creates a subsetted CID-keyed CFF table.
+// Like HarfBuzz's cff1 subsetter for CID fonts:
+// - the charset keeps the CID of every glyph and the ROS is preserved
+// - FDSelect is remapped through the glyph map and unused Font DICTs are dropped
+// - local subroutines are subsetted separately for each kept Font DICT
+func (p *Plan) subsetCIDCFF() ([]byte, error) {
+	cff := p.cff
+
+	sidmap := newSIDRemap()
+	topSIDs := collectTopDictSIDs(cff, sidmap)
+	ros := [3]int{
+		sidmap.add(cff.TopDict.ROS[0], cff.Strings),
+		sidmap.add(cff.TopDict.ROS[1], cff.Strings),
+		cff.TopDict.ROS[2],
+	}
+
+	// 1. Collect CharStrings and the original Font DICT of every kept glyph.
+	// Padding slots (FlagRetainGIDs) get just endchar and no Font DICT.
+	charStrings := make([][]byte, p.numOutputGlyphs)
+	glyphFDs := make([]int, p.numOutputGlyphs)
+	fdCharStrings := make(map[int][][]byte)
+	for newGID := 0; newGID < p.numOutputGlyphs; newGID++ {
+		oldGID, exists := p.reverseMap[ot.GlyphID(newGID)]
+		if !exists {
+			oldGID = ot.GlyphID(newGID)
+		}
+
+		fd := cff.FDIndex(oldGID)
+		if p.glyphSet[oldGID] && int(oldGID) < len(cff.CharStrings) && fd < len(cff.FDArray) {
+			charStrings[newGID] = cff.CharStrings[oldGID]
+			glyphFDs[newGID] = fd
+			fdCharStrings[fd] = append(fdCharStrings[fd], cff.CharStrings[oldGID])
+		} else {
+			charStrings[newGID] = []byte{14} // endchar
+			glyphFDs[newGID] = -1
+		}
+	}
+
+	// 2. Keep only the Font DICTs that are referenced by a kept glyph.
+	usedFDs := make([]int, 0, len(fdCharStrings))
+	for fd := range fdCharStrings {
+		usedFDs = append(usedFDs, fd)
+	}
+	sort.Ints(usedFDs)
+	if len(usedFDs) == 0 && len(cff.FDArray) > 0 {
+		usedFDs = append(usedFDs, 0)
+	}
+	fdMap := make(map[int]int, len(usedFDs))
+	for newFD, oldFD := range usedFDs {
+		fdMap[oldFD] = newFD
+	}
+
+	// 3. Collect the subroutine closure: global subrs over all glyphs,
+	// local subrs per Font DICT.
+	globalClosure := make(map[int]bool)
+	localClosures := make([]map[int]bool, len(usedFDs))
+	for i, fd := range usedFDs {
+		g, l := collectSubrClosure(fdCharStrings[fd], cff.GlobalSubrs, cff.FDArray[fd].LocalSubrs)
+		for n := range g {
+			globalClosure[n] = true
+		}
+		localClosures[i] = l
+	}
+
+	// Local calls inside a global subr resolve against the Font DICT of the
+	// calling glyph. If global subrs call local ones and several Font DICTs
+	// are kept, a single renumbering cannot be right for all of them, so the
+	// local subrs are kept whole.
+	if len(usedFDs) > 1 && globalSubrsCallLocal(cff, globalClosure, usedFDs) {
+		for i, fd := range usedFDs {
+			for n := range cff.FDArray[fd].LocalSubrs {
+				localClosures[i][n] = true
+			}
+		}
+	}
+
+	globalRemap := newSubrRemap()
+	globalRemap.create(globalClosure)
+	localRemaps := make([]*subrRemap, len(usedFDs))
+	for i := range usedFDs {
+		localRemaps[i] = newSubrRemap()
+		localRemaps[i].create(localClosures[i])
+	}
+	oldGlobalBias := calcSubrBias(len(cff.GlobalSubrs))
+
+	// 4. Remap CharStrings with the subroutine numbers of their Font DICT
+	for newGID, fd := range glyphFDs {
+		if fd < 0 {
+			continue
+		}
+		oldLocalBias := calcSubrBias(len(cff.FDArray[fd].LocalSubrs))
+		charStrings[newGID] = remapCharStringSubrs(charStrings[newGID], globalRemap, localRemaps[fdMap[fd]], oldGlobalBias, oldLocalBias)
+	}
+
+	// 5. Build the new subroutine arrays. Local calls inside global subrs
+	// only need remapping when a single Font DICT is kept.
+	var globalLocalRemap *subrRemap
+	globalLocalBias := 0
+	if len(usedFDs) > 0 {
+		globalLocalRemap = localRemaps[0]
+		globalLocalBias = calcSubrBias(len(cff.FDArray[usedFDs[0]].LocalSubrs))
+	}
+	newGlobalSubrs := extractUsedSubrs(cff.GlobalSubrs, globalClosure, globalRemap, globalLocalRemap, oldGlobalBias, globalLocalBias)
+
+	fontDicts := make([]cidFontDict, len(usedFDs))
+	for i, fd := range usedFDs {
+		orig := &cff.FDArray[fd]
+		oldLocalBias := calcSubrBias(len(orig.LocalSubrs))
+		fontDicts[i] = cidFontDict{
+			raw:        copyDict(cff.FontDictData(fd), cffFontDictRewritten...),
+			private:    &orig.PrivateDict,
+			localSubrs: extractUsedSubrs(orig.LocalSubrs, localClosures[i], globalRemap, localRemaps[i], oldGlobalBias, oldLocalBias),
+		}
+		if orig.FontName != 0 {
+			fontDicts[i].fontName = sidmap.add(orig.FontName, cff.Strings)
+		}
+	}
+
+	// 6. Build charset (GID -> CID) and FDSelect for the new glyph order
+	cids := make([]int, 0, p.numOutputGlyphs)
+	for newGID := 1; newGID < p.numOutputGlyphs; newGID++ {
+		oldGID, exists := p.reverseMap[ot.GlyphID(newGID)]
+		if !exists {
+			oldGID = ot.GlyphID(newGID)
+		}
+		cid := newGID
+		if int(oldGID) < len(cff.Charset) {
+			cid = int(cff.Charset[oldGID])
+		}
+		cids = append(cids, cid)
+	}
+	charset := buildCharset(cids)
+
+	newFDs := make([]int, p.numOutputGlyphs)
+	for newGID, fd := range glyphFDs {
+		if fd >= 0 {
+			newFDs[newGID] = fdMap[fd]
+		}
+	}
+	fdSelect := buildFDSelect(newFDs)
+
+	top := cidTopDict{
+		name:     cff.Name,
+		ros:      ros,
+		sids:     topSIDs,
+		fontBBox: cff.TopDict.FontBBox,
+		cidCount: cff.TopDict.CIDCount,
+		raw:      copyDict(cff.TopDictData(), cffTopDictRewritten...),
+	}
+	return serializeCIDCFF(top, sidmap, charStrings, newGlobalSubrs, charset, fdSelect, fontDicts), nil
+}
+
+// globalSubrsCallLocal reports whether any global subr in closure calls a
+// local subr of one of the given Font DICTs.
+func globalSubrsCallLocal(cff *ot.CFF, closure map[int]bool, fds []int) bool {
+	subrs := make([][]byte, 0, len(closure))
+	for n := range closure {
+		subrs = append(subrs, cff.GlobalSubrs[n])
+	}
+	for _, fd := range fds {
+		if _, local := collectSubrClosure(subrs, cff.GlobalSubrs, cff.FDArray[fd].LocalSubrs); len(local) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// buildFDSelect builds a Format 3 FDSelect from the Font DICT index of each glyph.
+func buildFDSelect(fds []int) []byte {
+	var ranges [][2]int // first glyph, fd
+	for gid, fd := range fds {
+		if len(ranges) == 0 || ranges[len(ranges)-1][1] != fd {
+			ranges = append(ranges, [2]int{gid, fd})
+		}
+	}
+
+	buf := make([]byte, 3+len(ranges)*3+2)
+	buf[0] = 3 // Format 3
+	binary.BigEndian.PutUint16(buf[1:], uint16(len(ranges)))
+	for i, r := range ranges {
+		binary.BigEndian.PutUint16(buf[3+i*3:], uint16(r[0]))
+		buf[3+i*3+2] = byte(r[1])
+	}
+	binary.BigEndian.PutUint16(buf[3+len(ranges)*3:], uint16(len(fds))) // sentinel
+	return buf
+}
+
+// serializeCIDCFF writes a CID-keyed CFF table. Offsets in the Top DICT and
+// the Font DICTs are written as 5-byte integers so that the DICT sizes do not
+// depend on the offsets they contain.
+func serializeCIDCFF(top cidTopDict, sidmap *sidRemap, charStrings, globalSubrs [][]byte, charset, fdSelect []byte, fontDicts []cidFontDict) []byte {
+
+	nameINDEX := buildINDEX([][]byte{[]byte(top.name)})
+	stringData := make([][]byte, len(sidmap.strings))
+	for i, s := range sidmap.strings {
+		stringData[i] = []byte(s)
+	}
+	stringINDEX := buildINDEX(stringData)
+	globalSubrsINDEX := buildINDEX(globalSubrs)
+	charStringsINDEX := buildINDEX(charStrings)
+
+	privateDicts := make([][]byte, len(fontDicts))
+	localSubrsINDEXes := make([][]byte, len(fontDicts))
+	for i, fd := range fontDicts {
+		privateDicts[i] = buildPrivateDict(fd.private, len(fd.localSubrs) > 0)
+		if len(fd.localSubrs) > 0 {
+			localSubrsINDEXes[i] = buildINDEX(fd.localSubrs)
+		}
+	}
+
+	// The Top DICT size does not depend on the offsets, so build it once
+	// with placeholders to learn the layout.
+	topDictINDEX := buildINDEX([][]byte{buildCIDTopDict(top, 0, 0, 0, 0)})
+
+	offset := 4 + len(nameINDEX) + len(topDictINDEX) + len(stringINDEX) + len(globalSubrsINDEX)
+	charsetOffset := offset
+	offset += len(charset)
+	fdSelectOffset := offset
+	offset += len(fdSelect)
+	charStringsOffset := offset
+	offset += len(charStringsINDEX)
+	fdArrayOffset := offset
+
+	// FDArray INDEX, followed by each Private DICT and its Local Subrs
+	fontDictData := make([][]byte, len(fontDicts))
+	for i := range fontDicts {
+		fontDictData[i] = buildCIDFontDict(fontDicts[i].fontName, fontDicts[i].raw, len(privateDicts[i]), 0)
+	}
+	offset += len(buildINDEX(fontDictData))
+	for i := range fontDicts {
+		fontDictData[i] = buildCIDFontDict(fontDicts[i].fontName, fontDicts[i].raw, len(privateDicts[i]), offset)
+		offset += len(privateDicts[i]) + len(localSubrsINDEXes[i])
+	}
+	fdArrayINDEX := buildINDEX(fontDictData)
+
+	topDictINDEX = buildINDEX([][]byte{buildCIDTopDict(top, charsetOffset, fdSelectOffset, charStringsOffset, fdArrayOffset)})
+
+	var buf bytes.Buffer
+	buf.Grow(offset)
+
+	// Header (like HarfBuzz: offSize = 4)
+	buf.Write([]byte{1, 0, 4, 4})
+	buf.Write(nameINDEX)
+	buf.Write(topDictINDEX)
+	buf.Write(stringINDEX)
+	buf.Write(globalSubrsINDEX)
+	buf.Write(charset)
+	buf.Write(fdSelect)
+	buf.Write(charStringsINDEX)
+	buf.Write(fdArrayINDEX)
+	for i := range fontDicts {
+		buf.Write(privateDicts[i])
+		buf.Write(localSubrsINDEXes[i])
+	}
+
+	return buf.Bytes()
+}
+
+// buildCIDTopDict creates the Top DICT of a CID-keyed font. ROS must be the
+// first entry.
+func buildCIDTopDict(top cidTopDict, charsetOff, fdSelectOff, charStringsOff, fdArrayOff int) []byte {
+	var buf bytes.Buffer
+
+	// ROS (operator 12 30)
+	writeIntArray(&buf, top.ros[:], 12<<8|30)
+
+	sids := top.sids
+	if sids.Version != 0 {
+		writeDictInt(&buf, sids.Version, 0) // version
+	}
+	if sids.Notice != 0 {
+		writeDictInt(&buf, sids.Notice, 1) // Notice
+	}
+	if sids.FullName != 0 {
+		writeDictInt(&buf, sids.FullName, 2) // FullName
+	}
+	if sids.FamilyName != 0 {
+		writeDictInt(&buf, sids.FamilyName, 3) // FamilyName
+	}
+	if sids.Weight != 0 {
+		writeDictInt(&buf, sids.Weight, 4) // Weight
+	}
+
+	// FontMatrix, ItalicAngle, UnderlinePosition, ... as they are
+	buf.Write(top.raw)
+
+	// FontBBox (operator 5)
+	writeIntArray(&buf, top.fontBBox[:], 5)
+
+	// CIDCount (operator 12 34)
+	writeDictInt(&buf, top.cidCount, 12<<8|34)
+
+	writeDictOffset(&buf, charsetOff, 15)        // charset
+	writeDictOffset(&buf, fdSelectOff, 12<<8|37) // FDSelect
+	writeDictOffset(&buf, charStringsOff, 17)    // CharStrings
+	writeDictOffset(&buf, fdArrayOff, 12<<8|36)  // FDArray
+
+	return buf.Bytes()
+}
+
+// buildCIDFontDict creates a Font DICT for the FDArray. raw holds the
+// entries that are copied unchanged.
+func buildCIDFontDict(fontName int, raw []byte, privateSize, privateOff int) []byte {
+	var buf bytes.Buffer
+	if fontName != 0 {
+		writeDictInt(&buf, fontName, 12<<8|38) // FontName
+	}
+	buf.Write(raw)
+	buf.Write(encodeCFFInt(privateSize))
+	writeDictOffset(&buf, privateOff, 18) // Private
+	return buf.Bytes()
+}
+
+// writeDictOffset writes an offset operand as a fixed-size 5-byte integer
+// followed by an operator.
+func writeDictOffset(buf *bytes.Buffer, off int, op int) {
+	buf.Write([]byte{29, byte(off >> 24), byte(off >> 16), byte(off >> 8), byte(off)})
+	if op >= 256 {
+		buf.WriteByte(12)
+		buf.WriteByte(byte(op & 0xff))
+	} else {
+		buf.WriteByte(byte(op))
+	}
+}
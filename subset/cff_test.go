@@ -1,6 +1,8 @@
 package subset
 
 import (
+	"bytes"
+	"encoding/binary"
 	"os"
 	"testing"
 
@@ -107,6 +109,17 @@ func TestCFFSubsetBasic(t *testing.T) {
 		t.Errorf("Expected at least %d glyphs, got %d", minExpectedGlyphs, subCFF.NumGlyphs())
 	}
 
+	// Top DICT entries without SIDs or offsets are copied
+	cffData, _ := font.TableData(ot.TagCFF)
+	cff, err := ot.ParseCFF(cffData)
+	if err != nil {
+		t.Fatalf("Failed to parse CFF: %v", err)
+	}
+	want := copyDict(cff.TopDictData(), cffTopDictRewritten...)
+	if got := copyDict(subCFF.TopDictData(), cffTopDictRewritten...); len(want) == 0 || !bytes.Equal(got, want) {
+		t.Errorf("Subset Top DICT entries %v, want %v", got, want)
+	}
+
 	// Verify size reduction
 	if len(result) >= len(data) {
 		t.Error("Subset should be smaller than original")
@@ -279,3 +292,515 @@ func TestCFFSubsetRetainGIDs(t *testing.T) {
 	}
 	t.Logf("Subset glyph count with RetainGIDs: %d (min expected: %d)", subCFF.NumGlyphs(), minExpectedGlyphs)
 }
+
+// Top DICT and Font DICT entries of makeCIDKeyedFont that the subsetter
+// copies unchanged: ItalicAngle -12, UnderlinePosition -100,
+// UnderlineThickness 50, PaintType 0, StrokeWidth 0 and FontMatrix
+// [1 0 0 1 0 0] at the top, FontMatrix [0.001 0 0 0.001 0 0] per Font DICT.
+var (
+	cidTopDictRaw = []byte{
+		127, 12, 2, 39, 12, 3, 189, 12, 4, 139, 12, 5, 139, 12, 8,
+		140, 139, 139, 140, 139, 139, 12, 7,
+	}
+	cidFontDictRaw = []byte{
+		30, 0x0a, 0x00, 0x1f, 139, 139, 30, 0x0a, 0x00, 0x1f, 139, 139, 12, 7,
+	}
+)
+
+// makeCIDKeyedFont rebuilds a name-keyed CFF font as a CID-keyed font whose
+// glyphs are split evenly over numFDs Font DICTs. The CID of every glyph is
+// its glyph ID.
+func makeCIDKeyedFont(t *testing.T, font *ot.Font, numFDs int) []byte {
+	t.Helper()
+
+	cffData, _ := font.TableData(ot.TagCFF)
+	cff, err := ot.ParseCFF(cffData)
+	if err != nil {
+		t.Fatalf("Failed to parse CFF: %v", err)
+	}
+
+	sidmap := newSIDRemap()
+	ros := [3]int{sidmap.addString("Adobe"), sidmap.addString("Identity"), 0}
+
+	numGlyphs := len(cff.CharStrings)
+	fds := make([]int, numGlyphs)
+	cids := make([]int, 0, numGlyphs)
+	for gid := range fds {
+		fds[gid] = gid * numFDs / numGlyphs
+		if gid > 0 {
+			cids = append(cids, gid)
+		}
+	}
+	fontDicts := make([]cidFontDict, numFDs)
+	for i := range fontDicts {
+		fontDicts[i] = cidFontDict{raw: cidFontDictRaw, private: &cff.PrivateDict, localSubrs: cff.LocalSubrs}
+	}
+
+	top := cidTopDict{name: cff.Name, ros: ros, fontBBox: cff.TopDict.FontBBox, cidCount: numGlyphs, raw: cidTopDictRaw}
+	cidCFF := serializeCIDCFF(top, sidmap, cff.CharStrings, cff.GlobalSubrs,
+		buildCharset(cids), buildFDSelect(fds), fontDicts)
+
+	builder := NewFontBuilder()
+	for _, tag := range []string{"head", "hhea", "hmtx", "maxp", "cmap", "OS/2", "name", "post"} {
+		tt := ot.MakeTag(tag[0], tag[1], tag[2], tag[3])
+		if data, err := font.TableData(tt); err == nil {
+			builder.AddTable(tt, data)
+		}
+	}
+	builder.AddTable(ot.TagCFF, cidCFF)
+	result, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Failed to build CID font: %v", err)
+	}
+	return result
+}
+
+func TestCFFSubsetCIDKeyed(t *testing.T) {
+	fontPath := testutil.FindTestFont("SourceSansPro-Regular.otf")
+	if fontPath == "" {
+		t.Skip("SourceSansPro-Regular.otf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	origFont, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	cidData := makeCIDKeyedFont(t, origFont, 3)
+	font, err := ot.ParseFont(cidData, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse CID font: %v", err)
+	}
+	cffData, _ := font.TableData(ot.TagCFF)
+	cff, err := ot.ParseCFF(cffData)
+	if err != nil {
+		t.Fatalf("Failed to parse CID CFF: %v", err)
+	}
+	if !cff.IsCID || len(cff.FDArray) != 3 {
+		t.Fatalf("IsCID = %v, %d Font DICTs; want CID font with 3", cff.IsCID, len(cff.FDArray))
+	}
+
+	// Keep glyphs from the first and the last Font DICT only
+	numGlyphs := cff.NumGlyphs()
+	lastGlyph := ot.GlyphID(numGlyphs - 1)
+	if cff.FDIndex(2) != 0 || cff.FDIndex(lastGlyph) != 2 {
+		t.Fatalf("FDIndex(2) = %d, FDIndex(%d) = %d", cff.FDIndex(2), lastGlyph, cff.FDIndex(lastGlyph))
+	}
+
+	input := NewInput()
+	input.AddGlyph(0)
+	input.AddGlyph(2)
+	input.AddGlyph(lastGlyph)
+	plan, err := CreatePlan(font, input)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	result, err := plan.Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute subset: %v", err)
+	}
+
+	subFont, err := ot.ParseFont(result, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse subset font: %v", err)
+	}
+	subCFFData, _ := subFont.TableData(ot.TagCFF)
+	subCFF, err := ot.ParseCFF(subCFFData)
+	if err != nil {
+		t.Fatalf("Failed to parse subset CFF: %v", err)
+	}
+
+	if !subCFF.IsCID {
+		t.Fatal("Subset CFF is not CID-keyed")
+	}
+	if got := subCFF.GetString(subCFF.TopDict.ROS[0]) + "-" + subCFF.GetString(subCFF.TopDict.ROS[1]); got != "Adobe-Identity" {
+		t.Errorf("ROS = %q, want Adobe-Identity", got)
+	}
+	if len(subCFF.FDArray) != 2 {
+		t.Errorf("Subset has %d Font DICTs, want 2 (unused one pruned)", len(subCFF.FDArray))
+	}
+	if !bytes.Contains(subCFF.TopDictData(), cidTopDictRaw) {
+		t.Errorf("Subset Top DICT %v lost entries of %v", subCFF.TopDictData(), cidTopDictRaw)
+	}
+	for fd := range subCFF.FDArray {
+		if !bytes.Contains(subCFF.FontDictData(fd), cidFontDictRaw) {
+			t.Errorf("Subset Font DICT %d %v lost the FontMatrix %v", fd, subCFF.FontDictData(fd), cidFontDictRaw)
+		}
+	}
+
+	glyphMap := plan.GlyphMap()
+	for _, oldGID := range []ot.GlyphID{2, lastGlyph} {
+		newGID := glyphMap[oldGID]
+		if cid := subCFF.Charset[newGID]; cid != oldGID {
+			t.Errorf("glyph %d: CID = %d, want %d", oldGID, cid, oldGID)
+		}
+		wantFD := 0
+		if oldGID == lastGlyph {
+			wantFD = 1
+		}
+		if fd := subCFF.FDIndex(newGID); fd != wantFD {
+			t.Errorf("glyph %d: FD = %d, want %d", oldGID, fd, wantFD)
+		}
+	}
+
+	// Every local subr call still resolves within the glyph's Font DICT
+	for gid, cs := range subCFF.CharStrings {
+		localSubrs := subCFF.GlyphLocalSubrs(ot.GlyphID(gid))
+		_, closure := collectSubrClosure([][]byte{cs}, subCFF.GlobalSubrs, localSubrs)
+		for n := range closure {
+			if n >= len(localSubrs) {
+				t.Errorf("glyph %d calls local subr %d of %d", gid, n, len(localSubrs))
+			}
+		}
+	}
+
+	// With a single Font DICT left, only the used local subrs are kept
+	input = NewInput()
+	input.AddGlyph(2)
+	plan, err = CreatePlan(font, input)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	result, err = plan.Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute subset: %v", err)
+	}
+	subFont, _ = ot.ParseFont(result, 0)
+	subCFFData, _ = subFont.TableData(ot.TagCFF)
+	subCFF, err = ot.ParseCFF(subCFFData)
+	if err != nil {
+		t.Fatalf("Failed to parse subset CFF: %v", err)
+	}
+	if len(subCFF.FDArray) != 1 {
+		t.Fatalf("Subset has %d Font DICTs, want 1", len(subCFF.FDArray))
+	}
+	localSubrs := subCFF.FDArray[0].LocalSubrs
+	_, closure := collectSubrClosure(subCFF.CharStrings, subCFF.GlobalSubrs, localSubrs)
+	if len(closure) != len(localSubrs) || len(localSubrs) >= len(cff.FDArray[0].LocalSubrs) {
+		t.Errorf("Subset keeps %d local subrs, %d used, %d in original", len(localSubrs), len(closure), len(cff.FDArray[0].LocalSubrs))
+	}
+}
+
+// charString encodes a Type 2 CharString. Operands are ints, operators are
+// given as []byte.
+func charString(items ...interface{}) []byte {
+	var cs []byte
+	for _, item := range items {
+		switch v := item.(type) {
+		case int:
+			cs = append(cs, encodeCharStringInt(v)...)
+		case []byte:
+			cs = append(cs, v...)
+		}
+	}
+	return cs
+}
+
+// makeCFF2Font builds a variable CFF2 font with a weight axis (400-900,
+// default 400) and three glyphs. Glyphs 0 and 2 use Font DICT 1, glyph 1
+// uses Font DICT 0, whose BlueValues vary with the weight. FDSelect has
+// Format 4.
+func makeCFF2Font(t *testing.T) []byte {
+	t.Helper()
+
+	fontPath := testutil.FindTestFont("SourceSansPro-Regular.otf")
+	if fontPath == "" {
+		t.Skip("SourceSansPro-Regular.otf not found")
+	}
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+	baseFont, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	const (
+		hlineto   = 6
+		rlineto   = 5
+		rrcurveto = 8
+		callsubr  = 10
+		blend     = 16
+		hstemhm   = 18
+		hintmask  = 19
+		rmoveto   = 21
+		vstemhm   = 23
+		callgsubr = 29
+	)
+	op := func(b ...byte) []byte { return b }
+	charStrings := [][]byte{
+		{},
+		charString(50, 0, -10, 0, 2, op(blend), op(rmoveto),
+			400, 100, 1, op(blend), 700, -400, -100, 1, op(blend), op(hlineto)),
+		charString(0, 20, op(hstemhm), 100, 50, op(vstemhm), op(hintmask, 0xC0),
+			-107, op(callsubr), -107, op(callgsubr), 200, 100, 1, op(blend), 0, op(rlineto)),
+	}
+	globalSubrs := [][]byte{charString(0, 200, 100, 100, 100, -100, op(rrcurveto))}
+	localSubrs := [][]byte{charString(100, 100, op(rmoveto))}
+
+	// VariationStore: one region peaking at the maximum weight
+	varStore := []byte{
+		0, 1, 0, 0, 0, 12, 0, 1, 0, 0, 0, 22, // format, region list, 1 ItemVariationData
+		0, 1, 0, 1, 0, 0, 0x40, 0, 0x40, 0, // 1 axis, 1 region (0, 1, 1)
+		0, 0, 0, 0, 0, 1, 0, 0, // no items, 1 region
+	}
+
+	var private0 bytes.Buffer
+	for _, v := range []int{-10, 10, 0, 4, 2} {
+		private0.Write(encodeCFFInt(v))
+	}
+	private0.Write([]byte{23, 6}) // blend BlueValues
+	var private1 bytes.Buffer
+	writeDictOffset(&private1, 6, 19) // Subrs
+
+	gsubrsINDEX := buildINDEX2(globalSubrs)
+	fdSelect := buildFDSelect4([]int{1, 0, 1})
+	charStringsINDEX := buildINDEX2(charStrings)
+	fdArraySize := len(buildINDEX2([][]byte{
+		buildCIDFontDict(0, nil, private0.Len(), 0), buildCIDFontDict(0, nil, private1.Len(), 0),
+	}))
+
+	varStoreOff := 5 + 26 + len(gsubrsINDEX)
+	fdSelectOff := varStoreOff + 2 + len(varStore)
+	charStringsOff := fdSelectOff + len(fdSelect)
+	fdArrayOff := charStringsOff + len(charStringsINDEX)
+	private0Off := fdArrayOff + fdArraySize
+	private1Off := private0Off + private0.Len()
+
+	var top bytes.Buffer
+	writeDictOffset(&top, varStoreOff, 24)
+	writeDictOffset(&top, fdSelectOff, 12<<8|37)
+	writeDictOffset(&top, charStringsOff, 17)
+	writeDictOffset(&top, fdArrayOff, 12<<8|36)
+
+	var cff2 bytes.Buffer
+	cff2.Write([]byte{2, 0, 5, 0, byte(top.Len())})
+	cff2.Write(top.Bytes())
+	cff2.Write(gsubrsINDEX)
+	cff2.Write([]byte{0, byte(len(varStore))})
+	cff2.Write(varStore)
+	cff2.Write(fdSelect)
+	cff2.Write(charStringsINDEX)
+	cff2.Write(buildINDEX2([][]byte{
+		buildCIDFontDict(0, nil, private0.Len(), private0Off), buildCIDFontDict(0, nil, private1.Len(), private1Off),
+	}))
+	cff2.Write(private0.Bytes())
+	cff2.Write(private1.Bytes())
+	cff2.Write(buildINDEX2(localSubrs))
+
+	fvar := []byte{
+		0, 1, 0, 0, 0, 16, 0, 2, 0, 1, 0, 20, 0, 0, 0, 8, // header
+		'w', 'g', 'h', 't', 1, 0x90, 0, 0, 1, 0x90, 0, 0, 3, 0x84, 0, 0, 0, 0, 1, 0, // wght 400 400 900
+	}
+
+	builder := NewFontBuilder()
+	for _, tag := range []ot.Tag{ot.TagHead, ot.TagHhea, ot.TagMaxp} {
+		data, _ := baseFont.TableData(tag)
+		data = append([]byte{}, data...)
+		switch tag {
+		case ot.TagHhea:
+			data[34], data[35] = 0, 3 // numberOfHMetrics
+		case ot.TagMaxp:
+			data[4], data[5] = 0, 3 // numGlyphs
+		}
+		builder.AddTable(tag, data)
+	}
+	builder.AddTable(ot.TagHmtx, []byte{1, 0xF4, 0, 0, 1, 0xF4, 0, 50, 1, 0xF4, 0, 100})
+	builder.AddTable(ot.TagFvar, fvar)
+	builder.AddTable(ot.TagCFF2, cff2.Bytes())
+	result, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Failed to build CFF2 font: %v", err)
+	}
+	return result
+}
+
+func TestCFF2(t *testing.T) {
+	font, err := ot.ParseFont(makeCFF2Font(t), 0)
+	if err != nil {
+		t.Fatalf("Failed to parse CFF2 font: %v", err)
+	}
+	face, err := ot.NewFace(font)
+	if err != nil {
+		t.Fatalf("Failed to create face: %v", err)
+	}
+	if !face.IsCFF() {
+		t.Error("IsCFF() = false for a CFF2 font")
+	}
+
+	cff2Data, _ := font.TableData(ot.TagCFF2)
+	cff2, err := ot.ParseCFF2(cff2Data)
+	if err != nil {
+		t.Fatalf("Failed to parse CFF2: %v", err)
+	}
+	if cff2.NumGlyphs() != 3 || len(cff2.FDArray) != 2 || cff2.FDIndex(1) != 0 || cff2.FDIndex(2) != 1 {
+		t.Fatalf("%d glyphs, %d Font DICTs, FDIndex(1) = %d, FDIndex(2) = %d",
+			cff2.NumGlyphs(), len(cff2.FDArray), cff2.FDIndex(1), cff2.FDIndex(2))
+	}
+
+	for _, tc := range []struct {
+		coords []int
+		want   ot.GlyphExtents
+	}{
+		{nil, ot.GlyphExtents{XBearing: 50, YBearing: 700, Width: 400, Height: -700}},
+		{[]int{16384}, ot.GlyphExtents{XBearing: 40, YBearing: 700, Width: 500, Height: -700}},
+	} {
+		if got, ok := cff2.GlyphExtents(1, tc.coords); !ok || got != tc.want {
+			t.Errorf("GlyphExtents(1, %v) = %+v, want %+v", tc.coords, got, tc.want)
+		}
+	}
+
+	var path ot.Path
+	if err := cff2.GlyphOutline(2, []int{8192}, &path); err != nil {
+		t.Fatalf("GlyphOutline: %v", err)
+	}
+	wantPath := ot.Path{
+		{Op: ot.PathMoveTo, Args: [6]float32{100, 100}},
+		{Op: ot.PathCubeTo, Args: [6]float32{100, 300, 200, 400, 300, 300}},
+		{Op: ot.PathLineTo, Args: [6]float32{550, 300}},
+		{Op: ot.PathClose},
+	}
+	if len(path) != len(wantPath) {
+		t.Fatalf("GlyphOutline(2) = %v, want %v", path, wantPath)
+	}
+	for i := range path {
+		if path[i] != wantPath[i] {
+			t.Errorf("segment %d = %v, want %v", i, path[i], wantPath[i])
+		}
+	}
+
+	if pd := cff2.PrivateDict(0, []int{8192}); len(pd.BlueValues) != 2 || pd.BlueValues[0] != -10 || pd.BlueValues[1] != 12 {
+		t.Errorf("blended BlueValues = %v, want [-10 12]", pd.BlueValues)
+	}
+
+	// FDSelect must not point past the FDArray
+	fdSelectOff := int(binary.BigEndian.Uint32(cff2Data[5+6+1:])) // second Top DICT entry
+	corrupt := append([]byte{}, cff2Data...)
+	binary.BigEndian.PutUint16(corrupt[fdSelectOff+5+4:], 2)
+	if _, err := ot.ParseCFF2(corrupt); err == nil {
+		t.Error("ParseCFF2 accepted an FDSelect with Font DICT 2 of 2")
+	}
+}
+
+func TestCFF2Subset(t *testing.T) {
+	font, err := ot.ParseFont(makeCFF2Font(t), 0)
+	if err != nil {
+		t.Fatalf("Failed to parse CFF2 font: %v", err)
+	}
+
+	// Glyphs 0 and 2 share a Font DICT, so the other one is dropped
+	input := NewInput()
+	input.AddGlyph(2)
+	plan, err := CreatePlan(font, input)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	result, err := plan.Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute subset: %v", err)
+	}
+	subFont, err := ot.ParseFont(result, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse subset font: %v", err)
+	}
+	if subFont.HasTable(ot.TagCFF) {
+		t.Error("Non-instanced subset should not have a CFF table")
+	}
+	if !subFont.HasTable(ot.TagFvar) {
+		t.Error("Non-instanced subset should keep fvar")
+	}
+	subData, err := subFont.TableData(ot.TagCFF2)
+	if err != nil {
+		t.Fatalf("Subset has no CFF2 table: %v", err)
+	}
+	subCFF2, err := ot.ParseCFF2(subData)
+	if err != nil {
+		t.Fatalf("Failed to parse subset CFF2: %v", err)
+	}
+	if subCFF2.NumGlyphs() != 2 || len(subCFF2.FDArray) != 1 || subCFF2.FDSelect != nil {
+		t.Errorf("subset: %d glyphs, %d Font DICTs, FDSelect %v; want 2 glyphs and 1 Font DICT",
+			subCFF2.NumGlyphs(), len(subCFF2.FDArray), subCFF2.FDSelect)
+	}
+	var want, got ot.Path
+	cff2Data, _ := font.TableData(ot.TagCFF2)
+	cff2, _ := ot.ParseCFF2(cff2Data)
+	cff2.GlyphOutline(2, []int{16384}, &want)
+	if err := subCFF2.GlyphOutline(1, []int{16384}, &got); err != nil || len(got) != len(want) {
+		t.Fatalf("subset outline = %v (%v), want %v", got, err, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("segment %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	// Limiting axis ranges is not supported for CFF2
+	input = NewInput()
+	input.LimitAxisRange(ot.MakeTag('w', 'g', 'h', 't'), 400, 400, 700)
+	if _, err := CreatePlan(font, input); err != ErrCFF2AxisLimits {
+		t.Errorf("CreatePlan with limited axes: err = %v, want %v", err, ErrCFF2AxisLimits)
+	}
+}
+
+func TestCFF2Instance(t *testing.T) {
+	font, err := ot.ParseFont(makeCFF2Font(t), 0)
+	if err != nil {
+		t.Fatalf("Failed to parse CFF2 font: %v", err)
+	}
+
+	input := NewInput()
+	input.AddGlyphs(1, 2)
+	input.PinAxisLocation(ot.MakeTag('w', 'g', 'h', 't'), 650)
+	plan, err := CreatePlan(font, input)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	result, err := plan.Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute subset: %v", err)
+	}
+	subFont, err := ot.ParseFont(result, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse instanced font: %v", err)
+	}
+	if subFont.HasTable(ot.TagCFF2) || subFont.HasTable(ot.TagFvar) {
+		t.Error("Instanced font should not have CFF2 or fvar tables")
+	}
+	cffData, err := subFont.TableData(ot.TagCFF)
+	if err != nil {
+		t.Fatalf("Instanced font has no CFF table: %v", err)
+	}
+	cff, err := ot.ParseCFF(cffData)
+	if err != nil {
+		t.Fatalf("Failed to parse instanced CFF: %v", err)
+	}
+	if !cff.IsCID || cff.NumGlyphs() != 3 || len(cff.FDArray) != 2 {
+		t.Fatalf("IsCID = %v, %d glyphs, %d Font DICTs; want CID font with 3 glyphs and 2 Font DICTs",
+			cff.IsCID, cff.NumGlyphs(), len(cff.FDArray))
+	}
+	if cid := cff.Charset[2]; cid != 2 {
+		t.Errorf("CID of glyph 2 = %d, want 2", cid)
+	}
+
+	want := charString(500, 0, 20, []byte{18}, 100, 50, []byte{23}, []byte{19, 0xC0},
+		100, 100, []byte{21}, 0, 200, 100, 100, 100, -100, []byte{8}, 250, 0, []byte{5}, []byte{14})
+	if got := cff.CharStrings[2]; !bytes.Equal(got, want) {
+		t.Errorf("instanced CharString = %v, want %v", got, want)
+	}
+	if bv := cff.FDArray[cff.FDIndex(1)].PrivateDict.BlueValues; len(bv) != 2 || bv[0] != -10 || bv[1] != 12 {
+		t.Errorf("instanced BlueValues = %v, want [-10 12]", bv)
+	}
+
+	face, err := ot.NewFace(subFont)
+	if err != nil {
+		t.Fatalf("Failed to create face: %v", err)
+	}
+	if !face.IsCFF() {
+		t.Error("IsCFF() = false for the instanced font")
+	}
+}
@@ -0,0 +1,492 @@
+package subset
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/boxesandglue/textshape/ot"
+)
+
+// This file implements subsetting of (chaining) context subtables. GSUB
+// types 5/6 and GPOS types 7/8 share the same binary layout, so both
+// builders convert their parsed subtables into a contextSubtable and use
+// the functions below.
+// HarfBuzz equivalent: ContextFormat1/2/3 and ChainContextFormat1/2/3
+// subset() in hb-ot-layout-gsubgpos.hh
+
+// contextSubtable is a table-independent view of a context or chaining
+// context subtable. For plain context subtables the backtrack and lookahead
+// parts are empty.
+type contextSubtable struct {
+	chain  bool
+	format uint16
+
+	// Formats 1 and 2
+	coverage *ot.Coverage
+	ruleSets [][]contextRule // Indexed by coverage index (1) or input class (2)
+
+	// Format 2
+	backtrackClassDef *ot.ClassDef
+	inputClassDef     *ot.ClassDef
+	lookaheadClassDef *ot.ClassDef
+
+	// Format 3
+	backtrackCoverages []*ot.Coverage
+	inputCoverages     []*ot.Coverage
+	lookaheadCoverages []*ot.Coverage
+	lookupRecords      []ot.LookupRecord
+}
+
+// contextRule is a single (chaining) context rule. The input sequence does
+// not include the first glyph, which is matched by the coverage table.
+type contextRule struct {
+	backtrack     []ot.GlyphID
+	input         []ot.GlyphID
+	lookahead     []ot.GlyphID
+	lookupRecords []ot.LookupRecord
+}
+
+// contextSubsetter subsets context subtables with a fixed glyph and lookup mapping.
+type contextSubsetter struct {
+	glyphMap  map[ot.GlyphID]ot.GlyphID
+	lookupMap map[uint16]uint16
+}
+
+// subset returns the serialized subsetted subtable, or nil if nothing can
+// match anymore. ErrOffsetOverflow is returned if the subtable does not fit
+// its 16-bit offsets.
+func (s *contextSubsetter) subset(c *contextSubtable) ([]byte, error) {
+	switch c.format {
+	case 1:
+		return s.subsetFormat1(c)
+	case 2:
+		return s.subsetFormat2(c)
+	case 3:
+		return s.subsetFormat3(c)
+	}
+	return nil, nil
+}
+
+// remapGlyphs remaps a glyph sequence. It returns false if any glyph was dropped.
+func (s *contextSubsetter) remapGlyphs(glyphs []ot.GlyphID) ([]ot.GlyphID, bool) {
+	out := make([]ot.GlyphID, len(glyphs))
+	for i, g := range glyphs {
+		newG, ok := s.glyphMap[g]
+		if !ok {
+			return nil, false
+		}
+		out[i] = newG
+	}
+	return out, true
+}
+
+// remapLookupRecords remaps nested lookup indices, dropping records whose
+// lookup was not retained.
+func (s *contextSubsetter) remapLookupRecords(records []ot.LookupRecord) []ot.LookupRecord {
+	out := make([]ot.LookupRecord, 0, len(records))
+	for _, r := range records {
+		if newIdx, ok := s.lookupMap[r.LookupIndex]; ok {
+			out = append(out, ot.LookupRecord{SequenceIndex: r.SequenceIndex, LookupIndex: newIdx})
+		}
+	}
+	return out
+}
+
+// remapCoverage remaps a coverage table and returns the sorted new glyphs.
+func (s *contextSubsetter) remapCoverage(cov *ot.Coverage) []ot.GlyphID {
+	var glyphs []ot.GlyphID
+	for _, g := range cov.Glyphs() {
+		if newG, ok := s.glyphMap[g]; ok {
+			glyphs = append(glyphs, newG)
+		}
+	}
+	sort.Slice(glyphs, func(i, j int) bool { return glyphs[i] < glyphs[j] })
+	return glyphs
+}
+
+// contextRuleSetEntry holds a remapped format 1 rule set and its first glyph.
+type contextRuleSetEntry struct {
+	firstGlyph ot.GlyphID
+	rules      []contextRule
+}
+
+func (s *contextSubsetter) subsetFormat1(c *contextSubtable) ([]byte, error) {
+	if c.coverage == nil {
+		return nil, nil
+	}
+
+	var sets []contextRuleSetEntry
+	for i, g := range c.coverage.Glyphs() {
+		newFirst, ok := s.glyphMap[g]
+		if !ok || i >= len(c.ruleSets) {
+			continue
+		}
+
+		var rules []contextRule
+		for _, rule := range c.ruleSets[i] {
+			backtrack, ok1 := s.remapGlyphs(rule.backtrack)
+			input, ok2 := s.remapGlyphs(rule.input)
+			lookahead, ok3 := s.remapGlyphs(rule.lookahead)
+			if !ok1 || !ok2 || !ok3 {
+				continue
+			}
+			rules = append(rules, contextRule{
+				backtrack:     backtrack,
+				input:         input,
+				lookahead:     lookahead,
+				lookupRecords: s.remapLookupRecords(rule.lookupRecords),
+			})
+		}
+
+		if len(rules) > 0 {
+			sets = append(sets, contextRuleSetEntry{newFirst, rules})
+		}
+	}
+
+	if len(sets) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(sets, func(i, j int) bool { return sets[i].firstGlyph < sets[j].firstGlyph })
+
+	glyphs := make([]ot.GlyphID, len(sets))
+	ruleSets := make([][]contextRule, len(sets))
+	for i, set := range sets {
+		glyphs[i] = set.firstGlyph
+		ruleSets[i] = set.rules
+	}
+	return buildContextRuleSets(1, c.chain, buildCoverageFormat1(glyphs), nil, ruleSets)
+}
+
+func (s *contextSubsetter) subsetFormat2(c *contextSubtable) ([]byte, error) {
+	if c.coverage == nil || c.inputClassDef == nil {
+		return nil, nil
+	}
+
+	covGlyphs := s.remapCoverage(c.coverage)
+	if len(covGlyphs) == 0 {
+		return nil, nil
+	}
+
+	inputClasses, inputLive := s.remapClassDef(c.inputClassDef)
+	var backtrackClasses, lookaheadClasses []classEntry
+	var backtrackLive, lookaheadLive map[uint16]bool
+	if c.chain {
+		backtrackClasses, backtrackLive = s.remapClassDef(c.backtrackClassDef)
+		lookaheadClasses, lookaheadLive = s.remapClassDef(c.lookaheadClassDef)
+	}
+
+	// Drop rules that reference classes without any retained glyph.
+	ruleSets := make([][]contextRule, len(c.ruleSets))
+	hasRules := false
+	for class, rules := range c.ruleSets {
+		if !inputLive[uint16(class)] {
+			continue
+		}
+		for _, rule := range rules {
+			if !classesLive(rule.input, inputLive) ||
+				!classesLive(rule.backtrack, backtrackLive) ||
+				!classesLive(rule.lookahead, lookaheadLive) {
+				continue
+			}
+			ruleSets[class] = append(ruleSets[class], contextRule{
+				backtrack:     rule.backtrack,
+				input:         rule.input,
+				lookahead:     rule.lookahead,
+				lookupRecords: s.remapLookupRecords(rule.lookupRecords),
+			})
+			hasRules = true
+		}
+	}
+	if !hasRules {
+		return nil, nil
+	}
+
+	// Trailing empty rule sets can be dropped entirely.
+	for len(ruleSets) > 0 && len(ruleSets[len(ruleSets)-1]) == 0 {
+		ruleSets = ruleSets[:len(ruleSets)-1]
+	}
+
+	classDefs := [][]byte{buildClassDefFormat2(inputClasses)}
+	if c.chain {
+		classDefs = [][]byte{
+			buildClassDefFormat2(backtrackClasses),
+			classDefs[0],
+			buildClassDefFormat2(lookaheadClasses),
+		}
+	}
+
+	return buildContextRuleSets(2, c.chain, buildCoverageFormat1(covGlyphs), classDefs, ruleSets)
+}
+
+// remapClassDef remaps a ClassDef and reports which classes still contain
+// at least one retained glyph. Class 0 is always considered live.
+func (s *contextSubsetter) remapClassDef(cd *ot.ClassDef) ([]classEntry, map[uint16]bool) {
+	live := map[uint16]bool{0: true}
+	if cd == nil {
+		return nil, live
+	}
+	var entries []classEntry
+	for glyph, class := range cd.Mapping() {
+		if newG, ok := s.glyphMap[glyph]; ok {
+			entries = append(entries, classEntry{newG, class})
+			live[class] = true
+		}
+	}
+	return entries, live
+}
+
+// classesLive returns true if every class in the sequence is live.
+func classesLive(classes []ot.GlyphID, live map[uint16]bool) bool {
+	for _, c := range classes {
+		if !live[uint16(c)] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *contextSubsetter) subsetFormat3(c *contextSubtable) ([]byte, error) {
+	if len(c.inputCoverages) == 0 {
+		return nil, nil
+	}
+
+	remapAll := func(covs []*ot.Coverage) ([][]byte, bool) {
+		out := make([][]byte, len(covs))
+		for i, cov := range covs {
+			glyphs := s.remapCoverage(cov)
+			if len(glyphs) == 0 {
+				return nil, false
+			}
+			out[i] = buildCoverageFormat1(glyphs)
+		}
+		return out, true
+	}
+
+	backtrack, ok1 := remapAll(c.backtrackCoverages)
+	input, ok2 := remapAll(c.inputCoverages)
+	lookahead, ok3 := remapAll(c.lookaheadCoverages)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, nil
+	}
+
+	records := s.remapLookupRecords(c.lookupRecords)
+
+	if !c.chain {
+		// Format 3: format(2) + glyphCount(2) + seqLookupCount(2) +
+		//           coverageOffsets[](2*n) + seqLookupRecords[](4*m)
+		headerSize := 6 + len(input)*2 + len(records)*4
+		return buildCoverageArrays(headerSize, [][][]byte{input}, func(data []byte, covOffsets [][]uint16) {
+			binary.BigEndian.PutUint16(data[0:], 3)
+			binary.BigEndian.PutUint16(data[2:], uint16(len(input)))
+			binary.BigEndian.PutUint16(data[4:], uint16(len(records)))
+			off := 6
+			for _, o := range covOffsets[0] {
+				binary.BigEndian.PutUint16(data[off:], o)
+				off += 2
+			}
+			writeLookupRecords(data[off:], records)
+		})
+	}
+
+	// Format 3: format(2) + backtrackCount(2) + backtrackOffsets[] +
+	//           inputCount(2) + inputOffsets[] + lookaheadCount(2) + lookaheadOffsets[] +
+	//           seqLookupCount(2) + seqLookupRecords[]
+	headerSize := 2 + 2 + len(backtrack)*2 + 2 + len(input)*2 + 2 + len(lookahead)*2 + 2 + len(records)*4
+	return buildCoverageArrays(headerSize, [][][]byte{backtrack, input, lookahead}, func(data []byte, covOffsets [][]uint16) {
+		binary.BigEndian.PutUint16(data[0:], 3)
+		off := 2
+		for _, offsets := range covOffsets {
+			binary.BigEndian.PutUint16(data[off:], uint16(len(offsets)))
+			off += 2
+			for _, o := range offsets {
+				binary.BigEndian.PutUint16(data[off:], o)
+				off += 2
+			}
+		}
+		binary.BigEndian.PutUint16(data[off:], uint16(len(records)))
+		writeLookupRecords(data[off+2:], records)
+	})
+}
+
+// buildCoverageArrays lays out a subtable header of headerSize bytes followed
+// by the given groups of coverage tables. writeHeader receives the offsets of
+// every coverage table, grouped like the input. ErrOffsetOverflow is returned
+// if a coverage table starts beyond 16-bit offsets.
+func buildCoverageArrays(headerSize int, groups [][][]byte, writeHeader func(data []byte, offsets [][]uint16)) ([]byte, error) {
+	covData := make([]byte, 0)
+	offsets := make([][]uint16, len(groups))
+	for i, group := range groups {
+		offsets[i] = make([]uint16, len(group))
+		for j, cov := range group {
+			covOff := headerSize + len(covData)
+			if covOff > 0xFFFF {
+				return nil, ErrOffsetOverflow
+			}
+			offsets[i][j] = uint16(covOff)
+			covData = append(covData, cov...)
+		}
+	}
+
+	data := make([]byte, headerSize+len(covData))
+	writeHeader(data, offsets)
+	copy(data[headerSize:], covData)
+	return data, nil
+}
+
+// buildContextRuleSets serializes format 1 or 2 context subtables.
+// classDefs holds the input ClassDef (context) or the backtrack, input and
+// lookahead ClassDefs (chaining context) for format 2, and is nil for format 1.
+// ErrOffsetOverflow is returned if the subtable does not fit 16-bit offsets.
+func buildContextRuleSets(format uint16, chain bool, coverage []byte, classDefs [][]byte, ruleSets [][]contextRule) ([]byte, error) {
+	// Header: format(2) + coverageOffset(2) + classDefOffsets[](2*n) + ruleSetCount(2) + ruleSetOffsets[]
+	headerSize := 4 + len(classDefs)*2 + 2 + len(ruleSets)*2
+
+	ruleSetData := make([]byte, 0)
+	ruleSetOffsets := make([]uint16, len(ruleSets))
+
+	for i, rules := range ruleSets {
+		if len(rules) == 0 {
+			continue // NULL offset
+		}
+		ruleSetOff := headerSize + len(ruleSetData)
+		if ruleSetOff > 0xFFFF {
+			return nil, ErrOffsetOverflow
+		}
+		ruleSet, err := buildContextRuleSet(chain, rules)
+		if err != nil {
+			return nil, err
+		}
+		ruleSetOffsets[i] = uint16(ruleSetOff)
+		ruleSetData = append(ruleSetData, ruleSet...)
+	}
+
+	// The coverage and ClassDefs follow the rule sets; the last ClassDef
+	// has the largest offset
+	coverageOff := headerSize + len(ruleSetData)
+	classDefOffsets := make([]uint16, len(classDefs))
+	tail := append([]byte{}, coverage...)
+	lastOff := coverageOff
+	for i, cd := range classDefs {
+		lastOff = coverageOff + len(tail)
+		classDefOffsets[i] = uint16(lastOff)
+		tail = append(tail, cd...)
+	}
+	if lastOff > 0xFFFF {
+		return nil, ErrOffsetOverflow
+	}
+
+	data := make([]byte, coverageOff+len(tail))
+	binary.BigEndian.PutUint16(data[0:], format)
+	binary.BigEndian.PutUint16(data[2:], uint16(coverageOff))
+	off := 4
+	for _, cdOff := range classDefOffsets {
+		binary.BigEndian.PutUint16(data[off:], cdOff)
+		off += 2
+	}
+	binary.BigEndian.PutUint16(data[off:], uint16(len(ruleSets)))
+	off += 2
+	for _, rsOff := range ruleSetOffsets {
+		binary.BigEndian.PutUint16(data[off:], rsOff)
+		off += 2
+	}
+
+	copy(data[headerSize:], ruleSetData)
+	copy(data[coverageOff:], tail)
+
+	return data, nil
+}
+
+// buildContextRuleSet serializes a (Chained)SequenceRuleSet.
+// ErrOffsetOverflow is returned if a rule starts beyond 16-bit offsets.
+func buildContextRuleSet(chain bool, rules []contextRule) ([]byte, error) {
+	// RuleSet: ruleCount(2) + ruleOffsets[](2*n) + Rule tables
+	headerSize := 2 + len(rules)*2
+
+	ruleData := make([]byte, 0)
+	ruleOffsets := make([]uint16, len(rules))
+
+	for i, rule := range rules {
+		ruleOff := headerSize + len(ruleData)
+		if ruleOff > 0xFFFF {
+			return nil, ErrOffsetOverflow
+		}
+		ruleOffsets[i] = uint16(ruleOff)
+		ruleData = append(ruleData, buildContextRule(chain, rule)...)
+	}
+
+	data := make([]byte, headerSize+len(ruleData))
+	binary.BigEndian.PutUint16(data[0:], uint16(len(rules)))
+	for i, off := range ruleOffsets {
+		binary.BigEndian.PutUint16(data[2+i*2:], off)
+	}
+	copy(data[headerSize:], ruleData)
+
+	return data, nil
+}
+
+// buildContextRule serializes a (Chained)SequenceRule.
+func buildContextRule(chain bool, rule contextRule) []byte {
+	if !chain {
+		// Rule: glyphCount(2) + seqLookupCount(2) + inputSequence[](2*(n-1)) + seqLookupRecords[](4*m)
+		data := make([]byte, 4+len(rule.input)*2+len(rule.lookupRecords)*4)
+		binary.BigEndian.PutUint16(data[0:], uint16(len(rule.input)+1))
+		binary.BigEndian.PutUint16(data[2:], uint16(len(rule.lookupRecords)))
+		off := 4
+		off += writeGlyphArray(data[off:], rule.input)
+		writeLookupRecords(data[off:], rule.lookupRecords)
+		return data
+	}
+
+	// ChainRule: backtrackCount(2) + backtrack[] + inputCount(2) + input[] +
+	//            lookaheadCount(2) + lookahead[] + seqLookupCount(2) + seqLookupRecords[]
+	size := 8 + (len(rule.backtrack)+len(rule.input)+len(rule.lookahead))*2 + len(rule.lookupRecords)*4
+	data := make([]byte, size)
+	off := 0
+	binary.BigEndian.PutUint16(data[off:], uint16(len(rule.backtrack)))
+	off += 2
+	off += writeGlyphArray(data[off:], rule.backtrack)
+	binary.BigEndian.PutUint16(data[off:], uint16(len(rule.input)+1))
+	off += 2
+	off += writeGlyphArray(data[off:], rule.input)
+	binary.BigEndian.PutUint16(data[off:], uint16(len(rule.lookahead)))
+	off += 2
+	off += writeGlyphArray(data[off:], rule.lookahead)
+	binary.BigEndian.PutUint16(data[off:], uint16(len(rule.lookupRecords)))
+	off += 2
+	writeLookupRecords(data[off:], rule.lookupRecords)
+	return data
+}
+
+// writeGlyphArray writes glyph IDs (or class values) and returns the number of bytes written.
+func writeGlyphArray(data []byte, glyphs []ot.GlyphID) int {
+	for i, g := range glyphs {
+		binary.BigEndian.PutUint16(data[i*2:], uint16(g))
+	}
+	return len(glyphs) * 2
+}
+
+// writeLookupRecords writes SequenceLookupRecords.
+func writeLookupRecords(data []byte, records []ot.LookupRecord) {
+	for i, r := range records {
+		binary.BigEndian.PutUint16(data[i*4:], r.SequenceIndex)
+		binary.BigEndian.PutUint16(data[i*4+2:], r.LookupIndex)
+	}
+}
+
+// contextLookupIndices returns all nested lookup indices referenced by a
+// context subtable.
+func contextLookupIndices(c *contextSubtable) []uint16 {
+	var indices []uint16
+	for _, rules := range c.ruleSets {
+		for _, rule := range rules {
+			for _, r := range rule.lookupRecords {
+				indices = append(indices, r.LookupIndex)
+			}
+		}
+	}
+	for _, r := range c.lookupRecords {
+		indices = append(indices, r.LookupIndex)
+	}
+	return indices
+}
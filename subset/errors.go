@@ -9,6 +9,17 @@ var (
 	// ErrMissingTable is returned when a required table is missing.
 	ErrMissingTable = errors.New("subset: required table missing")
 
+	// ErrInvalidTable is returned for malformed source table data.
+	ErrInvalidTable = errors.New("subset: invalid table data")
+
 	// ErrInvalidGlyph is returned for invalid glyph references.
 	ErrInvalidGlyph = errors.New("subset: invalid glyph reference")
+
+	// ErrOffsetOverflow is returned when a subsetted table does not fit its
+	// 16-bit offsets.
+	ErrOffsetOverflow = errors.New("subset: offset overflow")
+
+	// ErrCFF2AxisLimits is returned when limiting axis ranges of a CFF2 font,
+	// which is not supported. Axes of CFF2 fonts can only be pinned.
+	ErrCFF2AxisLimits = errors.New("subset: limiting axis ranges of CFF2 fonts is not supported")
 )
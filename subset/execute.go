@@ -45,6 +45,17 @@ func (p *Plan) Execute() ([]byte, error) {
 		}
 	}
 
+	// Subset CFF2 if present, or convert it to CFF when instancing
+	if p.source.HasTable(ot.TagCFF2) && p.cff2 != nil {
+		if p.IsInstanced() {
+			if cffData, err := p.instanceCFF2(); err == nil {
+				builder.AddTable(ot.TagCFF, cffData)
+			}
+		} else if cff2Data, err := p.subsetCFF2(); err == nil {
+			builder.AddTable(ot.TagCFF2, cff2Data)
+		}
+	}
+
 	// Subset cmap
 	if err := p.subsetCmap(builder); err != nil {
 		return nil, err
@@ -55,14 +66,22 @@ func (p *Plan) Execute() ([]byte, error) {
 	if p.input.Flags&FlagDropLayoutTables == 0 {
 		// Subset GSUB (with glyph ID remapping)
 		if p.gsub != nil {
-			if gsubData, err := p.subsetGSUB(); err == nil && gsubData != nil {
+			gsubData, err := p.subsetGSUB()
+			if err != nil {
+				return nil, err
+			}
+			if gsubData != nil {
 				builder.AddTable(ot.TagGSUB, gsubData)
 			}
 		}
 
 		// Subset GPOS (with glyph ID remapping)
 		if p.gpos != nil {
-			if gposData, err := p.subsetGPOS(); err == nil && gposData != nil {
+			gposData, err := p.subsetGPOS()
+			if err != nil {
+				return nil, err
+			}
+			if gposData != nil {
 				builder.AddTable(ot.TagGPOS, gposData)
 			}
 		}
@@ -130,7 +149,7 @@ func (p *Plan) subsetHhea(builder *FontBuilder) error {
 	// Update numberOfHMetrics (we'll have one per glyph for simplicity)
 	binary.BigEndian.PutUint16(newData[34:], uint16(p.numOutputGlyphs))
 
-	builder.AddTable(ot.TagHhea, newData)
+	builder.AddTable(ot.TagHhea, p.applyMvarShifts(ot.TagHhea, newData))
 	return nil
 }
 
@@ -153,12 +172,17 @@ func (p *Plan) subsetHmtx(builder *FontBuilder) error {
 
 		// Use instanced advance if available (includes HVAR deltas)
 		var advance uint16
-		if p.IsInstanced() {
+		if p.IsInstanced() || p.IsPartiallyInstanced() {
 			advance = p.GetInstancedAdvance(oldGID)
 		} else {
 			advance = p.hmtx.GetAdvanceWidth(oldGID)
 		}
 		_, lsb := p.hmtx.GetMetrics(oldGID)
+		if (p.IsInstanced() || p.IsPartiallyInstanced()) && p.glyf != nil {
+			lsb = p.instancedLsb(oldGID, lsb)
+		} else if p.IsInstanced() && p.cff2 != nil {
+			lsb = p.instancedCFF2Lsb(oldGID, lsb)
+		}
 
 		off := newGID * 4
 		binary.BigEndian.PutUint16(newData[off:], advance)
@@ -170,7 +194,8 @@ func (p *Plan) subsetHmtx(builder *FontBuilder) error {
 }
 
 // subsetGlyf subsets the glyf and loca tables.
-// When instancing (axes are pinned), gvar deltas are applied to glyph outlines.
+// When instancing (axes are pinned), gvar deltas are applied to glyph outlines
+// and composite component offsets, and bounding boxes are recomputed.
 func (p *Plan) subsetGlyf(builder *FontBuilder) error {
 	if p.glyf == nil {
 		return ErrMissingTable
@@ -194,22 +219,10 @@ func (p *Plan) subsetGlyf(builder *FontBuilder) error {
 			continue
 		}
 
-		// Apply gvar deltas when instancing
-		if p.IsInstanced() && len(glyphBytes) >= 10 {
-			numberOfContours := int16(glyphBytes[0])<<8 | int16(glyphBytes[1])
-			if numberOfContours > 0 {
-				// Simple glyph - parse points and apply deltas
-				points, _, err := ot.ParseSimpleGlyph(glyphBytes)
-				if err == nil && len(points) > 0 {
-					// Use GetGlyphDeltasWithCoords for proper IUP interpolation
-					xDeltas, yDeltas := p.GetGlyphDeltasWithCoords(oldGID, len(points), points)
-					if xDeltas != nil && yDeltas != nil {
-						glyphBytes = ot.InstanceSimpleGlyph(glyphBytes, xDeltas, yDeltas)
-					}
-				}
-			}
-			// Composite glyphs: component transforms may need adjustment
-			// but for now we just pass them through unchanged
+		// Apply gvar deltas when instancing (or move the outline to the new
+		// default location when axis ranges are limited)
+		if p.IsInstanced() || p.IsPartiallyInstanced() {
+			glyphBytes = p.instanceGlyph(oldGID).glyph
 		}
 
 		// Remap composite glyph component IDs
@@ -486,7 +499,11 @@ func (p *Plan) handleOptionalTables(builder *FontBuilder) {
 				continue
 			}
 			if p.source.HasTable(tag) {
-				if data, err := p.source.TableData(tag); err == nil {
+				data, err := p.source.TableData(tag)
+				if tag == ot.TagCvt && p.IsPartiallyInstanced() {
+					data, _, err = p.limitCvar()
+				}
+				if err == nil {
 					builder.AddTable(tag, data)
 				}
 			}
@@ -496,11 +513,11 @@ func (p *Plan) handleOptionalTables(builder *FontBuilder) {
 	// Copy OS/2 if present (important for metrics)
 	if !p.input.ShouldDropTable(ot.TagOS2) && p.source.HasTable(ot.TagOS2) {
 		if data, err := p.source.TableData(ot.TagOS2); err == nil {
-			builder.AddTable(ot.TagOS2, data)
+			builder.AddTable(ot.TagOS2, p.applyMvarShifts(ot.TagOS2, data))
 		}
 	}
 
-	// Variation tables - drop when instanced (axes pinned), otherwise pass through
+	// Variation tables - drop when instanced (axes pinned), otherwise keep
 	variationTables := []ot.Tag{
 		ot.TagFvar,
 		ot.TagAvar,
@@ -512,17 +529,37 @@ func (p *Plan) handleOptionalTables(builder *FontBuilder) {
 		ot.TagCvar,
 	}
 	if !p.IsInstanced() {
-		// Keep variation tables if not instancing
+		// A font that is not fully instanced stays variable. Tables indexed
+		// by glyph ID are subsetted, the others do not depend on the glyph
+		// set. A partially instanced font rebases them onto the limited axes.
 		for _, tag := range variationTables {
-			if p.input.ShouldDropTable(tag) {
+			if p.input.ShouldDropTable(tag) || !p.source.HasTable(tag) {
 				continue
 			}
-			if p.input.ShouldPassThrough(tag) || p.input.Flags&FlagPassUnrecognized != 0 {
-				if p.source.HasTable(tag) {
-					if data, err := p.source.TableData(tag); err == nil {
-						builder.AddTable(tag, data)
-					}
+			// cvar varies the cvt table, which goes with the hinting
+			if tag == ot.TagCvar && p.input.Flags&FlagNoHinting != 0 {
+				continue
+			}
+			var data []byte
+			var err error
+			switch tag {
+			case ot.TagGvar:
+				data, err = p.subsetGvar()
+			case ot.TagHvar:
+				data, err = p.subsetMetricsVar(tag, 3)
+			case ot.TagVvar:
+				data, err = p.subsetMetricsVar(tag, 4)
+			case ot.TagFvar, ot.TagAvar, ot.TagSTAT, ot.TagMvar, ot.TagCvar:
+				if p.IsPartiallyInstanced() {
+					data, err = p.limitVariationTable(tag)
+				} else {
+					data, err = p.source.TableData(tag)
 				}
+			default:
+				data, err = p.source.TableData(tag)
+			}
+			if err == nil && data != nil {
+				builder.AddTable(tag, data)
 			}
 		}
 	}
@@ -540,6 +577,9 @@ func (p *Plan) handleOptionalTables(builder *FontBuilder) {
 		}
 		if p.input.ShouldPassThrough(tag) || p.input.Flags&FlagPassUnrecognized != 0 {
 			if data, err := p.source.TableData(tag); err == nil {
+				if tag == ot.TagPost {
+					data = p.applyMvarShifts(tag, data)
+				}
 				builder.AddTable(tag, data)
 			}
 		}
@@ -14,14 +14,42 @@ func (p *Plan) subsetGDEF() ([]byte, error) {
 	}
 
 	builder := newGDEFBuilder(p.glyphMap, p.glyphSet, p.gdef)
+	if p.layoutVarStore != nil && len(p.layoutVarStore.data) > 0 {
+		builder.varStore = p.layoutVarStore.build()
+	}
 	return builder.build()
 }
 
+// gdefVarStore parses the ItemVariationStore of the source GDEF table
+// (version 1.3) for subsetting. It returns nil if there is none.
+func (p *Plan) gdefVarStore() *itemVariationStore {
+	if p.gdef == nil {
+		return nil
+	}
+	if _, minor := p.gdef.Version(); minor < 3 {
+		return nil
+	}
+	data, err := p.source.TableData(ot.TagGDEF)
+	if err != nil || len(data) < 18 {
+		return nil
+	}
+	off := binary.BigEndian.Uint32(data[14:])
+	if off == 0 || int(off) >= len(data) {
+		return nil
+	}
+	store, err := parseItemVariationStore(data[off:])
+	if err != nil {
+		return nil
+	}
+	return store
+}
+
 // gdefBuilder builds a subsetted GDEF table.
 type gdefBuilder struct {
 	glyphMap map[ot.GlyphID]ot.GlyphID
 	glyphSet map[ot.GlyphID]bool
 	gdef     *ot.GDEF
+	varStore []byte // Serialized ItemVariationStore, nil to drop it
 }
 
 func newGDEFBuilder(glyphMap map[ot.GlyphID]ot.GlyphID, glyphSet map[ot.GlyphID]bool, gdef *ot.GDEF) *gdefBuilder {
@@ -35,6 +63,13 @@ func newGDEFBuilder(glyphMap map[ot.GlyphID]ot.GlyphID, glyphSet map[ot.GlyphID]
 func (b *gdefBuilder) build() ([]byte, error) {
 	major, minor := b.gdef.Version()
 
+	// Version 1.3 adds the ItemVariationStore; without one, write 1.2.
+	if len(b.varStore) > 0 {
+		minor = 3
+	} else if minor >= 3 {
+		minor = 2
+	}
+
 	// Build individual components
 	var glyphClassDef, attachList, ligCaretList, markAttachClassDef, markGlyphSetsDef []byte
 
@@ -63,6 +98,9 @@ func (b *gdefBuilder) build() ([]byte, error) {
 	if minor >= 2 {
 		headerSize = 14 // + markGlyphSetsDefOffset(2)
 	}
+	if minor >= 3 {
+		headerSize = 18 // + itemVarStoreOffset(4)
+	}
 
 	// Calculate offsets
 	offset := headerSize
@@ -97,6 +135,13 @@ func (b *gdefBuilder) build() ([]byte, error) {
 		offset += len(markGlyphSetsDef)
 	}
 
+	// The store comes last; its offset is 32-bit
+	varStoreOffset := uint32(0)
+	if minor >= 3 {
+		varStoreOffset = uint32(offset)
+		offset += len(b.varStore)
+	}
+
 	// Build final table
 	totalSize := offset
 	data := make([]byte, totalSize)
@@ -112,6 +157,9 @@ func (b *gdefBuilder) build() ([]byte, error) {
 	if minor >= 2 {
 		binary.BigEndian.PutUint16(data[12:], markGlyphSetsDefOffset)
 	}
+	if minor >= 3 {
+		binary.BigEndian.PutUint32(data[14:], varStoreOffset)
+	}
 
 	// Copy component data
 	off := headerSize
@@ -133,6 +181,10 @@ func (b *gdefBuilder) build() ([]byte, error) {
 	}
 	if minor >= 2 && len(markGlyphSetsDef) > 0 {
 		copy(data[off:], markGlyphSetsDef)
+		off += len(markGlyphSetsDef)
+	}
+	if minor >= 3 {
+		copy(data[off:], b.varStore)
 	}
 
 	return data, nil
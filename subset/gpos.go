@@ -2,62 +2,119 @@ package subset
 
 import (
 	"encoding/binary"
+	"math"
 	"sort"
 
 	"github.com/boxesandglue/textshape/ot"
 )
 
 // subsetGPOS creates a subsetted GPOS table with remapped glyph IDs.
+// Like subsetGSUB, all features retained by Input.ShouldKeepFeature are kept
+// together with their lookups and nested context lookups.
 func (p *Plan) subsetGPOS() ([]byte, error) {
 	if p.gpos == nil {
 		return nil, nil
 	}
 
-	// Get the 'kern' feature's lookups
 	featList, err := p.gpos.ParseFeatureList()
 	if err != nil {
 		return nil, nil
 	}
+	scriptList, _ := p.gpos.ParseScriptList()
 
-	kernLookups := featList.FindFeature(ot.TagKern)
-	if len(kernLookups) == 0 {
-		return nil, nil
+	builder := newGPOSBuilder(p.glyphMap, p.glyphSet)
+	variations, applied := p.featureVariations(featList, p.gpos.GetFeatureVariations())
+	lookups := p.gposLookupIndices(featList, variations, applied)
+
+	store := p.gdefVarStore()
+	if store != nil {
+		builder.usedVarIdx = make(map[uint32]bool)
 	}
 
-	builder := newGPOSBuilder(p.glyphMap, p.glyphSet)
+	// First pass: find the lookups that still have content after subsetting
+	// and assign them new indices, preserving the original order. This also
+	// collects the variation indices the retained subtables reference.
+	lookupMap := make(map[uint16]uint16)
+	for _, lookupIdx := range lookups {
+		if lookup := p.gpos.GetLookup(int(lookupIdx)); lookup != nil && builder.subsetLookup(lookup) != nil {
+			lookupMap[lookupIdx] = uint16(len(lookupMap))
+		}
+	}
 
-	// Only process lookups referenced by 'kern' feature
-	for _, lookupIdx := range kernLookups {
-		lookup := p.gpos.GetLookup(int(lookupIdx))
-		if lookup == nil {
-			continue
+	// Keep only the referenced delta sets of the GDEF ItemVariationStore,
+	// as for HVAR. subsetGDEF writes the store. A partially instanced font
+	// bakes the deltas at the new default into the values, a fully
+	// instanced one those at the instance and drops the store.
+	if store != nil {
+		p.layoutVarStore, builder.varIdxMap = store.subset(builder.usedVarIdx)
+		builder.usedVarIdx = nil
+		switch {
+		case p.IsInstanced():
+			_, builder.varIdxShifts = p.layoutVarStore.limit(p.instanceLimits())
+			p.layoutVarStore = nil
+			builder.dropDevices = true
+		case p.IsPartiallyInstanced():
+			p.layoutVarStore, builder.varIdxShifts = p.layoutVarStore.limit(p.tupleLimits())
 		}
+	}
 
-		subsetLookup := builder.subsetLookup(lookup)
-		if subsetLookup != nil {
-			builder.addLookup(subsetLookup)
+	// Second pass: serialize the retained lookups. Nested lookup indices in
+	// context subtables are remapped through lookupMap.
+	builder.lookupMap = lookupMap
+	for _, lookupIdx := range lookups {
+		if _, ok := lookupMap[lookupIdx]; ok {
+			builder.addLookup(builder.subsetLookup(p.gpos.GetLookup(int(lookupIdx))))
 		}
 	}
 
-	// If no lookups remain, return nil (don't include empty GPOS)
-	if len(builder.lookups) == 0 {
+	builder.features, builder.scripts, builder.variations = p.subsetFeaturesAndScripts(featList, scriptList, lookupMap, variations, applied)
+
+	// If no features remain, return nil (don't include empty GPOS)
+	if len(builder.features) == 0 {
 		return nil, nil
 	}
 
 	return builder.build()
 }
 
-// gposBuilder builds a subsetted GPOS table.
-type gposBuilder struct {
-	glyphMap map[ot.GlyphID]ot.GlyphID
-	glyphSet map[ot.GlyphID]bool
-	lookups  []*gposLookupBuilder
+// gposLookupIndices returns the sorted indices of all lookups referenced by
+// retained features, including their feature variations and lookups that
+// are only reachable as nested lookups of context subtables.
+func (p *Plan) gposLookupIndices(featList *ot.FeatureList, variations []featureVariation, applied map[uint16][]uint16) []uint16 {
+	return lookupClosure(p.featureLookups(featList, variations, applied), func(idx uint16) []uint16 {
+		lookup := p.gpos.GetLookup(int(idx))
+		if lookup == nil {
+			return nil
+		}
+		var nested []uint16
+		for _, st := range lookup.Subtables() {
+			if c := gposContextSubtable(st); c != nil {
+				nested = append(nested, contextLookupIndices(c)...)
+			}
+		}
+		return nested
+	})
 }
 
-type gposLookupBuilder struct {
-	lookupType uint16
-	flag       uint16
-	subtables  [][]byte
+// gposBuilder builds a subsetted GPOS table.
+type gposBuilder struct {
+	glyphMap   map[ot.GlyphID]ot.GlyphID
+	glyphSet   map[ot.GlyphID]bool
+	lookupMap  map[uint16]uint16 // Old->new lookup indices for nested lookups
+	lookups    []*lookupBuilder
+	features   []featureRecord
+	scripts    []scriptRecord
+	variations []featureVariation
+
+	// Variation indices of VariationIndex tables: usedVarIdx collects them
+	// in the first pass, varIdxMap remaps them into the subsetted GDEF
+	// ItemVariationStore in the second. varIdxShifts holds the deltas at
+	// the new default of a partially instanced font, by new index, or at
+	// the instance of a fully instanced one, which sets dropDevices.
+	usedVarIdx   map[uint32]bool
+	varIdxMap    map[uint32]uint32
+	varIdxShifts [][]float64
+	dropDevices  bool
 }
 
 func newGPOSBuilder(glyphMap map[ot.GlyphID]ot.GlyphID, glyphSet map[ot.GlyphID]bool) *gposBuilder {
@@ -67,19 +124,21 @@ func newGPOSBuilder(glyphMap map[ot.GlyphID]ot.GlyphID, glyphSet map[ot.GlyphID]
 	}
 }
 
-func (b *gposBuilder) addLookup(lookup *gposLookupBuilder) {
+func (b *gposBuilder) addLookup(lookup *lookupBuilder) {
 	b.lookups = append(b.lookups, lookup)
 }
 
 // subsetLookup subsets a single lookup, returning nil if empty.
-func (b *gposBuilder) subsetLookup(lookup *ot.GPOSLookup) *gposLookupBuilder {
-	lb := &gposLookupBuilder{
+func (b *gposBuilder) subsetLookup(lookup *ot.GPOSLookup) *lookupBuilder {
+	lb := &lookupBuilder{
 		lookupType: lookup.Type,
 		flag:       lookup.Flag,
+		markFilter: lookup.MarkFilter,
 	}
 
 	for _, subtable := range lookup.Subtables() {
 		var data []byte
+		var err error
 
 		switch st := subtable.(type) {
 		case *ot.SinglePos:
@@ -94,20 +153,114 @@ func (b *gposBuilder) subsetLookup(lookup *ot.GPOSLookup) *gposLookupBuilder {
 			data = b.subsetMarkLigPos(st)
 		case *ot.MarkMarkPos:
 			data = b.subsetMarkMarkPos(st)
-			// TODO: Context, ChainContext
+		case *ot.ContextPos, *ot.ChainContextPos:
+			cs := &contextSubsetter{glyphMap: b.glyphMap, lookupMap: b.lookupMap}
+			data, err = cs.subset(gposContextSubtable(st))
+		}
+		if err != nil {
+			lb.err = err
 		}
 
 		if data != nil && len(data) > 0 {
 			lb.subtables = append(lb.subtables, data)
+			// Extension lookups keep their wrapper; the parser resolved the
+			// actual type, which we recover from the subtable.
+			if lookup.Type == ot.GPOSTypeExtension {
+				lb.extensionType = gposSubtableType(subtable)
+			}
 		}
 	}
 
-	if len(lb.subtables) == 0 {
+	if len(lb.subtables) == 0 && lb.err == nil {
 		return nil
 	}
 	return lb
 }
 
+// gposSubtableType returns the lookup type of a parsed GPOS subtable.
+func gposSubtableType(st ot.GPOSSubtable) uint16 {
+	switch st.(type) {
+	case *ot.SinglePos:
+		return ot.GPOSTypeSingle
+	case *ot.PairPos:
+		return ot.GPOSTypePair
+	case *ot.CursivePos:
+		return ot.GPOSTypeCursive
+	case *ot.MarkBasePos:
+		return ot.GPOSTypeMarkBase
+	case *ot.MarkLigPos:
+		return ot.GPOSTypeMarkLig
+	case *ot.MarkMarkPos:
+		return ot.GPOSTypeMarkMark
+	case *ot.ContextPos:
+		return ot.GPOSTypeContext
+	case *ot.ChainContextPos:
+		return ot.GPOSTypeChainContext
+	}
+	return 0
+}
+
+// gposContextSubtable converts a GPOS context or chaining context subtable
+// into the shared representation. It returns nil for other subtable types.
+func gposContextSubtable(st ot.GPOSSubtable) *contextSubtable {
+	switch st := st.(type) {
+	case *ot.ContextPos:
+		c := &contextSubtable{
+			format:         st.Format(),
+			coverage:       st.Coverage(),
+			inputClassDef:  st.ClassDef(),
+			inputCoverages: st.InputCoverages(),
+			lookupRecords:  gposLookupRecords(st.LookupRecords()),
+		}
+		for _, rules := range st.RuleSets() {
+			set := make([]contextRule, len(rules))
+			for i, r := range rules {
+				set[i] = contextRule{input: r.Input, lookupRecords: gposLookupRecords(r.LookupRecords)}
+			}
+			c.ruleSets = append(c.ruleSets, set)
+		}
+		return c
+
+	case *ot.ChainContextPos:
+		c := &contextSubtable{
+			chain:              true,
+			format:             st.Format(),
+			coverage:           st.Coverage(),
+			backtrackClassDef:  st.BacktrackClassDef(),
+			inputClassDef:      st.InputClassDef(),
+			lookaheadClassDef:  st.LookaheadClassDef(),
+			backtrackCoverages: st.BacktrackCoverages(),
+			inputCoverages:     st.InputCoverages(),
+			lookaheadCoverages: st.LookaheadCoverages(),
+			lookupRecords:      gposLookupRecords(st.LookupRecords()),
+		}
+		for _, rules := range st.ChainRuleSets() {
+			set := make([]contextRule, len(rules))
+			for i, r := range rules {
+				set[i] = contextRule{
+					backtrack:     r.Backtrack,
+					input:         r.Input,
+					lookahead:     r.Lookahead,
+					lookupRecords: gposLookupRecords(r.LookupRecords),
+				}
+			}
+			c.ruleSets = append(c.ruleSets, set)
+		}
+		return c
+	}
+	return nil
+}
+
+// gposLookupRecords converts GPOS lookup records, which have the same binary
+// layout as their GSUB counterparts.
+func gposLookupRecords(records []ot.GPOSLookupRecord) []ot.LookupRecord {
+	out := make([]ot.LookupRecord, len(records))
+	for i, r := range records {
+		out[i] = ot.LookupRecord{SequenceIndex: r.SequenceIndex, LookupIndex: r.LookupIndex}
+	}
+	return out
+}
+
 // subsetSinglePos subsets a SinglePos subtable.
 func (b *gposBuilder) subsetSinglePos(sp *ot.SinglePos) []byte {
 	covGlyphs := sp.Coverage().Glyphs()
@@ -175,10 +328,11 @@ func (b *gposBuilder) buildSinglePosFormat1(glyphs []ot.GlyphID, vr ot.ValueReco
 	binary.BigEndian.PutUint16(data[0:], 1)
 	binary.BigEndian.PutUint16(data[2:], uint16(headerSize))
 	binary.BigEndian.PutUint16(data[4:], valueFormat)
-	writeValueRecord(data[6:], vr, valueFormat)
+	devs := b.newDeviceTables(len(data))
+	b.writeValueRecord(data[6:], vr, valueFormat, devs)
 	copy(data[headerSize:], coverage)
 
-	return data
+	return append(data, devs.data...)
 }
 
 func (b *gposBuilder) buildSinglePosFormat2(glyphs []ot.GlyphID, vrs []ot.ValueRecord, valueFormat uint16) []byte {
@@ -194,14 +348,15 @@ func (b *gposBuilder) buildSinglePosFormat2(glyphs []ot.GlyphID, vrs []ot.ValueR
 	binary.BigEndian.PutUint16(data[4:], valueFormat)
 	binary.BigEndian.PutUint16(data[6:], uint16(len(vrs)))
 
+	devs := b.newDeviceTables(len(data))
 	off := 8
 	for _, vr := range vrs {
-		writeValueRecord(data[off:], vr, valueFormat)
+		b.writeValueRecord(data[off:], vr, valueFormat, devs)
 		off += vrSize
 	}
 	copy(data[headerSize:], coverage)
 
-	return data
+	return append(data, devs.data...)
 }
 
 // subsetPairPos subsets a PairPos subtable.
@@ -305,18 +460,21 @@ func (b *gposBuilder) buildPairPosFormat1(sets []pairSetEntry, vf1, vf2 uint16)
 		pairSetSize := 2 + len(set.pairs)*pairRecordSize
 		pairSet := make([]byte, pairSetSize)
 
+		// Device offsets are relative to the PairSet
+		devs := b.newDeviceTables(pairSetSize)
 		binary.BigEndian.PutUint16(pairSet[0:], uint16(len(set.pairs)))
 		off := 2
 		for _, p := range set.pairs {
 			binary.BigEndian.PutUint16(pairSet[off:], uint16(p.secondGlyph))
 			off += 2
-			writeValueRecord(pairSet[off:], p.value1, vf1)
+			b.writeValueRecord(pairSet[off:], p.value1, vf1, devs)
 			off += vr1Size
-			writeValueRecord(pairSet[off:], p.value2, vf2)
+			b.writeValueRecord(pairSet[off:], p.value2, vf2, devs)
 			off += vr2Size
 		}
 
 		pairSetData = append(pairSetData, pairSet...)
+		pairSetData = append(pairSetData, devs.data...)
 	}
 
 	totalSize := headerSize + len(pairSetData) + len(coverage)
@@ -431,14 +589,15 @@ func (b *gposBuilder) buildPairPosFormat2(covGlyphs []ot.GlyphID, class1, class2
 	binary.BigEndian.PutUint16(data[14:], class2Count)
 
 	// Write class matrix
+	devs := b.newDeviceTables(totalSize)
 	off := headerSize
 	for c1 := 0; c1 < int(class1Count); c1++ {
 		if c1 < len(classMatrix) {
 			for c2 := 0; c2 < int(class2Count); c2++ {
 				if c2 < len(classMatrix[c1]) {
-					writeValueRecord(data[off:], classMatrix[c1][c2].Value1, vf1)
+					b.writeValueRecord(data[off:], classMatrix[c1][c2].Value1, vf1, devs)
 					off += vr1Size
-					writeValueRecord(data[off:], classMatrix[c1][c2].Value2, vf2)
+					b.writeValueRecord(data[off:], classMatrix[c1][c2].Value2, vf2, devs)
 					off += vr2Size
 				} else {
 					off += classRecordSize
@@ -453,7 +612,7 @@ func (b *gposBuilder) buildPairPosFormat2(covGlyphs []ot.GlyphID, class1, class2
 	copy(data[classDef2Off:], classDef2)
 	copy(data[coverageOff:], coverage)
 
-	return data
+	return append(data, devs.data...)
 }
 
 // build serializes the GPOS table.
@@ -461,133 +620,7 @@ func (b *gposBuilder) build() ([]byte, error) {
 	if len(b.lookups) == 0 {
 		return nil, nil
 	}
-
-	// Build lookup list
-	lookupList := b.buildLookupList()
-
-	// Build minimal script list (DFLT/dflt)
-	scriptList := b.buildScriptList(len(b.lookups))
-
-	// Build feature list (all lookups under 'kern' feature)
-	featureList := b.buildFeatureList(len(b.lookups))
-
-	// GPOS header: version(4) + scriptListOff(2) + featureListOff(2) + lookupListOff(2)
-	headerSize := 10
-
-	scriptListOff := headerSize
-	featureListOff := scriptListOff + len(scriptList)
-	lookupListOff := featureListOff + len(featureList)
-
-	totalSize := lookupListOff + len(lookupList)
-	data := make([]byte, totalSize)
-
-	// Version 1.0
-	binary.BigEndian.PutUint16(data[0:], 1)
-	binary.BigEndian.PutUint16(data[2:], 0)
-	binary.BigEndian.PutUint16(data[4:], uint16(scriptListOff))
-	binary.BigEndian.PutUint16(data[6:], uint16(featureListOff))
-	binary.BigEndian.PutUint16(data[8:], uint16(lookupListOff))
-
-	copy(data[scriptListOff:], scriptList)
-	copy(data[featureListOff:], featureList)
-	copy(data[lookupListOff:], lookupList)
-
-	return data, nil
-}
-
-func (b *gposBuilder) buildLookupList() []byte {
-	// LookupList: lookupCount(2) + lookupOffsets[](2*n) + Lookup tables
-	headerSize := 2 + len(b.lookups)*2
-
-	lookupData := make([]byte, 0)
-	lookupOffsets := make([]uint16, len(b.lookups))
-
-	for i, lookup := range b.lookups {
-		lookupOffsets[i] = uint16(headerSize + len(lookupData))
-
-		// Lookup: lookupType(2) + lookupFlag(2) + subTableCount(2) + subTableOffsets[]
-		lookupHeaderSize := 6 + len(lookup.subtables)*2
-
-		subtableData := make([]byte, 0)
-		subtableOffsets := make([]uint16, len(lookup.subtables))
-
-		for j, st := range lookup.subtables {
-			subtableOffsets[j] = uint16(lookupHeaderSize + len(subtableData))
-			subtableData = append(subtableData, st...)
-		}
-
-		lookupTable := make([]byte, lookupHeaderSize+len(subtableData))
-		binary.BigEndian.PutUint16(lookupTable[0:], lookup.lookupType)
-		binary.BigEndian.PutUint16(lookupTable[2:], lookup.flag)
-		binary.BigEndian.PutUint16(lookupTable[4:], uint16(len(lookup.subtables)))
-		for j, off := range subtableOffsets {
-			binary.BigEndian.PutUint16(lookupTable[6+j*2:], off)
-		}
-		copy(lookupTable[lookupHeaderSize:], subtableData)
-
-		lookupData = append(lookupData, lookupTable...)
-	}
-
-	data := make([]byte, headerSize+len(lookupData))
-	binary.BigEndian.PutUint16(data[0:], uint16(len(b.lookups)))
-	for i, off := range lookupOffsets {
-		binary.BigEndian.PutUint16(data[2+i*2:], off)
-	}
-	copy(data[headerSize:], lookupData)
-
-	return data
-}
-
-func (b *gposBuilder) buildScriptList(numLookups int) []byte {
-	// Minimal script list: DFLT script with dflt language system
-	scriptCount := 1
-	headerSize := 2 + scriptCount*6
-
-	langSysSize := 6 + 2 // One feature index
-	scriptSize := 4 + langSysSize
-
-	totalSize := headerSize + scriptSize
-	data := make([]byte, totalSize)
-
-	binary.BigEndian.PutUint16(data[0:], uint16(scriptCount))
-	copy(data[2:], []byte("DFLT"))
-	binary.BigEndian.PutUint16(data[6:], uint16(headerSize))
-
-	scriptOff := headerSize
-	binary.BigEndian.PutUint16(data[scriptOff:], 4)
-	binary.BigEndian.PutUint16(data[scriptOff+2:], 0)
-
-	langSysOff := scriptOff + 4
-	binary.BigEndian.PutUint16(data[langSysOff:], 0)
-	binary.BigEndian.PutUint16(data[langSysOff+2:], 0xFFFF)
-	binary.BigEndian.PutUint16(data[langSysOff+4:], 1)
-	binary.BigEndian.PutUint16(data[langSysOff+6:], 0)
-
-	return data
-}
-
-func (b *gposBuilder) buildFeatureList(numLookups int) []byte {
-	// Single 'kern' feature that includes all lookups
-	featureCount := 1
-	headerSize := 2 + featureCount*6
-
-	featureSize := 4 + numLookups*2
-
-	totalSize := headerSize + featureSize
-	data := make([]byte, totalSize)
-
-	binary.BigEndian.PutUint16(data[0:], uint16(featureCount))
-	copy(data[2:], []byte("kern"))
-	binary.BigEndian.PutUint16(data[6:], uint16(headerSize))
-
-	featureOff := headerSize
-	binary.BigEndian.PutUint16(data[featureOff:], 0)
-	binary.BigEndian.PutUint16(data[featureOff+2:], uint16(numLookups))
-	for i := 0; i < numLookups; i++ {
-		binary.BigEndian.PutUint16(data[featureOff+4+i*2:], uint16(i))
-	}
-
-	return data
+	return buildLayoutTable(b.scripts, b.features, b.lookups, b.variations, ot.GPOSTypeExtension)
 }
 
 // valueRecordSize returns the byte size of a ValueRecord with the given format.
@@ -601,40 +634,109 @@ func valueRecordSize(format uint16) int {
 	return count * 2
 }
 
-// writeValueRecord writes a ValueRecord to data.
-func writeValueRecord(data []byte, vr ot.ValueRecord, format uint16) {
+// writeValueRecord writes a ValueRecord to data. Device offsets point to
+// VariationIndex tables added to devs; hinting Device tables are dropped.
+func (b *gposBuilder) writeValueRecord(data []byte, vr ot.ValueRecord, format uint16, devs *deviceTables) {
 	off := 0
 	if format&ot.ValueFormatXPlacement != 0 {
-		binary.BigEndian.PutUint16(data[off:], uint16(vr.XPlacement))
+		binary.BigEndian.PutUint16(data[off:], uint16(vr.XPlacement+b.deviceShift(vr.XPlaDevice)))
 		off += 2
 	}
 	if format&ot.ValueFormatYPlacement != 0 {
-		binary.BigEndian.PutUint16(data[off:], uint16(vr.YPlacement))
+		binary.BigEndian.PutUint16(data[off:], uint16(vr.YPlacement+b.deviceShift(vr.YPlaDevice)))
 		off += 2
 	}
 	if format&ot.ValueFormatXAdvance != 0 {
-		binary.BigEndian.PutUint16(data[off:], uint16(vr.XAdvance))
+		binary.BigEndian.PutUint16(data[off:], uint16(vr.XAdvance+b.deviceShift(vr.XAdvDevice)))
 		off += 2
 	}
 	if format&ot.ValueFormatYAdvance != 0 {
-		binary.BigEndian.PutUint16(data[off:], uint16(vr.YAdvance))
+		binary.BigEndian.PutUint16(data[off:], uint16(vr.YAdvance+b.deviceShift(vr.YAdvDevice)))
 		off += 2
 	}
-	// Device tables (not supported, write zeros if present)
 	if format&ot.ValueFormatXPlaDevice != 0 {
+		binary.BigEndian.PutUint16(data[off:], devs.add(vr.XPlaDevice))
 		off += 2
 	}
 	if format&ot.ValueFormatYPlaDevice != 0 {
+		binary.BigEndian.PutUint16(data[off:], devs.add(vr.YPlaDevice))
 		off += 2
 	}
 	if format&ot.ValueFormatXAdvDevice != 0 {
+		binary.BigEndian.PutUint16(data[off:], devs.add(vr.XAdvDevice))
 		off += 2
 	}
 	if format&ot.ValueFormatYAdvDevice != 0 {
-		off += 2
+		binary.BigEndian.PutUint16(data[off:], devs.add(vr.YAdvDevice))
 	}
 }
 
+// deviceShift returns the rounded delta of a VariationIndex table at the new
+// default location of a partially instanced font or at the instance.
+func (b *gposBuilder) deviceShift(dev *ot.Device) int16 {
+	if b.varIdxShifts == nil || dev == nil || dev.Format() != ot.DeviceFormatVariationIndex {
+		return 0
+	}
+	idx, ok := b.varIdxMap[dev.VariationIndex()]
+	if !ok || idx == noVariationIndex {
+		return 0
+	}
+	outer, inner := int(idx>>16), int(idx&0xFFFF)
+	if outer >= len(b.varIdxShifts) || inner >= len(b.varIdxShifts[outer]) {
+		return 0
+	}
+	return int16(math.Round(b.varIdxShifts[outer][inner]))
+}
+
+// deviceTables collects the VariationIndex tables referenced from one
+// subtable (or anchor). They are appended after its fixed part, so their
+// offsets start at base. Identical tables are shared.
+type deviceTables struct {
+	b       *gposBuilder
+	base    int
+	data    []byte
+	offsets map[uint32]uint16
+}
+
+func (b *gposBuilder) newDeviceTables(base int) *deviceTables {
+	return &deviceTables{b: b, base: base}
+}
+
+// add returns the offset of the remapped VariationIndex table of dev, or 0
+// if dev is nil, a hinting Device table, its delta set was dropped or the
+// font is fully instanced. While the variation indices are being
+// collected, it only records them.
+func (d *deviceTables) add(dev *ot.Device) uint16 {
+	if dev == nil || dev.Format() != ot.DeviceFormatVariationIndex {
+		return 0
+	}
+	idx := dev.VariationIndex()
+	if d.b.usedVarIdx != nil {
+		d.b.usedVarIdx[idx] = true
+	}
+	newIdx, ok := d.b.varIdxMap[idx]
+	if !ok || newIdx == noVariationIndex || d.b.dropDevices {
+		return 0
+	}
+	if off, ok := d.offsets[newIdx]; ok {
+		return off
+	}
+	if d.offsets == nil {
+		d.offsets = make(map[uint32]uint16)
+	}
+
+	// VariationIndex: deltaSetOuterIndex(2) + deltaSetInnerIndex(2) + deltaFormat(2)
+	table := make([]byte, 6)
+	binary.BigEndian.PutUint16(table[0:], uint16(newIdx>>16))
+	binary.BigEndian.PutUint16(table[2:], uint16(newIdx))
+	binary.BigEndian.PutUint16(table[4:], ot.DeviceFormatVariationIndex)
+
+	off := uint16(d.base + len(d.data))
+	d.data = append(d.data, table...)
+	d.offsets[newIdx] = off
+	return off
+}
+
 // buildClassDefFormat2 builds a ClassDef format 2 table from class entries.
 func buildClassDefFormat2(entries []classEntry) []byte {
 	if len(entries) == 0 {
@@ -743,11 +845,11 @@ func (b *gposBuilder) buildCursivePos(entries []cursiveEntry) []byte {
 	for i, e := range entries {
 		if e.entry != nil {
 			entryOffsets[i] = uint16(headerSize + len(anchorData))
-			anchorData = append(anchorData, buildAnchor(e.entry)...)
+			anchorData = append(anchorData, b.buildAnchor(e.entry)...)
 		}
 		if e.exit != nil {
 			exitOffsets[i] = uint16(headerSize + len(anchorData))
-			anchorData = append(anchorData, buildAnchor(e.exit)...)
+			anchorData = append(anchorData, b.buildAnchor(e.exit)...)
 		}
 	}
 
@@ -855,11 +957,11 @@ func (b *gposBuilder) buildMarkBasePos(marks []markEntry, bases []baseEntry, cla
 	headerSize := 12
 
 	// Build MarkArray
-	markArrayData := buildMarkArray(marks)
+	markArrayData := b.buildMarkArray(marks)
 	markArrayOff := headerSize
 
 	// Build BaseArray
-	baseArrayData := buildBaseArray(bases, int(classCount))
+	baseArrayData := b.buildBaseArray(bases, int(classCount))
 	baseArrayOff := markArrayOff + len(markArrayData)
 
 	// Coverage offsets
@@ -963,11 +1065,11 @@ func (b *gposBuilder) buildMarkLigPos(marks []markEntry, ligs []ligEntry, classC
 	headerSize := 12
 
 	// Build MarkArray
-	markArrayData := buildMarkArray(marks)
+	markArrayData := b.buildMarkArray(marks)
 	markArrayOff := headerSize
 
 	// Build LigatureArray
-	ligArrayData := buildLigatureArray(ligs, int(classCount))
+	ligArrayData := b.buildLigatureArray(ligs, int(classCount))
 	ligArrayOff := markArrayOff + len(markArrayData)
 
 	// Coverage offsets
@@ -1064,11 +1166,11 @@ func (b *gposBuilder) buildMarkMarkPos(mark1s []markEntry, mark2s []baseEntry, c
 	headerSize := 12
 
 	// Build Mark1Array
-	mark1ArrayData := buildMarkArray(mark1s)
+	mark1ArrayData := b.buildMarkArray(mark1s)
 	mark1ArrayOff := headerSize
 
 	// Build Mark2Array (same structure as BaseArray)
-	mark2ArrayData := buildBaseArray(mark2s, int(classCount))
+	mark2ArrayData := b.buildBaseArray(mark2s, int(classCount))
 	mark2ArrayOff := mark1ArrayOff + len(mark1ArrayData)
 
 	// Coverage offsets
@@ -1095,18 +1197,33 @@ func (b *gposBuilder) buildMarkMarkPos(mark1s []markEntry, mark2s []baseEntry, c
 
 // --- Helper functions for building anchor-based tables ---
 
-// buildAnchor builds an Anchor table (format 1).
-func buildAnchor(a *ot.Anchor) []byte {
+// buildAnchor builds an Anchor table. Anchors with retained VariationIndex
+// tables become format 3, all others format 1.
+func (b *gposBuilder) buildAnchor(a *ot.Anchor) []byte {
+	// Format 3: format(2) + x(2) + y(2) + xDeviceOffset(2) + yDeviceOffset(2)
+	x, y := a.X+b.deviceShift(a.XDevice), a.Y+b.deviceShift(a.YDevice)
+	devs := b.newDeviceTables(10)
+	xDevice, yDevice := devs.add(a.XDevice), devs.add(a.YDevice)
+	if xDevice != 0 || yDevice != 0 {
+		data := make([]byte, 10, 10+len(devs.data))
+		binary.BigEndian.PutUint16(data[0:], 3)
+		binary.BigEndian.PutUint16(data[2:], uint16(x))
+		binary.BigEndian.PutUint16(data[4:], uint16(y))
+		binary.BigEndian.PutUint16(data[6:], xDevice)
+		binary.BigEndian.PutUint16(data[8:], yDevice)
+		return append(data, devs.data...)
+	}
+
 	// Format 1: format(2) + x(2) + y(2)
 	data := make([]byte, 6)
 	binary.BigEndian.PutUint16(data[0:], 1) // Use format 1 for simplicity
-	binary.BigEndian.PutUint16(data[2:], uint16(a.X))
-	binary.BigEndian.PutUint16(data[4:], uint16(a.Y))
+	binary.BigEndian.PutUint16(data[2:], uint16(x))
+	binary.BigEndian.PutUint16(data[4:], uint16(y))
 	return data
 }
 
 // buildMarkArray builds a MarkArray table.
-func buildMarkArray(marks []markEntry) []byte {
+func (b *gposBuilder) buildMarkArray(marks []markEntry) []byte {
 	// MarkArray: markCount(2) + markRecords[](4*n) + anchors[]
 	headerSize := 2 + len(marks)*4
 
@@ -1116,7 +1233,7 @@ func buildMarkArray(marks []markEntry) []byte {
 	for i, m := range marks {
 		if m.anchor != nil {
 			anchorOffsets[i] = uint16(headerSize + len(anchorData))
-			anchorData = append(anchorData, buildAnchor(m.anchor)...)
+			anchorData = append(anchorData, b.buildAnchor(m.anchor)...)
 		}
 	}
 
@@ -1135,7 +1252,7 @@ func buildMarkArray(marks []markEntry) []byte {
 }
 
 // buildBaseArray builds a BaseArray (AnchorMatrix) table.
-func buildBaseArray(bases []baseEntry, classCount int) []byte {
+func (b *gposBuilder) buildBaseArray(bases []baseEntry, classCount int) []byte {
 	// BaseArray: baseCount(2) + baseRecords[](2*classCount*n) + anchors[]
 	headerSize := 2 + len(bases)*classCount*2
 
@@ -1147,7 +1264,7 @@ func buildBaseArray(bases []baseEntry, classCount int) []byte {
 		for c := 0; c < classCount; c++ {
 			if c < len(base.anchors) && base.anchors[c] != nil {
 				anchorOffsets[i][c] = uint16(headerSize + len(anchorData))
-				anchorData = append(anchorData, buildAnchor(base.anchors[c])...)
+				anchorData = append(anchorData, b.buildAnchor(base.anchors[c])...)
 			}
 		}
 	}
@@ -1168,7 +1285,7 @@ func buildBaseArray(bases []baseEntry, classCount int) []byte {
 }
 
 // buildLigatureArray builds a LigatureArray table.
-func buildLigatureArray(ligs []ligEntry, classCount int) []byte {
+func (b *gposBuilder) buildLigatureArray(ligs []ligEntry, classCount int) []byte {
 	// LigatureArray: ligCount(2) + ligAttachOffsets[](2*n) + LigatureAttach tables
 	headerSize := 2 + len(ligs)*2
 
@@ -1177,7 +1294,7 @@ func buildLigatureArray(ligs []ligEntry, classCount int) []byte {
 
 	for i, lig := range ligs {
 		ligAttachOffsets[i] = uint16(headerSize + len(ligAttachData))
-		ligAttachData = append(ligAttachData, buildLigatureAttach(lig.anchors, classCount)...)
+		ligAttachData = append(ligAttachData, b.buildLigatureAttach(lig.anchors, classCount)...)
 	}
 
 	totalSize := headerSize + len(ligAttachData)
@@ -1193,7 +1310,7 @@ func buildLigatureArray(ligs []ligEntry, classCount int) []byte {
 }
 
 // buildLigatureAttach builds a LigatureAttach table.
-func buildLigatureAttach(anchors [][]*ot.Anchor, classCount int) []byte {
+func (b *gposBuilder) buildLigatureAttach(anchors [][]*ot.Anchor, classCount int) []byte {
 	componentCount := len(anchors)
 	// LigatureAttach: componentCount(2) + componentRecords[](2*classCount*n) + anchors[]
 	headerSize := 2 + componentCount*classCount*2
@@ -1206,7 +1323,7 @@ func buildLigatureAttach(anchors [][]*ot.Anchor, classCount int) []byte {
 		for c := 0; c < classCount; c++ {
 			if comp < len(anchors) && c < len(anchors[comp]) && anchors[comp][c] != nil {
 				anchorOffsets[comp][c] = uint16(headerSize + len(anchorData))
-				anchorData = append(anchorData, buildAnchor(anchors[comp][c])...)
+				anchorData = append(anchorData, b.buildAnchor(anchors[comp][c])...)
 			}
 		}
 	}
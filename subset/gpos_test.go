@@ -174,3 +174,89 @@ func TestGPOSPairPositioning(t *testing.T) {
 	t.Logf("Subset has GPOS: %v", subFont.HasTable(ot.TagGPOS))
 	t.Logf("Subset has GDEF: %v", subFont.HasTable(ot.TagGDEF))
 }
+
+func TestGPOSMarkPositioning(t *testing.T) {
+	fontPath := testutil.FindTestFont("SourceSansPro-Regular.otf")
+	if fontPath == "" {
+		t.Skip("SourceSansPro-Regular.otf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	// Combining marks without precomposed forms exercise mark and mkmk.
+	text := "AVATAR q̣́ ẍ́"
+	input := NewInput()
+	input.AddString(text)
+
+	plan, err := CreatePlan(font, input)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	result, err := plan.Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+
+	subFont, err := ot.ParseFont(result, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse subset font: %v", err)
+	}
+
+	gposData, err := subFont.TableData(ot.TagGPOS)
+	if err != nil {
+		t.Fatalf("Subset has no GPOS table: %v", err)
+	}
+	gpos, err := ot.ParseGPOS(gposData)
+	if err != nil {
+		t.Fatalf("Failed to parse subset GPOS: %v", err)
+	}
+	featList, err := gpos.ParseFeatureList()
+	if err != nil {
+		t.Fatalf("Failed to parse subset FeatureList: %v", err)
+	}
+	tags := make(map[ot.Tag]bool)
+	for i := 0; i < featList.Count(); i++ {
+		if feat, err := featList.GetFeature(i); err == nil {
+			tags[feat.Tag] = true
+		}
+	}
+	for _, tag := range []ot.Tag{ot.TagKern, ot.MakeTag('m', 'a', 'r', 'k'), ot.MakeTag('m', 'k', 'm', 'k')} {
+		if !tags[tag] {
+			t.Errorf("Subset GPOS is missing feature %s", tag)
+		}
+	}
+
+	origShaper, _ := ot.NewShaper(font)
+	subShaper, _ := ot.NewShaper(subFont)
+
+	origBuf := ot.NewBuffer()
+	origBuf.AddString(text)
+	origBuf.GuessSegmentProperties()
+	origShaper.Shape(origBuf, nil)
+
+	subBuf := ot.NewBuffer()
+	subBuf.AddString(text)
+	subBuf.GuessSegmentProperties()
+	subShaper.Shape(subBuf, nil)
+
+	if subBuf.Len() != origBuf.Len() {
+		t.Fatalf("Glyph count mismatch: subset=%d, original=%d", subBuf.Len(), origBuf.Len())
+	}
+	for i := range origBuf.Info {
+		oldGID, _ := plan.OldGlyph(subBuf.Info[i].GlyphID)
+		if oldGID != origBuf.Info[i].GlyphID {
+			t.Errorf("Glyph %d: subset maps back to %d, original=%d", i, oldGID, origBuf.Info[i].GlyphID)
+		}
+		if subBuf.Pos[i] != origBuf.Pos[i] {
+			t.Errorf("Glyph %d: position=%+v, original=%+v", i, subBuf.Pos[i], origBuf.Pos[i])
+		}
+	}
+}
@@ -8,75 +8,80 @@ import (
 )
 
 // subsetGSUB creates a subsetted GSUB table with remapped glyph IDs.
+// All features retained by Input.ShouldKeepFeature are kept together with
+// their lookups; the ScriptList, FeatureList and LookupList are rebuilt with
+// remapped indices.
 func (p *Plan) subsetGSUB() ([]byte, error) {
 	if p.gsub == nil {
 		return nil, nil
 	}
 
-	// Get the 'liga' feature's lookups
 	featList, err := p.gsub.ParseFeatureList()
 	if err != nil {
 		return nil, nil
 	}
-
-	ligaLookups := featList.FindFeature(ot.TagLiga)
-	if len(ligaLookups) == 0 {
-		return nil, nil
-	}
+	scriptList, _ := p.gsub.ParseScriptList()
 
 	builder := newGSUBBuilder(p.glyphMap, p.glyphSet)
-
-	// Only process lookups referenced by 'liga' feature
-	for _, lookupIdx := range ligaLookups {
-		lookup := p.gsub.GetLookup(int(lookupIdx))
-		if lookup == nil {
-			continue
+	variations, applied := p.featureVariations(featList, p.gsub.GetFeatureVariations())
+	lookups := p.gsubLookupIndices(featList, variations, applied)
+
+	// First pass: find the lookups that still have content after subsetting
+	// and assign them new indices, preserving the original order.
+	lookupMap := make(map[uint16]uint16)
+	for _, lookupIdx := range lookups {
+		if lookup := p.gsub.GetLookup(int(lookupIdx)); lookup != nil && builder.subsetLookup(lookup) != nil {
+			lookupMap[lookupIdx] = uint16(len(lookupMap))
 		}
+	}
 
-		subsetLookup := builder.subsetLookup(lookup)
-		if subsetLookup != nil {
-			builder.addLookup(subsetLookup)
+	// Second pass: serialize the retained lookups. Nested lookup indices in
+	// context subtables are remapped through lookupMap.
+	builder.lookupMap = lookupMap
+	for _, lookupIdx := range lookups {
+		if _, ok := lookupMap[lookupIdx]; ok {
+			builder.addLookup(builder.subsetLookup(p.gsub.GetLookup(int(lookupIdx))))
 		}
 	}
 
-	// If no lookups remain, return nil (don't include empty GSUB)
-	if len(builder.lookups) == 0 {
+	builder.features, builder.scripts, builder.variations = p.subsetFeaturesAndScripts(featList, scriptList, lookupMap, variations, applied)
+
+	// If no features remain, return nil (don't include empty GSUB)
+	if len(builder.features) == 0 {
 		return nil, nil
 	}
 
 	return builder.build()
 }
 
-// gsubBuilder builds a subsetted GSUB table.
-type gsubBuilder struct {
-	glyphMap map[ot.GlyphID]ot.GlyphID
-	glyphSet map[ot.GlyphID]bool
-	lookups  []*lookupBuilder
-	features []featureRecord
-	scripts  []scriptRecord
-}
-
-type lookupBuilder struct {
-	lookupType uint16
-	flag       uint16
-	subtables  [][]byte
-}
-
-type featureRecord struct {
-	tag     ot.Tag
-	lookups []uint16
-}
-
-type scriptRecord struct {
-	tag      ot.Tag
-	langSys  []langSysRecord
-	dfltLang *langSysRecord
+// gsubLookupIndices returns the sorted indices of all lookups referenced by
+// retained features, including their feature variations and lookups that
+// are only reachable as nested lookups of context subtables.
+func (p *Plan) gsubLookupIndices(featList *ot.FeatureList, variations []featureVariation, applied map[uint16][]uint16) []uint16 {
+	return lookupClosure(p.featureLookups(featList, variations, applied), func(idx uint16) []uint16 {
+		lookup := p.gsub.GetLookup(int(idx))
+		if lookup == nil {
+			return nil
+		}
+		var nested []uint16
+		for _, st := range lookup.Subtables() {
+			if c := gsubContextSubtable(st); c != nil {
+				nested = append(nested, contextLookupIndices(c)...)
+			}
+		}
+		return nested
+	})
 }
 
-type langSysRecord struct {
-	tag      ot.Tag
-	reqFeat  uint16
-	features []uint16
+// gsubBuilder builds a subsetted GSUB table.
+type gsubBuilder struct {
+	glyphMap   map[ot.GlyphID]ot.GlyphID
+	glyphSet   map[ot.GlyphID]bool
+	lookupMap  map[uint16]uint16 // Old->new lookup indices for nested lookups
+	lookups    []*lookupBuilder
+	features   []featureRecord
+	scripts    []scriptRecord
+	variations []featureVariation
 }
 
 func newGSUBBuilder(glyphMap map[ot.GlyphID]ot.GlyphID, glyphSet map[ot.GlyphID]bool) *gsubBuilder {
@@ -95,10 +100,12 @@ func (b *gsubBuilder) subsetLookup(lookup *ot.GSUBLookup) *lookupBuilder {
 	lb := &lookupBuilder{
 		lookupType: lookup.Type,
 		flag:       lookup.Flag,
+		markFilter: lookup.MarkFilter,
 	}
 
 	for _, subtable := range lookup.Subtables() {
 		var data []byte
+		var err error
 
 		switch st := subtable.(type) {
 		case *ot.SingleSubst:
@@ -109,15 +116,27 @@ func (b *gsubBuilder) subsetLookup(lookup *ot.GSUBLookup) *lookupBuilder {
 			data = b.subsetAlternateSubst(st)
 		case *ot.LigatureSubst:
 			data = b.subsetLigatureSubst(st)
-			// TODO: Context, ChainContext, Extension
+		case *ot.ContextSubst, *ot.ChainContextSubst:
+			cs := &contextSubsetter{glyphMap: b.glyphMap, lookupMap: b.lookupMap}
+			data, err = cs.subset(gsubContextSubtable(st))
+		case *ot.ReverseChainSingleSubst:
+			data, err = b.subsetReverseChainSingleSubst(st)
+		}
+		if err != nil {
+			lb.err = err
 		}
 
 		if data != nil && len(data) > 0 {
 			lb.subtables = append(lb.subtables, data)
+			// Extension lookups keep their wrapper; the parser resolved the
+			// actual type, which we recover from the subtable.
+			if lookup.Type == ot.GSUBTypeExtension {
+				lb.extensionType = gsubSubtableType(subtable)
+			}
 		}
 	}
 
-	if len(lb.subtables) == 0 {
+	if len(lb.subtables) == 0 && lb.err == nil {
 		return nil
 	}
 	return lb
@@ -535,153 +554,152 @@ func (b *gsubBuilder) buildLigatureSubst(sets []ligatureSetEntry) []byte {
 	return data
 }
 
-// build serializes the GSUB table.
-func (b *gsubBuilder) build() ([]byte, error) {
-	if len(b.lookups) == 0 {
-		return nil, nil
-	}
-
-	// Build lookup list
-	lookupList := b.buildLookupList()
-
-	// Build minimal script list (DFLT/dflt)
-	scriptList := b.buildScriptList(len(b.lookups))
-
-	// Build feature list (all lookups under 'liga' and 'kern' features)
-	featureList := b.buildFeatureList(len(b.lookups))
-
-	// GSUB header: version(4) + scriptListOff(2) + featureListOff(2) + lookupListOff(2)
-	headerSize := 10
-
-	scriptListOff := headerSize
-	featureListOff := scriptListOff + len(scriptList)
-	lookupListOff := featureListOff + len(featureList)
-
-	totalSize := lookupListOff + len(lookupList)
-	data := make([]byte, totalSize)
-
-	// Version 1.0
-	binary.BigEndian.PutUint16(data[0:], 1)
-	binary.BigEndian.PutUint16(data[2:], 0)
-	binary.BigEndian.PutUint16(data[4:], uint16(scriptListOff))
-	binary.BigEndian.PutUint16(data[6:], uint16(featureListOff))
-	binary.BigEndian.PutUint16(data[8:], uint16(lookupListOff))
-
-	copy(data[scriptListOff:], scriptList)
-	copy(data[featureListOff:], featureList)
-	copy(data[lookupListOff:], lookupList)
-
-	return data, nil
+// gsubSubtableType returns the lookup type of a parsed GSUB subtable.
+func gsubSubtableType(st ot.GSUBSubtable) uint16 {
+	switch st.(type) {
+	case *ot.SingleSubst:
+		return ot.GSUBTypeSingle
+	case *ot.MultipleSubst:
+		return ot.GSUBTypeMultiple
+	case *ot.AlternateSubst:
+		return ot.GSUBTypeAlternate
+	case *ot.LigatureSubst:
+		return ot.GSUBTypeLigature
+	case *ot.ContextSubst:
+		return ot.GSUBTypeContext
+	case *ot.ChainContextSubst:
+		return ot.GSUBTypeChainContext
+	case *ot.ReverseChainSingleSubst:
+		return ot.GSUBTypeReverseChainSingle
+	}
+	return 0
 }
 
-func (b *gsubBuilder) buildLookupList() []byte {
-	// LookupList: lookupCount(2) + lookupOffsets[](2*n) + Lookup tables
-	headerSize := 2 + len(b.lookups)*2
-
-	lookupData := make([]byte, 0)
-	lookupOffsets := make([]uint16, len(b.lookups))
-
-	for i, lookup := range b.lookups {
-		lookupOffsets[i] = uint16(headerSize + len(lookupData))
-
-		// Lookup: lookupType(2) + lookupFlag(2) + subTableCount(2) + subTableOffsets[](2*n)
-		lookupHeaderSize := 6 + len(lookup.subtables)*2
-
-		subtableData := make([]byte, 0)
-		subtableOffsets := make([]uint16, len(lookup.subtables))
-
-		for j, st := range lookup.subtables {
-			subtableOffsets[j] = uint16(lookupHeaderSize + len(subtableData))
-			subtableData = append(subtableData, st...)
+// gsubContextSubtable converts a GSUB context or chaining context subtable
+// into the shared representation. It returns nil for other subtable types.
+func gsubContextSubtable(st ot.GSUBSubtable) *contextSubtable {
+	switch st := st.(type) {
+	case *ot.ContextSubst:
+		c := &contextSubtable{
+			format:         st.Format(),
+			coverage:       st.Coverage(),
+			inputClassDef:  st.ClassDef(),
+			inputCoverages: st.InputCoverages(),
+			lookupRecords:  st.LookupRecords(),
 		}
-
-		lookupTable := make([]byte, lookupHeaderSize+len(subtableData))
-		binary.BigEndian.PutUint16(lookupTable[0:], lookup.lookupType)
-		binary.BigEndian.PutUint16(lookupTable[2:], lookup.flag)
-		binary.BigEndian.PutUint16(lookupTable[4:], uint16(len(lookup.subtables)))
-		for j, off := range subtableOffsets {
-			binary.BigEndian.PutUint16(lookupTable[6+j*2:], off)
+		for _, rules := range st.RuleSets() {
+			set := make([]contextRule, len(rules))
+			for i, r := range rules {
+				set[i] = contextRule{input: r.Input, lookupRecords: r.LookupRecords}
+			}
+			c.ruleSets = append(c.ruleSets, set)
 		}
-		copy(lookupTable[lookupHeaderSize:], subtableData)
-
-		lookupData = append(lookupData, lookupTable...)
-	}
-
-	data := make([]byte, headerSize+len(lookupData))
-	binary.BigEndian.PutUint16(data[0:], uint16(len(b.lookups)))
-	for i, off := range lookupOffsets {
-		binary.BigEndian.PutUint16(data[2+i*2:], off)
+		return c
+
+	case *ot.ChainContextSubst:
+		c := &contextSubtable{
+			chain:              true,
+			format:             st.Format(),
+			coverage:           st.Coverage(),
+			backtrackClassDef:  st.BacktrackClassDef(),
+			inputClassDef:      st.InputClassDef(),
+			lookaheadClassDef:  st.LookaheadClassDef(),
+			backtrackCoverages: st.BacktrackCoverages(),
+			inputCoverages:     st.InputCoverages(),
+			lookaheadCoverages: st.LookaheadCoverages(),
+			lookupRecords:      st.LookupRecords(),
+		}
+		for _, rules := range st.ChainRuleSets() {
+			set := make([]contextRule, len(rules))
+			for i, r := range rules {
+				set[i] = contextRule{
+					backtrack:     r.Backtrack,
+					input:         r.Input,
+					lookahead:     r.Lookahead,
+					lookupRecords: r.LookupRecords,
+				}
+			}
+			c.ruleSets = append(c.ruleSets, set)
+		}
+		return c
 	}
-	copy(data[headerSize:], lookupData)
-
-	return data
+	return nil
 }
 
-func (b *gsubBuilder) buildScriptList(numLookups int) []byte {
-	// Minimal script list: DFLT script with dflt language system
-	// ScriptList: scriptCount(2) + scriptRecords[](6*n) + Script tables
-
-	// ScriptRecord: scriptTag(4) + scriptOffset(2)
-	scriptCount := 1
-	headerSize := 2 + scriptCount*6
-
-	// Script table: defaultLangSys(2) + langSysCount(2)
-	// DefaultLangSys: lookupOrder(2) + reqFeatureIndex(2) + featureIndexCount(2) + featureIndices[](2*n)
-	langSysSize := 6 + 2 // One feature index
-	scriptSize := 4 + langSysSize
-
-	totalSize := headerSize + scriptSize
-	data := make([]byte, totalSize)
+// subsetReverseChainSingleSubst subsets a ReverseChainSingleSubst subtable.
+func (b *gsubBuilder) subsetReverseChainSingleSubst(st *ot.ReverseChainSingleSubst) ([]byte, error) {
+	substitutes := st.Substitutes()
 
-	// Header
-	binary.BigEndian.PutUint16(data[0:], uint16(scriptCount))
-	// DFLT script tag
-	copy(data[2:], []byte("DFLT"))
-	binary.BigEndian.PutUint16(data[6:], uint16(headerSize))
+	var entries []struct{ in, out ot.GlyphID }
+	for i, g := range st.Coverage().Glyphs() {
+		if i >= len(substitutes) {
+			break
+		}
+		newIn, okIn := b.glyphMap[g]
+		newOut, okOut := b.glyphMap[substitutes[i]]
+		if okIn && okOut {
+			entries = append(entries, struct{ in, out ot.GlyphID }{newIn, newOut})
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].in < entries[j].in })
 
-	// Script table
-	scriptOff := headerSize
-	binary.BigEndian.PutUint16(data[scriptOff:], 4)   // offset to default LangSys (relative to script)
-	binary.BigEndian.PutUint16(data[scriptOff+2:], 0) // no other language systems
+	cs := &contextSubsetter{glyphMap: b.glyphMap}
+	remapAll := func(covs []*ot.Coverage) ([][]byte, bool) {
+		out := make([][]byte, len(covs))
+		for i, cov := range covs {
+			glyphs := cs.remapCoverage(cov)
+			if len(glyphs) == 0 {
+				return nil, false
+			}
+			out[i] = buildCoverageFormat1(glyphs)
+		}
+		return out, true
+	}
+	backtrack, ok1 := remapAll(st.BacktrackCoverages())
+	lookahead, ok2 := remapAll(st.LookaheadCoverages())
+	if !ok1 || !ok2 {
+		return nil, nil
+	}
 
-	// DefaultLangSys
-	langSysOff := scriptOff + 4
-	binary.BigEndian.PutUint16(data[langSysOff:], 0)        // lookupOrder (reserved)
-	binary.BigEndian.PutUint16(data[langSysOff+2:], 0xFFFF) // no required feature
-	binary.BigEndian.PutUint16(data[langSysOff+4:], 1)      // 1 feature
-	binary.BigEndian.PutUint16(data[langSysOff+6:], 0)      // feature index 0
+	glyphs := make([]ot.GlyphID, len(entries))
+	for i, e := range entries {
+		glyphs[i] = e.in
+	}
+	coverage := buildCoverageFormat1(glyphs)
 
-	return data
+	// Format 1: format(2) + coverageOffset(2) + backtrackCount(2) + backtrackOffsets[] +
+	//           lookaheadCount(2) + lookaheadOffsets[] + glyphCount(2) + substitutes[]
+	headerSize := 6 + len(backtrack)*2 + 2 + len(lookahead)*2 + 2 + len(entries)*2
+	return buildCoverageArrays(headerSize, [][][]byte{{coverage}, backtrack, lookahead}, func(data []byte, covOffsets [][]uint16) {
+		binary.BigEndian.PutUint16(data[0:], 1)
+		binary.BigEndian.PutUint16(data[2:], covOffsets[0][0])
+		off := 4
+		for _, offsets := range covOffsets[1:] {
+			binary.BigEndian.PutUint16(data[off:], uint16(len(offsets)))
+			off += 2
+			for _, o := range offsets {
+				binary.BigEndian.PutUint16(data[off:], o)
+				off += 2
+			}
+		}
+		binary.BigEndian.PutUint16(data[off:], uint16(len(entries)))
+		off += 2
+		for _, e := range entries {
+			binary.BigEndian.PutUint16(data[off:], uint16(e.out))
+			off += 2
+		}
+	})
 }
 
-func (b *gsubBuilder) buildFeatureList(numLookups int) []byte {
-	// Single 'liga' feature that includes all lookups
-	// FeatureList: featureCount(2) + featureRecords[](6*n) + Feature tables
-
-	featureCount := 1
-	headerSize := 2 + featureCount*6
-
-	// Feature table: featureParams(2) + lookupIndexCount(2) + lookupListIndices[](2*n)
-	featureSize := 4 + numLookups*2
-
-	totalSize := headerSize + featureSize
-	data := make([]byte, totalSize)
-
-	// Header
-	binary.BigEndian.PutUint16(data[0:], uint16(featureCount))
-	// 'liga' feature tag
-	copy(data[2:], []byte("liga"))
-	binary.BigEndian.PutUint16(data[6:], uint16(headerSize))
-
-	// Feature table
-	featureOff := headerSize
-	binary.BigEndian.PutUint16(data[featureOff:], 0) // no feature params
-	binary.BigEndian.PutUint16(data[featureOff+2:], uint16(numLookups))
-	for i := 0; i < numLookups; i++ {
-		binary.BigEndian.PutUint16(data[featureOff+4+i*2:], uint16(i))
+// build serializes the GSUB table.
+func (b *gsubBuilder) build() ([]byte, error) {
+	if len(b.lookups) == 0 {
+		return nil, nil
 	}
-
-	return data
+	return buildLayoutTable(b.scripts, b.features, b.lookups, b.variations, ot.GSUBTypeExtension)
 }
 
 // buildCoverageFormat1 builds a format 1 coverage table from sorted glyphs.
@@ -25,6 +25,10 @@ type Input struct {
 	// When axes are pinned, the font is instanced (variation tables removed).
 	pinnedAxes map[ot.Tag]float32
 
+	// limitedAxes maps axis tags to restricted ranges (design-space
+	// coordinates). Limited axes stay variable within the new range.
+	limitedAxes map[ot.Tag]AxisRange
+
 	// Flags controls subsetting behavior.
 	Flags Flags
 }
@@ -65,6 +69,7 @@ func NewInput() *Input {
 		passThroughTables: make(map[ot.Tag]bool),
 		layoutFeatures:    make(map[ot.Tag]bool),
 		pinnedAxes:        make(map[ot.Tag]float32),
+		limitedAxes:       make(map[ot.Tag]AxisRange),
 	}
 }
 
@@ -162,6 +167,7 @@ func (i *Input) ShouldKeepFeature(tag ot.Tag) bool {
 // The value should be in design-space coordinates (e.g., 700 for Bold weight).
 // This is similar to HarfBuzz's hb_subset_input_pin_axis_location().
 func (i *Input) PinAxisLocation(axisTag ot.Tag, value float32) {
+	delete(i.limitedAxes, axisTag)
 	i.pinnedAxes[axisTag] = value
 }
 
@@ -184,6 +190,7 @@ func (i *Input) PinAxisToDefault(font *ot.Font, axisTag ot.Tag) bool {
 	if !found {
 		return false
 	}
+	delete(i.limitedAxes, axisTag)
 	i.pinnedAxes[axisTag] = axis.DefaultValue
 	return true
 }
@@ -204,6 +211,7 @@ func (i *Input) PinAllAxesToDefault(font *ot.Font) bool {
 		return false
 	}
 	for _, axis := range fvar.AxisInfos() {
+		delete(i.limitedAxes, axis.Tag)
 		i.pinnedAxes[axis.Tag] = axis.DefaultValue
 	}
 	return true
@@ -219,6 +227,39 @@ func (i *Input) PinnedAxes() map[ot.Tag]float32 {
 	return i.pinnedAxes
 }
 
+// AxisRange is a range of a variation axis in design-space coordinates.
+type AxisRange struct {
+	Min     float32
+	Default float32
+	Max     float32
+}
+
+// LimitAxisRange restricts a variation axis to the range [min, max] with a
+// new default value. The axis stays variable, all variation data is
+// re-normalized to the new range and named instances outside of it are
+// dropped. If min equals max, the axis is pinned instead.
+// The range is clamped to the axis range of the font.
+// This is similar to HarfBuzz's hb_subset_input_set_axis_range() and the
+// fontTools L3 instancer.
+func (i *Input) LimitAxisRange(axisTag ot.Tag, min, def, max float32) {
+	if min == max {
+		i.PinAxisLocation(axisTag, min)
+		return
+	}
+	delete(i.pinnedAxes, axisTag)
+	i.limitedAxes[axisTag] = AxisRange{Min: min, Default: def, Max: max}
+}
+
+// HasLimitedAxes returns true if the range of any axis has been limited.
+func (i *Input) HasLimitedAxes() bool {
+	return len(i.limitedAxes) > 0
+}
+
+// LimitedAxes returns the map of limited axis tags to ranges.
+func (i *Input) LimitedAxes() map[ot.Tag]AxisRange {
+	return i.limitedAxes
+}
+
 // IsFullyInstanced returns true if all axes in the font have been pinned.
 func (i *Input) IsFullyInstanced(font *ot.Font) bool {
 	if !font.HasTable(ot.TagFvar) {
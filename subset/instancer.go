@@ -0,0 +1,1420 @@
+package subset
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/boxesandglue/textshape/ot"
+)
+
+// This file implements instancing of glyph outlines and partial instancing:
+// axes restricted with Input.LimitAxisRange stay variable, but every tuple
+// region is rebased onto the new axis range. Deltas that apply at a moved
+// default location are baked into the default outlines and metrics.
+// fontTools equivalent: fontTools.varLib.instancer (L3), instancer/solver.py
+
+// f2dot14Epsilon is the smallest step representable in F2DOT14.
+const f2dot14Epsilon = 1.0 / (1 << 14)
+
+// tent is a region on one axis: lower, peak and upper in normalized
+// coordinates. A zero peak means the axis does not take part in the region.
+type tent [3]float64
+
+// reverseNegate mirrors the tent around the default.
+func (t tent) reverseNegate() tent {
+	return tent{-t[2], -t[1], -t[0]}
+}
+
+// axisLimit is the restricted range of an axis in normalized coordinates.
+// distNeg and distPos are the design-space distances from the original
+// default to the original minimum and maximum; they keep renormalization
+// linear in design space when the new default crosses the old one.
+type axisLimit struct {
+	min, def, max    float64
+	distNeg, distPos float64
+}
+
+// pinned returns true if the limit collapses the axis to a single location.
+func (l axisLimit) pinned() bool {
+	return l.min == l.max
+}
+
+// reverseNegate mirrors the limit around the default.
+func (l axisLimit) reverseNegate() axisLimit {
+	return axisLimit{-l.max, -l.def, -l.min, l.distPos, l.distNeg}
+}
+
+// renormalize maps a normalized coordinate of the original axis range to
+// the restricted range, where the new default is 0 and min/max are -1/+1.
+func (l axisLimit) renormalize(v float64) float64 {
+	if v == l.def {
+		return 0
+	}
+	if l.def < 0 {
+		return -l.reverseNegate().renormalize(-v)
+	}
+	if v > l.def {
+		if l.max == l.def {
+			return 1
+		}
+		return (v - l.def) / (l.max - l.def)
+	}
+	if l.min == l.def {
+		return -1
+	}
+	if l.min >= 0 {
+		return (v - l.def) / (l.def - l.min)
+	}
+
+	// The range crosses the old default: measure in design space.
+	total := l.distNeg*-l.min + l.distPos*l.def
+	var dist float64
+	if v >= 0 {
+		dist = (l.def - v) * l.distPos
+	} else {
+		dist = -v*l.distNeg + l.distPos*l.def
+	}
+	return -dist / total
+}
+
+// limitedAxis is an axis restricted (or pinned) for partial instancing.
+type limitedAxis struct {
+	// user is the range in design-space coordinates, clamped to the axis.
+	user AxisRange
+	// normalized is the range in normalized coordinates before avar.
+	normalized axisLimit
+	// mapped is the range after avar; tuple regions are rebased onto it.
+	mapped axisLimit
+}
+
+// supportScalar evaluates a tent at v, following the OpenType rules for
+// invalid regions.
+func supportScalar(v float64, t tent) float64 {
+	lower, peak, upper := t[0], t[1], t[2]
+	if peak == 0 || lower > peak || peak > upper || (lower < 0 && upper > 0) {
+		return 1
+	}
+	if v == peak {
+		return 1
+	}
+	if v <= lower || upper <= v {
+		return 0
+	}
+	if v < peak {
+		return (v - lower) / (peak - lower)
+	}
+	return (v - upper) / (peak - upper)
+}
+
+// tentSolution is one part of a rebased tent. A zero tent is a gain that
+// applies everywhere, i.e. at the new default.
+type tentSolution struct {
+	scalar float64
+	tent   tent
+}
+
+// solveTent splits a tent into tents that, scaled, reproduce the original
+// variation within the limit.
+func solveTent(t tent, l axisLimit) []tentSolution {
+	lower, peak, upper := t[0], t[1], t[2]
+
+	// Mirror the problem such that l.def <= peak.
+	if l.def > peak {
+		sols := solveTent(t.reverseNegate(), l.reverseNegate())
+		for i := range sols {
+			if sols[i].tent != (tent{}) {
+				sols[i].tent = sols[i].tent.reverseNegate()
+			}
+		}
+		return sols
+	}
+
+	// Case 1: the tent lies completely outside the limit.
+	if l.max <= lower && l.max < peak {
+		return nil
+	}
+
+	// Case 2: the peak lies outside the limit. Move it to the limit and
+	// scale by the value the tent had there.
+	if l.max < peak {
+		mult := supportScalar(l.max, t)
+		sols := solveTent(tent{lower, l.max, l.max}, l)
+		for i := range sols {
+			sols[i].scalar *= mult
+		}
+		return sols
+	}
+
+	// lower <= l.def <= peak <= l.max
+	gain := supportScalar(l.def, t)
+	out := []tentSolution{{scalar: gain}}
+
+	// The positive side. outGain is the value of the tent at the limit.
+	outGain := supportScalar(l.max, t)
+	if gain >= outGain {
+		// Case 3a: the down slope crosses the gain level before the limit.
+		crossing := peak + (1-gain)*(upper-peak)
+		out = append(out, tentSolution{1 - gain, tent{math.Max(lower, l.def), peak, crossing}})
+
+		if upper >= l.max {
+			// Case 3a1: one tent up to the limit.
+			out = append(out, tentSolution{outGain - gain, tent{crossing, l.max, l.max}})
+		} else {
+			// Case 3a2: two tents to keep the gain cancelled up to the limit.
+			if upper == l.def {
+				upper += f2dot14Epsilon
+			}
+			out = append(out,
+				tentSolution{-gain, tent{crossing, upper, l.max}},
+				tentSolution{-gain, tent{upper, l.max, l.max}})
+		}
+	} else {
+		// Case 4: the limit cuts the down slope; chop into two tents.
+		out = append(out, tentSolution{1 - gain, tent{math.Max(l.def, lower), peak, l.max}})
+		if peak < l.max {
+			out = append(out, tentSolution{outGain - gain, tent{peak, l.max, l.max}})
+		}
+	}
+
+	// The negative side.
+	if lower <= l.min {
+		// Case 1neg: lower extends beyond the limit; chop.
+		out = append(out, tentSolution{supportScalar(l.min, t) - gain, tent{l.min, l.min, l.def}})
+	} else {
+		// Case 2neg: two tents to keep the gain cancelled down to the limit.
+		if lower == l.def {
+			lower -= f2dot14Epsilon
+		}
+		out = append(out,
+			tentSolution{-gain, tent{l.min, lower, l.def}},
+			tentSolution{-gain, tent{l.min, l.min, lower}})
+	}
+
+	return out
+}
+
+// rebaseTent solves a tent against a limit and renormalizes the resulting
+// tents to the new axis range. Parts with a zero scalar are dropped.
+func rebaseTent(t tent, l axisLimit) []tentSolution {
+	var sols []tentSolution
+	for _, s := range solveTent(t, l) {
+		if s.scalar == 0 {
+			continue
+		}
+		if s.tent != (tent{}) {
+			s.tent = tent{l.renormalize(s.tent[0]), l.renormalize(s.tent[1]), l.renormalize(s.tent[2])}
+		}
+		sols = append(sols, s)
+	}
+	return sols
+}
+
+// tupleDelta is a tuple variation with dense (interpolated) deltas.
+type tupleDelta struct {
+	axes []tent
+	x, y []float64 // y is nil for single-dimension stores (cvar, regions)
+}
+
+// scaled returns a copy of the tuple with its deltas multiplied by s.
+func (tv tupleDelta) scaled(s float64) tupleDelta {
+	out := tupleDelta{axes: append([]tent(nil), tv.axes...)}
+	out.x = make([]float64, len(tv.x))
+	for i, d := range tv.x {
+		out.x[i] = d * s
+	}
+	if tv.y != nil {
+		out.y = make([]float64, len(tv.y))
+		for i, d := range tv.y {
+			out.y[i] = d * s
+		}
+	}
+	return out
+}
+
+// keptAxes returns the indices of the axes that stay variable under the
+// limits: all but the pinned ones.
+func keptAxes(limits []*axisLimit) []int {
+	var keep []int
+	for i, l := range limits {
+		if l == nil || !l.pinned() {
+			keep = append(keep, i)
+		}
+	}
+	return keep
+}
+
+// limitTuples rebases tuples onto the axis limits (one entry per axis, nil
+// for axes that are not restricted). Pinned axes are removed from the
+// regions. Tuples with identical regions are merged. The deltas of tuples
+// that end up applying everywhere are summed into gainX and gainY; they
+// describe the shift of the default location.
+func limitTuples(tuples []tupleDelta, limits []*axisLimit) (out []tupleDelta, gainX, gainY []float64) {
+	for i, l := range limits {
+		if l == nil {
+			continue
+		}
+		var next []tupleDelta
+		for _, tv := range tuples {
+			t := tv.axes[i]
+			if t[1] == 0 {
+				next = append(next, tv)
+				continue
+			}
+			var sols []tentSolution
+			if l.pinned() {
+				if s := supportScalar(l.def, t); s != 0 {
+					sols = []tentSolution{{scalar: s}}
+				}
+			} else {
+				sols = rebaseTent(t, *l)
+			}
+			for _, s := range sols {
+				nt := tv.scaled(s.scalar)
+				nt.axes[i] = s.tent
+				next = append(next, nt)
+			}
+		}
+		tuples = next
+	}
+
+	if keep := keptAxes(limits); len(keep) < len(limits) {
+		for j, tv := range tuples {
+			axes := make([]tent, len(keep))
+			for k, i := range keep {
+				axes[k] = tv.axes[i]
+			}
+			tuples[j].axes = axes
+		}
+	}
+
+	// Quantize regions to F2DOT14 and merge tuples with the same region.
+	index := make(map[string]int)
+	for _, tv := range tuples {
+		key := make([]byte, 0, len(tv.axes)*6)
+		gain := true
+		for i, t := range tv.axes {
+			for j := range t {
+				tv.axes[i][j] = float64(quantizeF2DOT14(t[j])) / (1 << 14)
+			}
+			if tv.axes[i][1] == 0 {
+				tv.axes[i] = tent{}
+			} else {
+				gain = false
+			}
+			for _, v := range tv.axes[i] {
+				q := uint16(quantizeF2DOT14(v))
+				key = append(key, byte(q>>8), byte(q))
+			}
+		}
+
+		if gain {
+			gainX = addDeltas(gainX, tv.x)
+			gainY = addDeltas(gainY, tv.y)
+			continue
+		}
+		if j, ok := index[string(key)]; ok {
+			out[j].x = addDeltas(out[j].x, tv.x)
+			out[j].y = addDeltas(out[j].y, tv.y)
+			continue
+		}
+		index[string(key)] = len(out)
+		out = append(out, tv)
+	}
+
+	return out, gainX, gainY
+}
+
+// addDeltas adds src to dst element-wise, allocating dst if needed.
+func addDeltas(dst, src []float64) []float64 {
+	if src == nil {
+		return dst
+	}
+	if dst == nil {
+		dst = make([]float64, len(src))
+	}
+	for i, d := range src {
+		dst[i] += d
+	}
+	return dst
+}
+
+// quantizeF2DOT14 rounds a normalized coordinate to F2DOT14.
+func quantizeF2DOT14(v float64) int16 {
+	q := math.Round(v * (1 << 14))
+	return int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, q)))
+}
+
+// roundDeltas rounds deltas to integers. Returns false if all are zero.
+func roundDeltas(deltas []float64) ([]int16, bool) {
+	out := make([]int16, len(deltas))
+	nonZero := false
+	for i, d := range deltas {
+		out[i] = int16(math.Round(d))
+		if out[i] != 0 {
+			nonZero = true
+		}
+	}
+	return out, nonZero
+}
+
+// tentsFromTuple converts a decoded tuple region to tents.
+func tentsFromTuple(tv ot.TupleVariation) []tent {
+	axes := make([]tent, len(tv.Peak))
+	for i, peak := range tv.Peak {
+		p := float64(peak) / (1 << 14)
+		if tv.Start != nil && tv.End != nil {
+			axes[i] = tent{float64(tv.Start[i]) / (1 << 14), p, float64(tv.End[i]) / (1 << 14)}
+		} else {
+			axes[i] = tent{math.Min(p, 0), p, math.Max(p, 0)}
+		}
+	}
+	return axes
+}
+
+// encodeTupleVariations serializes tuples as a tuple variation store with
+// embedded peaks and deltas for all points. headerSize bytes are reserved
+// in front of tupleVariationCount (4 for cvar, 0 for gvar); the data offset
+// is relative to the start of the returned data. Tuples whose rounded
+// deltas are all zero are dropped. Returns nil if no tuple remains.
+func encodeTupleVariations(tuples []tupleDelta, axisCount, headerSize int) []byte {
+	var headers []byte
+	serialized := []byte{0} // Shared point numbers: all points
+	count := 0
+	for _, tv := range tuples {
+		x, nonZeroX := roundDeltas(tv.x)
+		y, nonZeroY := roundDeltas(tv.y)
+		if !nonZeroX && !nonZeroY {
+			continue
+		}
+
+		data := packDeltas(x)
+		if tv.y != nil {
+			data = append(data, packDeltas(y)...)
+		}
+		if len(data) > 0xFFFF {
+			continue
+		}
+
+		intermediate := false
+		for _, t := range tv.axes {
+			if t[0] != math.Min(t[1], 0) || t[2] != math.Max(t[1], 0) {
+				intermediate = true
+			}
+		}
+		tupleIndex := uint16(0x8000) // Embedded peak tuple
+		if intermediate {
+			tupleIndex |= 0x4000
+		}
+
+		header := make([]byte, 4, 4+axisCount*6)
+		binary.BigEndian.PutUint16(header[0:], uint16(len(data)))
+		binary.BigEndian.PutUint16(header[2:], tupleIndex)
+		for _, t := range tv.axes {
+			header = binary.BigEndian.AppendUint16(header, uint16(quantizeF2DOT14(t[1])))
+		}
+		if intermediate {
+			for _, t := range tv.axes {
+				header = binary.BigEndian.AppendUint16(header, uint16(quantizeF2DOT14(t[0])))
+			}
+			for _, t := range tv.axes {
+				header = binary.BigEndian.AppendUint16(header, uint16(quantizeF2DOT14(t[2])))
+			}
+		}
+
+		headers = append(headers, header...)
+		serialized = append(serialized, data...)
+		count++
+	}
+	if count == 0 {
+		return nil
+	}
+
+	dataOffset := headerSize + 4 + len(headers)
+	out := make([]byte, headerSize+4, dataOffset+len(serialized))
+	binary.BigEndian.PutUint16(out[headerSize:], uint16(count)|0x8000) // Shared point numbers
+	binary.BigEndian.PutUint16(out[headerSize+2:], uint16(dataOffset))
+	out = append(out, headers...)
+	out = append(out, serialized...)
+	return out
+}
+
+// packDeltas encodes deltas as runs of zero, byte and word values.
+func packDeltas(deltas []int16) []byte {
+	var out []byte
+	for i := 0; i < len(deltas); {
+		start := i
+		switch {
+		case deltas[i] == 0:
+			for i < len(deltas) && i-start < 64 && deltas[i] == 0 {
+				i++
+			}
+			out = append(out, 0x80|byte(i-start-1))
+		case deltas[i] >= -128 && deltas[i] <= 127:
+			for i < len(deltas) && i-start < 64 && deltas[i] != 0 && deltas[i] >= -128 && deltas[i] <= 127 {
+				i++
+			}
+			out = append(out, byte(i-start-1))
+			for _, d := range deltas[start:i] {
+				out = append(out, byte(int8(d)))
+			}
+		default:
+			for i < len(deltas) && i-start < 64 && (deltas[i] < -128 || deltas[i] > 127) {
+				i++
+			}
+			out = append(out, 0x40|byte(i-start-1))
+			for _, d := range deltas[start:i] {
+				out = binary.BigEndian.AppendUint16(out, uint16(d))
+			}
+		}
+	}
+	return out
+}
+
+// densifyTuples converts decoded tuples to dense deltas over numPoints
+// points. If coords is non-nil, missing deltas are interpolated with IUP,
+// otherwise they are zero.
+func densifyTuples(tuples []ot.TupleVariation, numPoints int, coords []ot.SimpleGlyphPoint, endPts []int) []tupleDelta {
+	out := make([]tupleDelta, 0, len(tuples))
+	for _, tv := range tuples {
+		td := tupleDelta{axes: tentsFromTuple(tv), x: make([]float64, numPoints)}
+		if tv.YDeltas != nil {
+			td.y = make([]float64, numPoints)
+		}
+		set := func(i, pt int) {
+			if pt >= numPoints || i >= len(tv.XDeltas) {
+				return
+			}
+			td.x[pt] = float64(tv.XDeltas[i])
+			if td.y != nil && i < len(tv.YDeltas) {
+				td.y[pt] = float64(tv.YDeltas[i])
+			}
+		}
+
+		if tv.Points == nil {
+			for i := 0; i < numPoints; i++ {
+				set(i, i)
+			}
+		} else {
+			touched := make([]bool, numPoints)
+			for i, pt := range tv.Points {
+				set(i, pt)
+				if pt < numPoints {
+					touched[pt] = true
+				}
+			}
+			if coords != nil && td.y != nil {
+				ot.InferDeltas(td.x, td.y, touched, coords, endPts)
+			}
+		}
+		out = append(out, td)
+	}
+	return out
+}
+
+// computeAxisLimits resolves the limited (and pinned) axes of a partially
+// instanced font to normalized ranges and the new default location.
+func (p *Plan) computeAxisLimits() {
+	if p.fvar == nil || !p.input.HasLimitedAxes() {
+		return
+	}
+
+	axes := p.fvar.AxisInfos()
+	p.limitedAxes = make([]*limitedAxis, len(axes))
+	for i, axis := range axes {
+		var r AxisRange
+		if v, pinned := p.input.pinnedAxes[axis.Tag]; pinned {
+			r = AxisRange{Min: v, Default: v, Max: v}
+		} else if lr, limited := p.input.limitedAxes[axis.Tag]; limited {
+			r = lr
+		} else {
+			continue
+		}
+		r.Min = clampAxisValue(r.Min, axis.MinValue, axis.MaxValue)
+		r.Max = clampAxisValue(r.Max, r.Min, axis.MaxValue)
+		r.Default = clampAxisValue(r.Default, r.Min, r.Max)
+
+		normalize := func(v float32) int {
+			return floatToF2DOT14(p.fvar.NormalizeAxisValue(i, v))
+		}
+		distNeg := float64(axis.DefaultValue - axis.MinValue)
+		distPos := float64(axis.MaxValue - axis.DefaultValue)
+		la := &limitedAxis{user: r}
+		la.normalized = axisLimit{
+			min:     float64(normalize(r.Min)) / (1 << 14),
+			def:     float64(normalize(r.Default)) / (1 << 14),
+			max:     float64(normalize(r.Max)) / (1 << 14),
+			distNeg: distNeg,
+			distPos: distPos,
+		}
+		la.mapped = axisLimit{
+			min:     float64(p.avar.MapValue(i, normalize(r.Min))) / (1 << 14),
+			def:     float64(p.avar.MapValue(i, normalize(r.Default))) / (1 << 14),
+			max:     float64(p.avar.MapValue(i, normalize(r.Max))) / (1 << 14),
+			distNeg: distNeg,
+			distPos: distPos,
+		}
+		p.limitedAxes[i] = la
+	}
+}
+
+// IsPartiallyInstanced returns true if the plan restricts axis ranges but
+// keeps the font variable.
+func (p *Plan) IsPartiallyInstanced() bool {
+	return p.limitedAxes != nil
+}
+
+// tupleLimits returns the avar-mapped limits per axis (nil for free axes).
+func (p *Plan) tupleLimits() []*axisLimit {
+	limits := make([]*axisLimit, len(p.limitedAxes))
+	for i, la := range p.limitedAxes {
+		if la != nil {
+			limits[i] = &la.mapped
+		}
+	}
+	return limits
+}
+
+// instanceLimits pins every axis at the instance location of a fully
+// instanced font, so that limit moves all deltas into the shifts.
+func (p *Plan) instanceLimits() []*axisLimit {
+	limits := make([]*axisLimit, len(p.normalizedCoords))
+	for i, c := range p.normalizedCoords {
+		v := float64(c) / (1 << 14)
+		limits[i] = &axisLimit{min: v, def: v, max: v}
+	}
+	return limits
+}
+
+// instancedGlyph is a glyph moved to the instance location (or, for partial
+// instancing, to the new default location).
+type instancedGlyph struct {
+	glyph []byte
+	// variations holds the rebased GlyphVariationData (partial instancing).
+	variations []byte
+	// phantomX holds the x deltas of the four phantom points.
+	phantomX [4]float64
+}
+
+// instanceGlyph applies the gvar deltas at the instance location to a glyph.
+// Simple glyphs get their points moved, composite glyphs their component
+// offsets, and the bounding box is recomputed. For partial instancing the
+// glyph's variations are rebased onto the axis limits as well.
+func (p *Plan) instanceGlyph(gid ot.GlyphID) *instancedGlyph {
+	if ig, ok := p.instancedGlyphs[gid]; ok {
+		return ig
+	}
+	if p.instancedGlyphs == nil {
+		p.instancedGlyphs = make(map[ot.GlyphID]*instancedGlyph)
+	}
+	ig := &instancedGlyph{}
+	p.instancedGlyphs[gid] = ig
+	if p.glyf == nil {
+		return ig
+	}
+	ig.glyph = p.glyf.GetGlyphBytes(gid)
+	if p.gvar == nil || !p.gvar.HasData() || p.normalizedCoords == nil {
+		return ig
+	}
+
+	// Collect the points (outline points or components, plus 4 phantom
+	// points) and the contour structure needed for IUP.
+	glyphBytes := ig.glyph
+	var coords []ot.SimpleGlyphPoint
+	var endPts []int
+	numPoints := 0
+	numberOfContours := 0
+	if len(glyphBytes) >= 10 {
+		numberOfContours = int(int16(binary.BigEndian.Uint16(glyphBytes[0:])))
+		if numberOfContours > 0 {
+			points, _, err := ot.ParseSimpleGlyph(glyphBytes)
+			if err != nil {
+				return ig
+			}
+			coords = append(points, make([]ot.SimpleGlyphPoint, 4)...)
+			numPoints = len(points)
+			for i := 0; i < numberOfContours; i++ {
+				endPts = append(endPts, int(binary.BigEndian.Uint16(glyphBytes[10+i*2:])))
+			}
+		} else if numberOfContours < 0 {
+			numPoints = len(ot.ParseCompositeGlyph(glyphBytes))
+		}
+	}
+
+	tuples := densifyTuples(p.gvar.GetGlyphTupleVariations(gid, numPoints+4), numPoints+4, coords, endPts)
+	var gainX, gainY []float64
+	if p.IsPartiallyInstanced() {
+		var out []tupleDelta
+		out, gainX, gainY = limitTuples(tuples, p.tupleLimits())
+		ig.variations = encodeTupleVariations(out, len(keptAxes(p.tupleLimits())), 0)
+	} else {
+		gainX, gainY = instanceTuples(tuples, p.normalizedCoords)
+	}
+
+	if gainX != nil {
+		copy(ig.phantomX[:], gainX[numPoints:])
+		x, _ := roundDeltas(gainX[:numPoints])
+		y, _ := roundDeltas(gainY[:numPoints])
+		if numberOfContours > 0 {
+			ig.glyph = ot.InstanceSimpleGlyph(glyphBytes, x, y)
+		} else if numberOfContours < 0 {
+			ig.glyph = ot.InstanceCompositeGlyph(glyphBytes, x, y)
+		}
+	}
+
+	// The bounds of a composite depend on its (instanced) components even
+	// if the composite itself has no variations.
+	if numberOfContours < 0 {
+		ig.glyph = p.updateCompositeBounds(ig.glyph)
+	}
+	return ig
+}
+
+// instanceTuples sums the deltas of all tuples at a location given in
+// F2DOT14 normalized coordinates.
+func instanceTuples(tuples []tupleDelta, coords []int) (x, y []float64) {
+	for _, tv := range tuples {
+		scalar := 1.0
+		for i, t := range tv.axes {
+			v := 0.0
+			if i < len(coords) {
+				v = float64(coords[i]) / (1 << 14)
+			}
+			if scalar *= supportScalar(v, t); scalar == 0 {
+				break
+			}
+		}
+		if scalar != 0 {
+			s := tv.scaled(scalar)
+			x = addDeltas(x, s.x)
+			y = addDeltas(y, s.y)
+		}
+	}
+	return x, y
+}
+
+// maxCompositeDepth limits the nesting of composite glyphs.
+const maxCompositeDepth = 8
+
+// instancedGlyphPoints returns the outline points of an instanced glyph in
+// font units, with composite components resolved.
+func (p *Plan) instancedGlyphPoints(gid ot.GlyphID, depth int) [][2]float64 {
+	if depth > maxCompositeDepth {
+		return nil
+	}
+	return p.glyphPoints(p.instanceGlyph(gid).glyph, depth)
+}
+
+// glyphPoints returns the outline points of glyph data, resolving the
+// components of composite glyphs with their instanced outlines.
+func (p *Plan) glyphPoints(data []byte, depth int) [][2]float64 {
+	if len(data) < 10 {
+		return nil
+	}
+	if int16(binary.BigEndian.Uint16(data)) >= 0 {
+		points, _, _ := ot.ParseSimpleGlyph(data)
+		out := make([][2]float64, len(points))
+		for i, pt := range points {
+			out[i] = [2]float64{float64(pt.X), float64(pt.Y)}
+		}
+		return out
+	}
+
+	var out [][2]float64
+	for _, c := range ot.ParseCompositeGlyph(data) {
+		child := p.instancedGlyphPoints(c.GlyphID, depth+1)
+		for i, pt := range child {
+			child[i] = [2]float64{
+				pt[0]*float64(c.ScaleX) + pt[1]*float64(c.Scale10),
+				pt[0]*float64(c.Scale01) + pt[1]*float64(c.ScaleY),
+			}
+		}
+
+		var dx, dy float64
+		if c.HasXYOffset() {
+			dx, dy = float64(c.Arg1), float64(c.Arg2)
+		} else if int(c.Arg1) < len(out) && int(c.Arg2) < len(child) {
+			// Align a point of the component with a point of the glyph so far
+			dx = out[c.Arg1][0] - child[c.Arg2][0]
+			dy = out[c.Arg1][1] - child[c.Arg2][1]
+		}
+		for _, pt := range child {
+			out = append(out, [2]float64{pt[0] + dx, pt[1] + dy})
+		}
+	}
+	return out
+}
+
+// updateCompositeBounds recomputes the bounding box of a composite glyph
+// from its instanced components.
+func (p *Plan) updateCompositeBounds(data []byte) []byte {
+	points := p.glyphPoints(data, 0)
+	if len(points) == 0 {
+		return data
+	}
+	xMin, yMin := points[0][0], points[0][1]
+	xMax, yMax := xMin, yMin
+	for _, pt := range points[1:] {
+		xMin, xMax = math.Min(xMin, pt[0]), math.Max(xMax, pt[0])
+		yMin, yMax = math.Min(yMin, pt[1]), math.Max(yMax, pt[1])
+	}
+
+	result := make([]byte, len(data))
+	copy(result, data)
+	binary.BigEndian.PutUint16(result[2:], uint16(int16(math.Floor(xMin))))
+	binary.BigEndian.PutUint16(result[4:], uint16(int16(math.Floor(yMin))))
+	binary.BigEndian.PutUint16(result[6:], uint16(int16(math.Ceil(xMax))))
+	binary.BigEndian.PutUint16(result[8:], uint16(int16(math.Ceil(yMax))))
+	return result
+}
+
+// phantomAdvanceDelta returns the advance width delta of a glyph derived
+// from its phantom points.
+func (p *Plan) phantomAdvanceDelta(gid ot.GlyphID) float64 {
+	ig := p.instanceGlyph(gid)
+	return ig.phantomX[1] - ig.phantomX[0]
+}
+
+// instancedLsb returns the left side bearing of an instanced glyph. It keeps
+// the relation between the original left side bearing and xMin, taking a
+// moved origin phantom point into account.
+func (p *Plan) instancedLsb(gid ot.GlyphID, lsb int16) int16 {
+	orig := p.glyf.GetGlyphBytes(gid)
+	ig := p.instanceGlyph(gid)
+	if len(orig) < 10 || len(ig.glyph) < 10 {
+		return lsb
+	}
+	oldXMin := int16(binary.BigEndian.Uint16(orig[2:]))
+	newXMin := int16(binary.BigEndian.Uint16(ig.glyph[2:]))
+	return lsb + newXMin - oldXMin - int16(math.Round(ig.phantomX[0]))
+}
+
+// limit rebases the regions of an ItemVariationStore onto the axis limits.
+// Rows and subtables keep their order, so variation indices stay valid.
+// Deltas that apply at the new default are dropped from the store and
+// returned as shifts, indexed like the delta sets; the caller is responsible
+// for baking them into the default values.
+func (s *itemVariationStore) limit(limits []*axisLimit) (*itemVariationStore, [][]float64) {
+	if len(s.regionList) < 4 {
+		return s, nil
+	}
+	axisCount := int(binary.BigEndian.Uint16(s.regionList[0:]))
+	regionCount := int(binary.BigEndian.Uint16(s.regionList[2:]))
+	if axisCount != len(limits) {
+		return s, nil
+	}
+
+	// Rebase every region. The deltas of a region are scaled per resulting
+	// region, so a region is rebased as a single-delta tuple.
+	type regionPart struct {
+		region int
+		scalar float64
+	}
+	parts := make([][]regionPart, regionCount)
+	gains := make([]float64, regionCount)
+	var newRegions [][]tent
+	regionIndex := make(map[string]int)
+	for r := 0; r < regionCount; r++ {
+		axes := make([]tent, axisCount)
+		for a := range axes {
+			off := 4 + (r*axisCount+a)*6
+			for j := 0; j < 3; j++ {
+				axes[a][j] = float64(int16(binary.BigEndian.Uint16(s.regionList[off+j*2:]))) / (1 << 14)
+			}
+		}
+		out, gain, _ := limitTuples([]tupleDelta{{axes: axes, x: []float64{1}}}, limits)
+		if gain != nil {
+			gains[r] = gain[0]
+		}
+		for _, tv := range out {
+			key := make([]byte, 0, axisCount*6)
+			for _, t := range tv.axes {
+				for _, v := range t {
+					key = binary.BigEndian.AppendUint16(key, uint16(quantizeF2DOT14(v)))
+				}
+			}
+			idx, ok := regionIndex[string(key)]
+			if !ok {
+				idx = len(newRegions)
+				regionIndex[string(key)] = idx
+				newRegions = append(newRegions, tv.axes)
+			}
+			parts[r] = append(parts[r], regionPart{idx, tv.x[0]})
+		}
+	}
+
+	// Pinned axes are gone from the regions
+	newAxisCount := len(keptAxes(limits))
+	regionList := make([]byte, 4, 4+len(newRegions)*newAxisCount*6)
+	binary.BigEndian.PutUint16(regionList[0:], uint16(newAxisCount))
+	binary.BigEndian.PutUint16(regionList[2:], uint16(len(newRegions)))
+	for _, axes := range newRegions {
+		for _, t := range axes {
+			for _, v := range t {
+				regionList = binary.BigEndian.AppendUint16(regionList, uint16(quantizeF2DOT14(v)))
+			}
+		}
+	}
+
+	out := &itemVariationStore{regionList: regionList}
+	shifts := make([][]float64, len(s.data))
+	for outer, ivd := range s.data {
+		var columns []uint16
+		columnIndex := make(map[int]int)
+		for _, r := range ivd.regionIndexes {
+			if int(r) >= regionCount {
+				continue
+			}
+			for _, part := range parts[r] {
+				if _, ok := columnIndex[part.region]; !ok {
+					columnIndex[part.region] = len(columns)
+					columns = append(columns, uint16(part.region))
+				}
+			}
+		}
+
+		rows := make([][]int32, len(ivd.rows))
+		shifts[outer] = make([]float64, len(ivd.rows))
+		for i, row := range ivd.rows {
+			deltas := ivd.rowDeltas(row)
+			sums := make([]float64, len(columns))
+			for j, r := range ivd.regionIndexes {
+				if int(r) >= regionCount {
+					continue
+				}
+				shifts[outer][i] += float64(deltas[j]) * gains[r]
+				for _, part := range parts[r] {
+					sums[columnIndex[part.region]] += float64(deltas[j]) * part.scalar
+				}
+			}
+			rows[i] = make([]int32, len(columns))
+			for j, v := range sums {
+				rows[i][j] = int32(math.Round(v))
+			}
+		}
+		out.data = append(out.data, newItemVariationData(columns, rows))
+	}
+	return out, shifts
+}
+
+// rowDeltas decodes a delta set row.
+func (d *itemVariationData) rowDeltas(row []byte) []int32 {
+	wordCount := int(d.wordDeltaCount & 0x7FFF)
+	longWords := d.wordDeltaCount&0x8000 != 0
+	deltas := make([]int32, len(d.regionIndexes))
+	off := 0
+	for i := range deltas {
+		switch {
+		case i < wordCount && longWords:
+			deltas[i] = int32(binary.BigEndian.Uint32(row[off:]))
+			off += 4
+		case i < wordCount || longWords:
+			deltas[i] = int32(int16(binary.BigEndian.Uint16(row[off:])))
+			off += 2
+		default:
+			deltas[i] = int32(int8(row[off]))
+			off++
+		}
+	}
+	return deltas
+}
+
+// newItemVariationData encodes delta rows with the smallest delta sizes.
+// Columns that are zero in every row are dropped, and columns that need the
+// larger size are moved to the front as the format requires.
+func newItemVariationData(regions []uint16, rows [][]int32) *itemVariationData {
+	const (
+		sizeZero = iota
+		sizeByte
+		sizeShort
+		sizeLong
+	)
+	sizes := make([]int, len(regions))
+	longWords := false
+	for _, row := range rows {
+		for j, v := range row {
+			size := sizeZero
+			switch {
+			case v < math.MinInt16 || v > math.MaxInt16:
+				size = sizeLong
+				longWords = true
+			case v < math.MinInt8 || v > math.MaxInt8:
+				size = sizeShort
+			case v != 0:
+				size = sizeByte
+			}
+			sizes[j] = max(sizes[j], size)
+		}
+	}
+
+	// Word columns first, then the rest, dropping unused columns.
+	wordSize := sizeShort
+	if longWords {
+		wordSize = sizeLong
+	}
+	var order []int
+	for j, size := range sizes {
+		if size >= wordSize {
+			order = append(order, j)
+		}
+	}
+	wordCount := len(order)
+	for j, size := range sizes {
+		if size != sizeZero && size < wordSize {
+			order = append(order, j)
+		}
+	}
+
+	ivd := &itemVariationData{
+		wordDeltaCount: uint16(wordCount),
+		regionIndexes:  make([]uint16, len(order)),
+		rows:           make([][]byte, len(rows)),
+	}
+	if longWords {
+		ivd.wordDeltaCount |= 0x8000
+	}
+	for k, j := range order {
+		ivd.regionIndexes[k] = regions[j]
+	}
+	for i, row := range rows {
+		var data []byte
+		for k, j := range order {
+			switch {
+			case k < wordCount && longWords:
+				data = binary.BigEndian.AppendUint32(data, uint32(row[j]))
+			case k < wordCount || longWords:
+				data = binary.BigEndian.AppendUint16(data, uint16(row[j]))
+			default:
+				data = append(data, byte(int8(row[j])))
+			}
+		}
+		ivd.rows[i] = data
+	}
+	return ivd
+}
+
+// limitVariationTable rebuilds a glyph-independent variation table for the
+// limited axes.
+func (p *Plan) limitVariationTable(tag ot.Tag) ([]byte, error) {
+	switch tag {
+	case ot.TagFvar:
+		return p.limitFvar()
+	case ot.TagAvar:
+		return p.limitAvar()
+	case ot.TagMvar:
+		return p.limitMvar()
+	case ot.TagSTAT:
+		return p.limitSTAT()
+	case ot.TagCvar:
+		_, cvar, err := p.limitCvar()
+		return cvar, err
+	}
+	return p.source.TableData(tag)
+}
+
+// limitFvar restricts the axis ranges in fvar and drops named instances
+// outside of them. Pinned axes are removed.
+func (p *Plan) limitFvar() ([]byte, error) {
+	src, err := p.source.TableData(ot.TagFvar)
+	if err != nil || len(src) < 16 {
+		return nil, ErrInvalidTable
+	}
+	axisOffset := int(binary.BigEndian.Uint16(src[4:]))
+	axisCount := int(binary.BigEndian.Uint16(src[8:]))
+	instanceCount := int(binary.BigEndian.Uint16(src[12:]))
+	instanceSize := int(binary.BigEndian.Uint16(src[14:]))
+	instancesStart := axisOffset + axisCount*20
+	if instancesStart+instanceCount*instanceSize > len(src) || axisCount != len(p.limitedAxes) || instanceSize < 4+axisCount*4 {
+		return nil, ErrInvalidTable
+	}
+
+	keep := keptAxes(p.tupleLimits())
+	newInstanceSize := instanceSize - (axisCount-len(keep))*4
+	data := make([]byte, axisOffset, axisOffset+len(keep)*20+instanceCount*newInstanceSize)
+	copy(data, src)
+	binary.BigEndian.PutUint16(data[8:], uint16(len(keep)))
+	binary.BigEndian.PutUint16(data[14:], uint16(newInstanceSize))
+
+	// VariationAxisRecord: axisTag(4) + minValue(4) + defaultValue(4) +
+	//                      maxValue(4) + flags(2) + axisNameID(2)
+	for _, i := range keep {
+		record := append([]byte(nil), src[axisOffset+i*20:axisOffset+(i+1)*20]...)
+		if la := p.limitedAxes[i]; la != nil {
+			binary.BigEndian.PutUint32(record[4:], floatToFixed(la.user.Min))
+			binary.BigEndian.PutUint32(record[8:], floatToFixed(la.user.Default))
+			binary.BigEndian.PutUint32(record[12:], floatToFixed(la.user.Max))
+		}
+		data = append(data, record...)
+	}
+
+	// InstanceRecord: subfamilyNameID(2) + flags(2) + coordinates(4*axisCount) +
+	//                 [postScriptNameID(2)]
+	kept := 0
+	for n := 0; n < instanceCount; n++ {
+		inst := src[instancesStart+n*instanceSize : instancesStart+(n+1)*instanceSize]
+		inside := true
+		for i, la := range p.limitedAxes {
+			if la == nil {
+				continue
+			}
+			v := fixedToFloat(binary.BigEndian.Uint32(inst[4+i*4:]))
+			if v < la.user.Min || v > la.user.Max {
+				inside = false
+			}
+		}
+		if !inside {
+			continue
+		}
+		data = append(data, inst[:4]...)
+		for _, i := range keep {
+			data = append(data, inst[4+i*4:8+i*4]...)
+		}
+		data = append(data, inst[4+axisCount*4:]...)
+		kept++
+	}
+	binary.BigEndian.PutUint16(data[12:], uint16(kept))
+
+	return data, nil
+}
+
+// limitAvar renormalizes the avar segment maps of limited axes.
+func (p *Plan) limitAvar() ([]byte, error) {
+	if !p.avar.HasData() {
+		return nil, nil
+	}
+	src, err := p.source.TableData(ot.TagAvar)
+	if err != nil || len(src) < 8 {
+		return nil, ErrInvalidTable
+	}
+	axisCount := int(binary.BigEndian.Uint16(src[6:]))
+
+	// Pinned axes are removed
+	data := make([]byte, 8, len(src))
+	copy(data, src[:8])
+	kept := 0
+	for i := 0; i < axisCount; i++ {
+		if i < len(p.limitedAxes) && p.limitedAxes[i] != nil && p.limitedAxes[i].normalized.pinned() {
+			continue
+		}
+		kept++
+		mapping := p.avar.SegmentMap(i)
+		if i < len(p.limitedAxes) && p.limitedAxes[i] != nil {
+			la := p.limitedAxes[i]
+			limited := make(map[int16]int16)
+			for _, m := range mapping {
+				from := float64(m.From) / (1 << 14)
+				if from < la.normalized.min || from > la.normalized.max {
+					continue
+				}
+				to := math.Max(-1, math.Min(1, la.mapped.renormalize(float64(m.To)/(1<<14))))
+				limited[quantizeF2DOT14(la.normalized.renormalize(from))] = quantizeF2DOT14(to)
+			}
+			limited[-1<<14] = -1 << 14
+			limited[0] = 0
+			limited[1<<14] = 1 << 14
+
+			mapping = make([]ot.AxisValueMapping, 0, len(limited))
+			for from, to := range limited {
+				mapping = append(mapping, ot.AxisValueMapping{From: from, To: to})
+			}
+			sort.Slice(mapping, func(a, b int) bool { return mapping[a].From < mapping[b].From })
+		}
+
+		data = binary.BigEndian.AppendUint16(data, uint16(len(mapping)))
+		for _, m := range mapping {
+			data = binary.BigEndian.AppendUint16(data, uint16(m.From))
+			data = binary.BigEndian.AppendUint16(data, uint16(m.To))
+		}
+	}
+	binary.BigEndian.PutUint16(data[6:], uint16(kept))
+	return data, nil
+}
+
+// limitMvar rebases the ItemVariationStore of MVAR. Metric shifts at a moved
+// default are applied to the OS/2, hhea and post values (see mvarShifts).
+func (p *Plan) limitMvar() ([]byte, error) {
+	src, err := p.source.TableData(ot.TagMvar)
+	if err != nil || len(src) < 12 {
+		return nil, ErrInvalidTable
+	}
+	// Header: version(4) + reserved(2) + valueRecordSize(2) +
+	//         valueRecordCount(2) + itemVariationStoreOffset(2) + records
+	recordSize := int(binary.BigEndian.Uint16(src[6:]))
+	recordCount := int(binary.BigEndian.Uint16(src[8:]))
+	storeOff := int(binary.BigEndian.Uint16(src[10:]))
+	headerEnd := 12 + recordSize*recordCount
+	if storeOff == 0 || storeOff >= len(src) || headerEnd > len(src) {
+		return src, nil
+	}
+	store, err := parseItemVariationStore(src[storeOff:])
+	if err != nil {
+		return nil, err
+	}
+	limited, _ := store.limit(p.tupleLimits())
+
+	data := make([]byte, headerEnd)
+	copy(data, src)
+	binary.BigEndian.PutUint16(data[10:], uint16(headerEnd))
+	return append(data, limited.build()...), nil
+}
+
+// mvarField is a metric varied by an MVAR value record.
+type mvarField struct {
+	table  ot.Tag
+	offset int
+}
+
+// mvarFields maps MVAR value tags to the table fields they vary.
+// fontTools equivalent: fontTools.varLib.mvar.MVAR_ENTRIES
+var mvarFields = map[ot.Tag]mvarField{
+	ot.MakeTag('h', 'a', 's', 'c'): {ot.TagOS2, 68},  // sTypoAscender
+	ot.MakeTag('h', 'd', 's', 'c'): {ot.TagOS2, 70},  // sTypoDescender
+	ot.MakeTag('h', 'l', 'g', 'p'): {ot.TagOS2, 72},  // sTypoLineGap
+	ot.MakeTag('h', 'c', 'l', 'a'): {ot.TagOS2, 74},  // usWinAscent
+	ot.MakeTag('h', 'c', 'l', 'd'): {ot.TagOS2, 76},  // usWinDescent
+	ot.MakeTag('x', 'h', 'g', 't'): {ot.TagOS2, 86},  // sxHeight
+	ot.MakeTag('c', 'p', 'h', 't'): {ot.TagOS2, 88},  // sCapHeight
+	ot.MakeTag('s', 'b', 'x', 's'): {ot.TagOS2, 10},  // ySubscriptXSize
+	ot.MakeTag('s', 'b', 'y', 's'): {ot.TagOS2, 12},  // ySubscriptYSize
+	ot.MakeTag('s', 'b', 'x', 'o'): {ot.TagOS2, 14},  // ySubscriptXOffset
+	ot.MakeTag('s', 'b', 'y', 'o'): {ot.TagOS2, 16},  // ySubscriptYOffset
+	ot.MakeTag('s', 'p', 'x', 's'): {ot.TagOS2, 18},  // ySuperscriptXSize
+	ot.MakeTag('s', 'p', 'y', 's'): {ot.TagOS2, 20},  // ySuperscriptYSize
+	ot.MakeTag('s', 'p', 'x', 'o'): {ot.TagOS2, 22},  // ySuperscriptXOffset
+	ot.MakeTag('s', 'p', 'y', 'o'): {ot.TagOS2, 24},  // ySuperscriptYOffset
+	ot.MakeTag('s', 't', 'r', 's'): {ot.TagOS2, 26},  // yStrikeoutSize
+	ot.MakeTag('s', 't', 'r', 'o'): {ot.TagOS2, 28},  // yStrikeoutPosition
+	ot.MakeTag('h', 'c', 'r', 's'): {ot.TagHhea, 18}, // caretSlopeRise
+	ot.MakeTag('h', 'c', 'r', 'n'): {ot.TagHhea, 20}, // caretSlopeRun
+	ot.MakeTag('h', 'c', 'o', 'f'): {ot.TagHhea, 22}, // caretOffset
+	ot.MakeTag('u', 'n', 'd', 'o'): {ot.TagPost, 8},  // underlinePosition
+	ot.MakeTag('u', 'n', 'd', 's'): {ot.TagPost, 10}, // underlineThickness
+}
+
+// mvarShifts returns the MVAR deltas at the new default location of a
+// partially instanced font per value tag, rounded to font units.
+func (p *Plan) mvarShifts() map[ot.Tag]int {
+	if !p.IsPartiallyInstanced() {
+		return nil
+	}
+	src, err := p.source.TableData(ot.TagMvar)
+	if err != nil || len(src) < 12 {
+		return nil
+	}
+	recordSize := int(binary.BigEndian.Uint16(src[6:]))
+	recordCount := int(binary.BigEndian.Uint16(src[8:]))
+	storeOff := int(binary.BigEndian.Uint16(src[10:]))
+	if recordSize < 8 || storeOff == 0 || storeOff >= len(src) || 12+recordSize*recordCount > len(src) {
+		return nil
+	}
+	store, err := parseItemVariationStore(src[storeOff:])
+	if err != nil {
+		return nil
+	}
+	_, shifts := store.limit(p.tupleLimits())
+
+	// ValueRecord: valueTag(4) + deltaSetOuterIndex(2) + deltaSetInnerIndex(2)
+	out := make(map[ot.Tag]int)
+	for i := 0; i < recordCount; i++ {
+		rec := src[12+i*recordSize:]
+		tag := ot.Tag(binary.BigEndian.Uint32(rec[0:]))
+		outer := int(binary.BigEndian.Uint16(rec[4:]))
+		inner := int(binary.BigEndian.Uint16(rec[6:]))
+		if outer < len(shifts) && inner < len(shifts[outer]) {
+			if d := int(math.Round(shifts[outer][inner])); d != 0 {
+				out[tag] = d
+			}
+		}
+	}
+	return out
+}
+
+// applyMvarShifts moves the metrics of an OS/2, hhea or post table to the new
+// default location of a partially instanced font. data is not modified; a
+// changed copy is returned.
+// fontTools equivalent: instancer.instantiateMVAR
+func (p *Plan) applyMvarShifts(table ot.Tag, data []byte) []byte {
+	var out []byte
+	for tag, d := range p.mvarShifts() {
+		f, ok := mvarFields[tag]
+		if !ok || f.table != table || f.offset+2 > len(data) {
+			continue
+		}
+		if out == nil {
+			out = make([]byte, len(data))
+			copy(out, data)
+		}
+		// Unsigned fields wrap the same as signed ones
+		v := int(binary.BigEndian.Uint16(out[f.offset:]))
+		binary.BigEndian.PutUint16(out[f.offset:], uint16(v+d))
+	}
+	if out == nil {
+		return data
+	}
+	return out
+}
+
+// limitSTAT drops the axis values of STAT that lie outside of the axis
+// limits and clips the ranges of format 2 axis values. Design axes are kept.
+// fontTools equivalent: instancer.instantiateSTAT
+func (p *Plan) limitSTAT() ([]byte, error) {
+	src, err := p.source.TableData(ot.TagSTAT)
+	if err != nil || len(src) < 18 {
+		return nil, ErrInvalidTable
+	}
+	// Header: majorVersion(2) + minorVersion(2) + designAxisSize(2) +
+	//         designAxisCount(2) + designAxesOffset(4) + axisValueCount(2) +
+	//         offsetToAxisValueOffsets(4) + [elidedFallbackNameID(2)]
+	headerSize := 18
+	if binary.BigEndian.Uint16(src[2:]) >= 1 {
+		headerSize = 20
+	}
+	axisSize := int(binary.BigEndian.Uint16(src[4:]))
+	axisCount := int(binary.BigEndian.Uint16(src[6:]))
+	axesOff := int(binary.BigEndian.Uint32(src[8:]))
+	valueCount := int(binary.BigEndian.Uint16(src[12:]))
+	valuesOff := int(binary.BigEndian.Uint32(src[14:]))
+	if len(src) < headerSize || axisSize < 4 || axesOff+axisCount*axisSize > len(src) ||
+		(valueCount > 0 && valuesOff+valueCount*2 > len(src)) {
+		return nil, ErrInvalidTable
+	}
+
+	// The limits of the STAT design axes, found by tag
+	limits := make([]*AxisRange, axisCount)
+	for i, axis := range p.fvar.AxisInfos() {
+		la := p.limitedAxes[i]
+		if la == nil {
+			continue
+		}
+		for j := range limits {
+			if ot.Tag(binary.BigEndian.Uint32(src[axesOff+j*axisSize:])) == axis.Tag {
+				limits[j] = &la.user
+			}
+		}
+	}
+	inside := func(axisIndex int, v uint32) bool {
+		if axisIndex >= axisCount || limits[axisIndex] == nil {
+			return true
+		}
+		f := fixedToFloat(v)
+		return f >= limits[axisIndex].Min && f <= limits[axisIndex].Max
+	}
+
+	var values [][]byte
+	for i := 0; i < valueCount; i++ {
+		off := valuesOff + int(binary.BigEndian.Uint16(src[valuesOff+i*2:]))
+		if off+4 > len(src) {
+			continue
+		}
+		var size int
+		switch format := binary.BigEndian.Uint16(src[off:]); format {
+		case 1:
+			size = 12 // format, axisIndex, flags, valueNameID, value
+		case 2:
+			size = 20 // ... nominalValue, rangeMinValue, rangeMaxValue
+		case 3:
+			size = 16 // ... value, linkedValue
+		case 4:
+			size = 8 + int(binary.BigEndian.Uint16(src[off+2:]))*6 // axisCount, ..., axisValues[]
+		}
+		if size == 0 || off+size > len(src) {
+			continue
+		}
+		value := append([]byte(nil), src[off:off+size]...)
+		axisIndex := int(binary.BigEndian.Uint16(value[2:]))
+
+		keep := true
+		switch binary.BigEndian.Uint16(value[0:]) {
+		case 1, 3:
+			keep = inside(axisIndex, binary.BigEndian.Uint32(value[8:]))
+		case 2:
+			keep = inside(axisIndex, binary.BigEndian.Uint32(value[8:]))
+			if keep && axisIndex < axisCount && limits[axisIndex] != nil {
+				lo := clampAxisValue(fixedToFloat(binary.BigEndian.Uint32(value[12:])), limits[axisIndex].Min, limits[axisIndex].Max)
+				hi := clampAxisValue(fixedToFloat(binary.BigEndian.Uint32(value[16:])), limits[axisIndex].Min, limits[axisIndex].Max)
+				binary.BigEndian.PutUint32(value[12:], floatToFixed(lo))
+				binary.BigEndian.PutUint32(value[16:], floatToFixed(hi))
+			}
+		case 4:
+			// AxisValueRecord: axisIndex(2) + value(4)
+			for j := 8; j < size; j += 6 {
+				if !inside(int(binary.BigEndian.Uint16(value[j:])), binary.BigEndian.Uint32(value[j+2:])) {
+					keep = false
+				}
+			}
+		}
+		if keep {
+			values = append(values, value)
+		}
+	}
+
+	axesSize := axisCount * axisSize
+	data := make([]byte, headerSize+axesSize+len(values)*2)
+	copy(data, src[:headerSize])
+	copy(data[headerSize:], src[axesOff:axesOff+axesSize])
+	valuesStart := headerSize + axesSize
+	binary.BigEndian.PutUint32(data[8:], uint32(headerSize))
+	binary.BigEndian.PutUint16(data[12:], uint16(len(values)))
+	binary.BigEndian.PutUint32(data[14:], uint32(valuesStart))
+	for i, value := range values {
+		binary.BigEndian.PutUint16(data[valuesStart+i*2:], uint16(len(data)-valuesStart))
+		data = append(data, value...)
+	}
+	return data, nil
+}
+
+// limitCvar rebases cvar onto the axis limits and returns the new cvt and
+// cvar tables. CVT shifts at a moved default are baked into cvt.
+func (p *Plan) limitCvar() (cvt, cvar []byte, err error) {
+	cvt, err = p.source.TableData(ot.TagCvt)
+	if err != nil {
+		return nil, nil, err
+	}
+	src, err := p.source.TableData(ot.TagCvar)
+	if err != nil {
+		return cvt, nil, nil
+	}
+	tuples, err := ot.ParseCvar(src, p.fvar.AxisCount(), len(cvt)/2)
+	if err != nil {
+		return cvt, nil, err
+	}
+
+	out, gain, _ := limitTuples(densifyTuples(tuples, len(cvt)/2, nil, nil), p.tupleLimits())
+	if gain != nil {
+		shifted := make([]byte, len(cvt))
+		copy(shifted, cvt)
+		for i, d := range gain {
+			v := int16(binary.BigEndian.Uint16(cvt[i*2:])) + int16(math.Round(d))
+			binary.BigEndian.PutUint16(shifted[i*2:], uint16(v))
+		}
+		cvt = shifted
+	}
+
+	cvar = encodeTupleVariations(out, len(keptAxes(p.tupleLimits())), 4)
+	if cvar != nil {
+		binary.BigEndian.PutUint16(cvar[0:], 1) // majorVersion
+		binary.BigEndian.PutUint16(cvar[2:], 0) // minorVersion
+	}
+	return cvt, cvar, nil
+}
+
+// clampAxisValue clamps an axis value to the range [lo, hi].
+func clampAxisValue(v, lo, hi float32) float32 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// floatToFixed converts a float32 to a 16.16 fixed-point number.
+func floatToFixed(v float32) uint32 {
+	return uint32(int32(math.Round(float64(v) * 65536)))
+}
+
+// fixedToFloat converts a 16.16 fixed-point number to float32.
+func fixedToFloat(v uint32) float32 {
+	return float32(int32(v)) / 65536
+}
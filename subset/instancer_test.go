@@ -0,0 +1,65 @@
+package subset
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRebaseTent(t *testing.T) {
+	tests := []struct {
+		name  string
+		tent  tent
+		limit axisLimit
+		want  []tentSolution
+	}{
+		{
+			name:  "peak beyond new maximum",
+			tent:  tent{0, 1, 1},
+			limit: axisLimit{min: -1, def: 0, max: 0.5, distNeg: 1, distPos: 1},
+			want:  []tentSolution{{0.5, tent{0, 1, 1}}},
+		},
+		{
+			name:  "default moved into the tent",
+			tent:  tent{0, 1, 1},
+			limit: axisLimit{min: -1, def: 0.5, max: 1, distNeg: 1, distPos: 1},
+			want: []tentSolution{
+				{0.5, tent{}},
+				{0.5, tent{0, 1, 1}},
+				{-0.5, tent{-1, -1.0 / 3, 0}},
+				{-0.5, tent{-1, -1, -1.0 / 3}},
+			},
+		},
+		{
+			name:  "tent outside the range",
+			tent:  tent{0.5, 1, 1},
+			limit: axisLimit{min: -1, def: 0, max: 0.25, distNeg: 1, distPos: 1},
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		got := rebaseTent(tt.tent, tt.limit)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			same := math.Abs(got[i].scalar-tt.want[i].scalar) < 1e-9
+			for j := range got[i].tent {
+				same = same && math.Abs(got[i].tent[j]-tt.want[i].tent[j]) < 1e-9
+			}
+			if !same {
+				t.Errorf("%s: solution %d = %v, want %v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestPackDeltas(t *testing.T) {
+	deltas := []int16{0, 0, 0, 5, -3, 300, 0, 1}
+	want := []byte{0x82, 0x01, 5, 0xFD, 0x40, 0x01, 0x2C, 0x80, 0x00, 1}
+	got := packDeltas(deltas)
+	if string(got) != string(want) {
+		t.Errorf("packDeltas = % x, want % x", got, want)
+	}
+}
@@ -0,0 +1,735 @@
+package subset
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/boxesandglue/textshape/ot"
+)
+
+// This file contains the parts of GSUB/GPOS subsetting that are shared by
+// both tables: selecting the lookups of retained features and rebuilding the
+// ScriptList, FeatureList, LookupList and FeatureVariations with remapped
+// indices.
+// HarfBuzz equivalent: hb-ot-layout-common.hh (ScriptList/FeatureList subset)
+
+// lookupBuilder holds a subsetted lookup ready for serialization.
+type lookupBuilder struct {
+	lookupType    uint16
+	flag          uint16
+	markFilter    uint16 // Only written if flag has useMarkFilteringSet
+	extensionType uint16 // Wrapped lookup type if lookupType is an extension
+	subtables     [][]byte
+	err           error // Set if a subtable does not fit its own offsets
+}
+
+// featureRecord is a retained feature with remapped lookup indices.
+type featureRecord struct {
+	tag     ot.Tag
+	lookups []uint16
+	params  []byte // FeatureParams table, nil if absent
+}
+
+// featureVariation is a FeatureVariationRecord: while all conditions hold,
+// the lookups of the substituted features are replaced.
+type featureVariation struct {
+	conditions    []axisCondition
+	substitutions []featureSubstitution
+}
+
+// axisCondition is a Format 1 condition: the normalized coordinate (F2DOT14,
+// after avar) of an axis lies within min and max.
+type axisCondition struct {
+	axis     uint16
+	min, max int16
+}
+
+// featureSubstitution replaces the lookups of a feature.
+type featureSubstitution struct {
+	feature uint16
+	lookups []uint16
+}
+
+// scriptRecord is a retained script with remapped language systems.
+type scriptRecord struct {
+	tag      ot.Tag
+	langSys  []langSysRecord
+	dfltLang *langSysRecord
+}
+
+// langSysRecord is a retained language system with remapped feature indices.
+type langSysRecord struct {
+	tag      ot.Tag
+	reqFeat  uint16
+	features []uint16
+}
+
+// featureLookups returns the sorted lookup indices referenced by all features
+// the input retains, in the FeatureList (with the applied substitutions) and
+// in the feature variations.
+func (p *Plan) featureLookups(featList *ot.FeatureList, variations []featureVariation, applied map[uint16][]uint16) []uint16 {
+	lookupSet := make(map[uint16]bool)
+	kept := make(map[uint16]bool)
+	for i := 0; i < featList.Count(); i++ {
+		feat, err := featList.GetFeature(i)
+		if err != nil || !p.input.ShouldKeepFeature(feat.Tag) {
+			continue
+		}
+		kept[uint16(i)] = true
+		lookups := feat.Lookups
+		if alt, ok := applied[uint16(i)]; ok {
+			lookups = alt
+		}
+		for _, idx := range lookups {
+			lookupSet[idx] = true
+		}
+	}
+	for _, v := range variations {
+		for _, fs := range v.substitutions {
+			if kept[fs.feature] {
+				for _, idx := range fs.lookups {
+					lookupSet[idx] = true
+				}
+			}
+		}
+	}
+
+	lookups := make([]uint16, 0, len(lookupSet))
+	for idx := range lookupSet {
+		lookups = append(lookups, idx)
+	}
+	sort.Slice(lookups, func(i, j int) bool { return lookups[i] < lookups[j] })
+	return lookups
+}
+
+// lookupClosure extends lookups with all lookups reachable through nested
+// lookup records and returns the sorted result. nested returns the lookup
+// indices referenced by the context subtables of a lookup.
+func lookupClosure(lookups []uint16, nested func(idx uint16) []uint16) []uint16 {
+	seen := make(map[uint16]bool)
+	queue := append([]uint16{}, lookups...)
+	for _, idx := range queue {
+		seen[idx] = true
+	}
+
+	for len(queue) > 0 {
+		idx := queue[0]
+		queue = queue[1:]
+		for _, n := range nested(idx) {
+			if !seen[n] {
+				seen[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+
+	result := make([]uint16, 0, len(seen))
+	for idx := range seen {
+		result = append(result, idx)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// featureVariations returns the FeatureVariations records that stay in the
+// subset, with the original feature and lookup indices, together with the
+// alternate lookup lists that replace the ones of the FeatureList.
+// A fully instanced font keeps no records: the record matching the instance
+// is applied. For partial instancing, conditions are limited to the new axis
+// ranges and moved off pinned axes. Records that can no longer match are
+// dropped; the first record that matches everywhere is applied and ends the
+// list. Earlier records substitute the original lookups of the features it
+// replaces, so they keep their effect.
+// fontTools equivalent: fontTools.varLib.instancer.featureVars
+func (p *Plan) featureVariations(featList *ot.FeatureList, fv *ot.FeatureVariations) (records []featureVariation, applied map[uint16][]uint16) {
+	if fv.RecordCount() == 0 {
+		return nil, nil
+	}
+	if p.IsInstanced() {
+		if idx := fv.FindIndex(p.normalizedCoords); idx != ot.VariationsNotFoundIndex {
+			applied = make(map[uint16][]uint16)
+			for _, fs := range fv.Substitutions(int(idx)) {
+				applied[fs.FeatureIndex] = fs.Lookups
+			}
+		}
+		return nil, applied
+	}
+
+	var limits []*axisLimit
+	var axisMap map[int]int
+	if p.IsPartiallyInstanced() {
+		limits = p.tupleLimits()
+		axisMap = make(map[int]int)
+		for newAxis, axis := range keptAxes(limits) {
+			axisMap[axis] = newAxis
+		}
+	}
+
+	for i := 0; i < fv.RecordCount(); i++ {
+		conditions, ok := fv.Conditions(i)
+		if !ok {
+			continue
+		}
+		var rec featureVariation
+		for _, c := range conditions {
+			var cond axisCondition
+			var keep bool
+			if cond, keep, ok = limitCondition(c, limits, axisMap); !ok {
+				break
+			}
+			if keep {
+				rec.conditions = append(rec.conditions, cond)
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		for _, fs := range fv.Substitutions(i) {
+			rec.substitutions = append(rec.substitutions, featureSubstitution{feature: fs.FeatureIndex, lookups: fs.Lookups})
+		}
+		if limits != nil && len(rec.conditions) == 0 {
+			applied = make(map[uint16][]uint16)
+			for _, fs := range rec.substitutions {
+				applied[fs.feature] = fs.lookups
+			}
+			break
+		}
+		records = append(records, rec)
+	}
+
+	// Earlier records keep the original lookups of the applied features
+	for i := range records {
+		substituted := make(map[uint16]bool)
+		for _, fs := range records[i].substitutions {
+			substituted[fs.feature] = true
+		}
+		for idx := range applied {
+			if substituted[idx] {
+				continue
+			}
+			if feat, err := featList.GetFeature(int(idx)); err == nil {
+				records[i].substitutions = append(records[i].substitutions, featureSubstitution{feature: idx, lookups: feat.Lookups})
+			}
+		}
+		sort.Slice(records[i].substitutions, func(a, b int) bool {
+			return records[i].substitutions[a].feature < records[i].substitutions[b].feature
+		})
+	}
+	return records, applied
+}
+
+// limitCondition limits a condition to the axis limits, which are nil if
+// the font keeps its axis ranges. axisMap maps the kept axes to their new
+// indices. ok is false if the condition can no longer hold, keep is false
+// if it holds everywhere.
+func limitCondition(c *ot.Condition, limits []*axisLimit, axisMap map[int]int) (cond axisCondition, keep, ok bool) {
+	axis, min, max, ok := c.AxisRange()
+	if !ok {
+		// Unknown conditions never hold
+		return cond, false, false
+	}
+	if limits == nil {
+		return axisCondition{axis: uint16(axis), min: min, max: max}, true, true
+	}
+	if axis >= len(limits) {
+		return cond, false, false
+	}
+	l := limits[axis]
+	if l == nil {
+		return axisCondition{axis: uint16(axisMap[axis]), min: min, max: max}, true, true
+	}
+
+	lo := math.Max(float64(min)/(1<<14), l.min)
+	hi := math.Min(float64(max)/(1<<14), l.max)
+	switch {
+	case lo > hi:
+		return cond, false, false
+	case lo == l.min && hi == l.max:
+		return cond, false, true
+	}
+	return axisCondition{axis: uint16(axisMap[axis]), min: quantizeF2DOT14(l.renormalize(lo)), max: quantizeF2DOT14(l.renormalize(hi))}, true, true
+}
+
+// subsetFeaturesAndScripts rebuilds the FeatureList, ScriptList and
+// FeatureVariations records. lookupMap maps old lookup indices to their
+// index in the subsetted LookupList; lookups missing from it were dropped.
+// variations and applied come from featureVariations. Features that lose
+// all of their lookups, also in the feature variations, are removed and the
+// feature indices of every LangSys are remapped accordingly.
+func (p *Plan) subsetFeaturesAndScripts(featList *ot.FeatureList, scriptList *ot.ScriptList, lookupMap map[uint16]uint16,
+	variations []featureVariation, applied map[uint16][]uint16) ([]featureRecord, []scriptRecord, []featureVariation) {
+	remap := func(lookups []uint16) []uint16 {
+		var remapped []uint16
+		for _, idx := range lookups {
+			if newIdx, ok := lookupMap[idx]; ok {
+				remapped = append(remapped, newIdx)
+			}
+		}
+		return remapped
+	}
+
+	// Features with alternate lookups in a feature variation
+	varied := make(map[uint16]bool)
+	for _, v := range variations {
+		for _, fs := range v.substitutions {
+			if len(remap(fs.lookups)) > 0 {
+				varied[fs.feature] = true
+			}
+		}
+	}
+
+	var features []featureRecord
+	featureMap := make(map[uint16]uint16)
+
+	for i := 0; i < featList.Count(); i++ {
+		feat, err := featList.GetFeature(i)
+		if err != nil || !p.input.ShouldKeepFeature(feat.Tag) {
+			continue
+		}
+
+		lookups := feat.Lookups
+		if alt, ok := applied[uint16(i)]; ok {
+			lookups = alt
+		}
+		lookups = remap(lookups)
+		if len(lookups) == 0 && !varied[uint16(i)] {
+			continue
+		}
+
+		featureMap[uint16(i)] = uint16(len(features))
+		features = append(features, featureRecord{tag: feat.Tag, lookups: lookups, params: featList.FeatureParams(i)})
+	}
+
+	if len(features) == 0 {
+		return nil, nil, nil
+	}
+
+	// Records without substitutions at the end have no effect
+	var newVariations []featureVariation
+	for _, v := range variations {
+		rec := featureVariation{conditions: v.conditions}
+		for _, fs := range v.substitutions {
+			if newIdx, ok := featureMap[fs.feature]; ok {
+				rec.substitutions = append(rec.substitutions, featureSubstitution{feature: newIdx, lookups: remap(fs.lookups)})
+			}
+		}
+		newVariations = append(newVariations, rec)
+	}
+	for len(newVariations) > 0 && len(newVariations[len(newVariations)-1].substitutions) == 0 {
+		newVariations = newVariations[:len(newVariations)-1]
+	}
+
+	if scriptList == nil {
+		// No usable ScriptList: expose all features under DFLT.
+		dflt := &langSysRecord{reqFeat: 0xFFFF}
+		for i := range features {
+			dflt.features = append(dflt.features, uint16(i))
+		}
+		return features, []scriptRecord{{tag: ot.MakeTag('D', 'F', 'L', 'T'), dfltLang: dflt}}, newVariations
+	}
+
+	var scripts []scriptRecord
+	for _, script := range scriptList.Scripts() {
+		rec := scriptRecord{tag: script.Tag}
+		used := false
+
+		if script.DefaultLangSys != nil {
+			rec.dfltLang = remapLangSys(0, script.DefaultLangSys, featureMap)
+			used = used || !rec.dfltLang.isEmpty()
+		}
+		for _, ls := range script.LangSys {
+			newLS := remapLangSys(ls.Tag, ls.LangSys, featureMap)
+			rec.langSys = append(rec.langSys, *newLS)
+			used = used || !newLS.isEmpty()
+		}
+
+		if used {
+			scripts = append(scripts, rec)
+		}
+	}
+
+	return features, scripts, newVariations
+}
+
+// remapLangSys remaps the feature indices of a LangSys, dropping features
+// that were not retained.
+func remapLangSys(tag ot.Tag, ls *ot.LangSys, featureMap map[uint16]uint16) *langSysRecord {
+	rec := &langSysRecord{tag: tag, reqFeat: 0xFFFF}
+	if ls.RequiredFeature >= 0 {
+		if newIdx, ok := featureMap[uint16(ls.RequiredFeature)]; ok {
+			rec.reqFeat = newIdx
+		}
+	}
+	for _, idx := range ls.FeatureIndices {
+		if newIdx, ok := featureMap[idx]; ok {
+			rec.features = append(rec.features, newIdx)
+		}
+	}
+	return rec
+}
+
+// isEmpty returns true if the language system references no features.
+func (ls *langSysRecord) isEmpty() bool {
+	return ls.reqFeat == 0xFFFF && len(ls.features) == 0
+}
+
+// buildLayoutTable serializes a GSUB or GPOS table from its lists: version
+// 1.1 with feature variations, 1.0 otherwise. If the lookups overflow 16-bit
+// offsets, all of them are moved behind extension lookups of type
+// extensionLookupType, as HarfBuzz's repacker does. ErrOffsetOverflow is
+// returned if the table still does not fit.
+func buildLayoutTable(scripts []scriptRecord, features []featureRecord, lookups []*lookupBuilder,
+	variations []featureVariation, extensionLookupType uint16) ([]byte, error) {
+	data, err := serializeLayoutTable(scripts, features, lookups, variations)
+	if err != ErrOffsetOverflow {
+		return data, err
+	}
+	for _, lookup := range lookups {
+		if lookup.extensionType == 0 {
+			lookup.extensionType = lookup.lookupType
+			lookup.lookupType = extensionLookupType
+		}
+	}
+	return serializeLayoutTable(scripts, features, lookups, variations)
+}
+
+// serializeLayoutTable serializes a GSUB or GPOS table, see buildLayoutTable.
+func serializeLayoutTable(scripts []scriptRecord, features []featureRecord, lookups []*lookupBuilder, variations []featureVariation) ([]byte, error) {
+	scriptList, err := buildScriptList(scripts)
+	if err != nil {
+		return nil, err
+	}
+	featureList, err := buildFeatureList(features)
+	if err != nil {
+		return nil, err
+	}
+	lookupList, extensions, err := buildLookupList(lookups)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header: version(4) + scriptListOff(2) + featureListOff(2) + lookupListOff(2)
+	//         [+ featureVariationsOff(4)]
+	headerSize := 10
+	if len(variations) > 0 {
+		headerSize = 14
+	}
+
+	scriptListOff := headerSize
+	featureListOff := scriptListOff + len(scriptList)
+	lookupListOff := featureListOff + len(featureList)
+	if lookupListOff > 0xFFFF {
+		return nil, ErrOffsetOverflow
+	}
+
+	// Subtables of extension lookups are placed after the LookupList and
+	// referenced through the 32-bit offsets of their extension headers.
+	extensionOff := lookupListOff + len(lookupList)
+	extensionData := make([]byte, 0)
+	for _, ext := range extensions {
+		headerPos := lookupListOff + ext.headerPos
+		binary.BigEndian.PutUint32(lookupList[ext.headerPos+4:], uint32(extensionOff+len(extensionData)-headerPos))
+		extensionData = append(extensionData, ext.subtable...)
+	}
+
+	// FeatureVariations come last, at a 32-bit offset
+	featureVariationsOff := extensionOff + len(extensionData)
+	var featureVariations []byte
+	if len(variations) > 0 {
+		featureVariations = buildFeatureVariations(variations)
+	}
+
+	data := make([]byte, featureVariationsOff+len(featureVariations))
+
+	binary.BigEndian.PutUint16(data[0:], 1)
+	binary.BigEndian.PutUint16(data[4:], uint16(scriptListOff))
+	binary.BigEndian.PutUint16(data[6:], uint16(featureListOff))
+	binary.BigEndian.PutUint16(data[8:], uint16(lookupListOff))
+	if len(variations) > 0 {
+		binary.BigEndian.PutUint16(data[2:], 1)
+		binary.BigEndian.PutUint32(data[10:], uint32(featureVariationsOff))
+	}
+
+	copy(data[scriptListOff:], scriptList)
+	copy(data[featureListOff:], featureList)
+	copy(data[lookupListOff:], lookupList)
+	copy(data[extensionOff:], extensionData)
+	copy(data[featureVariationsOff:], featureVariations)
+
+	return data, nil
+}
+
+// extensionSubtable is the payload of an extension subtable whose 32-bit
+// offset must be patched once the final position is known.
+type extensionSubtable struct {
+	headerPos int // Position of the extension header within the LookupList
+	subtable  []byte
+}
+
+// buildLookupList serializes a LookupList. Subtables of extension lookups
+// are returned separately, see buildLayoutTable.
+func buildLookupList(lookups []*lookupBuilder) ([]byte, []extensionSubtable, error) {
+	// LookupList: lookupCount(2) + lookupOffsets[](2*n) + Lookup tables
+	headerSize := 2 + len(lookups)*2
+
+	lookupData := make([]byte, 0)
+	lookupOffsets := make([]uint16, len(lookups))
+	var extensions []extensionSubtable
+
+	for i, lookup := range lookups {
+		lookupOff := headerSize + len(lookupData)
+		if lookupOff > 0xFFFF {
+			return nil, nil, ErrOffsetOverflow
+		}
+		lookupOffsets[i] = uint16(lookupOff)
+		data, ext, err := buildLookup(lookup)
+		if err != nil {
+			return nil, nil, err
+		}
+		for j := range ext {
+			ext[j].headerPos += lookupOff
+		}
+		extensions = append(extensions, ext...)
+		lookupData = append(lookupData, data...)
+	}
+
+	data := make([]byte, headerSize+len(lookupData))
+	binary.BigEndian.PutUint16(data[0:], uint16(len(lookups)))
+	for i, off := range lookupOffsets {
+		binary.BigEndian.PutUint16(data[2+i*2:], off)
+	}
+	copy(data[headerSize:], lookupData)
+
+	return data, extensions, nil
+}
+
+// buildLookup serializes a single Lookup table with its subtables. For
+// extension lookups the subtables are replaced by extension headers and
+// returned separately.
+func buildLookup(lookup *lookupBuilder) ([]byte, []extensionSubtable, error) {
+	if lookup.err != nil {
+		return nil, nil, lookup.err
+	}
+	// Lookup: lookupType(2) + lookupFlag(2) + subTableCount(2) + subTableOffsets[](2*n)
+	//         [+ markFilteringSet(2)]
+	headerSize := 6 + len(lookup.subtables)*2
+	hasMarkFilter := lookup.flag&ot.LookupFlagUseMarkFilteringSet != 0
+	if hasMarkFilter {
+		headerSize += 2
+	}
+
+	subtableData := make([]byte, 0)
+	subtableOffsets := make([]uint16, len(lookup.subtables))
+	var extensions []extensionSubtable
+
+	for j, st := range lookup.subtables {
+		subtableOff := headerSize + len(subtableData)
+		if subtableOff > 0xFFFF {
+			return nil, nil, ErrOffsetOverflow
+		}
+		subtableOffsets[j] = uint16(subtableOff)
+		if lookup.extensionType != 0 {
+			// Extension format 1: format(2) + extensionLookupType(2) + extensionOffset(4)
+			ext := make([]byte, 8)
+			binary.BigEndian.PutUint16(ext[0:], 1)
+			binary.BigEndian.PutUint16(ext[2:], lookup.extensionType)
+			extensions = append(extensions, extensionSubtable{headerPos: subtableOff, subtable: st})
+			subtableData = append(subtableData, ext...)
+			continue
+		}
+		subtableData = append(subtableData, st...)
+	}
+
+	data := make([]byte, headerSize+len(subtableData))
+	binary.BigEndian.PutUint16(data[0:], lookup.lookupType)
+	binary.BigEndian.PutUint16(data[2:], lookup.flag)
+	binary.BigEndian.PutUint16(data[4:], uint16(len(lookup.subtables)))
+	for j, off := range subtableOffsets {
+		binary.BigEndian.PutUint16(data[6+j*2:], off)
+	}
+	if hasMarkFilter {
+		binary.BigEndian.PutUint16(data[6+len(lookup.subtables)*2:], lookup.markFilter)
+	}
+	copy(data[headerSize:], subtableData)
+
+	return data, extensions, nil
+}
+
+// buildScriptList serializes a ScriptList.
+func buildScriptList(scripts []scriptRecord) ([]byte, error) {
+	// ScriptList: scriptCount(2) + scriptRecords[](6*n) + Script tables
+	// ScriptRecord: scriptTag(4) + scriptOffset(2)
+	headerSize := 2 + len(scripts)*6
+
+	scriptData := make([]byte, 0)
+	scriptOffsets := make([]uint16, len(scripts))
+
+	for i := range scripts {
+		scriptOff := headerSize + len(scriptData)
+		if scriptOff > 0xFFFF {
+			return nil, ErrOffsetOverflow
+		}
+		scriptOffsets[i] = uint16(scriptOff)
+		script, err := buildScript(&scripts[i])
+		if err != nil {
+			return nil, err
+		}
+		scriptData = append(scriptData, script...)
+	}
+
+	data := make([]byte, headerSize+len(scriptData))
+	binary.BigEndian.PutUint16(data[0:], uint16(len(scripts)))
+	for i, s := range scripts {
+		off := 2 + i*6
+		binary.BigEndian.PutUint32(data[off:], uint32(s.tag))
+		binary.BigEndian.PutUint16(data[off+4:], scriptOffsets[i])
+	}
+	copy(data[headerSize:], scriptData)
+
+	return data, nil
+}
+
+// buildScript serializes a Script table with its LangSys tables.
+func buildScript(s *scriptRecord) ([]byte, error) {
+	// Script: defaultLangSysOffset(2) + langSysCount(2) + langSysRecords[](6*n)
+	// LangSysRecord: langSysTag(4) + langSysOffset(2)
+	headerSize := 4 + len(s.langSys)*6
+
+	langSysData := make([]byte, 0)
+
+	defaultOff := uint16(0)
+	if s.dfltLang != nil {
+		defaultOff = uint16(headerSize)
+		langSysData = append(langSysData, buildLangSys(s.dfltLang)...)
+	}
+
+	langSysOffsets := make([]uint16, len(s.langSys))
+	for i := range s.langSys {
+		langSysOff := headerSize + len(langSysData)
+		if langSysOff > 0xFFFF {
+			return nil, ErrOffsetOverflow
+		}
+		langSysOffsets[i] = uint16(langSysOff)
+		langSysData = append(langSysData, buildLangSys(&s.langSys[i])...)
+	}
+
+	data := make([]byte, headerSize+len(langSysData))
+	binary.BigEndian.PutUint16(data[0:], defaultOff)
+	binary.BigEndian.PutUint16(data[2:], uint16(len(s.langSys)))
+	for i, ls := range s.langSys {
+		off := 4 + i*6
+		binary.BigEndian.PutUint32(data[off:], uint32(ls.tag))
+		binary.BigEndian.PutUint16(data[off+4:], langSysOffsets[i])
+	}
+	copy(data[headerSize:], langSysData)
+
+	return data, nil
+}
+
+// buildLangSys serializes a LangSys table.
+func buildLangSys(ls *langSysRecord) []byte {
+	// LangSys: lookupOrder(2) + reqFeatureIndex(2) + featureIndexCount(2) + featureIndices[](2*n)
+	data := make([]byte, 6+len(ls.features)*2)
+	binary.BigEndian.PutUint16(data[0:], 0) // lookupOrder (reserved)
+	binary.BigEndian.PutUint16(data[2:], ls.reqFeat)
+	binary.BigEndian.PutUint16(data[4:], uint16(len(ls.features)))
+	for i, idx := range ls.features {
+		binary.BigEndian.PutUint16(data[6+i*2:], idx)
+	}
+	return data
+}
+
+// buildFeatureList serializes a FeatureList.
+func buildFeatureList(features []featureRecord) ([]byte, error) {
+	// FeatureList: featureCount(2) + featureRecords[](6*n) + Feature tables
+	// FeatureRecord: featureTag(4) + featureOffset(2)
+	headerSize := 2 + len(features)*6
+
+	featureData := make([]byte, 0)
+	featureOffsets := make([]uint16, len(features))
+
+	for i, f := range features {
+		featureOff := headerSize + len(featureData)
+		if featureOff > 0xFFFF {
+			return nil, ErrOffsetOverflow
+		}
+		featureOffsets[i] = uint16(featureOff)
+		featureData = append(featureData, buildFeature(f.lookups, f.params)...)
+	}
+
+	data := make([]byte, headerSize+len(featureData))
+	binary.BigEndian.PutUint16(data[0:], uint16(len(features)))
+	for i, f := range features {
+		off := 2 + i*6
+		binary.BigEndian.PutUint32(data[off:], uint32(f.tag))
+		binary.BigEndian.PutUint16(data[off+4:], featureOffsets[i])
+	}
+	copy(data[headerSize:], featureData)
+
+	return data, nil
+}
+
+// buildFeature serializes a Feature table. The FeatureParams table, if any,
+// follows the lookup indices.
+func buildFeature(lookups []uint16, params []byte) []byte {
+	// Feature: featureParams(2) + lookupIndexCount(2) + lookupListIndices[](2*n)
+	size := 4 + len(lookups)*2
+	data := make([]byte, size+len(params))
+	if len(params) > 0 {
+		binary.BigEndian.PutUint16(data[0:], uint16(size))
+	}
+	binary.BigEndian.PutUint16(data[2:], uint16(len(lookups)))
+	for j, idx := range lookups {
+		binary.BigEndian.PutUint16(data[4+j*2:], idx)
+	}
+	copy(data[size:], params)
+	return data
+}
+
+// buildFeatureVariations serializes a FeatureVariations table. All offsets
+// in it are 32-bit.
+func buildFeatureVariations(variations []featureVariation) []byte {
+	// FeatureVariations: version(4) + recordCount(4) + records[](8*n)
+	// FeatureVariationRecord: conditionSetOffset(4) + featureTableSubstitutionOffset(4)
+	headerSize := 8 + len(variations)*8
+	data := make([]byte, headerSize)
+	binary.BigEndian.PutUint16(data[0:], 1)
+	binary.BigEndian.PutUint32(data[4:], uint32(len(variations)))
+
+	for i, v := range variations {
+		// ConditionSet: conditionCount(2) + conditionOffsets[](4*n)
+		// Condition format 1: format(2) + axisIndex(2) + filterRangeMin(2) + filterRangeMax(2)
+		conditionSetOff := len(data)
+		conditionSet := make([]byte, 2+len(v.conditions)*4, 2+len(v.conditions)*12)
+		binary.BigEndian.PutUint16(conditionSet[0:], uint16(len(v.conditions)))
+		for j, c := range v.conditions {
+			binary.BigEndian.PutUint32(conditionSet[2+j*4:], uint32(len(conditionSet)))
+			condition := make([]byte, 8)
+			binary.BigEndian.PutUint16(condition[0:], 1)
+			binary.BigEndian.PutUint16(condition[2:], c.axis)
+			binary.BigEndian.PutUint16(condition[4:], uint16(c.min))
+			binary.BigEndian.PutUint16(condition[6:], uint16(c.max))
+			conditionSet = append(conditionSet, condition...)
+		}
+		data = append(data, conditionSet...)
+
+		// FeatureTableSubstitution: version(4) + substitutionCount(2) + records[](6*n)
+		// FeatureTableSubstitutionRecord: featureIndex(2) + alternateFeatureOffset(4)
+		substitutionOff := len(data)
+		substitution := make([]byte, 6+len(v.substitutions)*6)
+		binary.BigEndian.PutUint16(substitution[0:], 1)
+		binary.BigEndian.PutUint16(substitution[4:], uint16(len(v.substitutions)))
+		for j, fs := range v.substitutions {
+			binary.BigEndian.PutUint16(substitution[6+j*6:], fs.feature)
+			binary.BigEndian.PutUint32(substitution[6+j*6+2:], uint32(len(substitution)))
+			substitution = append(substitution, buildFeature(fs.lookups, nil)...)
+		}
+		data = append(data, substitution...)
+
+		binary.BigEndian.PutUint32(data[8+i*8:], uint32(conditionSetOff))
+		binary.BigEndian.PutUint32(data[8+i*8+4:], uint32(substitutionOff))
+	}
+	return data
+}
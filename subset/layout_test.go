@@ -0,0 +1,376 @@
+package subset
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/boxesandglue/textshape/ot"
+)
+
+// singleSubst returns a SingleSubst Format 2 subtable mapping each glyph of
+// glyphs to the glyph delta positions further.
+func singleSubst(glyphs []ot.GlyphID, delta int) []byte {
+	// SingleSubst: format(2) + coverageOffset(2) + glyphCount(2) + substitutes[](2*n)
+	// Coverage: format(2) + glyphCount(2) + glyphs[](2*n)
+	n := len(glyphs)
+	coverageOff := 6 + 2*n
+	data := make([]byte, coverageOff+4+2*n)
+	binary.BigEndian.PutUint16(data[0:], 2)
+	binary.BigEndian.PutUint16(data[2:], uint16(coverageOff))
+	binary.BigEndian.PutUint16(data[4:], uint16(n))
+	binary.BigEndian.PutUint16(data[coverageOff:], 1)
+	binary.BigEndian.PutUint16(data[coverageOff+2:], uint16(n))
+	for i, g := range glyphs {
+		binary.BigEndian.PutUint16(data[6+2*i:], uint16(int(g)+delta))
+		binary.BigEndian.PutUint16(data[coverageOff+4+2*i:], uint16(g))
+	}
+	return data
+}
+
+func TestBuildLayoutTableOverflow(t *testing.T) {
+	glyphs := make([]ot.GlyphID, 8000)
+	for i := range glyphs {
+		glyphs[i] = ot.GlyphID(i + 1)
+	}
+	scripts := []scriptRecord{{
+		tag:      ot.MakeTag('D', 'F', 'L', 'T'),
+		dfltLang: &langSysRecord{reqFeat: 0xFFFF, features: []uint16{0}},
+	}}
+	features := []featureRecord{{tag: ot.MakeTag('c', 'c', 'm', 'p'), lookups: []uint16{0, 1, 2, 3}}}
+
+	// Four lookups of 32 KiB each do not fit 16-bit lookup offsets
+	var lookups []*lookupBuilder
+	for i := 0; i < 4; i++ {
+		lookups = append(lookups, &lookupBuilder{
+			lookupType: ot.GSUBTypeSingle,
+			subtables:  [][]byte{singleSubst(glyphs, 100*(i+1))},
+		})
+	}
+	data, err := buildLayoutTable(scripts, features, lookups, nil, ot.GSUBTypeExtension)
+	if err != nil {
+		t.Fatalf("buildLayoutTable: %v", err)
+	}
+	gsub, err := ot.ParseGSUB(data)
+	if err != nil {
+		t.Fatalf("ParseGSUB: %v", err)
+	}
+	lookupList := int(binary.BigEndian.Uint16(data[8:]))
+	for i := 0; i < 4; i++ {
+		lookupOff := lookupList + int(binary.BigEndian.Uint16(data[lookupList+2+2*i:]))
+		if typ := binary.BigEndian.Uint16(data[lookupOff:]); typ != ot.GSUBTypeExtension {
+			t.Errorf("lookup %d has type %d, want an extension", i, typ)
+		}
+		if got := gsub.ApplyLookupWithGDEF(i, []ot.GlyphID{5000}, nil, nil); len(got) != 1 || int(got[0]) != 5000+100*(i+1) {
+			t.Errorf("lookup %d maps glyph 5000 to %v", i, got)
+		}
+	}
+
+	// A FeatureList beyond 64 KiB cannot be moved
+	features[0].lookups = make([]uint16, 40000)
+	if _, err := buildLayoutTable(scripts, features, lookups, nil, ot.GSUBTypeExtension); err != ErrOffsetOverflow {
+		t.Errorf("oversized FeatureList: err = %v, want ErrOffsetOverflow", err)
+	}
+}
+
+// sharedRuleSetContext returns a ContextSubst Format 1 subtable whose n
+// coverage glyphs 1..n share one rule set. The rule matches 40 glyphs.
+func sharedRuleSetContext(n int) []byte {
+	// ContextSubst: format(2) + coverageOffset(2) + ruleSetCount(2) + ruleSetOffsets[](2*n)
+	// RuleSet: ruleCount(2) + ruleOffsets[](2)
+	// Rule: glyphCount(2) + seqLookupCount(2) + inputSequence[](2*39)
+	ruleSetOff := 6 + 2*n
+	coverageOff := ruleSetOff + 4 + 4 + 2*39
+	data := make([]byte, coverageOff+4+2*n)
+	binary.BigEndian.PutUint16(data[0:], 1)
+	binary.BigEndian.PutUint16(data[2:], uint16(coverageOff))
+	binary.BigEndian.PutUint16(data[4:], uint16(n))
+	binary.BigEndian.PutUint16(data[coverageOff:], 1)
+	binary.BigEndian.PutUint16(data[coverageOff+2:], uint16(n))
+	for i := 0; i < n; i++ {
+		binary.BigEndian.PutUint16(data[6+2*i:], uint16(ruleSetOff))
+		binary.BigEndian.PutUint16(data[coverageOff+4+2*i:], uint16(i+1))
+	}
+	binary.BigEndian.PutUint16(data[ruleSetOff:], 1)
+	binary.BigEndian.PutUint16(data[ruleSetOff+2:], 4)
+	binary.BigEndian.PutUint16(data[ruleSetOff+4:], 40)
+	for i := 0; i < 39; i++ {
+		binary.BigEndian.PutUint16(data[ruleSetOff+8+2*i:], 1)
+	}
+	return data
+}
+
+func TestContextSubtableOverflow(t *testing.T) {
+	scripts := []scriptRecord{{
+		tag:      ot.MakeTag('D', 'F', 'L', 'T'),
+		dfltLang: &langSysRecord{reqFeat: 0xFFFF, features: []uint16{0}},
+	}}
+	features := []featureRecord{{tag: ot.MakeTag('c', 'a', 'l', 't'), lookups: []uint16{0}}}
+
+	for _, tc := range []struct {
+		glyphs int
+		err    error
+	}{
+		{100, nil},
+		// Every glyph gets its own copy of the rule set, 92 bytes each
+		{1000, ErrOffsetOverflow},
+	} {
+		source, err := buildLayoutTable(scripts, features, []*lookupBuilder{{
+			lookupType: ot.GSUBTypeContext,
+			subtables:  [][]byte{sharedRuleSetContext(tc.glyphs)},
+		}}, nil, ot.GSUBTypeExtension)
+		if err != nil {
+			t.Fatalf("%d glyphs: source: %v", tc.glyphs, err)
+		}
+		gsub, err := ot.ParseGSUB(source)
+		if err != nil {
+			t.Fatalf("%d glyphs: ParseGSUB: %v", tc.glyphs, err)
+		}
+
+		glyphMap := make(map[ot.GlyphID]ot.GlyphID)
+		glyphSet := make(map[ot.GlyphID]bool)
+		for g := ot.GlyphID(0); int(g) <= tc.glyphs; g++ {
+			glyphMap[g] = g
+			glyphSet[g] = true
+		}
+		lookup := newGSUBBuilder(glyphMap, glyphSet).subsetLookup(gsub.GetLookup(0))
+		if lookup == nil {
+			t.Fatalf("%d glyphs: lookup dropped", tc.glyphs)
+		}
+		data, err := buildLayoutTable(scripts, features, []*lookupBuilder{lookup}, nil, ot.GSUBTypeExtension)
+		if err != tc.err {
+			t.Fatalf("%d glyphs: err = %v, want %v", tc.glyphs, err, tc.err)
+		}
+		if err != nil {
+			continue
+		}
+		if _, err := ot.ParseGSUB(data); err != nil {
+			t.Errorf("%d glyphs: subset GSUB: %v", tc.glyphs, err)
+		}
+	}
+
+	// A single rule set whose second rule starts beyond 64 KiB
+	rules := []contextRule{{input: make([]ot.GlyphID, 33000)}, {}}
+	if _, err := buildContextRuleSet(false, rules); err != ErrOffsetOverflow {
+		t.Errorf("oversized rule set: err = %v, want ErrOffsetOverflow", err)
+	}
+	// The coverage that follows it is out of reach as well
+	if _, err := buildContextRuleSets(1, false, buildCoverageFormat1([]ot.GlyphID{1}), nil, [][]contextRule{rules[:1]}); err != ErrOffsetOverflow {
+		t.Errorf("coverage after a large rule set: err = %v, want ErrOffsetOverflow", err)
+	}
+}
+
+func TestSubsetFeatureParams(t *testing.T) {
+	fontPath := findTestFont("SourceSansPro-Regular.otf")
+	if fontPath == "" {
+		t.Skip("SourceSansPro-Regular.otf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	input := NewInput()
+	input.AddUnicodeRange(0x20, 0x7E)
+	plan, err := CreatePlan(font, input)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	result, err := plan.Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	subFont, err := ot.ParseFont(result, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse subset font: %v", err)
+	}
+
+	featureParams := func(f *ot.Font) map[ot.Tag][]byte {
+		data, err := f.TableData(ot.TagGSUB)
+		if err != nil {
+			t.Fatalf("No GSUB table: %v", err)
+		}
+		gsub, err := ot.ParseGSUB(data)
+		if err != nil {
+			t.Fatalf("Failed to parse GSUB: %v", err)
+		}
+		featList, err := gsub.ParseFeatureList()
+		if err != nil {
+			t.Fatalf("Failed to parse FeatureList: %v", err)
+		}
+		params := make(map[ot.Tag][]byte)
+		for i := 0; i < featList.Count(); i++ {
+			rec, err := featList.GetFeature(i)
+			if err != nil {
+				t.Fatalf("GetFeature(%d): %v", i, err)
+			}
+			if p := featList.FeatureParams(i); p != nil {
+				params[rec.Tag] = p
+			}
+		}
+		return params
+	}
+
+	// The stylistic sets keep their UI name IDs
+	orig := featureParams(font)
+	sub := featureParams(subFont)
+	if len(sub) == 0 {
+		t.Fatal("subset has no FeatureParams")
+	}
+	for tag, p := range sub {
+		if string(p) != string(orig[tag]) {
+			t.Errorf("%s FeatureParams %v, original %v", tag, p, orig[tag])
+		}
+	}
+}
+
+// variedGSUBFont returns Roboto-Variable with a GSUB whose 'liga' maps 'a'
+// to 'b', and to 'c' where the normalized weight is at least 0.5.
+func variedGSUBFont(t *testing.T) *ot.Font {
+	t.Helper()
+	fontPath := findTestFont("Roboto-Variable.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+	cmapData, _ := font.TableData(ot.TagCmap)
+	cmap, err := ot.ParseCmap(cmapData)
+	if err != nil {
+		t.Fatalf("Failed to parse cmap: %v", err)
+	}
+	a, _ := cmap.Lookup('a')
+	b, _ := cmap.Lookup('b')
+	c, _ := cmap.Lookup('c')
+
+	scripts := []scriptRecord{{
+		tag:      ot.MakeTag('D', 'F', 'L', 'T'),
+		dfltLang: &langSysRecord{reqFeat: 0xFFFF, features: []uint16{0}},
+	}}
+	features := []featureRecord{{tag: ot.MakeTag('l', 'i', 'g', 'a'), lookups: []uint16{0}}}
+	lookups := []*lookupBuilder{
+		{lookupType: ot.GSUBTypeSingle, subtables: [][]byte{singleSubst([]ot.GlyphID{a}, int(b)-int(a))}},
+		{lookupType: ot.GSUBTypeSingle, subtables: [][]byte{singleSubst([]ot.GlyphID{a}, int(c)-int(a))}},
+	}
+	variations := []featureVariation{{
+		conditions:    []axisCondition{{axis: 0, min: 0x2000, max: 0x4000}},
+		substitutions: []featureSubstitution{{feature: 0, lookups: []uint16{1}}},
+	}}
+	gsub, err := buildLayoutTable(scripts, features, lookups, variations, ot.GSUBTypeExtension)
+	if err != nil {
+		t.Fatalf("buildLayoutTable: %v", err)
+	}
+
+	builder := NewFontBuilder()
+	for _, tag := range []string{"GDEF", "GPOS", "HVAR", "OS/2", "STAT", "avar", "cmap", "cvt ",
+		"fpgm", "fvar", "gasp", "glyf", "gvar", "head", "hhea", "hmtx", "loca", "maxp", "name", "post", "prep"} {
+		tt := ot.MakeTag(tag[0], tag[1], tag[2], tag[3])
+		if data, err := font.TableData(tt); err == nil {
+			builder.AddTable(tt, data)
+		}
+	}
+	builder.AddTable(ot.TagGSUB, gsub)
+	data, err = builder.Build()
+	if err != nil {
+		t.Fatalf("Failed to build font: %v", err)
+	}
+	font, err = ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+	return font
+}
+
+func TestSubsetFeatureVariations(t *testing.T) {
+	font := variedGSUBFont(t)
+
+	// shapeA returns the character 'a' is substituted with at a weight
+	shapeA := func(f *ot.Font, weight float32) rune {
+		cmapData, _ := f.TableData(ot.TagCmap)
+		cmap, err := ot.ParseCmap(cmapData)
+		if err != nil {
+			t.Fatalf("Failed to parse cmap: %v", err)
+		}
+		shaper, err := ot.NewShaper(f)
+		if err != nil {
+			t.Fatalf("NewShaper: %v", err)
+		}
+		shaper.SetVariation(ot.TagAxisWeight, weight)
+		buf := ot.NewBuffer()
+		buf.AddString("a")
+		shaper.Shape(buf, nil)
+		for _, r := range "abc" {
+			if g, _ := cmap.Lookup(ot.Codepoint(r)); g == buf.Info[0].GlyphID {
+				return r
+			}
+		}
+		return 0
+	}
+	if got := shapeA(font, 400); got != 'b' {
+		t.Fatalf("original maps 'a' to %q at wght=400", got)
+	}
+	if got := shapeA(font, 900); got != 'c' {
+		t.Fatalf("original maps 'a' to %q at wght=900", got)
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(*Input)
+		minor   uint16 // GSUB minor version
+		weights []float32
+	}{
+		{"default", func(*Input) {}, 1, []float32{100, 400, 700, 900}},
+		{"limited", func(in *Input) { in.LimitAxisRange(ot.TagAxisWeight, 300, 400, 800) }, 1, []float32{300, 400, 700, 800}},
+		{"applied", func(in *Input) { in.LimitAxisRange(ot.TagAxisWeight, 800, 900, 900) }, 0, []float32{800, 900}},
+		{"unused", func(in *Input) { in.LimitAxisRange(ot.TagAxisWeight, 100, 400, 500) }, 0, []float32{100, 400, 500}},
+		{"pinned", func(in *Input) {
+			in.PinAxisLocation(ot.TagAxisWeight, 900)
+			in.PinAxisLocation(ot.TagAxisWidth, 100)
+		}, 0, []float32{900}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := NewInput()
+			input.AddString("abc")
+			tt.setup(input)
+			plan, err := CreatePlan(font, input)
+			if err != nil {
+				t.Fatalf("Failed to create plan: %v", err)
+			}
+			result, err := plan.Execute()
+			if err != nil {
+				t.Fatalf("Failed to execute plan: %v", err)
+			}
+			subFont, err := ot.ParseFont(result, 0)
+			if err != nil {
+				t.Fatalf("Failed to parse subset font: %v", err)
+			}
+			gsub, err := subFont.TableData(ot.TagGSUB)
+			if err != nil {
+				t.Fatalf("Subset has no GSUB table: %v", err)
+			}
+			if minor := binary.BigEndian.Uint16(gsub[2:]); minor != tt.minor {
+				t.Errorf("GSUB version 1.%d, want 1.%d", minor, tt.minor)
+			}
+			for _, weight := range tt.weights {
+				if got, want := shapeA(subFont, weight), shapeA(font, weight); got != want {
+					t.Errorf("wght=%.0f: 'a' maps to %q, original %q", weight, got, want)
+				}
+			}
+		})
+	}
+}
@@ -34,6 +34,7 @@ type Plan struct {
 	hmtx *ot.Hmtx
 	glyf *ot.Glyf
 	cff  *ot.CFF
+	cff2 *ot.CFF2
 
 	// Variation tables (for instancing)
 	fvar *ot.Fvar
@@ -46,6 +47,17 @@ type Plan struct {
 
 	// Normalized coordinates for instancing (F2DOT14 format)
 	normalizedCoords []int
+
+	// Restricted axes for partial instancing, indexed like fvar axes
+	// (nil for axes that stay unchanged)
+	limitedAxes []*limitedAxis
+
+	// GDEF ItemVariationStore reduced to the delta sets referenced by the
+	// subsetted GPOS (set by subsetGPOS, nil if none are left)
+	layoutVarStore *itemVariationStore
+
+	// Glyphs with gvar deltas applied (computed on demand)
+	instancedGlyphs map[ot.GlyphID]*instancedGlyph
 }
 
 // CreatePlan creates a subset plan from a font and input configuration.
@@ -64,14 +76,19 @@ func CreatePlan(font *ot.Font, input *Input) (*Plan, error) {
 		return nil, err
 	}
 
+	if input.HasLimitedAxes() && p.cff2 != nil {
+		return nil, ErrCFF2AxisLimits
+	}
+
 	// Compute glyph closure
 	p.computeGlyphClosure()
 
 	// Create glyph mapping
 	p.createGlyphMapping()
 
-	// Compute instanced advances if axes are pinned
-	if input.HasPinnedAxes() {
+	// Compute instanced advances if axes are pinned or limited
+	p.computeAxisLimits()
+	if input.HasPinnedAxes() || input.HasLimitedAxes() {
 		p.computeInstancedAdvances()
 	}
 
@@ -125,6 +142,10 @@ func (p *Plan) parseTables() error {
 		data, _ := p.source.TableData(ot.TagCFF)
 		p.cff, _ = ot.ParseCFF(data)
 	}
+	if p.source.HasTable(ot.TagCFF2) {
+		data, _ := p.source.TableData(ot.TagCFF2)
+		p.cff2, _ = ot.ParseCFF2(data)
+	}
 
 	// Parse variation tables (for instancing)
 	if p.source.HasTable(ot.TagFvar) {
@@ -288,6 +309,15 @@ func (p *Plan) getGSUBLookupOutputGlyphs(lookup *ot.GSUBLookup) map[ot.GlyphID]b
 					}
 				}
 			}
+
+		case *ot.ReverseChainSingleSubst:
+			// Reverse chaining: if input glyph is in set, add its substitute
+			substitutes := st.Substitutes()
+			for i, inGlyph := range st.Coverage().Glyphs() {
+				if i < len(substitutes) && p.glyphSet[inGlyph] {
+					result[substitutes[i]] = true
+				}
+			}
 		}
 	}
 
@@ -411,7 +441,7 @@ func (p *Plan) Fvar() *ot.Fvar {
 
 // IsInstanced returns true if the plan will produce an instanced (static) font.
 func (p *Plan) IsInstanced() bool {
-	return p.input.HasPinnedAxes() && p.instancedAdvances != nil
+	return p.input.HasPinnedAxes() && p.instancedAdvances != nil && !p.IsPartiallyInstanced()
 }
 
 // computeInstancedAdvances computes advance widths with HVAR deltas applied.
@@ -420,7 +450,8 @@ func (p *Plan) computeInstancedAdvances() {
 		return
 	}
 
-	// Build normalized coordinates from pinned axes
+	// Build normalized coordinates from pinned axes and the new defaults
+	// of limited axes
 	axisCount := p.fvar.AxisCount()
 	normalizedCoords := make([]float32, axisCount)
 	axes := p.fvar.AxisInfos()
@@ -428,8 +459,10 @@ func (p *Plan) computeInstancedAdvances() {
 	for i, axis := range axes {
 		if value, pinned := p.input.pinnedAxes[axis.Tag]; pinned {
 			normalizedCoords[i] = p.fvar.NormalizeAxisValue(i, value)
+		} else if p.IsPartiallyInstanced() && p.limitedAxes[i] != nil {
+			normalizedCoords[i] = p.fvar.NormalizeAxisValue(i, p.limitedAxes[i].user.Default)
 		}
-		// Unpinned axes stay at 0 (default)
+		// Other axes stay at 0 (default)
 	}
 
 	// Convert to F2DOT14 format and apply avar mapping
@@ -450,10 +483,13 @@ func (p *Plan) computeInstancedAdvances() {
 	for oldGID := range p.glyphSet {
 		baseAdvance := p.hmtx.GetAdvanceWidth(oldGID)
 
-		// Apply HVAR delta if available
+		// Apply HVAR delta if available, otherwise use the phantom points
 		if p.hvar != nil && p.hvar.HasData() {
 			delta := p.hvar.GetAdvanceDelta(oldGID, normalizedCoordsI)
 			baseAdvance = uint16(int32(baseAdvance) + roundToInt(delta))
+		} else if p.gvar != nil && p.gvar.HasData() {
+			delta := p.phantomAdvanceDelta(oldGID)
+			baseAdvance = uint16(int32(baseAdvance) + roundToInt(float32(delta)))
 		}
 
 		p.instancedAdvances[oldGID] = baseAdvance
@@ -480,11 +516,10 @@ func (p *Plan) GetGlyphDeltasWithCoords(gid ot.GlyphID, numPoints int, origPoint
 	// Convert SimpleGlyphPoint to GlyphPoint for IUP
 	var origCoords []ot.GlyphPoint
 	if origPoints != nil {
-		origCoords = make([]ot.GlyphPoint, len(origPoints)+4) // +4 for phantom points
+		origCoords = make([]ot.GlyphPoint, len(origPoints))
 		for i, p := range origPoints {
 			origCoords[i] = ot.GlyphPoint{X: p.X, Y: p.Y}
 		}
-		// Phantom points are at indices [numPoints:numPoints+4], initialize with zeros
 	}
 
 	deltas := p.gvar.GetGlyphDeltasWithCoords(gid, p.normalizedCoords, totalPoints, origCoords)
@@ -74,7 +74,11 @@ func (b *FontBuilder) Build() ([]byte, error) {
 	out := make([]byte, totalSize)
 
 	// Write offset table
-	binary.BigEndian.PutUint32(out[0:], 0x00010000) // sfntVersion for TrueType
+	sfntVersion := uint32(0x00010000) // TrueType
+	if b.HasTable(ot.TagCFF) || b.HasTable(ot.TagCFF2) {
+		sfntVersion = 0x4F54544F // 'OTTO' for CFF outlines
+	}
+	binary.BigEndian.PutUint32(out[0:], sfntVersion)
 	binary.BigEndian.PutUint16(out[4:], uint16(numTables))
 	binary.BigEndian.PutUint16(out[6:], searchRange)
 	binary.BigEndian.PutUint16(out[8:], entrySelector)
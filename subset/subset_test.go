@@ -1,6 +1,8 @@
 package subset
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"os"
 	"os/exec"
@@ -657,7 +659,7 @@ func TestInstancingAppliesHVAR(t *testing.T) {
 
 	// Expected advances from hb-shape at different weights for "Hello"
 	// These are the same values from ot/hvar_compare_test.go
-	expectedAdvances := map[float32][]int16{
+	expectedAdvances := map[float32][]int32{
 		100: {1438, 1032, 422, 422, 1127},
 		400: {1461, 1086, 498, 498, 1168},
 		700: {1446, 1106, 542, 542, 1156},
@@ -717,6 +719,67 @@ func TestInstancingAppliesHVAR(t *testing.T) {
 	}
 }
 
+// TestInstancingAppliesGPOSVariations tests that the GPOS deltas at the
+// instance are baked into the kerning and anchors of a pinned font.
+func TestInstancingAppliesGPOSVariations(t *testing.T) {
+	fontPath := findTestFont("Roboto-Variable.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	const text = "To AVATAR e\u0301"
+	for _, weight := range []float32{100, 300, 700, 900} {
+		t.Run(fmt.Sprintf("weight%.0f", weight), func(t *testing.T) {
+			input := NewInput()
+			input.AddString(text)
+			input.PinAxisLocation(ot.TagAxisWeight, weight)
+			plan, err := CreatePlan(font, input)
+			if err != nil {
+				t.Fatalf("Failed to create plan: %v", err)
+			}
+			result, err := plan.Execute()
+			if err != nil {
+				t.Fatalf("Failed to execute plan: %v", err)
+			}
+			subFont, err := ot.ParseFont(result, 0)
+			if err != nil {
+				t.Fatalf("Failed to parse subset font: %v", err)
+			}
+			if gdef, err := subFont.TableData(ot.TagGDEF); err == nil && binary.BigEndian.Uint16(gdef[2:]) >= 3 {
+				t.Error("instanced GDEF keeps its ItemVariationStore")
+			}
+
+			origShaper, _ := ot.NewShaper(font)
+			origShaper.SetVariation(ot.TagAxisWeight, weight)
+			origBuf := ot.NewBuffer()
+			origBuf.AddString(text)
+			origShaper.Shape(origBuf, nil)
+
+			subShaper, _ := ot.NewShaper(subFont)
+			subBuf := ot.NewBuffer()
+			subBuf.AddString(text)
+			subShaper.Shape(subBuf, nil)
+
+			for i, pos := range subBuf.Pos {
+				orig := origBuf.Pos[i]
+				if pos.XAdvance != orig.XAdvance || pos.XOffset != orig.XOffset || pos.YOffset != orig.YOffset {
+					t.Errorf("glyph %d: position %+v, original %+v", i, pos, orig)
+				}
+			}
+		})
+	}
+}
+
 // TestPinAxisMethods tests the Input pin axis methods.
 func TestPinAxisMethods(t *testing.T) {
 	fontPath := findTestFont("Roboto-Variable.ttf")
@@ -864,3 +927,754 @@ func TestFlagDropLayoutTables(t *testing.T) {
 		t.Errorf("Subset without layout tables should be smaller: %d >= %d", len(result2), len(result1))
 	}
 }
+
+// TestSubsetGSUBAllFeatures verifies that GSUB features other than liga
+// survive subsetting and shape exactly like the original font.
+func TestSubsetGSUBAllFeatures(t *testing.T) {
+	fontPath := findTestFont("SourceSansPro-Regular.otf")
+	if fontPath == "" {
+		t.Skip("SourceSansPro-Regular.otf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	text := "Office 1234"
+	input := NewInput()
+	input.AddString(text)
+
+	plan, err := CreatePlan(font, input)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	result, err := plan.Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+
+	subFont, err := ot.ParseFont(result, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse subset font: %v", err)
+	}
+
+	gsubData, err := subFont.TableData(ot.TagGSUB)
+	if err != nil {
+		t.Fatalf("Subset has no GSUB table: %v", err)
+	}
+	gsub, err := ot.ParseGSUB(gsubData)
+	if err != nil {
+		t.Fatalf("Failed to parse subset GSUB: %v", err)
+	}
+	featList, err := gsub.ParseFeatureList()
+	if err != nil {
+		t.Fatalf("Failed to parse subset FeatureList: %v", err)
+	}
+	tags := make(map[ot.Tag]bool)
+	for i := 0; i < featList.Count(); i++ {
+		if feat, err := featList.GetFeature(i); err == nil {
+			tags[feat.Tag] = true
+		}
+	}
+	for _, tag := range []ot.Tag{ot.TagLiga, ot.TagSmcp, ot.MakeTag('o', 'n', 'u', 'm')} {
+		if !tags[tag] {
+			t.Errorf("Subset GSUB is missing feature %s", tag)
+		}
+	}
+
+	origShaper, _ := ot.NewShaper(font)
+	subShaper, _ := ot.NewShaper(subFont)
+
+	for _, feats := range []string{"", "smcp", "onum", "c2sc,smcp", "-liga"} {
+		t.Run("features="+feats, func(t *testing.T) {
+			features := ot.ParseFeatures(feats)
+
+			origBuf := ot.NewBuffer()
+			origBuf.AddString(text)
+			origBuf.GuessSegmentProperties()
+			origShaper.Shape(origBuf, features)
+
+			subBuf := ot.NewBuffer()
+			subBuf.AddString(text)
+			subBuf.GuessSegmentProperties()
+			subShaper.Shape(subBuf, features)
+
+			if subBuf.Len() != origBuf.Len() {
+				t.Fatalf("Glyph count mismatch: subset=%d, original=%d", subBuf.Len(), origBuf.Len())
+			}
+			for i := range origBuf.Info {
+				oldGID, _ := plan.OldGlyph(subBuf.Info[i].GlyphID)
+				if oldGID != origBuf.Info[i].GlyphID {
+					t.Errorf("Glyph %d: subset maps back to %d, original=%d", i, oldGID, origBuf.Info[i].GlyphID)
+				}
+				if subBuf.Pos[i].XAdvance != origBuf.Pos[i].XAdvance {
+					t.Errorf("Glyph %d: advance=%d, original=%d", i, subBuf.Pos[i].XAdvance, origBuf.Pos[i].XAdvance)
+				}
+			}
+		})
+	}
+
+	// Restricting features must drop everything else.
+	input2 := NewInput()
+	input2.AddString(text)
+	input2.KeepFeature(ot.TagLiga)
+	plan2, _ := CreatePlan(font, input2)
+	result2, err := plan2.Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	subFont2, _ := ot.ParseFont(result2, 0)
+	gsubData2, err := subFont2.TableData(ot.TagGSUB)
+	if err != nil {
+		t.Fatalf("Subset has no GSUB table: %v", err)
+	}
+	gsub2, _ := ot.ParseGSUB(gsubData2)
+	featList2, _ := gsub2.ParseFeatureList()
+	for i := 0; i < featList2.Count(); i++ {
+		if feat, err := featList2.GetFeature(i); err == nil && feat.Tag != ot.TagLiga {
+			t.Errorf("Unexpected feature %s with KeepFeature(liga)", feat.Tag)
+		}
+	}
+}
+
+func TestSubsetGSUBChainContext(t *testing.T) {
+	fontPath := findTestFont("Roboto-Regular.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Regular.ttf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	// frac and ccmp (j + combining accent) use chaining context lookups.
+	text := "1/2 3/4 j́"
+	input := NewInput()
+	input.AddString(text)
+
+	plan, err := CreatePlan(font, input)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	result, err := plan.Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+
+	subFont, err := ot.ParseFont(result, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse subset font: %v", err)
+	}
+
+	gsubData, err := subFont.TableData(ot.TagGSUB)
+	if err != nil {
+		t.Fatalf("Subset has no GSUB table: %v", err)
+	}
+	gsub, err := ot.ParseGSUB(gsubData)
+	if err != nil {
+		t.Fatalf("Failed to parse subset GSUB: %v", err)
+	}
+	hasChain := false
+	for i := 0; i < gsub.NumLookups(); i++ {
+		if lookup := gsub.GetLookup(i); lookup != nil && lookup.Type == ot.GSUBTypeChainContext {
+			hasChain = true
+		}
+	}
+	if !hasChain {
+		t.Error("Subset GSUB has no chaining context lookup")
+	}
+
+	origShaper, _ := ot.NewShaper(font)
+	subShaper, _ := ot.NewShaper(subFont)
+
+	for _, feats := range []string{"", "frac"} {
+		t.Run("features="+feats, func(t *testing.T) {
+			features := ot.ParseFeatures(feats)
+
+			origBuf := ot.NewBuffer()
+			origBuf.AddString(text)
+			origBuf.GuessSegmentProperties()
+			origShaper.Shape(origBuf, features)
+
+			subBuf := ot.NewBuffer()
+			subBuf.AddString(text)
+			subBuf.GuessSegmentProperties()
+			subShaper.Shape(subBuf, features)
+
+			if subBuf.Len() != origBuf.Len() {
+				t.Fatalf("Glyph count mismatch: subset=%d, original=%d", subBuf.Len(), origBuf.Len())
+			}
+			for i := range origBuf.Info {
+				oldGID, _ := plan.OldGlyph(subBuf.Info[i].GlyphID)
+				if oldGID != origBuf.Info[i].GlyphID {
+					t.Errorf("Glyph %d: subset maps back to %d, original=%d", i, oldGID, origBuf.Info[i].GlyphID)
+				}
+			}
+		})
+	}
+}
+
+// TestSubsetKeepsVariations tests that gvar and HVAR are subsetted for the new
+// glyph order when the font stays variable.
+func TestSubsetKeepsVariations(t *testing.T) {
+	fontPath := findTestFont("Roboto-Variable.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	input := NewInput()
+	input.AddString("Hello")
+	input.Flags = FlagPassUnrecognized
+	plan, err := CreatePlan(font, input)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	result, err := plan.Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	subFont, err := ot.ParseFont(result, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse subset font: %v", err)
+	}
+
+	gvarData, err := subFont.TableData(ot.TagGvar)
+	if err != nil {
+		t.Fatalf("Subset has no gvar table: %v", err)
+	}
+	gvar, err := ot.ParseGvar(gvarData)
+	if err != nil {
+		t.Fatalf("Failed to parse subset gvar: %v", err)
+	}
+	if gvar.GlyphCount() != subFont.NumGlyphs() {
+		t.Errorf("gvar glyphCount=%d, numGlyphs=%d", gvar.GlyphCount(), subFont.NumGlyphs())
+	}
+
+	// Shaping the variable subset must give the same advances as the original.
+	for _, weight := range []float32{100, 400, 700, 900} {
+		origShaper, _ := ot.NewShaper(font)
+		origShaper.SetVariation(ot.TagAxisWeight, weight)
+		origBuf := ot.NewBuffer()
+		origBuf.AddString("Hello")
+		origShaper.Shape(origBuf, nil)
+
+		subShaper, _ := ot.NewShaper(subFont)
+		subShaper.SetVariation(ot.TagAxisWeight, weight)
+		subBuf := ot.NewBuffer()
+		subBuf.AddString("Hello")
+		subShaper.Shape(subBuf, nil)
+
+		for i := range origBuf.Pos {
+			if subBuf.Pos[i].XAdvance != origBuf.Pos[i].XAdvance {
+				t.Errorf("wght=%.0f glyph %d: advance=%d, original=%d", weight, i, subBuf.Pos[i].XAdvance, origBuf.Pos[i].XAdvance)
+			}
+		}
+
+		// Instancing the subset must give the same outlines as instancing
+		// the original font directly. The layout closure is skipped so that
+		// both instances contain the same glyphs.
+		instance := func(f *ot.Font) []byte {
+			in := NewInput()
+			in.AddString("Hello")
+			in.Flags = FlagNoLayoutClosure
+			in.PinAxisLocation(ot.TagAxisWeight, weight)
+			p, err := CreatePlan(f, in)
+			if err != nil {
+				t.Fatalf("Failed to create plan: %v", err)
+			}
+			out, err := p.Execute()
+			if err != nil {
+				t.Fatalf("Failed to execute plan: %v", err)
+			}
+			f2, _ := ot.ParseFont(out, 0)
+			glyf, _ := f2.TableData(ot.TagGlyf)
+			return glyf
+		}
+		if !bytes.Equal(instance(font), instance(subFont)) {
+			t.Errorf("wght=%.0f: instanced glyf differs between original and subset", weight)
+		}
+	}
+}
+
+func TestSubsetKeepsLayoutVariations(t *testing.T) {
+	fontPath := findTestFont("Roboto-Variable.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	// Kerning varies through the GDEF ItemVariationStore
+	texts := []string{"AVATAR", "Hello"}
+	input := NewInput()
+	for _, text := range texts {
+		input.AddString(text)
+	}
+	plan, err := CreatePlan(font, input)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	result, err := plan.Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	subFont, err := ot.ParseFont(result, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse subset font: %v", err)
+	}
+
+	// A default subset stays variable
+	for _, tag := range []ot.Tag{ot.TagFvar, ot.TagGvar, ot.TagHvar} {
+		if !subFont.HasTable(tag) {
+			t.Errorf("subset has no %s table", tag)
+		}
+	}
+
+	gdefData, err := subFont.TableData(ot.TagGDEF)
+	if err != nil {
+		t.Fatalf("Subset has no GDEF table: %v", err)
+	}
+	gdef, err := ot.ParseGDEF(gdefData)
+	if err != nil {
+		t.Fatalf("Failed to parse subset GDEF: %v", err)
+	}
+	if major, minor := gdef.Version(); major != 1 || minor != 3 || gdef.VarStore() == nil {
+		t.Fatalf("subset GDEF %d.%d without ItemVariationStore", major, minor)
+	}
+
+	for _, weight := range []float32{100, 400, 900} {
+		for _, text := range texts {
+			origShaper, _ := ot.NewShaper(font)
+			origShaper.SetVariation(ot.TagAxisWeight, weight)
+			origBuf := ot.NewBuffer()
+			origBuf.AddString(text)
+			origShaper.Shape(origBuf, nil)
+
+			subShaper, _ := ot.NewShaper(subFont)
+			subShaper.SetVariation(ot.TagAxisWeight, weight)
+			subBuf := ot.NewBuffer()
+			subBuf.AddString(text)
+			subShaper.Shape(subBuf, nil)
+
+			for i := range origBuf.Pos {
+				if subBuf.Pos[i] != origBuf.Pos[i] {
+					t.Errorf("wght=%.0f %q glyph %d: %+v, original %+v", weight, text, i, subBuf.Pos[i], origBuf.Pos[i])
+				}
+			}
+		}
+	}
+}
+
+func TestSubsetLimitAxisRange(t *testing.T) {
+	fontPath := findTestFont("Roboto-Variable.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	for _, r := range []AxisRange{{300, 400, 700}, {500, 600, 900}} {
+		input := NewInput()
+		input.AddString("Hello AVATAR")
+		input.LimitAxisRange(ot.TagAxisWeight, r.Min, r.Default, r.Max)
+		plan, err := CreatePlan(font, input)
+		if err != nil {
+			t.Fatalf("Failed to create plan: %v", err)
+		}
+		if !plan.IsPartiallyInstanced() || plan.IsInstanced() {
+			t.Fatalf("expected a partially instanced plan")
+		}
+		result, err := plan.Execute()
+		if err != nil {
+			t.Fatalf("Failed to execute plan: %v", err)
+		}
+		subFont, err := ot.ParseFont(result, 0)
+		if err != nil {
+			t.Fatalf("Failed to parse subset font: %v", err)
+		}
+
+		fvarData, err := subFont.TableData(ot.TagFvar)
+		if err != nil {
+			t.Fatalf("Subset has no fvar table: %v", err)
+		}
+		fvar, err := ot.ParseFvar(fvarData)
+		if err != nil {
+			t.Fatalf("Failed to parse subset fvar: %v", err)
+		}
+		axis, _ := fvar.FindAxis(ot.TagAxisWeight)
+		if axis.MinValue != r.Min || axis.DefaultValue != r.Default || axis.MaxValue != r.Max {
+			t.Errorf("wght axis = %v/%v/%v, want %v/%v/%v", axis.MinValue, axis.DefaultValue, axis.MaxValue, r.Min, r.Default, r.Max)
+		}
+		for _, inst := range fvar.NamedInstances() {
+			if inst.Coords[0] < r.Min || inst.Coords[0] > r.Max {
+				t.Errorf("named instance at wght=%v outside of range", inst.Coords[0])
+			}
+		}
+
+		// STAT keeps the weight axis values within the range, with clipped
+		// format 2 ranges. Axis index 1 is wght in Roboto's STAT.
+		statData, err := subFont.TableData(ot.TagSTAT)
+		if err != nil {
+			t.Fatalf("Subset has no STAT table: %v", err)
+		}
+		fixed := func(b []byte) float32 { return float32(int32(binary.BigEndian.Uint32(b))) / 65536 }
+		valueCount := int(binary.BigEndian.Uint16(statData[12:]))
+		valuesOff := int(binary.BigEndian.Uint32(statData[14:]))
+		weights := 0
+		for v := 0; v < valueCount; v++ {
+			value := statData[valuesOff+int(binary.BigEndian.Uint16(statData[valuesOff+v*2:])):]
+			format := binary.BigEndian.Uint16(value[0:])
+			if format > 3 || binary.BigEndian.Uint16(value[2:]) != 1 {
+				continue
+			}
+			weights++
+			if w := fixed(value[8:]); w < r.Min || w > r.Max {
+				t.Errorf("STAT axis value at wght=%v outside of range", w)
+			}
+			if format == 2 && (fixed(value[12:]) < r.Min || fixed(value[16:]) > r.Max) {
+				t.Errorf("STAT axis value range %v-%v outside of range", fixed(value[12:]), fixed(value[16:]))
+			}
+		}
+		if weights == 0 || weights >= 10 {
+			t.Errorf("STAT has %d weight axis values", weights)
+		}
+
+		// Within the range, the narrower font must match the original up to
+		// rounding of the rebased deltas of the advances and the kerning.
+		for weight := r.Min; weight <= r.Max; weight += 50 {
+			origShaper, _ := ot.NewShaper(font)
+			origShaper.SetVariation(ot.TagAxisWeight, weight)
+			origBuf := ot.NewBuffer()
+			origBuf.AddString("Hello AVATAR")
+			origShaper.Shape(origBuf, nil)
+
+			subShaper, _ := ot.NewShaper(subFont)
+			subShaper.SetVariation(ot.TagAxisWeight, weight)
+			subBuf := ot.NewBuffer()
+			subBuf.AddString("Hello AVATAR")
+			subShaper.Shape(subBuf, nil)
+
+			for i := range origBuf.Pos {
+				if d := subBuf.Pos[i].XAdvance - origBuf.Pos[i].XAdvance; d < -2 || d > 2 {
+					t.Errorf("wght=%.0f glyph %d: advance=%d, original=%d", weight, i, subBuf.Pos[i].XAdvance, origBuf.Pos[i].XAdvance)
+				}
+			}
+		}
+	}
+}
+
+// TestSubsetLimitAxisRangeMVAR tests that metric deltas at a moved default
+// are applied to OS/2 and post.
+func TestSubsetLimitAxisRangeMVAR(t *testing.T) {
+	fontPath := findTestFont("Roboto-Variable.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	// MVAR with 'undo' -50 and 'xhgt' +100 at wght=900
+	mvar := []byte{
+		0, 1, 0, 0, 0, 0, 0, 8, 0, 2, 0, 28, // header
+		'u', 'n', 'd', 'o', 0, 0, 0, 0,
+		'x', 'h', 'g', 't', 0, 0, 0, 1,
+		0, 1, 0, 0, 0, 12, 0, 1, 0, 0, 0, 28, // ItemVariationStore
+		0, 2, 0, 1, 0, 0, 0x40, 0, 0x40, 0, 0, 0, 0, 0, 0, 0, // regions: wght 0..1
+		0, 2, 0, 0, 0, 1, 0, 0, 0xCE, 100, // ItemVariationData
+	}
+	builder := NewFontBuilder()
+	for _, tag := range []string{"GDEF", "GPOS", "GSUB", "HVAR", "OS/2", "STAT", "avar", "cmap", "cvt ",
+		"fpgm", "fvar", "gasp", "glyf", "gvar", "head", "hhea", "hmtx", "loca", "maxp", "name", "post", "prep"} {
+		tt := ot.MakeTag(tag[0], tag[1], tag[2], tag[3])
+		if data, err := font.TableData(tt); err == nil {
+			builder.AddTable(tt, data)
+		}
+	}
+	builder.AddTable(ot.TagMvar, mvar)
+	data, err = builder.Build()
+	if err != nil {
+		t.Fatalf("Failed to build font: %v", err)
+	}
+	font, err = ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	input := NewInput()
+	input.AddString("x")
+	input.Flags = FlagPassUnrecognized
+	input.LimitAxisRange(ot.TagAxisWeight, 400, 900, 900)
+	plan, err := CreatePlan(font, input)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	result, err := plan.Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	subFont, err := ot.ParseFont(result, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse subset font: %v", err)
+	}
+
+	field := func(f *ot.Font, tag ot.Tag, off int) int16 {
+		data, err := f.TableData(tag)
+		if err != nil {
+			t.Fatalf("no %s table: %v", tag, err)
+		}
+		return int16(binary.BigEndian.Uint16(data[off:]))
+	}
+	if got, want := field(subFont, ot.TagOS2, 86), field(font, ot.TagOS2, 86)+100; got != want {
+		t.Errorf("sxHeight = %d, want %d", got, want)
+	}
+	if got, want := field(subFont, ot.TagPost, 8), field(font, ot.TagPost, 8)-50; got != want {
+		t.Errorf("underlinePosition = %d, want %d", got, want)
+	}
+	if got, want := field(subFont, ot.TagOS2, 68), field(font, ot.TagOS2, 68); got != want {
+		t.Errorf("sTypoAscender = %d, want %d", got, want)
+	}
+}
+
+// TestSubsetLimitAxisRangePinned tests that axes pinned in a partial instance
+// are dropped from fvar, avar and the variation tuples.
+func TestSubsetLimitAxisRangePinned(t *testing.T) {
+	fontPath := findTestFont("Roboto-Variable.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	input := NewInput()
+	input.AddString("Hello AVATAR")
+	input.LimitAxisRange(ot.TagAxisWeight, 300, 400, 700)
+	input.PinAxisLocation(ot.TagAxisWidth, 90)
+	plan, err := CreatePlan(font, input)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	result, err := plan.Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	subFont, err := ot.ParseFont(result, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse subset font: %v", err)
+	}
+
+	fvarData, err := subFont.TableData(ot.TagFvar)
+	if err != nil {
+		t.Fatalf("Subset has no fvar table: %v", err)
+	}
+	fvar, err := ot.ParseFvar(fvarData)
+	if err != nil {
+		t.Fatalf("Failed to parse subset fvar: %v", err)
+	}
+	if axes := fvar.AxisInfos(); len(axes) != 1 || axes[0].Tag != ot.TagAxisWeight {
+		t.Fatalf("fvar axes = %v, want wght only", axes)
+	}
+	for _, inst := range fvar.NamedInstances() {
+		if len(inst.Coords) != 1 {
+			t.Errorf("named instance has %d coordinates", len(inst.Coords))
+		}
+	}
+
+	axisCount := func(tag ot.Tag, off func([]byte) int) {
+		data, err := subFont.TableData(tag)
+		if err != nil {
+			t.Fatalf("Subset has no %s table: %v", tag, err)
+		}
+		if n := binary.BigEndian.Uint16(data[off(data):]); n != 1 {
+			t.Errorf("%s axisCount = %d, want 1", tag, n)
+		}
+	}
+	axisCount(ot.TagAvar, func([]byte) int { return 6 })
+	axisCount(ot.TagGvar, func([]byte) int { return 4 })
+	axisCount(ot.TagHvar, func(d []byte) int {
+		store := int(binary.BigEndian.Uint32(d[4:]))
+		return store + int(binary.BigEndian.Uint32(d[store+2:]))
+	})
+
+	// At the pinned width, the subset matches the original
+	for weight := float32(300); weight <= 700; weight += 100 {
+		origShaper, _ := ot.NewShaper(font)
+		origShaper.SetVariation(ot.TagAxisWeight, weight)
+		origShaper.SetVariation(ot.TagAxisWidth, 90)
+		origBuf := ot.NewBuffer()
+		origBuf.AddString("Hello AVATAR")
+		origShaper.Shape(origBuf, nil)
+
+		subShaper, _ := ot.NewShaper(subFont)
+		subShaper.SetVariation(ot.TagAxisWeight, weight)
+		subBuf := ot.NewBuffer()
+		subBuf.AddString("Hello AVATAR")
+		subShaper.Shape(subBuf, nil)
+
+		for i := range origBuf.Pos {
+			if d := subBuf.Pos[i].XAdvance - origBuf.Pos[i].XAdvance; d < -2 || d > 2 {
+				t.Errorf("wght=%.0f glyph %d: advance=%d, original=%d", weight, i, subBuf.Pos[i].XAdvance, origBuf.Pos[i].XAdvance)
+			}
+		}
+	}
+}
+
+// TestInstancingComposites tests that component offsets and bounding boxes
+// of composite glyphs follow the instance.
+func TestInstancingComposites(t *testing.T) {
+	fontPath := findTestFont("Roboto-Variable.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	instance := func(weight float32) (*ot.Glyf, ot.GlyphID) {
+		input := NewInput()
+		input.AddString("Ä")
+		input.Flags = FlagNoLayoutClosure
+		input.PinAxisLocation(ot.TagAxisWeight, weight)
+		plan, err := CreatePlan(font, input)
+		if err != nil {
+			t.Fatalf("Failed to create plan: %v", err)
+		}
+		result, err := plan.Execute()
+		if err != nil {
+			t.Fatalf("Failed to execute plan: %v", err)
+		}
+		subFont, err := ot.ParseFont(result, 0)
+		if err != nil {
+			t.Fatalf("Failed to parse subset font: %v", err)
+		}
+		glyf, err := ot.ParseGlyfFromFont(subFont)
+		if err != nil {
+			t.Fatalf("Failed to parse glyf: %v", err)
+		}
+		gid := plan.unicodeMap['Ä']
+		return glyf, gid
+	}
+
+	defGlyf, defGID := instance(400)
+	boldGlyf, boldGID := instance(900)
+
+	defComps := ot.ParseCompositeGlyph(defGlyf.GetGlyphBytes(defGID))
+	boldComps := ot.ParseCompositeGlyph(boldGlyf.GetGlyphBytes(boldGID))
+	if len(boldComps) != 2 || len(defComps) != 2 {
+		t.Fatalf("expected Ä to be a composite of 2 components, got %d", len(boldComps))
+	}
+	if boldComps[1].Arg1 == defComps[1].Arg1 {
+		t.Errorf("dieresis offset not instanced: %d at both weights", boldComps[1].Arg1)
+	}
+
+	// The bounding box must be the union of the instanced components.
+	ext, _ := boldGlyf.GetGlyphExtents(boldGID)
+	base, _ := boldGlyf.GetGlyphExtents(boldComps[0].GlyphID)
+	mark, _ := boldGlyf.GetGlyphExtents(boldComps[1].GlyphID)
+	wantXMin := min(int(base.XBearing), int(mark.XBearing+int32(boldComps[1].Arg1)))
+	wantYMax := int(mark.YBearing + int32(boldComps[1].Arg2))
+	if int(ext.XBearing) != wantXMin || int(ext.YBearing) != wantYMax {
+		t.Errorf("bounds xMin=%d yMax=%d, want xMin=%d yMax=%d", ext.XBearing, ext.YBearing, wantXMin, wantYMax)
+	}
+}
+
+// TestInstancingPhantomAdvances tests that advances derived from gvar
+// phantom points match HVAR.
+func TestInstancingPhantomAdvances(t *testing.T) {
+	fontPath := findTestFont("Roboto-Variable.ttf")
+	if fontPath == "" {
+		t.Skip("Roboto-Variable.ttf not found")
+	}
+
+	data, err := os.ReadFile(fontPath)
+	if err != nil {
+		t.Fatalf("Failed to read font: %v", err)
+	}
+
+	font, err := ot.ParseFont(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse font: %v", err)
+	}
+
+	for _, weight := range []float32{100, 700, 900} {
+		input := NewInput()
+		input.AddString("Hello Äé")
+		input.PinAxisLocation(ot.TagAxisWeight, weight)
+		plan, err := CreatePlan(font, input)
+		if err != nil {
+			t.Fatalf("Failed to create plan: %v", err)
+		}
+		withHVAR := plan.instancedAdvances
+
+		// Recompute without HVAR
+		plan.hvar = nil
+		plan.instancedGlyphs = nil
+		plan.computeInstancedAdvances()
+
+		for gid, adv := range withHVAR {
+			if got := plan.GetInstancedAdvance(gid); got != adv {
+				t.Errorf("wght=%.0f glyph %d: phantom advance=%d, HVAR advance=%d", weight, gid, got, adv)
+			}
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package subset
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/boxesandglue/textshape/ot"
+)
+
+// This file implements subsetting of variation tables for fonts that stay
+// variable (no axes pinned). gvar, HVAR and VVAR are indexed by glyph ID and
+// are rebuilt for the new glyph order. fvar, avar, STAT, MVAR and cvar do not
+// reference glyphs and are copied unchanged, unless axis ranges are limited
+// (see instancer.go).
+// HarfBuzz equivalent: hb-ot-var-gvar-table.hh, hb-ot-var-hvar-table.hh
+
+// noVariationIndex marks a glyph without variation data in a DeltaSetIndexMap.
+const noVariationIndex = 0xFFFFFFFF
+
+// subsetGvar rebuilds the gvar table for the new glyph order.
+func (p *Plan) subsetGvar() ([]byte, error) {
+	if p.gvar == nil || !p.gvar.HasData() {
+		return nil, nil
+	}
+
+	// Rebased variation data of a partially instanced font only uses
+	// embedded peak tuples, without the pinned axes.
+	sharedTuples := p.gvar.SharedTuplesData()
+	axisCount := p.gvar.AxisCount()
+	if p.IsPartiallyInstanced() {
+		sharedTuples = nil
+		axisCount = len(keptAxes(p.tupleLimits()))
+	}
+
+	glyphData := make([][]byte, p.numOutputGlyphs)
+	totalSize := 0
+	longOffsets := false
+	for newGID := 0; newGID < p.numOutputGlyphs; newGID++ {
+		oldGID, ok := p.reverseMap[ot.GlyphID(newGID)]
+		if !ok {
+			continue
+		}
+		var data []byte
+		if p.IsPartiallyInstanced() {
+			data = p.instanceGlyph(oldGID).variations
+		} else {
+			data = p.gvar.GetGlyphVariationData(oldGID)
+		}
+		glyphData[newGID] = data
+		totalSize += len(data)
+		if len(data)%2 != 0 {
+			longOffsets = true
+		}
+	}
+	if totalSize > 0x1FFFE {
+		longOffsets = true
+	}
+
+	// Header: version(2) + reserved(2) + axisCount(2) + sharedTupleCount(2) +
+	//         sharedTuplesOffset(4) + glyphCount(2) + flags(2) +
+	//         glyphVariationDataArrayOffset(4) + offsets[glyphCount+1]
+	offsetSize := 2
+	if longOffsets {
+		offsetSize = 4
+	}
+	sharedTuplesOff := 20 + (p.numOutputGlyphs+1)*offsetSize
+	dataArrayOff := sharedTuplesOff + len(sharedTuples)
+
+	data := make([]byte, dataArrayOff+totalSize)
+	binary.BigEndian.PutUint16(data[0:], 1)
+	binary.BigEndian.PutUint16(data[2:], 0)
+	binary.BigEndian.PutUint16(data[4:], uint16(axisCount))
+	binary.BigEndian.PutUint16(data[6:], uint16(len(sharedTuples)/(2*max(axisCount, 1))))
+	binary.BigEndian.PutUint32(data[8:], uint32(sharedTuplesOff))
+	binary.BigEndian.PutUint16(data[12:], uint16(p.numOutputGlyphs))
+	if longOffsets {
+		binary.BigEndian.PutUint16(data[14:], 1)
+	}
+	binary.BigEndian.PutUint32(data[16:], uint32(dataArrayOff))
+	copy(data[sharedTuplesOff:], sharedTuples)
+
+	writeOffset := func(i int, off int) {
+		if longOffsets {
+			binary.BigEndian.PutUint32(data[20+i*4:], uint32(off))
+		} else {
+			binary.BigEndian.PutUint16(data[20+i*2:], uint16(off/2))
+		}
+	}
+
+	off := 0
+	for newGID, gd := range glyphData {
+		writeOffset(newGID, off)
+		copy(data[dataArrayOff+off:], gd)
+		off += len(gd)
+	}
+	writeOffset(p.numOutputGlyphs, off)
+
+	return data, nil
+}
+
+// subsetMetricsVar subsets an HVAR or VVAR table. numMaps is the number of
+// DeltaSetIndexMap offsets following the ItemVariationStore offset (3 for
+// HVAR, 4 for VVAR). The first map is the advance map, which is implicit
+// (glyph ID = inner index) if absent.
+func (p *Plan) subsetMetricsVar(tag ot.Tag, numMaps int) ([]byte, error) {
+	src, err := p.source.TableData(tag)
+	if err != nil {
+		return nil, nil
+	}
+	headerSize := 8 + numMaps*4
+	if len(src) < headerSize {
+		return nil, nil
+	}
+
+	varStoreOff := binary.BigEndian.Uint32(src[4:])
+	if varStoreOff == 0 || int(varStoreOff) >= len(src) {
+		return nil, nil
+	}
+	store, err := parseItemVariationStore(src[varStoreOff:])
+	if err != nil {
+		return nil, nil
+	}
+
+	// Collect the variation indices of every retained glyph, per map.
+	maps := make([][]uint32, numMaps)
+	used := make(map[uint32]bool)
+	for i := 0; i < numMaps; i++ {
+		mapOff := binary.BigEndian.Uint32(src[8+i*4:])
+		var entries []uint32
+		if mapOff != 0 && int(mapOff) < len(src) {
+			if entries, err = readDeltaSetIndexMap(src[mapOff:]); err != nil {
+				return nil, nil
+			}
+		} else if i != 0 {
+			continue
+		}
+
+		mapped := make([]uint32, p.numOutputGlyphs)
+		for newGID := range mapped {
+			oldGID, ok := p.reverseMap[ot.GlyphID(newGID)]
+			switch {
+			case !ok:
+				mapped[newGID] = noVariationIndex
+			case len(entries) == 0:
+				mapped[newGID] = uint32(oldGID) // Implicit mapping
+			case int(oldGID) < len(entries):
+				mapped[newGID] = entries[oldGID]
+			default:
+				mapped[newGID] = entries[len(entries)-1]
+			}
+			used[mapped[newGID]] = true
+		}
+		maps[i] = mapped
+	}
+
+	newStore, varIdxMap := store.subset(used)
+	if p.IsPartiallyInstanced() {
+		// Advances at the new default come from computeInstancedAdvances
+		newStore, _ = newStore.limit(p.tupleLimits())
+	}
+	for _, m := range maps {
+		for i, idx := range m {
+			if newIdx, ok := varIdxMap[idx]; ok {
+				m[i] = newIdx
+			} else {
+				m[i] = noVariationIndex
+			}
+		}
+	}
+
+	// Drop the advance map again if the implicit mapping still holds.
+	if maps[0] != nil && isImplicitMapping(maps[0]) {
+		origAdvOff := binary.BigEndian.Uint32(src[8:])
+		if origAdvOff == 0 {
+			maps[0] = nil
+		}
+	}
+
+	storeData := newStore.build()
+	out := make([]byte, headerSize, headerSize+len(storeData))
+	copy(out[0:4], src[0:4]) // Version
+	binary.BigEndian.PutUint32(out[4:], uint32(headerSize))
+	out = append(out, storeData...)
+
+	for i, m := range maps {
+		if m == nil {
+			continue
+		}
+		binary.BigEndian.PutUint32(out[8+i*4:], uint32(len(out)))
+		out = append(out, buildDeltaSetIndexMap(m)...)
+	}
+
+	return out, nil
+}
+
+// isImplicitMapping returns true if every glyph maps to outer 0 and an inner
+// index equal to its glyph ID.
+func isImplicitMapping(entries []uint32) bool {
+	for i, idx := range entries {
+		if idx != uint32(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// itemVariationStore is a parsed ItemVariationStore with row-level access.
+type itemVariationStore struct {
+	regionList []byte
+	data       []*itemVariationData
+}
+
+// itemVariationData is one ItemVariationData subtable.
+type itemVariationData struct {
+	wordDeltaCount uint16
+	regionIndexes  []uint16
+	rows           [][]byte
+}
+
+// parseItemVariationStore parses an ItemVariationStore for subsetting.
+func parseItemVariationStore(data []byte) (*itemVariationStore, error) {
+	if len(data) < 8 {
+		return nil, ErrInvalidTable
+	}
+	if binary.BigEndian.Uint16(data[0:]) != 1 {
+		return nil, ErrInvalidTable
+	}
+
+	regionListOff := int(binary.BigEndian.Uint32(data[2:]))
+	dataCount := int(binary.BigEndian.Uint16(data[6:]))
+	if len(data) < 8+dataCount*4 || regionListOff+4 > len(data) {
+		return nil, ErrInvalidTable
+	}
+
+	// VariationRegionList: axisCount(2) + regionCount(2) + regions[](axisCount*6)
+	axisCount := int(binary.BigEndian.Uint16(data[regionListOff:]))
+	regionCount := int(binary.BigEndian.Uint16(data[regionListOff+2:]))
+	regionListEnd := regionListOff + 4 + axisCount*regionCount*6
+	if regionListEnd > len(data) {
+		return nil, ErrInvalidTable
+	}
+
+	store := &itemVariationStore{regionList: data[regionListOff:regionListEnd]}
+
+	for i := 0; i < dataCount; i++ {
+		off := int(binary.BigEndian.Uint32(data[8+i*4:]))
+		if off == 0 || off+6 > len(data) {
+			store.data = append(store.data, &itemVariationData{})
+			continue
+		}
+		vd := data[off:]
+
+		// ItemVariationData: itemCount(2) + wordDeltaCount(2) + regionIndexCount(2) +
+		//                    regionIndexes[](2*n) + deltaSets[]
+		itemCount := int(binary.BigEndian.Uint16(vd[0:]))
+		wordDeltaCount := binary.BigEndian.Uint16(vd[2:])
+		regionIndexCount := int(binary.BigEndian.Uint16(vd[4:]))
+
+		rowSize := itemVariationRowSize(wordDeltaCount, regionIndexCount)
+		deltaStart := 6 + regionIndexCount*2
+		if len(vd) < deltaStart+itemCount*rowSize {
+			return nil, ErrInvalidTable
+		}
+
+		ivd := &itemVariationData{
+			wordDeltaCount: wordDeltaCount,
+			regionIndexes:  make([]uint16, regionIndexCount),
+			rows:           make([][]byte, itemCount),
+		}
+		for j := range ivd.regionIndexes {
+			ivd.regionIndexes[j] = binary.BigEndian.Uint16(vd[6+j*2:])
+		}
+		for j := range ivd.rows {
+			start := deltaStart + j*rowSize
+			ivd.rows[j] = vd[start : start+rowSize]
+		}
+		store.data = append(store.data, ivd)
+	}
+
+	return store, nil
+}
+
+// itemVariationRowSize returns the size of a delta set row.
+func itemVariationRowSize(wordDeltaCount uint16, regionIndexCount int) int {
+	wordCount := int(wordDeltaCount & 0x7FFF)
+	if wordDeltaCount&0x8000 != 0 {
+		return wordCount*4 + (regionIndexCount-wordCount)*2
+	}
+	return wordCount*2 + (regionIndexCount - wordCount)
+}
+
+// subset keeps only the delta sets referenced by used (outer<<16 | inner)
+// and returns the new store together with the old->new index mapping.
+// Relative order of rows and subtables is preserved; empty subtables are
+// dropped. noVariationIndex is always mapped to itself.
+func (s *itemVariationStore) subset(used map[uint32]bool) (*itemVariationStore, map[uint32]uint32) {
+	indices := make([]uint32, 0, len(used))
+	for idx := range used {
+		if idx != noVariationIndex && int(idx>>16) < len(s.data) && int(idx&0xFFFF) < len(s.data[idx>>16].rows) {
+			indices = append(indices, idx)
+		}
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+	out := &itemVariationStore{regionList: s.regionList}
+	varIdxMap := map[uint32]uint32{noVariationIndex: noVariationIndex}
+
+	var cur *itemVariationData
+	curOuter := -1
+	for _, idx := range indices {
+		outer := int(idx >> 16)
+		if outer != curOuter {
+			src := s.data[outer]
+			cur = &itemVariationData{wordDeltaCount: src.wordDeltaCount, regionIndexes: src.regionIndexes}
+			out.data = append(out.data, cur)
+			curOuter = outer
+		}
+		varIdxMap[idx] = uint32(len(out.data)-1)<<16 | uint32(len(cur.rows))
+		cur.rows = append(cur.rows, s.data[outer].rows[idx&0xFFFF])
+	}
+
+	return out, varIdxMap
+}
+
+// build serializes the ItemVariationStore.
+func (s *itemVariationStore) build() []byte {
+	// Header: format(2) + regionListOffset(4) + dataCount(2) + dataOffsets[](4*n)
+	headerSize := 8 + len(s.data)*4
+
+	data := make([]byte, headerSize, headerSize+len(s.regionList))
+	binary.BigEndian.PutUint16(data[0:], 1)
+	binary.BigEndian.PutUint32(data[2:], uint32(headerSize))
+	binary.BigEndian.PutUint16(data[6:], uint16(len(s.data)))
+	data = append(data, s.regionList...)
+
+	for i, ivd := range s.data {
+		binary.BigEndian.PutUint32(data[8+i*4:], uint32(len(data)))
+
+		sub := make([]byte, 6+len(ivd.regionIndexes)*2)
+		binary.BigEndian.PutUint16(sub[0:], uint16(len(ivd.rows)))
+		binary.BigEndian.PutUint16(sub[2:], ivd.wordDeltaCount)
+		binary.BigEndian.PutUint16(sub[4:], uint16(len(ivd.regionIndexes)))
+		for j, r := range ivd.regionIndexes {
+			binary.BigEndian.PutUint16(sub[6+j*2:], r)
+		}
+		for _, row := range ivd.rows {
+			sub = append(sub, row...)
+		}
+		data = append(data, sub...)
+	}
+
+	return data
+}
+
+// readDeltaSetIndexMap reads all entries of a DeltaSetIndexMap as
+// outer<<16 | inner values.
+func readDeltaSetIndexMap(data []byte) ([]uint32, error) {
+	if len(data) < 4 {
+		return nil, ErrInvalidTable
+	}
+
+	var mapCount, headerSize int
+	switch data[0] {
+	case 0:
+		mapCount = int(binary.BigEndian.Uint16(data[2:]))
+		headerSize = 4
+	case 1:
+		if len(data) < 6 {
+			return nil, ErrInvalidTable
+		}
+		mapCount = int(binary.BigEndian.Uint32(data[2:]))
+		headerSize = 6
+	default:
+		return nil, ErrInvalidTable
+	}
+
+	entryFormat := data[1]
+	innerBitCount := uint(entryFormat&0x0F) + 1
+	width := int((entryFormat>>4)&0x03) + 1
+	if len(data) < headerSize+mapCount*width {
+		return nil, ErrInvalidTable
+	}
+
+	entries := make([]uint32, mapCount)
+	for i := range entries {
+		var u uint32
+		for _, b := range data[headerSize+i*width : headerSize+(i+1)*width] {
+			u = u<<8 | uint32(b)
+		}
+		entries[i] = (u>>innerBitCount)<<16 | u&(1<<innerBitCount-1)
+	}
+	return entries, nil
+}
+
+// buildDeltaSetIndexMap serializes a DeltaSetIndexMap with the smallest
+// entry format that can hold all entries.
+func buildDeltaSetIndexMap(entries []uint32) []byte {
+	var maxOuter, maxInner uint32
+	for _, idx := range entries {
+		maxOuter = max(maxOuter, idx>>16)
+		maxInner = max(maxInner, idx&0xFFFF)
+	}
+
+	innerBitCount := uint(1)
+	for maxInner>>innerBitCount != 0 {
+		innerBitCount++
+	}
+	outerBitCount := uint(0)
+	for maxOuter>>outerBitCount != 0 {
+		outerBitCount++
+	}
+	width := int((innerBitCount + outerBitCount + 7) / 8)
+
+	// Format 0: format(1) + entryFormat(1) + mapCount(2); format 1 uses a 32-bit count.
+	format, headerSize := byte(0), 4
+	if len(entries) > 0xFFFF {
+		format, headerSize = 1, 6
+	}
+
+	data := make([]byte, headerSize+len(entries)*width)
+	data[0] = format
+	data[1] = byte(width-1)<<4 | byte(innerBitCount-1)
+	if format == 0 {
+		binary.BigEndian.PutUint16(data[2:], uint16(len(entries)))
+	} else {
+		binary.BigEndian.PutUint32(data[2:], uint32(len(entries)))
+	}
+
+	for i, idx := range entries {
+		u := (idx>>16)<<innerBitCount | idx&0xFFFF
+		off := headerSize + i*width
+		for j := width - 1; j >= 0; j-- {
+			data[off+j] = byte(u)
+			u >>= 8
+		}
+	}
+	return data
+}
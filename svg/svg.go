@@ -0,0 +1,284 @@
+// Package svg renders shaped text as standalone SVG documents, like
+// hb-view --output-format=svg.
+package svg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/boxesandglue/textshape/ot"
+)
+
+// Defaults of Options, as in hb-view.
+const (
+	DefaultFontSize   = 256
+	DefaultMargin     = 16
+	DefaultForeground = "#000000"
+	DefaultBackground = "#ffffff"
+)
+
+// Annotation colors
+const (
+	clusterColor  = "#e53935"
+	glyphBoxColor = "#1e88e5"
+)
+
+// Options controls the SVG output. The zero value selects the defaults.
+type Options struct {
+	// FontSize is the em size in SVG user units (px).
+	FontSize float64
+
+	// Margin is the space around the text in SVG user units. A negative
+	// margin selects none.
+	Margin float64
+
+	// Foreground and Background are CSS colors. A Background of "none"
+	// leaves the background transparent.
+	Foreground string
+	Background string
+
+	// AnnotateClusters outlines every cluster and labels it with its
+	// cluster value.
+	AnnotateClusters bool
+
+	// GlyphBoxes outlines the ink extents of every glyph and marks its
+	// origin, which shows where mark and cursive attachment put a glyph.
+	GlyphBoxes bool
+}
+
+// layout maps the scaled units of a shaper (y up, run starting at 0, 0) to
+// SVG user units (y down).
+type layout struct {
+	xFactor, yFactor float64 // user units per scaled unit
+	xMin, yMax       float64 // top-left corner of the text box in scaled units
+	margin           float64
+}
+
+func (l *layout) x(v float64) float64 { return l.margin + (v-l.xMin)*l.xFactor }
+func (l *layout) y(v float64) float64 { return l.margin + (l.yMax-v)*l.yFactor }
+
+// Render writes buf, shaped with shaper, as an SVG document to w. Glyph
+// outlines become <symbol> elements drawn with <use> at the positions of
+// the buffer. Horizontal runs sit on a line of the font's ascender and
+// descender; vertical runs in a column one em wide. Nil opts selects the
+// defaults.
+// HarfBuzz equivalent: hb-view with --output-format=svg
+func Render(w io.Writer, shaper *ot.Shaper, buf *ot.Buffer, opts *Options) error {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.FontSize <= 0 {
+		o.FontSize = DefaultFontSize
+	}
+	switch {
+	case o.Margin == 0:
+		o.Margin = DefaultMargin
+	case o.Margin < 0:
+		o.Margin = 0
+	}
+	if o.Foreground == "" {
+		o.Foreground = DefaultForeground
+	}
+	if o.Background == "" {
+		o.Background = DefaultBackground
+	}
+
+	face := shaper.Face()
+	xScale, yScale := shaper.Scale()
+	upem := float64(face.Upem())
+	vertical := buf.Direction.IsVertical()
+
+	// Pen positions in scaled units
+	n := len(buf.Info)
+	penX := make([]float64, n+1)
+	penY := make([]float64, n+1)
+	for i, pos := range buf.Pos[:n] {
+		penX[i+1] = penX[i] + float64(pos.XAdvance)
+		penY[i+1] = penY[i] + float64(pos.YAdvance)
+	}
+
+	// The text box: the line extents across the run
+	var xMin, xMax, yMin, yMax float64
+	if vertical {
+		width := float64(xScale)
+		xMin, xMax = -width/2, width/2
+		yMin, yMax = math.Min(0, penY[n]), math.Max(0, penY[n])
+	} else {
+		xMin, xMax = math.Min(0, penX[n]), math.Max(0, penX[n])
+		yMax = float64(face.Ascender()) * float64(yScale) / upem
+		yMin = float64(face.Descender()) * float64(yScale) / upem
+	}
+	l := &layout{
+		xFactor: o.FontSize / float64(xScale),
+		yFactor: o.FontSize / float64(yScale),
+		xMin:    xMin,
+		yMax:    yMax,
+		margin:  o.Margin,
+	}
+	width := (xMax-xMin)*l.xFactor + 2*o.Margin
+	height := (yMax-yMin)*l.yFactor + 2*o.Margin
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%s" height="%s" viewBox="0 0 %s %s">`+"\n",
+		num(width), num(height), num(width), num(height))
+	if o.Background != "none" {
+		fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", escape(o.Background))
+	}
+
+	// Glyph outlines, once per glyph
+	fmt.Fprintf(bw, "<defs>\n")
+	defined := make(map[ot.GlyphID]bool)
+	for _, info := range buf.Info {
+		if _, ok := defined[info.GlyphID]; ok {
+			continue
+		}
+		path, err := shaper.GlyphOutline(info.GlyphID)
+		if err != nil {
+			return err
+		}
+		defined[info.GlyphID] = len(path) > 0
+		if len(path) > 0 {
+			fmt.Fprintf(bw, `<symbol id="g%d" overflow="visible"><path d="%s"/></symbol>`+"\n", info.GlyphID, pathData(path))
+		}
+	}
+	fmt.Fprintf(bw, "</defs>\n")
+
+	if o.AnnotateClusters {
+		writeClusters(bw, buf, l, penX, penY, xMin, xMax, yMin, yMax, vertical)
+	}
+
+	fmt.Fprintf(bw, `<g fill="%s">`+"\n", escape(o.Foreground))
+	for i, info := range buf.Info {
+		if !defined[info.GlyphID] {
+			continue
+		}
+		x := l.x(penX[i] + float64(buf.Pos[i].XOffset))
+		y := l.y(penY[i] + float64(buf.Pos[i].YOffset))
+		fmt.Fprintf(bw, `<use xlink:href="#g%d" transform="matrix(%s 0 0 %s %s %s)"/>`+"\n",
+			info.GlyphID, num(l.xFactor), num(-l.yFactor), num(x), num(y))
+	}
+	fmt.Fprintf(bw, "</g>\n")
+
+	if o.GlyphBoxes {
+		writeGlyphBoxes(bw, shaper, buf, l, penX, penY)
+	}
+
+	fmt.Fprintf(bw, "</svg>\n")
+	return bw.Flush()
+}
+
+// writeClusters outlines the clusters of buf across the text box and
+// labels them with their cluster values. Glyphs of a cluster are adjacent
+// after shaping.
+func writeClusters(w io.Writer, buf *ot.Buffer, l *layout, penX, penY []float64, xMin, xMax, yMin, yMax float64, vertical bool) {
+	fmt.Fprintf(w, `<g fill="none" stroke="%s" stroke-width="1" stroke-dasharray="4 2">`+"\n", clusterColor)
+	var labels strings.Builder
+	n := len(buf.Info)
+	for start := 0; start < n; {
+		end := start + 1
+		for end < n && buf.Info[end].Cluster == buf.Info[start].Cluster {
+			end++
+		}
+		var x0, y0, x1, y1 float64
+		if vertical {
+			x0, x1 = xMin, xMax
+			y0, y1 = math.Max(penY[start], penY[end]), math.Min(penY[start], penY[end])
+		} else {
+			x0, x1 = math.Min(penX[start], penX[end]), math.Max(penX[start], penX[end])
+			y0, y1 = yMax, yMin
+		}
+		fmt.Fprintf(w, `<rect x="%s" y="%s" width="%s" height="%s"/>`+"\n",
+			num(l.x(x0)), num(l.y(y0)), num((x1-x0)*l.xFactor), num((y0-y1)*l.yFactor))
+
+		// Labels go below the line or to the right of the column
+		lx, ly := l.x((x0+x1)/2), l.y(y1)+l.margin*0.75
+		anchor := "middle"
+		if vertical {
+			lx, ly = l.x(x1)+2, l.y((y0+y1)/2)
+			anchor = "start"
+		}
+		fmt.Fprintf(&labels, `<text x="%s" y="%s" text-anchor="%s">%d</text>`+"\n",
+			num(lx), num(ly), anchor, buf.Info[start].Cluster)
+		start = end
+	}
+	fmt.Fprintf(w, "</g>\n")
+	fmt.Fprintf(w, `<g fill="%s" font-family="sans-serif" font-size="%s">`+"\n", clusterColor, num(math.Max(8, l.margin*0.6)))
+	io.WriteString(w, labels.String())
+	fmt.Fprintf(w, "</g>\n")
+}
+
+// writeGlyphBoxes outlines the ink extents of the glyphs of buf and marks
+// their origins with a cross.
+func writeGlyphBoxes(w io.Writer, shaper *ot.Shaper, buf *ot.Buffer, l *layout, penX, penY []float64) {
+	fmt.Fprintf(w, `<g fill="none" stroke="%s" stroke-width="1">`+"\n", glyphBoxColor)
+	for i, info := range buf.Info {
+		ox := penX[i] + float64(buf.Pos[i].XOffset)
+		oy := penY[i] + float64(buf.Pos[i].YOffset)
+		if ext, ok := shaper.GlyphExtents(info.GlyphID); ok {
+			// YBearing is the top, Height is negative
+			x := ox + float64(ext.XBearing)
+			y := oy + float64(ext.YBearing)
+			fmt.Fprintf(w, `<rect x="%s" y="%s" width="%s" height="%s"/>`+"\n",
+				num(l.x(x)), num(l.y(y)), num(float64(ext.Width)*l.xFactor), num(-float64(ext.Height)*l.yFactor))
+		}
+		x, y := l.x(ox), l.y(oy)
+		fmt.Fprintf(w, `<path d="M%s %sh6M%s %sv6"/>`+"\n", num(x-3), num(y), num(x), num(y-3))
+	}
+	fmt.Fprintf(w, "</g>\n")
+}
+
+// pathData returns the SVG path data of a glyph outline.
+func pathData(p ot.Path) string {
+	var sb strings.Builder
+	for _, seg := range p {
+		a := seg.Args
+		switch seg.Op {
+		case ot.PathMoveTo:
+			sb.WriteString("M")
+			writeNums(&sb, a[:2])
+		case ot.PathLineTo:
+			sb.WriteString("L")
+			writeNums(&sb, a[:2])
+		case ot.PathQuadTo:
+			sb.WriteString("Q")
+			writeNums(&sb, a[:4])
+		case ot.PathCubeTo:
+			sb.WriteString("C")
+			writeNums(&sb, a[:6])
+		case ot.PathClose:
+			sb.WriteString("Z")
+		}
+	}
+	return sb.String()
+}
+
+func writeNums(sb *strings.Builder, v []float32) {
+	for i, f := range v {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(num(float64(f)))
+	}
+}
+
+// num formats a coordinate with at most two decimals.
+func num(v float64) string {
+	v = math.Round(v*100) / 100
+	if v == 0 {
+		v = 0 // no "-0"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+var attrEscaper = strings.NewReplacer(`&`, "&amp;", `<`, "&lt;", `>`, "&gt;", `"`, "&quot;")
+
+// escape escapes s for an attribute value.
+func escape(s string) string {
+	return attrEscaper.Replace(s)
+}
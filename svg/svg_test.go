@@ -0,0 +1,216 @@
+package svg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/boxesandglue/textshape/internal/shapertest"
+	"github.com/boxesandglue/textshape/ot"
+)
+
+// element is a start element of a parsed SVG document.
+type element struct {
+	name  string
+	attrs map[string]string
+}
+
+// render renders text and returns the elements of the well-formed output.
+func render(t *testing.T, shaper *ot.Shaper, buf *ot.Buffer, opts *Options) []element {
+	t.Helper()
+	var out bytes.Buffer
+	if err := Render(&out, shaper, buf, opts); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	var elements []element
+	dec := xml.NewDecoder(&out)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG: %v", err)
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			e := element{name: se.Name.Local, attrs: make(map[string]string)}
+			for _, a := range se.Attr {
+				e.attrs[a.Name.Local] = a.Value
+			}
+			elements = append(elements, e)
+		}
+	}
+	return elements
+}
+
+func shape(shaper *ot.Shaper, text string, dir ot.Direction) *ot.Buffer {
+	buf := ot.NewBuffer()
+	buf.AddString(text)
+	buf.GuessSegmentProperties()
+	if dir != 0 {
+		buf.Direction = dir
+	}
+	shaper.Shape(buf, nil)
+	return buf
+}
+
+// useOrigins returns the glyph and origin of every <use> element.
+func useOrigins(t *testing.T, elements []element) (glyphs []string, xs, ys []float64) {
+	t.Helper()
+	for _, e := range elements {
+		if e.name != "use" {
+			continue
+		}
+		glyphs = append(glyphs, e.attrs["href"])
+		m := strings.Fields(strings.TrimSuffix(strings.TrimPrefix(e.attrs["transform"], "matrix("), ")"))
+		if len(m) != 6 {
+			t.Fatalf("transform %q", e.attrs["transform"])
+		}
+		x, _ := strconv.ParseFloat(m[4], 64)
+		y, _ := strconv.ParseFloat(m[5], 64)
+		xs = append(xs, x)
+		ys = append(ys, y)
+	}
+	return glyphs, xs, ys
+}
+
+func TestRender(t *testing.T) {
+	shaper := shapertest.Load(t, "Roboto-Regular.ttf")
+	buf := shape(shaper, "To fly", 0)
+	elements := render(t, shaper, buf, &Options{FontSize: 100, Margin: 10})
+
+	root := elements[0]
+	if root.name != "svg" {
+		t.Fatalf("root element %q", root.name)
+	}
+	width, _ := strconv.ParseFloat(root.attrs["width"], 64)
+	height, _ := strconv.ParseFloat(root.attrs["height"], 64)
+	upem, _ := shaper.Scale()
+	var advance int32
+	for _, pos := range buf.Pos {
+		advance += pos.XAdvance
+	}
+	if want := float64(advance)*100/float64(upem) + 20; width < want-0.01 || width > want+0.01 {
+		t.Errorf("width %v, want %v", width, want)
+	}
+	if height <= 100 {
+		t.Errorf("height %v should exceed the font size", height)
+	}
+
+	// One symbol per distinct glyph with an outline, one use per drawn
+	// glyph; the space has no outline
+	symbols := 0
+	for _, e := range elements {
+		if e.name == "symbol" {
+			symbols++
+		}
+	}
+	glyphs, xs, ys := useOrigins(t, elements)
+	if len(glyphs) != len(buf.Info)-1 {
+		t.Errorf("%d uses for %d glyphs", len(glyphs), len(buf.Info))
+	}
+	if symbols != len(glyphs) {
+		t.Errorf("%d symbols for %d distinct glyphs", symbols, len(glyphs))
+	}
+	if xs[0] != 10 {
+		t.Errorf("first glyph at x=%v, want the margin", xs[0])
+	}
+	for i := 1; i < len(xs); i++ {
+		if xs[i] <= xs[i-1] || ys[i] != ys[0] {
+			t.Errorf("glyph %d at (%v, %v) after (%v, %v)", i, xs[i], ys[i], xs[i-1], ys[i-1])
+		}
+	}
+
+	// Each scale maps to the font size on its own axis
+	shaper.SetScale(2*upem, upem/2)
+	defer shaper.SetScale(0, 0)
+	scaled := render(t, shaper, shape(shaper, "To fly", 0), &Options{FontSize: 100, Margin: 10})
+	for _, attr := range []string{"width", "height"} {
+		if scaled[0].attrs[attr] != root.attrs[attr] {
+			t.Errorf("scaled %s %s, want %s", attr, scaled[0].attrs[attr], root.attrs[attr])
+		}
+	}
+	_, scaledXs, scaledYs := useOrigins(t, scaled)
+	for i := range xs {
+		if math.Abs(scaledXs[i]-xs[i]) > 0.05 || math.Abs(scaledYs[i]-ys[i]) > 0.05 {
+			t.Errorf("scaled glyph %d at (%v, %v), want (%v, %v)", i, scaledXs[i], scaledYs[i], xs[i], ys[i])
+		}
+	}
+}
+
+func TestRenderOptions(t *testing.T) {
+	shaper := shapertest.Load(t, "Roboto-Regular.ttf")
+	buf := shape(shaper, "fi é", 0)
+	elements := render(t, shaper, buf, &Options{
+		Foreground:       `rgb(1,2,3)"`,
+		Background:       "none",
+		AnnotateClusters: true,
+		GlyphBoxes:       true,
+	})
+
+	rects, labels := 0, 0
+	fills := map[string]bool{}
+	for _, e := range elements {
+		switch e.name {
+		case "rect":
+			rects++
+		case "text":
+			labels++
+		case "g":
+			fills[e.attrs["fill"]] = true
+		}
+	}
+	clusters := 0
+	for i := range buf.Info {
+		if i == 0 || buf.Info[i].Cluster != buf.Info[i-1].Cluster {
+			clusters++
+		}
+	}
+	// No background; cluster boxes and boxes of the inked glyphs
+	if labels != clusters || rects != clusters+len(buf.Info)-1 {
+		t.Errorf("%d rects and %d labels for %d clusters of %d glyphs", rects, labels, clusters, len(buf.Info))
+	}
+	if !fills[`rgb(1,2,3)"`] {
+		t.Errorf("foreground not escaped correctly: %v", fills)
+	}
+}
+
+func TestRenderRTLAndVertical(t *testing.T) {
+	shaper := shapertest.Load(t, "Roboto-Regular.ttf")
+
+	// Right-to-left buffers are in visual order after shaping
+	ltr := shape(shaper, "abc", ot.DirectionLTR)
+	rtl := shape(shaper, "abc", ot.DirectionRTL)
+	ltrGlyphs, _, _ := useOrigins(t, render(t, shaper, ltr, nil))
+	rtlGlyphs, xs, _ := useOrigins(t, render(t, shaper, rtl, nil))
+	for i := range ltrGlyphs {
+		if rtlGlyphs[i] != ltrGlyphs[len(ltrGlyphs)-1-i] {
+			t.Errorf("RTL glyphs %v, want the reverse of %v", rtlGlyphs, ltrGlyphs)
+			break
+		}
+	}
+	for i := 1; i < len(xs); i++ {
+		if xs[i] <= xs[i-1] {
+			t.Errorf("RTL glyph %d at x=%v after %v", i, xs[i], xs[i-1])
+		}
+	}
+
+	// Vertical runs go down a column
+	ttb := shape(shaper, "abc", ot.DirectionTTB)
+	elements := render(t, shaper, ttb, nil)
+	width, _ := strconv.ParseFloat(elements[0].attrs["width"], 64)
+	height, _ := strconv.ParseFloat(elements[0].attrs["height"], 64)
+	if width != DefaultFontSize+2*DefaultMargin || height <= width {
+		t.Errorf("vertical size %v×%v", width, height)
+	}
+	_, _, ys := useOrigins(t, elements)
+	for i := 1; i < len(ys); i++ {
+		if ys[i] <= ys[i-1] {
+			t.Errorf("vertical glyph %d at y=%v after %v", i, ys[i], ys[i-1])
+		}
+	}
+}